@@ -1,6 +1,8 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
@@ -65,14 +67,22 @@ func main() {
 	}
 }
 
+// ข้อมูลตัวอย่างอยู่ในไฟล์ fixtures/todos.json (ฝังเข้าไปในโปรแกรมตอน build)
+//
+//go:embed fixtures/todos.json
+var sampleTodos []byte
+
 // ฟังก์ชันสำหรับเตรียมข้อมูลตัวอย่าง
 func initSampleData() {
-	todos = []Todo{
-		{ID: 1, Title: "เรียน Go Programming", Done: false},
-		{ID: 2, Title: "ทำโปรเจกต์ Todo API", Done: true},
-		{ID: 3, Title: "ทบทวน Fiber Framework", Done: false},
+	if err := json.Unmarshal(sampleTodos, &todos); err != nil {
+		log.Fatalf("โหลดข้อมูลตัวอย่างไม่สำเร็จ: %v", err)
+	}
+	// ID ถัดไปที่จะใช้ ต่อจาก ID ที่มากที่สุดในข้อมูลตัวอย่าง
+	for _, todo := range todos {
+		if todo.ID >= nextID {
+			nextID = todo.ID + 1
+		}
 	}
-	nextID = 4 // ID ถัดไปที่จะใช้
 }
 
 // GET /todos - คืนรายการ todo ทั้งหมด
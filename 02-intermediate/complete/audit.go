@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ============ Audit Log ============
+
+// AuditEntry หนึ่ง document ใน collection audit_log (เพิ่มได้อย่างเดียว ไม่มีโค้ดแก้หรือลบ)
+type AuditEntry struct {
+	ID         primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	EntityType string                 `json:"entity_type" bson:"entity_type"`
+	EntityID   string                 `json:"entity_id" bson:"entity_id"`
+	Action     string                 `json:"action" bson:"action"` // create, update, delete
+	Actor      string                 `json:"actor" bson:"actor"`
+	RequestID  string                 `json:"request_id" bson:"request_id"`
+	IP         string                 `json:"ip" bson:"ip"`
+	Before     *Todo                  `json:"before" bson:"before"`
+	After      *Todo                  `json:"after" bson:"after"`
+	Changes    map[string]FieldChange `json:"changes" bson:"changes"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+}
+
+// FieldChange ค่าก่อนและหลังของ field ที่เปลี่ยน
+type FieldChange struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+var auditCollection *mongo.Collection
+
+// supportsTransactions เป็น true เมื่อ MongoDB เป็น replica set (standalone ใช้ transaction ไม่ได้)
+var supportsTransactions bool
+
+// initAudit เตรียม collection audit_log และตรวจว่าใช้ transaction ได้หรือไม่
+func initAudit(ctx context.Context, db *mongo.Database) {
+	auditCollection = db.Collection("audit_log")
+	_, err := auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ สร้าง index ของ audit_log ไม่สำเร็จ: %v", err)
+	}
+
+	var hello bson.M
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err == nil {
+		_, isReplicaSet := hello["setName"]
+		supportsTransactions = isReplicaSet || hello["msg"] == "isdbgrid"
+	}
+	if !supportsTransactions {
+		log.Println("⚠️ MongoDB ไม่ใช่ replica set: audit log จะถูกเขียนแยกจากการเปลี่ยนแปลง (ไม่อยู่ใน transaction เดียวกัน)")
+	}
+}
+
+// withTransaction รัน fn ใน transaction เดียว การเปลี่ยนแปลงกับ audit จึงสำเร็จหรือล้มเหลวพร้อมกัน
+// fn ต้องใช้ ctx ที่ได้รับ (ผูกกับ session) ในทุกคำสั่ง และอาจถูกเรียกซ้ำเมื่อ transaction ชนกัน
+func withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !supportsTransactions {
+		return fn(ctx)
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// AuditInfo ผู้ทำรายการของ request นี้ (actor มาจาก Locals ที่ APIKeyMiddleware ตั้งไว้)
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+func auditInfoFrom(c *fiber.Ctx) AuditInfo {
+	actor, _ := c.Locals("actor").(string)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	requestID, _ := c.Locals("requestid").(string)
+	return AuditInfo{Actor: actor, RequestID: requestID, IP: c.IP()}
+}
+
+// apiKeyActor ระบุตัวผู้ใช้จาก API Key โดยไม่เก็บ key จริงลง log
+func apiKeyActor(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "apikey:" + hex.EncodeToString(sum[:4])
+}
+
+// recordAudit เพิ่ม audit entry ของ todo หนึ่งรายการ (before = nil ตอนสร้าง, after = nil ตอนลบ)
+func recordAudit(ctx context.Context, info AuditInfo, action string, id primitive.ObjectID, before, after *Todo) error {
+	changes, err := diffTodos(before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = auditCollection.InsertOne(ctx, AuditEntry{
+		EntityType: "todo",
+		EntityID:   id.Hex(),
+		Action:     action,
+		Actor:      info.Actor,
+		RequestID:  info.RequestID,
+		IP:         info.IP,
+		Before:     before,
+		After:      after,
+		Changes:    changes,
+		CreatedAt:  time.Now(),
+	})
+	return err
+}
+
+// diffTodos เทียบทีละ field ตามชื่อใน JSON
+func diffTodos(before, after *Todo) (map[string]FieldChange, error) {
+	b, err := todoFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := todoFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+	for field, old := range b {
+		if value, ok := a[field]; !ok || !bytes.Equal(old, value) {
+			changes[field] = FieldChange{Before: decodeJSON(old), After: decodeJSON(a[field])}
+		}
+	}
+	for field, value := range a {
+		if _, ok := b[field]; !ok {
+			changes[field] = FieldChange{After: decodeJSON(value)}
+		}
+	}
+	return changes, nil
+}
+
+func todoFields(todo *Todo) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if todo == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+func decodeJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
+
+// GET /audit - ดูประวัติการเปลี่ยนแปลง (กรองด้วย entity_type, entity_id, actor, from, to)
+func getAuditLog(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{}
+	for _, field := range []string{"entity_type", "entity_id", "actor"} {
+		if v := c.Query(field); v != "" {
+			filter[field] = v
+		}
+	}
+
+	createdAt := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lt"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"success": false,
+					"error":   "รูปแบบวันที่ของ " + param + " ไม่ถูกต้อง (ใช้ RFC3339 หรือ YYYY-MM-DD)",
+				})
+			}
+		}
+		createdAt[op] = t
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64((page - 1) * limit)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := auditCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"success": false,
+			"error":   "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []AuditEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"success": false,
+			"error":   "ไม่สามารถอ่านข้อมูลได้",
+		})
+	}
+
+	total, err := auditCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		total = 0
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    entries,
+		"pagination": fiber.Map{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
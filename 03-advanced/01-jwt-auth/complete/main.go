@@ -1,6 +1,8 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
 	"log"
 	"strings"
 	"time"
@@ -88,27 +90,38 @@ func main() {
 	log.Fatal(app.Listen(":3000"))
 }
 
+// ข้อมูลตัวอย่างอยู่ใน fixtures/sample.json (password เป็น plain text เฉพาะในไฟล์ตัวอย่าง hash ตอนโหลด)
+//
+//go:embed fixtures/sample.json
+var sampleData []byte
+
 // setupSampleData เตรียมข้อมูลตัวอย่าง
 func setupSampleData() {
-	// สร้าง user ตัวอย่าง
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
-	users = append(users, User{
-		ID:       1,
-		Email:    "demo@example.com",
-		Password: string(hashedPassword),
-		Name:     "นาย Demo",
-	})
-
-	// สร้าง todos ตัวอย่าง
-	todos = append(todos, Todo{
-		ID:     1,
-		Title:  "เรียน JWT Authentication",
-		Done:   false,
-		UserID: 1,
-	})
+	var fixtures struct {
+		Users []struct {
+			User
+			Password string `json:"password"`
+		} `json:"users"`
+		Todos []Todo `json:"todos"`
+	}
+	if err := json.Unmarshal(sampleData, &fixtures); err != nil {
+		log.Fatalf("❌ โหลดข้อมูลตัวอย่างไม่สำเร็จ: %v", err)
+	}
 
-	userID = 2
-	todoID = 2
+	for _, fixture := range fixtures.Users {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(fixture.Password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Fatalf("❌ hash password ของ %s ไม่สำเร็จ: %v", fixture.Email, err)
+		}
+		user := fixture.User
+		user.Password = string(hashedPassword)
+		users = append(users, user)
+		userID = max(userID, user.ID+1)
+	}
+	for _, todo := range fixtures.Todos {
+		todos = append(todos, todo)
+		todoID = max(todoID, todo.ID+1)
+	}
 }
 
 // registerHandler จัดการการสมัครสมาชิก
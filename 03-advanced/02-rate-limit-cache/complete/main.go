@@ -2,6 +2,9 @@ package main
 
 import (
 	"log"
+	"math"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -88,6 +91,7 @@ func (r *RateLimiter) GetRemainingRequests(ip string) int {
 // Cache จัดการ cache ใน memory
 type Cache struct {
 	data  map[string]CacheItem
+	tags  map[string]map[string]struct{} // tag -> keys ที่ผูกกับ tag นั้น
 	mutex sync.RWMutex
 }
 
@@ -95,12 +99,14 @@ type Cache struct {
 type CacheItem struct {
 	Value     interface{}
 	ExpiresAt time.Time
+	Tags      []string // tags ที่ entry นี้ขึ้นอยู่ด้วย เช่น "todos:list", "todo:1"
 }
 
 // NewCache สร้าง Cache ใหม่
 func NewCache() *Cache {
 	cache := &Cache{
 		data: make(map[string]CacheItem),
+		tags: make(map[string]map[string]struct{}),
 	}
 
 	// เริ่ม cleanup goroutine
@@ -127,13 +133,68 @@ func (c *Cache) Get(key string) interface{} {
 
 // Set เก็บข้อมูลลง cache
 func (c *Cache) Set(key string, value interface{}, duration time.Duration) {
+	c.SetWithTags(key, value, duration)
+}
+
+// SetWithTags เก็บข้อมูลลง cache พร้อมผูก tags ไว้สำหรับ invalidate ภายหลัง
+func (c *Cache) SetWithTags(key string, value interface{}, duration time.Duration, tags ...string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	// ถ้า key นี้เคยมีอยู่ ให้ถอด tags เดิมออกก่อน
+	c.deleteLocked(key)
+
 	c.data[key] = CacheItem{
 		Value:     value,
 		ExpiresAt: time.Now().Add(duration),
+		Tags:      tags,
+	}
+	for _, tag := range tags {
+		keys, exists := c.tags[tag]
+		if !exists {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Delete ลบ key เดียวออกจาก cache
+func (c *Cache) Delete(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.deleteLocked(key)
+}
+
+// InvalidateTags ลบทุก entry ที่ผูกกับ tag ใด tag หนึ่ง และส่งจำนวน keys ที่ถูกลบ
+func (c *Cache) InvalidateTags(tags ...string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if c.deleteLocked(key) {
+				removed++
+			}
+		}
+		delete(c.tags, tag)
 	}
+	return removed
+}
+
+// DeleteByPrefix ลบทุก key ที่ขึ้นต้นด้วย prefix และส่งจำนวน keys ที่ถูกลบ
+func (c *Cache) DeleteByPrefix(prefix string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for key := range c.data {
+		if strings.HasPrefix(key, prefix) && c.deleteLocked(key) {
+			removed++
+		}
+	}
+	return removed
 }
 
 // Clear ล้าง cache ทั้งหมด
@@ -141,6 +202,25 @@ func (c *Cache) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.data = make(map[string]CacheItem)
+	c.tags = make(map[string]map[string]struct{})
+}
+
+// deleteLocked ลบ key และถอดออกจาก tag index (ต้องถือ lock อยู่แล้ว)
+func (c *Cache) deleteLocked(key string) bool {
+	item, exists := c.data[key]
+	if !exists {
+		return false
+	}
+
+	delete(c.data, key)
+	for _, tag := range item.Tags {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	return true
 }
 
 // cleanup ลบข้อมูลที่หมดอายุ
@@ -151,22 +231,125 @@ func (c *Cache) cleanup() {
 		now := time.Now()
 		for key, item := range c.data {
 			if now.After(item.ExpiresAt) {
-				delete(c.data, key)
+				c.deleteLocked(key)
 			}
 		}
 		c.mutex.Unlock()
 	}
 }
 
+// ConcurrencyLimiter จำกัดจำนวน requests ที่กำลังทำงานพร้อมกัน (in-flight)
+// และปรับ limit ตาม latency ที่วัดได้แบบ AIMD (Additive Increase, Multiplicative Decrease)
+type ConcurrencyLimiter struct {
+	name          string
+	limit         float64       // limit ปัจจุบัน (เป็น float เพื่อให้เพิ่มทีละเศษส่วนได้)
+	minLimit      float64       // limit ต่ำสุด ไม่ลดต่ำกว่านี้
+	maxLimit      float64       // limit สูงสุด
+	targetLatency time.Duration // ถ้า latency เกินค่านี้ถือว่า server เริ่มรับไม่ไหว
+	backoff       float64       // ตัวคูณตอนลด limit เช่น 0.9
+	inFlight      int
+	shed          int
+	lastDecrease  time.Time        // ครั้งล่าสุดที่ลด limit
+	now           func() time.Time // แทนที่ได้ใน tests
+	mutex         sync.Mutex
+}
+
+// LimiterState สถานะของ ConcurrencyLimiter สำหรับแสดงใน stats
+type LimiterState struct {
+	Name            string  `json:"name"`
+	Limit           int     `json:"limit"`
+	InFlight        int     `json:"in_flight"`
+	Shed            int     `json:"shed"`
+	TargetLatencyMs float64 `json:"target_latency_ms"`
+}
+
+// NewConcurrencyLimiter สร้าง ConcurrencyLimiter ใหม่
+func NewConcurrencyLimiter(name string, initial, min, max int, targetLatency time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		name:          name,
+		limit:         float64(initial),
+		minLimit:      float64(min),
+		maxLimit:      float64(max),
+		targetLatency: targetLatency,
+		backoff:       0.9,
+		now:           time.Now,
+	}
+}
+
+// Acquire จองที่สำหรับ request ใหม่ ถ้าเต็มแล้วส่ง false (ต้อง shed request นี้)
+func (l *ConcurrencyLimiter) Acquire() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		l.shed++
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release คืนที่หลัง request จบ แล้วปรับ limit ตาม latency และผลลัพธ์
+func (l *ConcurrencyLimiter) Release(latency time.Duration, failed bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	saturated := l.inFlight >= int(l.limit)
+	l.inFlight--
+
+	if failed || latency > l.targetLatency {
+		// Multiplicative decrease: ช้าหรือ error = ลด limit ลง แต่ไม่เกินครั้งละหนึ่งรอบ (RTT)
+		// requests ที่เริ่มก่อนการลดครั้งล่าสุดเห็นภาระเดียวกันกับที่ทำให้ลดไปแล้ว
+		// ถ้าลดซ้ำทุกตัวที่ช้า limit จะดิ่งลง min ทันทีจาก spike ครั้งเดียว
+		now := l.now()
+		if now.Add(-latency).Before(l.lastDecrease) {
+			return
+		}
+		l.limit = math.Max(l.minLimit, l.limit*l.backoff)
+		l.lastDecrease = now
+		return
+	}
+
+	// Additive increase: เพิ่มเฉพาะตอนที่ใช้ limit เต็มจริง ๆ
+	// (+1/limit ต่อ request ≈ +1 ต่อรอบที่ใช้ครบ limit)
+	if saturated {
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	}
+}
+
+// State ส่งสถานะปัจจุบันของ limiter
+func (l *ConcurrencyLimiter) State() LimiterState {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return LimiterState{
+		Name:            l.name,
+		Limit:           int(l.limit),
+		InFlight:        l.inFlight,
+		Shed:            l.shed,
+		TargetLatencyMs: float64(l.targetLatency.Microseconds()) / 1000,
+	}
+}
+
 // Stats เก็บสถิติการใช้งาน
 type Stats struct {
 	TotalRequests int `json:"total_requests"`
 	CacheHits     int `json:"cache_hits"`
 	CacheMisses   int `json:"cache_misses"`
 	RateLimited   int `json:"rate_limited"`
+	LoadShed      int `json:"load_shed"`
 	mutex         sync.RWMutex
 }
 
+// StatsSnapshot สถิติ ณ เวลาหนึ่ง (ไม่มี mutex จึง copy และแปลงเป็น JSON ได้)
+type StatsSnapshot struct {
+	TotalRequests int            `json:"total_requests"`
+	CacheHits     int            `json:"cache_hits"`
+	CacheMisses   int            `json:"cache_misses"`
+	RateLimited   int            `json:"rate_limited"`
+	LoadShed      int            `json:"load_shed"`
+	Concurrency   []LimiterState `json:"concurrency"`
+}
+
 // IncrementTotal เพิ่มจำนวน total requests
 func (s *Stats) IncrementTotal() {
 	s.mutex.Lock()
@@ -195,16 +378,29 @@ func (s *Stats) IncrementRateLimited() {
 	s.RateLimited++
 }
 
-// GetStats ส่งสถิติปัจจุบัน
-func (s *Stats) GetStats() Stats {
+// IncrementLoadShed เพิ่มจำนวน requests ที่ถูก shed เพราะ server รับไม่ไหว
+func (s *Stats) IncrementLoadShed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.LoadShed++
+}
+
+// GetStats ส่งสถิติปัจจุบัน รวมสถานะของ concurrency limiters ทุกกลุ่ม
+func (s *Stats) GetStats() StatsSnapshot {
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return Stats{
+	snapshot := StatsSnapshot{
 		TotalRequests: s.TotalRequests,
 		CacheHits:     s.CacheHits,
 		CacheMisses:   s.CacheMisses,
 		RateLimited:   s.RateLimited,
+		LoadShed:      s.LoadShed,
+	}
+	s.mutex.RUnlock()
+
+	for _, group := range concurrencyGroups {
+		snapshot.Concurrency = append(snapshot.Concurrency, group.limiter.State())
 	}
+	return snapshot
 }
 
 // ข้อมูลตัวอย่าง
@@ -222,15 +418,47 @@ var todos = []Todo{
 	{ID: 5, Title: "ทดสอบ Rate Limit", Done: false},
 }
 
+var todosMutex sync.RWMutex
+
+// Cache tags ที่ handlers ใช้ประกาศว่า response ขึ้นอยู่กับข้อมูลอะไร
+const (
+	TagTodoList   = "todos:list"
+	TodoTagPrefix = "todo:"
+)
+
+// todoTag สร้าง tag ของ todo แต่ละตัว เช่น "todo:1"
+func todoTag(id int) string {
+	return TodoTagPrefix + strconv.Itoa(id)
+}
+
+// concurrencyGroup ผูก path prefix เข้ากับ limiter ของกลุ่มนั้น
+type concurrencyGroup struct {
+	prefix  string
+	limiter *ConcurrencyLimiter
+}
+
 // Global instances
 var rateLimiter = NewRateLimiter(10, 1*time.Minute) // 10 requests ต่อนาที
 var cache = NewCache()
 var stats = &Stats{}
 
+// แต่ละกลุ่มมี limit ของตัวเอง เรียงจาก prefix ที่เจาะจงที่สุดไปหาทั่วไป
+var concurrencyGroups = []concurrencyGroup{
+	{prefix: "/todos", limiter: NewConcurrencyLimiter("todos", 20, 2, 200, 250*time.Millisecond)},
+	{prefix: "/", limiter: NewConcurrencyLimiter("default", 50, 5, 500, 100*time.Millisecond)},
+}
+
+// priorityPaths ไม่ถูก shed เลย เพื่อให้ health check และ monitoring ยังเห็น server ตอน overload
+var priorityPaths = map[string]bool{
+	"/health": true,
+	"/stats":  true,
+}
+
 func main() {
 	app := fiber.New()
 
 	app.Use(logger.New())
+	app.Use(loadShedMiddleware())
 
 	// Basic endpoint
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -238,8 +466,9 @@ func main() {
 			"message": "Rate Limiting & Cache API - Complete Version",
 			"status":  "ok",
 			"config": fiber.Map{
-				"rate_limit": "10 requests/minute",
-				"cache_ttl":  "30 seconds",
+				"rate_limit":    "10 requests/minute",
+				"cache_ttl":     "30 seconds",
+				"load_shedding": "adaptive concurrency limit per route group (AIMD)",
 			},
 		})
 	})
@@ -250,8 +479,11 @@ func main() {
 
 	// Endpoints
 	app.Get("/todos", getTodosHandler)
+	app.Patch("/todos/:id/toggle", toggleTodoHandler)
+	app.Get("/health", healthHandler)
 	app.Get("/stats", getStatsHandler)
 	app.Get("/cache/clear", clearCacheHandler)
+	app.Post("/cache/invalidate", invalidateCacheHandler)
 
 	log.Println("🚀 Server started on port 3000")
 	log.Println("📊 Try: curl http://localhost:3000/todos")
@@ -259,6 +491,55 @@ func main() {
 	log.Fatal(app.Listen(":3000"))
 }
 
+// loadShedMiddleware จำกัด in-flight requests ต่อกลุ่ม route และตอบ 503 เมื่อเกินความสามารถ
+// ต่างจาก rate limit ตรงที่ดูภาระรวมของ server ไม่ใช่ของ client คนเดียว
+func loadShedMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if priorityPaths[c.Path()] {
+			return c.Next()
+		}
+
+		limiter := limiterFor(c.Path())
+		if !limiter.Acquire() {
+			stats.IncrementLoadShed()
+
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":       "Server is overloaded. Try again later.",
+				"retry_after": "1s",
+				"group":       limiter.name,
+			})
+		}
+
+		// defer เพื่อคืนที่แม้ handler จะ panic (นับเป็น failure)
+		start := time.Now()
+		failed := true
+		defer func() { limiter.Release(time.Since(start), failed) }()
+
+		err := c.Next()
+		failed = err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError
+		return err
+	}
+}
+
+// limiterFor หา limiter ของกลุ่มที่ path นี้อยู่
+// prefix ต้องตรงทั้ง segment: "/todos" ครอบ "/todos" และ "/todos/1" แต่ไม่ครอบ "/todosx"
+func limiterFor(path string) *ConcurrencyLimiter {
+	for _, group := range concurrencyGroups {
+		if matchesPrefix(path, group.prefix) {
+			return group.limiter
+		}
+	}
+	return concurrencyGroups[len(concurrencyGroups)-1].limiter
+}
+
+func matchesPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
 // rateLimitMiddleware ตรวจสอบ rate limit
 func rateLimitMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -293,6 +574,11 @@ func rateLimitMiddleware() fiber.Handler {
 // cacheMiddleware ตรวจสอบและจัดการ cache
 func cacheMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		// cache เฉพาะ GET เท่านั้น ส่วน request ที่แก้ข้อมูลต้องถึง handler เสมอ
+		if c.Method() != fiber.MethodGet {
+			return c.Next()
+		}
+
 		// สร้าง cache key จาก path และ query
 		cacheKey := c.Route().Path + c.OriginalURL()
 
@@ -322,22 +608,76 @@ func getTodosHandler(c *fiber.Ctx) error {
 	// จำลองการประมวลผลที่ใช้เวลา (เหมือน database query)
 	time.Sleep(100 * time.Millisecond)
 
+	todosMutex.RLock()
+	data := make([]Todo, len(todos))
+	copy(data, todos)
+	todosMutex.RUnlock()
+
 	response := fiber.Map{
 		"success":   true,
-		"data":      todos,
-		"count":     len(todos),
+		"data":      data,
+		"count":     len(data),
 		"cached":    false,
 		"timestamp": time.Now().Format("15:04:05"),
 	}
 
-	// เก็บลง cache สำหรับครั้งต่อไป
+	// เก็บลง cache สำหรับครั้งต่อไป โดยประกาศว่า response นี้ขึ้นอยู่กับ list และ todo ทุกตัวในนั้น
 	if cacheKey := c.Locals("cache_key"); cacheKey != nil {
-		cache.Set(cacheKey.(string), response, 30*time.Second)
+		tags := []string{TagTodoList}
+		for _, todo := range data {
+			tags = append(tags, todoTag(todo.ID))
+		}
+		cache.SetWithTags(cacheKey.(string), response, 30*time.Second, tags...)
 	}
 
 	return c.JSON(response)
 }
 
+// toggleTodoHandler สลับสถานะ done ของ todo แล้ว invalidate cache ที่ขึ้นอยู่กับ todo นั้น
+func toggleTodoHandler(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid todo ID",
+		})
+	}
+
+	todosMutex.Lock()
+	var updated *Todo
+	for i := range todos {
+		if todos[i].ID == id {
+			todos[i].Done = !todos[i].Done
+			updated = &Todo{ID: todos[i].ID, Title: todos[i].Title, Done: todos[i].Done}
+			break
+		}
+	}
+	todosMutex.Unlock()
+
+	if updated == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Todo not found",
+		})
+	}
+
+	// ไม่ต้องรู้ว่า cache key ไหนมี todo นี้อยู่ แค่บอก tag ที่เปลี่ยน
+	removed := cache.InvalidateTags(todoTag(id))
+
+	return c.JSON(fiber.Map{
+		"success":          true,
+		"data":             updated,
+		"invalidated_keys": removed,
+		"invalidated_tags": []string{todoTag(id)},
+	})
+}
+
+// healthHandler ใช้สำหรับ health check (อยู่ใน priorityPaths จึงไม่ถูก shed)
+func healthHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":    "ok",
+		"timestamp": time.Now().Format("15:04:05"),
+	})
+}
+
 // getStatsHandler ส่งสถิติการใช้งาน
 func getStatsHandler(c *fiber.Ctx) error {
 	currentStats := stats.GetStats()
@@ -373,3 +713,37 @@ func clearCacheHandler(c *fiber.Ctx) error {
 		"timestamp": time.Now().Format("15:04:05"),
 	})
 }
+
+// invalidateCacheHandler ล้าง cache ตาม tags และ/หรือ key prefix
+func invalidateCacheHandler(c *fiber.Ctx) error {
+	var req struct {
+		Tags   []string `json:"tags"`
+		Prefix string   `json:"prefix"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if len(req.Tags) == 0 && req.Prefix == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "tags or prefix is required",
+		})
+	}
+
+	removed := 0
+	if len(req.Tags) > 0 {
+		removed += cache.InvalidateTags(req.Tags...)
+	}
+	if req.Prefix != "" {
+		removed += cache.DeleteByPrefix(req.Prefix)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":          true,
+		"invalidated_keys": removed,
+		"tags":             req.Tags,
+		"prefix":           req.Prefix,
+		"timestamp":        time.Now().Format("15:04:05"),
+	})
+}
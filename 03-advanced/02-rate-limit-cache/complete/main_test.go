@@ -0,0 +1,184 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheInvalidateTags(t *testing.T) {
+	cache := NewCache()
+	cache.SetWithTags("todos:page=1", "page 1", time.Minute, TagTodoList, todoTag(1), todoTag(2))
+	cache.SetWithTags("todos:page=2", "page 2", time.Minute, TagTodoList, todoTag(3))
+	cache.SetWithTags("todo:1", "todo 1", time.Minute, todoTag(1))
+	cache.Set("stats", "untagged", time.Minute)
+
+	for _, step := range []struct {
+		name    string
+		tags    []string
+		removed int
+		left    []string
+	}{
+		{"todo in one page", []string{todoTag(3)}, 1, []string{"todos:page=1", "todo:1", "stats"}},
+		{"todo in page and detail", []string{todoTag(1)}, 2, []string{"stats"}},
+		{"already invalidated", []string{todoTag(1), todoTag(2)}, 0, []string{"stats"}},
+		{"unknown tag", []string{"missing"}, 0, []string{"stats"}},
+	} {
+		if removed := cache.InvalidateTags(step.tags...); removed != step.removed {
+			t.Errorf("%s: removed = %d, want %d", step.name, removed, step.removed)
+		}
+		if got := len(cache.data); got != len(step.left) {
+			t.Errorf("%s: %d keys left, want %v", step.name, got, step.left)
+		}
+		for _, key := range step.left {
+			if cache.Get(key) == nil {
+				t.Errorf("%s: %s was removed", step.name, key)
+			}
+		}
+	}
+	if len(cache.tags) != 0 {
+		t.Errorf("tag index not cleaned up: %v", cache.tags)
+	}
+}
+
+func TestCacheSetReplacesTags(t *testing.T) {
+	cache := NewCache()
+	cache.SetWithTags("todos:page=1", "old", time.Minute, todoTag(1))
+	cache.SetWithTags("todos:page=1", "new", time.Minute, todoTag(2))
+
+	if removed := cache.InvalidateTags(todoTag(1)); removed != 0 {
+		t.Errorf("old tag still invalidates the key (removed %d)", removed)
+	}
+	if removed := cache.InvalidateTags(todoTag(2)); removed != 1 {
+		t.Errorf("new tag removed %d keys, want 1", removed)
+	}
+}
+
+func TestCacheDeleteByPrefix(t *testing.T) {
+	cache := NewCache()
+	cache.SetWithTags("todos:page=1", "a", time.Minute, TagTodoList)
+	cache.SetWithTags("todos:page=2", "b", time.Minute, TagTodoList)
+	cache.Set("stats", "c", time.Minute)
+
+	if removed := cache.DeleteByPrefix("todos:"); removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if cache.Get("stats") == nil {
+		t.Error("key outside prefix was removed")
+	}
+	if _, ok := cache.tags[TagTodoList]; ok {
+		t.Error("tag still indexes deleted keys")
+	}
+}
+
+// fakeClock ให้ tests กำหนดเวลาของ limiter เอง
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter(initial int) (*ConcurrencyLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := NewConcurrencyLimiter("test", initial, 2, 20, 100*time.Millisecond)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	l, _ := newTestLimiter(3)
+	for i, want := range []bool{true, true, true, false, false} {
+		if got := l.Acquire(); got != want {
+			t.Errorf("acquire %d = %v, want %v", i+1, got, want)
+		}
+	}
+	if state := l.State(); state.InFlight != 3 || state.Shed != 2 {
+		t.Errorf("state = %+v, want in_flight 3, shed 2", state)
+	}
+}
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		inFlight int // requests ที่ถืออยู่ก่อน Release
+		latency  time.Duration
+		failed   bool
+		want     float64
+	}{
+		{"fast and saturated grows by 1/limit", 10, 10 * time.Millisecond, false, 10.1},
+		{"fast but not saturated stays", 5, 10 * time.Millisecond, false, 10},
+		{"slow shrinks by backoff", 5, 200 * time.Millisecond, false, 9},
+		{"failure shrinks by backoff", 5, 10 * time.Millisecond, true, 9},
+	} {
+		l, _ := newTestLimiter(10)
+		for i := 0; i < tc.inFlight; i++ {
+			l.Acquire()
+		}
+		l.Release(tc.latency, tc.failed)
+		if diff := l.limit - tc.want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s: limit = %v, want %v", tc.name, l.limit, tc.want)
+		}
+	}
+}
+
+func TestConcurrencyLimiterDecreasesOncePerRTT(t *testing.T) {
+	l, clock := newTestLimiter(10)
+	for i := 0; i < 10; i++ {
+		l.Acquire()
+	}
+
+	// 10 requests ที่เริ่มพร้อมกันช้าหมด = ลดครั้งเดียว
+	for i := 0; i < 10; i++ {
+		clock.t = clock.t.Add(time.Millisecond)
+		l.Release(200*time.Millisecond, false)
+	}
+	if l.limit != 9 {
+		t.Fatalf("limit after one slow burst = %v, want 9", l.limit)
+	}
+
+	// request ที่เริ่มหลังการลดครั้งก่อนและยังช้าอยู่ = ลดได้อีกรอบ
+	clock.t = clock.t.Add(time.Second)
+	l.Acquire()
+	l.Release(200*time.Millisecond, false)
+	if diff := l.limit - 8.1; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("limit after second round = %v, want 8.1", l.limit)
+	}
+}
+
+func TestConcurrencyLimiterBounds(t *testing.T) {
+	l, clock := newTestLimiter(3)
+	for i := 0; i < 20; i++ {
+		clock.t = clock.t.Add(time.Second)
+		l.Acquire()
+		l.Release(0, true)
+	}
+	if l.limit != 2 {
+		t.Errorf("limit = %v, want min 2", l.limit)
+	}
+
+	l, _ = newTestLimiter(19)
+	for i := 0; i < 1000; i++ {
+		for l.Acquire() {
+		}
+		l.Release(0, false)
+	}
+	if l.limit != 20 {
+		t.Errorf("limit = %v, want max 20", l.limit)
+	}
+}
+
+func TestLimiterFor(t *testing.T) {
+	todos, fallback := concurrencyGroups[0].limiter, concurrencyGroups[1].limiter
+	for _, tc := range []struct {
+		path string
+		want *ConcurrencyLimiter
+	}{
+		{"/todos", todos},
+		{"/todos/1/toggle", todos},
+		{"/todosx", fallback},
+		{"/todo", fallback},
+		{"/", fallback},
+		{"/cache/clear", fallback},
+	} {
+		if got := limiterFor(tc.path); got != tc.want {
+			t.Errorf("limiterFor(%q) = %s, want %s", tc.path, got.name, tc.want.name)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Audit Log ============
+
+// การกระทำที่บันทึกใน audit_log
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditEntry หนึ่งแถวใน audit_log: ใครเปลี่ยนอะไร จากอะไรเป็นอะไร เมื่อไร
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   string                 `json:"entity_id"`
+	Action     string                 `json:"action"`
+	Actor      string                 `json:"actor"`
+	RequestID  string                 `json:"request_id"`
+	IP         string                 `json:"ip"`
+	Before     json.RawMessage        `json:"before"` // null ตอน create
+	After      json.RawMessage        `json:"after"`  // null ตอน delete
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// FieldChange ค่าก่อนและหลังของ field ที่เปลี่ยน
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditInfo ข้อมูลของผู้ที่ทำการเปลี่ยนแปลง ส่งผ่าน context จาก middleware ไปถึง repositories
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+type auditInfoKey struct{}
+
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// auditInfoFrom อ่าน AuditInfo จาก ctx (งานเบื้องหลังที่ไม่มี request ถือว่าเป็น "system")
+func auditInfoFrom(ctx context.Context) AuditInfo {
+	if info, ok := ctx.Value(auditInfoKey{}).(AuditInfo); ok {
+		return info
+	}
+	return AuditInfo{Actor: "system"}
+}
+
+// recordAudit บันทึกการเปลี่ยนแปลงหนึ่งครั้งผ่าน q เดียวกับที่ใช้เปลี่ยนข้อมูล
+// ถ้า q เป็น *Tx audit จะ commit หรือ rollback พร้อมกับการเปลี่ยนแปลงเสมอ
+// before/after เป็น struct หรือ map ใดก็ได้ที่ encode เป็น JSON object ได้ (nil = ไม่มี)
+func recordAudit(ctx context.Context, q DBTX, entityType string, entityID interface{}, action string, before, after interface{}) error {
+	beforeJSON, err := marshalAuditState(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalAuditState(after)
+	if err != nil {
+		return err
+	}
+	changes, err := diffAuditStates(beforeJSON, afterJSON)
+	if err != nil {
+		return err
+	}
+	if action == AuditUpdate && len(changes) == 0 {
+		return nil // ไม่มีอะไรเปลี่ยนจริง
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	info := auditInfoFrom(ctx)
+	// ส่ง JSON เป็น string (lib/pq ส่ง []byte เป็น bytea ซึ่งใส่ column JSONB ไม่ได้)
+	_, err = q.ExecContext(ctx, `INSERT INTO audit_log
+		(entity_type, entity_id, action, actor, request_id, ip, before, after, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entityType, fmt.Sprint(entityID), action, info.Actor, info.RequestID, info.IP,
+		nullableJSON(beforeJSON), nullableJSON(afterJSON), string(changesJSON))
+	return err
+}
+
+func marshalAuditState(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+// diffAuditStates เทียบ JSON object สองชุดทีละ field (ไม่มี before = ทุก field เป็นค่าใหม่)
+func diffAuditStates(before, after []byte) (map[string]FieldChange, error) {
+	var b, a map[string]json.RawMessage
+	if before != nil {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make(map[string]FieldChange)
+	for field, old := range b {
+		if value, ok := a[field]; !ok || !bytes.Equal(compactJSON(old), compactJSON(value)) {
+			changes[field] = FieldChange{Before: decodeJSON(old), After: decodeJSON(a[field])}
+		}
+	}
+	for field, value := range a {
+		if _, ok := b[field]; !ok {
+			changes[field] = FieldChange{Before: nil, After: decodeJSON(value)}
+		}
+	}
+	return changes, nil
+}
+
+func compactJSON(data json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func decodeJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
+
+// Repository
+
+// AuditFilter เงื่อนไขการค้นหา audit log (ค่าว่าง / nil = ไม่กรอง)
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	Actor      string
+	From       *time.Time // created_at >= From
+	To         *time.Time // created_at < To
+	Cursor     int64      // keyset: เอาเฉพาะ id < Cursor (0 = หน้าแรก)
+	Limit      int
+}
+
+type auditRepository struct{}
+
+// List ค้นหา audit log เรียงจากใหม่ไปเก่า (audit_log มีแต่เพิ่ม ไม่มีแก้/ลบ จึงไม่มี UPDATE/DELETE ใน repository นี้)
+func (r *auditRepository) List(ctx context.Context, q DBTX, filter AuditFilter) ([]AuditEntry, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.EntityType != "" {
+		where = append(where, "entity_type = "+arg(filter.EntityType))
+	}
+	if filter.EntityID != "" {
+		where = append(where, "entity_id = "+arg(filter.EntityID))
+	}
+	if filter.Actor != "" {
+		where = append(where, "actor = "+arg(filter.Actor))
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < "+arg(*filter.To))
+	}
+	if filter.Cursor > 0 {
+		where = append(where, "id < "+arg(filter.Cursor))
+	}
+
+	query := `SELECT id, entity_type, entity_id, action, actor, request_id, ip, before, after, changes, created_at
+		FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + arg(filter.Limit)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after, changes []byte
+		if err := rows.Scan(&entry.ID, &entry.EntityType, &entry.EntityID, &entry.Action, &entry.Actor,
+			&entry.RequestID, &entry.IP, &before, &after, &changes, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Before, entry.After = before, after
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Middleware / Handlers
+
+// auditContext ใส่ AuditInfo ลงใน context ของ request
+// actor มาจาก Locals ที่ auth middleware ตั้งไว้ (identify หรือ "user_id" แบบ 01-jwt-auth) ไม่มี = "anonymous"
+// จึงต้อง register หลัง identify และหลัง requestid
+func auditContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor := "anonymous"
+		if v, ok := c.Locals("actor").(string); ok && v != "" {
+			actor = v
+		} else if userID := c.Locals("user_id"); userID != nil {
+			actor = fmt.Sprintf("user:%v", userID)
+		}
+
+		requestID, _ := c.Locals("requestid").(string)
+		if requestID == "" {
+			requestID = c.Get(fiber.HeaderXRequestID)
+		}
+
+		c.SetUserContext(WithAuditInfo(c.UserContext(), AuditInfo{
+			Actor:     actor,
+			RequestID: requestID,
+			IP:        c.IP(),
+		}))
+		return c.Next()
+	}
+}
+
+// parseAuditFilter อ่าน query string: entity_type, entity_id, actor, from, to, cursor, limit
+func parseAuditFilter(c *fiber.Ctx) (AuditFilter, error) {
+	filter := AuditFilter{
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+		Actor:      c.Query("actor"),
+	}
+	for _, p := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseDateParam(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q (use RFC3339 or YYYY-MM-DD)", p.name, v)
+		}
+		*p.target = &t
+	}
+
+	var err error
+	if filter.Cursor, err = strconv.ParseInt(c.Query("cursor", "0"), 10, 64); err != nil || filter.Cursor < 0 {
+		return filter, fmt.Errorf("invalid cursor %q", c.Query("cursor"))
+	}
+	if filter.Limit, err = strconv.Atoi(c.Query("limit", "0")); err != nil || filter.Limit < 0 {
+		return filter, fmt.Errorf("invalid limit %q", c.Query("limit"))
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	return filter, nil
+}
+
+func listAuditHandler(q DBTX, auditRepo *auditRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := parseAuditFilter(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// ขอเกินมา 1 แถวเพื่อรู้ว่ามีหน้าถัดไปหรือไม่
+		pageSize := filter.Limit
+		filter.Limit++
+		entries, err := auditRepo.List(c.UserContext(), q, filter)
+		if err != nil {
+			return err
+		}
+
+		response := fiber.Map{
+			"success":     true,
+			"data":        entries,
+			"count":       len(entries),
+			"next_cursor": nil,
+		}
+		if len(entries) > pageSize {
+			entries = entries[:pageSize]
+			response["data"] = entries
+			response["count"] = pageSize
+			response["next_cursor"] = entries[pageSize-1].ID
+		}
+		return c.JSON(response)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+func TestAuditRecordsProductChanges(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "user:7", RequestID: "req-1", IP: "10.0.0.1"})
+	txm := NewTxManager(f.db)
+
+	product := &Product{SKU: "CAM-001", Name: "Camera", Category: "test", Price: NewMoney(150000, "THB"), Stock: 5}
+	if err := txm.WithTx(ctx, nil, func(tx *Tx) error { return f.products.Create(ctx, tx, product) }); err != nil {
+		t.Fatal(err)
+	}
+	product.Name = "Camera Pro"
+	if err := txm.WithTx(ctx, nil, func(tx *Tx) error { return f.products.Update(ctx, tx, product) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := txm.WithTx(ctx, nil, func(tx *Tx) error { return f.products.Delete(ctx, tx, product.ID) }); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := (&auditRepository{}).List(ctx, f.db, AuditFilter{EntityType: "product", EntityID: "3", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries = %d, want 3", len(entries))
+	}
+	deleted, updated, created := entries[0], entries[1], entries[2]
+
+	if created.Action != AuditCreate || created.Before != nil || created.Changes["sku"].After != "CAM-001" {
+		t.Errorf("create entry = %+v", created)
+	}
+	if updated.Action != AuditUpdate || len(updated.Changes) != 1 {
+		t.Errorf("update changes = %v, want only name", updated.Changes)
+	}
+	if change := updated.Changes["name"]; change.Before != "Camera" || change.After != "Camera Pro" {
+		t.Errorf("name change = %+v", change)
+	}
+	if deleted.Action != AuditDelete || deleted.After != nil || deleted.Changes["name"].Before != "Camera Pro" {
+		t.Errorf("delete entry = %+v", deleted)
+	}
+	if created.Actor != "user:7" || created.RequestID != "req-1" || created.IP != "10.0.0.1" {
+		t.Errorf("audit info = %q %q %q", created.Actor, created.RequestID, created.IP)
+	}
+}
+
+func TestAuditRollsBackWithChange(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	err := NewTxManager(f.db).WithTx(ctx, nil, func(tx *Tx) error {
+		laptop := f.product(t, f.laptop.ID)
+		laptop.Name = "Renamed"
+		if err := f.products.Update(ctx, tx, laptop); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v, want errAbort", err)
+	}
+
+	entries, err := (&auditRepository{}).List(ctx, f.db, AuditFilter{EntityType: "product", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Action == AuditUpdate {
+			t.Errorf("audit entry survived rollback: %+v", entry)
+		}
+	}
+}
+
+func TestAuditOrderStatusAndFilters(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+
+	placed := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+	if _, err := f.service.UpdateStatus(WithAuditInfo(ctx, AuditInfo{Actor: "admin"}), placed.ID, OrderStatusPaid, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &auditRepository{}
+	entries, err := repo.List(ctx, f.db, AuditFilter{EntityType: "order", Actor: "admin", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("admin order entries = %d, want 1", len(entries))
+	}
+	if change := entries[0].Changes["status"]; change.Before != "pending" || change.After != "paid" {
+		t.Errorf("status change = %+v", change)
+	}
+
+	// order ที่สร้างโดยไม่มี request (เช่นงานเบื้องหลัง) ถือเป็น system
+	entries, err = repo.List(ctx, f.db, AuditFilter{EntityType: "order", Actor: "system", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != AuditCreate {
+		t.Errorf("system order entries = %+v, want one create", entries)
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	f.createProduct(t, "CAM-001", NewMoney(1500000, "THB"), 5) // มี audit อย่างน้อยหนึ่งแถว
+
+	if _, err := f.db.ExecContext(ctx, "UPDATE audit_log SET actor = $1", "someone-else"); err == nil {
+		t.Error("UPDATE audit_log succeeded, want error")
+	}
+	if _, err := f.db.ExecContext(ctx, "DELETE FROM audit_log"); err == nil {
+		t.Error("DELETE FROM audit_log succeeded, want error")
+	}
+}
+
+func TestAuditRecordsActorFromRequest(t *testing.T) {
+	f := newTestFixture(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	txm := NewTxManager(f.db)
+
+	app := fiber.New()
+	app.Use(requestid.New(), identify(), auditContext())
+	app.Post("/products", adminOnly(), createProductHandler(txm, f.products))
+	app.Post("/users", createUserHandler(txm, &userRepository{}))
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+		entity  string
+		actor   string
+	}{
+		{"admin token", "/products", `{"sku":"CAM-001","name":"Camera","category":"test","price":1500,"stock":5}`,
+			map[string]string{"X-Admin-Token": "secret"}, 201, "product", "admin"},
+		{"forwarded user", "/users", `{"email":"jane@example.com","name":"Jane"}`,
+			map[string]string{"X-User-ID": "42"}, 201, "user", "user:42"},
+		{"no identity", "/users", `{"email":"anon@example.com","name":"Anon"}`,
+			nil, 201, "user", "anonymous"},
+		{"invalid user id", "/users", `{"email":"bad@example.com","name":"Bad"}`,
+			map[string]string{"X-User-ID": "abc"}, 400, "", ""},
+		{"wrong admin token", "/products", `{"sku":"CAM-002","name":"Camera","category":"test","price":1500,"stock":5}`,
+			map[string]string{"X-Admin-Token": "guess"}, 401, "", ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.status)
+			continue
+		}
+		if tc.actor == "" {
+			continue
+		}
+
+		entries, err := (&auditRepository{}).List(context.Background(), f.db,
+			AuditFilter{EntityType: tc.entity, Actor: tc.actor, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].RequestID == "" {
+			t.Errorf("%s: entries by %s = %+v, want one with a request ID", tc.name, tc.actor, entries)
+		}
+	}
+}
+
+func TestAuditRecordsReservationsAndCoupons(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "user:7"})
+	f.createCoupon(t, Coupon{Code: "PCT10", Type: CouponPercentage, PercentOffBP: 1000})
+
+	placed, err := f.service.PlaceOrder(ctx, PlaceOrderRequest{UserID: f.userID, CouponCode: "PCT10",
+		Items: []PlaceOrderItemRequest{{ProductID: f.laptop.ID, Quantity: 1}, {ProductID: f.mouse.ID, Quantity: 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.UpdateStatus(ctx, placed.ID, OrderStatusCancelled, "changed my mind"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &auditRepository{}
+	for _, tc := range []struct {
+		entity  string
+		creates int
+		updates int
+		status  string // สถานะหลังการ update
+	}{
+		{"stock_reservation", 2, 2, ReservationReleased},
+		{"coupon_redemption", 1, 1, RedemptionReleased},
+	} {
+		entries, err := repo.List(ctx, f.db, AuditFilter{EntityType: tc.entity, Actor: "user:7", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		creates, updates := 0, 0
+		for _, entry := range entries {
+			switch entry.Action {
+			case AuditCreate:
+				creates++
+			case AuditUpdate:
+				updates++
+				if change := entry.Changes["status"]; change.Before != "active" || change.After != tc.status {
+					t.Errorf("%s %s: status change = %+v", tc.entity, entry.EntityID, change)
+				}
+			}
+		}
+		if creates != tc.creates || updates != tc.updates {
+			t.Errorf("%s: %d creates, %d updates, want %d and %d", tc.entity, creates, updates, tc.creates, tc.updates)
+		}
+	}
+}
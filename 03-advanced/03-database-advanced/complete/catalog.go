@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Product Catalog ============
+
+var (
+	ErrDuplicateSKU       = errors.New("sku already exists")
+	ErrProductInUse       = errors.New("product is referenced by orders and cannot be deleted")
+	ErrStockBelowReserved = errors.New("stock cannot be lower than the reserved quantity")
+)
+
+// ProductFilter เงื่อนไขค้นหาสินค้า
+type ProductFilter struct {
+	Query    string // ค้นจากชื่อหรือ SKU
+	Category string
+	Limit    int
+	Offset   int
+}
+
+func (r *productRepository) Search(ctx context.Context, q DBTX, filter ProductFilter) ([]Product, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.Query != "" {
+		pattern := "%" + strings.ToLower(filter.Query) + "%"
+		where = append(where, "(LOWER(name) LIKE "+arg(pattern)+" OR LOWER(sku) LIKE "+arg(pattern)+")")
+	}
+	if filter.Category != "" {
+		where = append(where, "category = "+arg(filter.Category))
+	}
+
+	query := "SELECT " + productColumns + " FROM products"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id LIMIT " + arg(filter.Limit) + " OFFSET " + arg(filter.Offset)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *product)
+	}
+	return products, rows.Err()
+}
+
+// Create / Update / Delete บันทึก audit ผ่าน q เดียวกัน ควรเรียกใน transaction
+func (r *productRepository) Create(ctx context.Context, q DBTX, product *Product) error {
+	err := q.QueryRowContext(ctx,
+		"INSERT INTO products (sku, name, category, price, currency, stock) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		product.SKU, product.Name, product.Category, product.Price, product.Price.Currency, product.Stock,
+	).Scan(&product.ID)
+	if err != nil {
+		return productConstraintError(err)
+	}
+	product.Reserved = 0
+	product.Available = product.Stock
+	return recordAudit(ctx, q, "product", product.ID, AuditCreate, nil, product)
+}
+
+// Update แก้ข้อมูลสินค้า (reserved ถูกจัดการโดยระบบจองเท่านั้น แก้ผ่านนี้ไม่ได้)
+func (r *productRepository) Update(ctx context.Context, q DBTX, product *Product) error {
+	before, err := r.GetByIDForUpdate(ctx, q, product.ID)
+	if err != nil {
+		return err
+	}
+
+	err = q.QueryRowContext(ctx,
+		`UPDATE products SET sku = $1, name = $2, category = $3, price = $4, currency = $5, stock = $6
+		WHERE id = $7 RETURNING reserved`,
+		product.SKU, product.Name, product.Category, product.Price, product.Price.Currency, product.Stock, product.ID,
+	).Scan(&product.Reserved)
+	if err != nil {
+		return productConstraintError(err)
+	}
+	product.Available = product.Stock - product.Reserved
+	return recordAudit(ctx, q, "product", product.ID, AuditUpdate, before, product)
+}
+
+func (r *productRepository) Delete(ctx context.Context, q DBTX, id int) error {
+	before, err := r.GetByIDForUpdate(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, "DELETE FROM products WHERE id = $1", id); err != nil {
+		return productConstraintError(err)
+	}
+	return recordAudit(ctx, q, "product", id, AuditDelete, before, nil)
+}
+
+// Reserve จองสินค้า (ต้อง lock แถวและตรวจ available ก่อนเรียก)
+func (r *productRepository) Reserve(ctx context.Context, q DBTX, id int, quantity int) error {
+	_, err := q.ExecContext(ctx, "UPDATE products SET reserved = reserved + $1 WHERE id = $2", quantity, id)
+	return err
+}
+
+// ReleaseReserved ปล่อยของที่จองไว้กลับไปขายได้
+func (r *productRepository) ReleaseReserved(ctx context.Context, q DBTX, id int, quantity int) error {
+	_, err := q.ExecContext(ctx, "UPDATE products SET reserved = reserved - $1 WHERE id = $2", quantity, id)
+	return err
+}
+
+// CommitReserved เปลี่ยนของที่จองไว้เป็นขายแล้ว (ตัดออกจากทั้ง stock และ reserved)
+func (r *productRepository) CommitReserved(ctx context.Context, q DBTX, id int, quantity int) error {
+	_, err := q.ExecContext(ctx, "UPDATE products SET stock = stock - $1, reserved = reserved - $1 WHERE id = $2",
+		quantity, id)
+	return err
+}
+
+// productConstraintError แปลง constraint violation ของ database เป็น error ที่ handler เข้าใจ
+func productConstraintError(err error) error {
+	switch constraintViolation(err) {
+	case "unique":
+		return ErrDuplicateSKU
+	case "foreign_key":
+		return ErrProductInUse
+	case "check":
+		return ErrStockBelowReserved
+	}
+	return err
+}
+
+// Handlers
+
+type productRequest struct {
+	SKU      string `json:"sku"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Price    Money  `json:"price"` // 999.99, "999.99" หรือ {"amount": "29.99", "currency": "USD"}
+	Stock    int    `json:"stock"`
+}
+
+func (req productRequest) validate() string {
+	switch {
+	case strings.TrimSpace(req.SKU) == "":
+		return "sku is required"
+	case strings.TrimSpace(req.Name) == "":
+		return "name is required"
+	case req.Price.Currency == "":
+		return "price is required"
+	case req.Price.IsNegative():
+		return "price must not be negative"
+	case req.Stock < 0:
+		return "stock must not be negative"
+	}
+	return ""
+}
+
+func searchProductsHandler(q DBTX, productRepo ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := ProductFilter{
+			Query:    c.Query("q"),
+			Category: c.Query("category"),
+			Limit:    c.QueryInt("limit", 50),
+			Offset:   c.QueryInt("offset", 0),
+		}
+		if filter.Limit <= 0 || filter.Limit > 100 {
+			filter.Limit = 50
+		}
+		if filter.Offset < 0 {
+			filter.Offset = 0
+		}
+
+		products, err := productRepo.Search(c.UserContext(), q, filter)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    products,
+			"count":   len(products),
+		})
+	}
+}
+
+func getProductHandler(q DBTX, productRepo ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+		}
+
+		product, err := productRepo.GetByID(c.UserContext(), q, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"product": product,
+		})
+	}
+}
+
+func createProductHandler(txm *TxManager, productRepo ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req productRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if msg := req.validate(); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+
+		product := &Product{SKU: req.SKU, Name: req.Name, Category: req.Category, Price: req.Price, Stock: req.Stock}
+		ctx := c.UserContext()
+		err := txm.WithTx(ctx, nil, func(tx *Tx) error {
+			return productRepo.Create(ctx, tx, product)
+		})
+		if errors.Is(err, ErrDuplicateSKU) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"success": true,
+			"product": product,
+		})
+	}
+}
+
+func updateProductHandler(txm *TxManager, productRepo ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+		}
+
+		var req productRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if msg := req.validate(); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+
+		product := &Product{ID: id, SKU: req.SKU, Name: req.Name, Category: req.Category, Price: req.Price, Stock: req.Stock}
+		ctx := c.UserContext()
+		err = txm.WithTx(ctx, nil, func(tx *Tx) error {
+			return productRepo.Update(ctx, tx, product)
+		})
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+		case errors.Is(err, ErrDuplicateSKU), errors.Is(err, ErrStockBelowReserved):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"product": product,
+		})
+	}
+}
+
+func deleteProductHandler(txm *TxManager, productRepo ProductRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid product ID"})
+		}
+
+		ctx := c.UserContext()
+		err = txm.WithTx(ctx, nil, func(tx *Tx) error {
+			return productRepo.Delete(ctx, tx, id)
+		})
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+		case errors.Is(err, ErrProductInUse):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Product deleted",
+		})
+	}
+}
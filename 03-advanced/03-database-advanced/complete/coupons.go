@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Coupons & Discounts ============
+
+// CouponType ชนิดของคูปอง
+type CouponType string
+
+const (
+	CouponPercentage CouponType = "percentage"  // ลดเป็น % ของยอดรวม
+	CouponFixed      CouponType = "fixed"       // ลดเป็นจำนวนเงิน
+	CouponBuyXGetY   CouponType = "buy_x_get_y" // ซื้อ X แถม Y ของสินค้าที่กำหนด
+)
+
+// สถานะของการใช้คูปองกับ order
+const (
+	RedemptionActive   = "active"
+	RedemptionReleased = "released" // order ถูกยกเลิก คืนสิทธิ์ให้ใช้ใหม่ได้
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponInvalid       = errors.New("coupon is not valid")
+	ErrCouponUsageLimit    = errors.New("coupon usage limit reached")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this order")
+	ErrDuplicateCoupon     = errors.New("coupon code already exists")
+)
+
+// Coupon หนึ่งแถวใน coupons
+// AmountOff และ MinOrder ใช้สกุลเงินเดียวกัน (column currency)
+type Coupon struct {
+	ID           int        `json:"id"`
+	Code         string     `json:"code"`
+	Type         CouponType `json:"type"`
+	Description  string     `json:"description"`
+	PercentOffBP int        `json:"percent_off_bp,omitempty"` // basis points: 1000 = 10%, 750 = 7.5%
+	AmountOff    Money      `json:"amount_off"`
+	BuyQuantity  int        `json:"buy_quantity,omitempty"`
+	GetQuantity  int        `json:"get_quantity,omitempty"`
+	ProductID    *int       `json:"product_id,omitempty"`
+	MinOrder     Money      `json:"min_order"`
+	StartsAt     *time.Time `json:"starts_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	UsageLimit   *int       `json:"usage_limit"`    // nil = ไม่จำกัด
+	PerUserLimit *int       `json:"per_user_limit"` // nil = ไม่จำกัด
+	TimesUsed    int        `json:"times_used"`
+	Active       bool       `json:"active"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// OrderDiscount ส่วนลดหนึ่งบรรทัดของ order (หนึ่งแถวใน order_discounts)
+type OrderDiscount struct {
+	ID          int    `json:"id,omitempty"`
+	OrderID     int    `json:"order_id,omitempty"`
+	CouponID    int    `json:"coupon_id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
+
+// normalizeCouponCode โค้ดคูปองไม่สนตัวพิมพ์เล็ก-ใหญ่ เก็บเป็นตัวพิมพ์ใหญ่
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// checkValid ตรวจว่าคูปองเปิดใช้และอยู่ในช่วงเวลาที่ใช้ได้
+func (c *Coupon) checkValid(now time.Time) error {
+	switch {
+	case !c.Active:
+		return fmt.Errorf("%w: %s is inactive", ErrCouponInvalid, c.Code)
+	case c.StartsAt != nil && now.Before(*c.StartsAt):
+		return fmt.Errorf("%w: %s starts at %s", ErrCouponInvalid, c.Code, c.StartsAt.Format(time.RFC3339))
+	case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+		return fmt.Errorf("%w: %s expired at %s", ErrCouponInvalid, c.Code, c.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Discount คำนวณส่วนลดสำหรับ items (ราคาต่อชิ้น) และยอดรวม subtotal
+// ไม่ตรวจช่วงเวลาหรือจำนวนครั้งที่ใช้ (ดู checkValid และ OrderService.applyCoupon)
+// ส่วนลดไม่เกิน subtotal เสมอ
+func (c *Coupon) Discount(items []OrderItem, subtotal Money) (Money, error) {
+	// ยอดขั้นต่ำและส่วนลดแบบจำนวนเงินผูกกับสกุลเงินของคูปอง
+	if (c.Type == CouponFixed || !c.MinOrder.IsZero()) && subtotal.Currency != c.MinOrder.Currency {
+		return Money{}, fmt.Errorf("%w: %s is for %s orders", ErrCouponNotApplicable, c.Code, c.MinOrder.Currency)
+	}
+	if !c.MinOrder.IsZero() {
+		if cmp, err := subtotal.Cmp(c.MinOrder); err != nil {
+			return Money{}, err
+		} else if cmp < 0 {
+			return Money{}, fmt.Errorf("%w: %s requires a minimum order of %s", ErrCouponNotApplicable, c.Code, c.MinOrder)
+		}
+	}
+
+	var discount Money
+	var err error
+	switch c.Type {
+	case CouponPercentage:
+		discount, err = subtotal.MulRatio(int64(c.PercentOffBP), 10000)
+	case CouponFixed:
+		discount = c.AmountOff
+	case CouponBuyXGetY:
+		discount, err = c.freeItemsDiscount(items)
+	default:
+		return Money{}, fmt.Errorf("%w: unknown coupon type %q", ErrCouponInvalid, c.Type)
+	}
+	if err != nil {
+		return Money{}, err
+	}
+
+	if cmp, err := discount.Cmp(subtotal); err != nil {
+		return Money{}, err
+	} else if cmp > 0 {
+		discount = subtotal
+	}
+	return discount, nil
+}
+
+// freeItemsDiscount ซื้อ X แถม Y: ทุก X+Y ชิ้นของสินค้าที่กำหนด Y ชิ้นไม่คิดเงิน
+// นับจำนวนรวมทุกบรรทัดของสินค้านั้น (สินค้าเดียวกันราคาเดียวกัน ใช้ราคาของบรรทัดแรก)
+func (c *Coupon) freeItemsDiscount(items []OrderItem) (Money, error) {
+	group := c.BuyQuantity + c.GetQuantity
+	var quantity int
+	var price Money
+	for _, item := range items {
+		if c.ProductID == nil || item.ProductID != *c.ProductID {
+			continue
+		}
+		if quantity == 0 {
+			price = item.Price
+		}
+		quantity += item.Quantity
+	}
+	if group > 0 {
+		if free := quantity / group * c.GetQuantity; free > 0 {
+			return price.Mul(int64(free))
+		}
+	}
+	return Money{}, fmt.Errorf("%w: %s needs %d of product %d in the order",
+		ErrCouponNotApplicable, c.Code, group, derefInt(c.ProductID))
+}
+
+// Label คำอธิบายส่วนลดที่แสดงใน order (ใช้ description ถ้ามี)
+func (c *Coupon) Label() string {
+	if c.Description != "" {
+		return c.Description
+	}
+	switch c.Type {
+	case CouponPercentage:
+		return strconv.FormatFloat(float64(c.PercentOffBP)/100, 'f', -1, 64) + "% off"
+	case CouponFixed:
+		return c.AmountOff.String() + " off"
+	case CouponBuyXGetY:
+		return fmt.Sprintf("buy %d get %d free", c.BuyQuantity, c.GetQuantity)
+	}
+	return c.Code
+}
+
+func derefInt(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// ============ Repository ============
+
+type CouponRepository interface {
+	Create(ctx context.Context, q DBTX, coupon *Coupon) error
+	List(ctx context.Context, q DBTX) ([]Coupon, error)
+	GetByCode(ctx context.Context, q DBTX, code string) (*Coupon, error)
+	GetByCodeForUpdate(ctx context.Context, q DBTX, code string) (*Coupon, error)
+	ActiveRedemptions(ctx context.Context, q DBTX, couponID, userID int) (int, error)
+	Redeem(ctx context.Context, q DBTX, couponID, orderID, userID int) error
+	ReleaseForOrder(ctx context.Context, q DBTX, orderID int) (int, error)
+	AddOrderDiscount(ctx context.Context, q DBTX, discount *OrderDiscount) error
+	DiscountsForOrders(ctx context.Context, q DBTX, orderIDs []int) (map[int][]OrderDiscount, error)
+}
+
+type couponRepository struct{}
+
+const couponColumns = `id, code, type, description, percent_off_bp, amount_off, buy_quantity, get_quantity,
+	product_id, min_order, currency, starts_at, expires_at, usage_limit, per_user_limit, times_used, active, created_at`
+
+func scanCoupon(row interface {
+	Scan(dest ...interface{}) error
+}) (*Coupon, error) {
+	var c Coupon
+	var currency string
+	if err := row.Scan(&c.ID, &c.Code, &c.Type, &c.Description, &c.PercentOffBP, &c.AmountOff,
+		&c.BuyQuantity, &c.GetQuantity, &c.ProductID, &c.MinOrder, &currency, &c.StartsAt, &c.ExpiresAt,
+		&c.UsageLimit, &c.PerUserLimit, &c.TimesUsed, &c.Active, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.AmountOff.Currency = currency
+	c.MinOrder.Currency = c.AmountOff.Currency
+	return &c, nil
+}
+
+// Create บันทึกคูปองพร้อม audit ควรเรียกใน transaction
+func (r *couponRepository) Create(ctx context.Context, q DBTX, coupon *Coupon) error {
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO coupons (code, type, description, percent_off_bp, amount_off, buy_quantity, get_quantity,
+			product_id, min_order, currency, starts_at, expires_at, usage_limit, per_user_limit, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at`,
+		coupon.Code, coupon.Type, coupon.Description, coupon.PercentOffBP, coupon.AmountOff,
+		coupon.BuyQuantity, coupon.GetQuantity, coupon.ProductID, coupon.MinOrder, coupon.AmountOff.Currency,
+		coupon.StartsAt, coupon.ExpiresAt, coupon.UsageLimit, coupon.PerUserLimit, coupon.Active,
+	).Scan(&coupon.ID, &coupon.CreatedAt)
+	if err != nil {
+		switch constraintViolation(err) {
+		case "unique":
+			return ErrDuplicateCoupon
+		case "foreign_key":
+			return fmt.Errorf("%w: %d", ErrProductNotFound, derefInt(coupon.ProductID))
+		}
+		return err
+	}
+	return recordAudit(ctx, q, "coupon", coupon.ID, AuditCreate, nil, coupon)
+}
+
+func (r *couponRepository) List(ctx context.Context, q DBTX) ([]Coupon, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+couponColumns+" FROM coupons ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []Coupon{}
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, *coupon)
+	}
+	return coupons, rows.Err()
+}
+
+func (r *couponRepository) GetByCode(ctx context.Context, q DBTX, code string) (*Coupon, error) {
+	return scanCoupon(q.QueryRowContext(ctx, "SELECT "+couponColumns+" FROM coupons WHERE code = $1", code))
+}
+
+// GetByCodeForUpdate lock แถวคูปองจนจบ transaction (กันหลาย orders ใช้เกิน usage_limit พร้อมกัน)
+func (r *couponRepository) GetByCodeForUpdate(ctx context.Context, q DBTX, code string) (*Coupon, error) {
+	return scanCoupon(q.QueryRowContext(ctx, "SELECT "+couponColumns+" FROM coupons WHERE code = $1 FOR UPDATE", code))
+}
+
+// ActiveRedemptions จำนวนครั้งที่ user ใช้คูปองนี้กับ orders ที่ยังไม่ถูกยกเลิก
+func (r *couponRepository) ActiveRedemptions(ctx context.Context, q DBTX, couponID, userID int) (int, error) {
+	var n int
+	err := q.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2 AND status = $3",
+		couponID, userID, RedemptionActive).Scan(&n)
+	return n, err
+}
+
+// Redeem บันทึกการใช้คูปองกับ order และนับจำนวนครั้งที่ใช้
+func (r *couponRepository) Redeem(ctx context.Context, q DBTX, couponID, orderID, userID int) error {
+	var id int
+	if err := q.QueryRowContext(ctx,
+		"INSERT INTO coupon_redemptions (coupon_id, order_id, user_id, status) VALUES ($1, $2, $3, $4) RETURNING id",
+		couponID, orderID, userID, RedemptionActive).Scan(&id); err != nil {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, "UPDATE coupons SET times_used = times_used + 1 WHERE id = $1", couponID); err != nil {
+		return err
+	}
+	return recordAudit(ctx, q, "coupon_redemption", id, AuditCreate, nil,
+		redemptionState(couponID, orderID, userID, RedemptionActive))
+}
+
+// ReleaseForOrder คืนสิทธิ์คูปองที่ order ใช้ไป (ตอนยกเลิก) คืนจำนวนคูปองที่ถูกคืน
+func (r *couponRepository) ReleaseForOrder(ctx context.Context, q DBTX, orderID int) (int, error) {
+	if _, err := q.ExecContext(ctx,
+		`UPDATE coupons SET times_used = times_used - 1
+		WHERE id IN (SELECT coupon_id FROM coupon_redemptions WHERE order_id = $1 AND status = $2)`,
+		orderID, RedemptionActive); err != nil {
+		return 0, err
+	}
+	rows, err := q.QueryContext(ctx,
+		"UPDATE coupon_redemptions SET status = $1 WHERE order_id = $2 AND status = $3 RETURNING id, coupon_id, user_id",
+		RedemptionReleased, orderID, RedemptionActive)
+	if err != nil {
+		return 0, err
+	}
+	type released struct{ id, couponID, userID int }
+	var redemptions []released
+	for rows.Next() {
+		var red released
+		if err := rows.Scan(&red.id, &red.couponID, &red.userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		redemptions = append(redemptions, red)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, red := range redemptions {
+		if err := recordAudit(ctx, q, "coupon_redemption", red.id, AuditUpdate,
+			redemptionState(red.couponID, orderID, red.userID, RedemptionActive),
+			redemptionState(red.couponID, orderID, red.userID, RedemptionReleased)); err != nil {
+			return 0, err
+		}
+	}
+	return len(redemptions), nil
+}
+
+// redemptionState สถานะของการใช้คูปองหนึ่งครั้งสำหรับ audit log
+func redemptionState(couponID, orderID, userID int, status string) map[string]interface{} {
+	return map[string]interface{}{"coupon_id": couponID, "order_id": orderID, "user_id": userID, "status": status}
+}
+
+func (r *couponRepository) AddOrderDiscount(ctx context.Context, q DBTX, discount *OrderDiscount) error {
+	return q.QueryRowContext(ctx,
+		`INSERT INTO order_discounts (order_id, coupon_id, code, description, amount)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		discount.OrderID, discount.CouponID, discount.Code, discount.Description, discount.Amount,
+	).Scan(&discount.ID)
+}
+
+// DiscountsForOrders โหลดส่วนลดของหลาย orders ใน query เดียว แล้วจัดกลุ่มตาม order_id
+func (r *couponRepository) DiscountsForOrders(ctx context.Context, q DBTX, orderIDs []int) (map[int][]OrderDiscount, error) {
+	discounts := make(map[int][]OrderDiscount, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return discounts, nil
+	}
+
+	placeholders := make([]string, len(orderIDs))
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT d.id, d.order_id, COALESCE(d.coupon_id, 0), d.code, d.description, d.amount, o.currency
+		FROM order_discounts d
+		JOIN orders o ON o.id = d.order_id
+		WHERE d.order_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY d.order_id, d.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d OrderDiscount
+		if err := rows.Scan(&d.ID, &d.OrderID, &d.CouponID, &d.Code, &d.Description,
+			&d.Amount, &d.Amount.Currency); err != nil {
+			return nil, err
+		}
+		discounts[d.OrderID] = append(discounts[d.OrderID], d)
+	}
+	return discounts, rows.Err()
+}
+
+// ============ Service ============
+
+// applyCoupon ตรวจคูปองและคำนวณส่วนลดของ order
+// forUpdate = lock แถวคูปองไว้จน commit (ใช้ใน transaction ของ PlaceOrder) ส่วน QuoteOrder อ่านอย่างเดียว
+// code ว่าง = ไม่ใช้คูปอง
+func (s *OrderService) applyCoupon(ctx context.Context, q DBTX, code string, userID int,
+	items []OrderItem, subtotal Money, forUpdate bool) (*Coupon, []OrderDiscount, error) {
+	code = normalizeCouponCode(code)
+	if code == "" {
+		return nil, []OrderDiscount{}, nil
+	}
+
+	get := s.couponRepo.GetByCode
+	if forUpdate {
+		get = s.couponRepo.GetByCodeForUpdate
+	}
+	coupon, err := get(ctx, q, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCouponNotFound, code)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := coupon.checkValid(time.Now()); err != nil {
+		return nil, nil, err
+	}
+	if coupon.UsageLimit != nil && coupon.TimesUsed >= *coupon.UsageLimit {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCouponUsageLimit, code)
+	}
+	if coupon.PerUserLimit != nil {
+		used, err := s.couponRepo.ActiveRedemptions(ctx, q, coupon.ID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if used >= *coupon.PerUserLimit {
+			return nil, nil, fmt.Errorf("%w: %s (already used %d times by this user)", ErrCouponUsageLimit, code, used)
+		}
+	}
+
+	amount, err := coupon.Discount(items, subtotal)
+	if err != nil {
+		return nil, nil, err
+	}
+	return coupon, []OrderDiscount{{
+		CouponID: coupon.ID, Code: coupon.Code, Description: coupon.Label(), Amount: amount,
+	}}, nil
+}
+
+// releaseCoupons คืนสิทธิ์คูปองของ order ที่ถูกยกเลิก
+func (s *OrderService) releaseCoupons(ctx context.Context, tx *Tx, orderID int) error {
+	_, err := s.couponRepo.ReleaseForOrder(ctx, tx, orderID)
+	return err
+}
+
+// ============ Handlers ============
+
+type couponRequest struct {
+	Code         string     `json:"code"`
+	Type         CouponType `json:"type"`
+	Description  string     `json:"description"`
+	PercentOffBP int        `json:"percent_off_bp"`
+	AmountOff    Money      `json:"amount_off"`
+	BuyQuantity  int        `json:"buy_quantity"`
+	GetQuantity  int        `json:"get_quantity"`
+	ProductID    *int       `json:"product_id"`
+	MinOrder     Money      `json:"min_order"`
+	StartsAt     *time.Time `json:"starts_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	UsageLimit   *int       `json:"usage_limit"`
+	PerUserLimit *int       `json:"per_user_limit"`
+	Active       *bool      `json:"active"` // ไม่ส่ง = เปิดใช้
+}
+
+// coupon ตรวจ request แล้วสร้าง Coupon (คืนข้อความ error ถ้าไม่ถูกต้อง)
+func (req couponRequest) coupon() (*Coupon, string) {
+	coupon := &Coupon{
+		Code: normalizeCouponCode(req.Code), Type: req.Type, Description: strings.TrimSpace(req.Description),
+		StartsAt: req.StartsAt, ExpiresAt: req.ExpiresAt, UsageLimit: req.UsageLimit, PerUserLimit: req.PerUserLimit,
+		Active: req.Active == nil || *req.Active,
+	}
+
+	currency := req.AmountOff.Currency
+	if currency == "" {
+		currency = req.MinOrder.Currency
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if req.MinOrder.Currency != "" && req.MinOrder.Currency != currency {
+		return nil, "amount_off and min_order must use the same currency"
+	}
+	coupon.AmountOff = NewMoney(req.AmountOff.Amount, currency)
+	coupon.MinOrder = NewMoney(req.MinOrder.Amount, currency)
+
+	switch {
+	case coupon.Code == "":
+		return nil, "code is required"
+	case coupon.MinOrder.IsNegative():
+		return nil, "min_order must not be negative"
+	case req.StartsAt != nil && req.ExpiresAt != nil && !req.ExpiresAt.After(*req.StartsAt):
+		return nil, "expires_at must be after starts_at"
+	case req.UsageLimit != nil && *req.UsageLimit <= 0, req.PerUserLimit != nil && *req.PerUserLimit <= 0:
+		return nil, "usage limits must be greater than 0"
+	}
+
+	switch req.Type {
+	case CouponPercentage:
+		if req.PercentOffBP <= 0 || req.PercentOffBP > 10000 {
+			return nil, "percent_off_bp must be between 1 and 10000"
+		}
+		coupon.PercentOffBP = req.PercentOffBP
+	case CouponFixed:
+		if coupon.AmountOff.Amount <= 0 {
+			return nil, "amount_off must be greater than 0"
+		}
+	case CouponBuyXGetY:
+		if req.BuyQuantity <= 0 || req.GetQuantity <= 0 || req.ProductID == nil {
+			return nil, "buy_quantity, get_quantity and product_id are required"
+		}
+		coupon.BuyQuantity, coupon.GetQuantity, coupon.ProductID = req.BuyQuantity, req.GetQuantity, req.ProductID
+	default:
+		return nil, "type must be percentage, fixed or buy_x_get_y"
+	}
+	return coupon, ""
+}
+
+func listCouponsHandler(q DBTX, couponRepo CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		coupons, err := couponRepo.List(c.UserContext(), q)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    coupons,
+			"count":   len(coupons),
+		})
+	}
+}
+
+func createCouponHandler(txm *TxManager, couponRepo CouponRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req couponRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		coupon, msg := req.coupon()
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+
+		ctx := c.UserContext()
+		err := txm.WithTx(ctx, nil, func(tx *Tx) error {
+			return couponRepo.Create(ctx, tx, coupon)
+		})
+		switch {
+		case errors.Is(err, ErrDuplicateCoupon):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, ErrProductNotFound):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return err
+		}
+
+		return c.Status(201).JSON(fiber.Map{
+			"success": true,
+			"coupon":  coupon,
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (f *testFixture) createCoupon(t *testing.T, coupon Coupon) *Coupon {
+	t.Helper()
+	coupon.Active = true
+	if coupon.MinOrder.Currency == "" {
+		coupon.AmountOff.Currency, coupon.MinOrder.Currency = "THB", "THB"
+	}
+	if err := (&couponRepository{}).Create(context.Background(), f.db, &coupon); err != nil {
+		t.Fatal(err)
+	}
+	return &coupon
+}
+
+func (f *testFixture) placeOrderWithCoupon(code string, items ...PlaceOrderItemRequest) (*PlacedOrder, error) {
+	return f.service.PlaceOrder(context.Background(), PlaceOrderRequest{UserID: f.userID, Items: items, CouponCode: code})
+}
+
+func intPtr(n int) *int { return &n }
+
+func TestCouponDiscountTypes(t *testing.T) {
+	f := newTestFixture(t)
+	laptop := PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 1}
+
+	f.createCoupon(t, Coupon{Code: "PCT75", Type: CouponPercentage, PercentOffBP: 750})
+	f.createCoupon(t, Coupon{Code: "FIX100", Type: CouponFixed, AmountOff: NewMoney(10000, "THB")})
+	f.createCoupon(t, Coupon{Code: "HUGE", Type: CouponFixed, AmountOff: NewMoney(10000000, "THB")})
+	f.createCoupon(t, Coupon{Code: "B2G1", Type: CouponBuyXGetY, BuyQuantity: 2, GetQuantity: 1, ProductID: &f.mouse.ID})
+
+	for _, tc := range []struct {
+		code     string
+		items    []PlaceOrderItemRequest
+		discount int64
+	}{
+		{"pct75", []PlaceOrderItemRequest{laptop}, 7500},                              // 7.5% ของ 999.99 = 74.99925 → ปัดเป็น 75.00
+		{"FIX100", []PlaceOrderItemRequest{laptop}, 10000},                            // ลด 100.00
+		{"HUGE", []PlaceOrderItemRequest{laptop}, 99999},                              // ไม่เกินยอดรวม
+		{"B2G1", []PlaceOrderItemRequest{{ProductID: f.mouse.ID, Quantity: 7}}, 5998}, // 7 ชิ้น = 2 กลุ่ม → ฟรี 2 ชิ้น
+	} {
+		quote, err := f.service.QuoteOrder(context.Background(),
+			PlaceOrderRequest{UserID: f.userID, Items: tc.items, CouponCode: tc.code})
+		if err != nil {
+			t.Errorf("%s: %v", tc.code, err)
+			continue
+		}
+		if len(quote.Discounts) != 1 || quote.Discounts[0].Amount.Amount != tc.discount {
+			t.Errorf("%s: discounts = %+v, want %d", tc.code, quote.Discounts, tc.discount)
+			continue
+		}
+		if quote.Total.Amount != quote.Subtotal.Amount-tc.discount {
+			t.Errorf("%s: total = %s, subtotal = %s", tc.code, quote.Total, quote.Subtotal)
+		}
+	}
+
+	_, err := f.service.QuoteOrder(context.Background(),
+		PlaceOrderRequest{UserID: f.userID, Items: []PlaceOrderItemRequest{{ProductID: f.mouse.ID, Quantity: 2}}, CouponCode: "B2G1"})
+	if !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("B2G1 with 2 mice: err = %v, want ErrCouponNotApplicable", err)
+	}
+}
+
+func TestCouponValidation(t *testing.T) {
+	f := newTestFixture(t)
+	mouse := PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	f.createCoupon(t, Coupon{Code: "EXPIRED", Type: CouponPercentage, PercentOffBP: 1000, ExpiresAt: &past})
+	f.createCoupon(t, Coupon{Code: "LATER", Type: CouponPercentage, PercentOffBP: 1000, StartsAt: &future})
+	f.createCoupon(t, Coupon{Code: "MIN500", Type: CouponPercentage, PercentOffBP: 1000, MinOrder: NewMoney(50000, "THB")})
+	f.createCoupon(t, Coupon{Code: "USD", Type: CouponFixed, AmountOff: NewMoney(500, "USD"), MinOrder: NewMoney(0, "USD")})
+
+	for code, want := range map[string]error{
+		"NOPE":    ErrCouponNotFound,
+		"EXPIRED": ErrCouponInvalid,
+		"LATER":   ErrCouponInvalid,
+		"MIN500":  ErrCouponNotApplicable,
+		"USD":     ErrCouponNotApplicable,
+	} {
+		if _, err := f.placeOrderWithCoupon(code, mouse); !errors.Is(err, want) {
+			t.Errorf("%s: err = %v, want %v", code, err, want)
+		}
+	}
+
+	// คูปองใช้ไม่ได้ = ทั้ง order rollback ไม่มีการจอง stock
+	assertStock(t, f.product(t, f.mouse.ID), 50, 0)
+}
+
+func TestCouponUsageLimits(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	mouse := PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1}
+
+	f.createCoupon(t, Coupon{Code: "ONCE", Type: CouponPercentage, PercentOffBP: 1000, PerUserLimit: intPtr(1)})
+	f.createCoupon(t, Coupon{Code: "TWO", Type: CouponFixed, AmountOff: NewMoney(100, "THB"), UsageLimit: intPtr(2)})
+
+	first, err := f.placeOrderWithCoupon("ONCE", mouse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.placeOrderWithCoupon("ONCE", mouse); !errors.Is(err, ErrCouponUsageLimit) {
+		t.Errorf("second use per user: err = %v, want ErrCouponUsageLimit", err)
+	}
+
+	// ยกเลิก order = คืนสิทธิ์ ใช้ใหม่ได้
+	if _, err := f.service.UpdateStatus(ctx, first.ID, OrderStatusCancelled, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.placeOrderWithCoupon("ONCE", mouse); err != nil {
+		t.Errorf("use after cancel: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.placeOrderWithCoupon("TWO", mouse); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.placeOrderWithCoupon("TWO", mouse); !errors.Is(err, ErrCouponUsageLimit) {
+		t.Errorf("third use: err = %v, want ErrCouponUsageLimit", err)
+	}
+
+	// order แรกถูกยกเลิกแล้ว นับเฉพาะ order ที่ยังใช้คูปองอยู่
+	coupon, err := (&couponRepository{}).GetByCode(ctx, f.db, "ONCE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coupon.TimesUsed != 1 {
+		t.Errorf("ONCE times_used = %d, want 1", coupon.TimesUsed)
+	}
+}
+
+func TestPlaceOrderPersistsDiscounts(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	f.createCoupon(t, Coupon{Code: "SAVE10", Type: CouponPercentage, PercentOffBP: 1000})
+
+	placed, err := f.placeOrderWithCoupon("save10",
+		PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 1},
+		PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// subtotal 1029.98 ลด 10% = 103.00 (102.998 ปัดขึ้น) → 926.98
+	if placed.Subtotal.Amount != 102998 || placed.Total.Amount != 92698 {
+		t.Errorf("subtotal = %s, total = %s, want 1029.98 / 926.98", placed.Subtotal, placed.Total)
+	}
+
+	order, err := f.service.GetOrder(ctx, placed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order.Discounts) != 1 || order.Discounts[0].Code != "SAVE10" || order.Discounts[0].Description != "10% off" ||
+		order.Discounts[0].Amount != NewMoney(10300, "THB") {
+		t.Errorf("discounts = %+v", order.Discounts)
+	}
+	if order.Total.Amount != 92698 || order.Subtotal.Amount != 102998 {
+		t.Errorf("order total = %s, subtotal = %s", order.Total, order.Subtotal)
+	}
+
+	// ยกเลิกเพราะหมดเวลาจอง ก็คืนสิทธิ์คูปองเหมือนกัน
+	f.service.reservationTTL = -time.Minute
+	if _, err := f.placeOrderWithCoupon("SAVE10", PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.ExpireReservations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	coupon, err := (&couponRepository{}).GetByCode(ctx, f.db, "SAVE10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coupon.TimesUsed != 1 {
+		t.Errorf("times_used = %d, want 1 (expired order released its coupon)", coupon.TimesUsed)
+	}
+}
+
+func TestFreeItemsDiscount(t *testing.T) {
+	mouse, laptop := 2, 1
+	coupon := &Coupon{Code: "B2G1", Type: CouponBuyXGetY, BuyQuantity: 2, GetQuantity: 1, ProductID: &mouse}
+	price := NewMoney(2999, "THB")
+
+	for _, tc := range []struct {
+		name     string
+		items    []OrderItem
+		discount int64 // -1 = ErrCouponNotApplicable
+	}{
+		{"one line", []OrderItem{{ProductID: mouse, Quantity: 3, Price: price}}, 2999},
+		{"split lines", []OrderItem{{ProductID: mouse, Quantity: 1, Price: price}, {ProductID: mouse, Quantity: 2, Price: price}}, 2999},
+		{"split lines two groups", []OrderItem{{ProductID: mouse, Quantity: 4, Price: price}, {ProductID: mouse, Quantity: 3, Price: price}}, 5998},
+		{"other product ignored", []OrderItem{{ProductID: laptop, Quantity: 9, Price: price}, {ProductID: mouse, Quantity: 2, Price: price}}, -1},
+		{"not enough", []OrderItem{{ProductID: mouse, Quantity: 1, Price: price}, {ProductID: mouse, Quantity: 1, Price: price}}, -1},
+	} {
+		discount, err := coupon.freeItemsDiscount(tc.items)
+		if tc.discount < 0 {
+			if !errors.Is(err, ErrCouponNotApplicable) {
+				t.Errorf("%s: err = %v, want ErrCouponNotApplicable", tc.name, err)
+			}
+			continue
+		}
+		if err != nil || discount.Amount != tc.discount {
+			t.Errorf("%s: discount = %s, %v, want %d", tc.name, discount, err, tc.discount)
+		}
+	}
+}
+
+func TestOrderCouponUsesCallerIdentity(t *testing.T) {
+	f := newTestFixture(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	f.createCoupon(t, Coupon{Code: "ONCE", Type: CouponPercentage, PercentOffBP: 1000, PerUserLimit: intPtr(1)})
+
+	app := fiber.New()
+	app.Use(identify())
+	app.Post("/orders", createOrderHandler(f.service))
+
+	john := strconv.Itoa(f.userID)
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		userID  int
+		coupon  string
+		status  int
+	}{
+		{"anonymous with coupon", nil, f.userID, "ONCE", 401},
+		{"body names another user", map[string]string{"X-User-ID": john}, f.userID + 1, "ONCE", 403},
+		{"identified user", map[string]string{"X-User-ID": john}, 0, "ONCE", 201},
+		{"limit counted per identity", map[string]string{"X-User-ID": john}, 0, "ONCE", 409},
+		{"admin on behalf of user", map[string]string{"X-Admin-Token": "secret"}, f.userID, "ONCE", 409},
+		{"anonymous without coupon", nil, f.userID, "", 201},
+	} {
+		body := fmt.Sprintf(`{"user_id": %d, "items": [{"product_id": %d, "quantity": 1}], "coupon_code": %q}`,
+			tc.userID, f.mouse.ID, tc.coupon)
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ============ SQL Dialects ============
+
+// Dialect รวมสิ่งที่ต่างกันระหว่าง database
+// SQL ในโค้ดเขียนแบบ PostgreSQL ($1, RETURNING, FOR UPDATE) แล้วให้ dialect แปลงเป็นของตัวเอง
+type Dialect interface {
+	// Name ใช้เป็นชื่อโฟลเดอร์ migrations/<name>
+	Name() string
+	DriverName() string
+	// Rebind แปลง query ที่เขียนแบบ PostgreSQL ให้รันได้กับ database นี้
+	Rebind(query string) string
+	// BindArgs ปรับค่า arguments ก่อนส่งให้ driver
+	BindArgs(args []interface{}) []interface{}
+	// LockMigrations กันหลาย process รัน migration พร้อมกัน (คืน function สำหรับปลด lock)
+	LockMigrations(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+	// IsRetryable บอกว่า error นี้ควร retry ทั้ง transaction หรือไม่
+	IsRetryable(err error) bool
+	// ConstraintViolation ชนิดของ constraint ที่ถูกละเมิด ("unique", "foreign_key", "check") หรือ ""
+	ConstraintViolation(err error) string
+	// ReplicationLag replica ตามหลัง primary อยู่เท่าไร (0 ถ้าไม่ใช่ replica)
+	ReplicationLag(ctx context.Context, db *DB) (time.Duration, error)
+	// ListTables ชื่อตารางทั้งหมดของแอป
+	ListTables(ctx context.Context, q DBTX) ([]string, error)
+	// TruncateTables ลบข้อมูลทุกแถวและเริ่มนับ id ใหม่ (ใช้ตอน reset fixtures)
+	TruncateTables(ctx context.Context, tx *Tx, tables []string) error
+	// RefreshView คำนวณ view สรุปผลใหม่ (materialized view) คืน false ถ้า view ของ database นี้สดอยู่แล้ว
+	RefreshView(ctx context.Context, q DBTX, view string) (bool, error)
+}
+
+// dialects ที่รองรับ (key = ชื่อที่ใช้ใน DB_DIALECT)
+var dialects = map[string]Dialect{
+	"postgres": postgresDialect{},
+	"sqlite":   sqliteDialect{},
+}
+
+// PostgreSQL
+
+// migrationLockKey คือ key ของ PostgreSQL advisory lock
+// กันไม่ให้หลาย instance รัน migration พร้อมกันตอน deploy
+const migrationLockKey = 72_030_028
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                              { return "postgres" }
+func (postgresDialect) DriverName() string                        { return "postgres" }
+func (postgresDialect) Rebind(query string) string                { return query }
+func (postgresDialect) BindArgs(args []interface{}) []interface{} { return args }
+
+// LockMigrations ใช้ advisory lock ซึ่งผูกกับ session จึงต้อง lock/unlock บน connection เดียวกัน
+func (postgresDialect) LockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}, nil
+}
+
+// IsRetryable: 40001 = serialization_failure, 40P01 = deadlock_detected
+func (postgresDialect) IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+func (postgresDialect) ConstraintViolation(err error) string {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return ""
+	}
+	switch pqErr.Code {
+	case "23505":
+		return "unique"
+	case "23503":
+		return "foreign_key"
+	case "23514":
+		return "check"
+	}
+	return ""
+}
+
+// ReplicationLag เทียบเวลาของ transaction ล่าสุดที่ replay แล้ว
+// ถ้า replay ทัน WAL ที่ได้รับแล้ว ถือว่าไม่ lag (primary ที่ไม่มีใครเขียนนาน ๆ จะได้ไม่ดูเหมือน lag)
+func (postgresDialect) ReplicationLag(ctx context.Context, db *DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+		WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+func (postgresDialect) ListTables(ctx context.Context, q DBTX) ([]string, error) {
+	return queryStrings(ctx, q, "SELECT tablename FROM pg_tables WHERE schemaname = current_schema() ORDER BY tablename")
+}
+
+// TruncateTables ไม่ใส่ CASCADE: ถ้ามีตารางอื่นอ้างถึงแต่ไม่อยู่ในรายการจะ error แทนที่จะลบเงียบ ๆ
+func (postgresDialect) TruncateTables(ctx context.Context, tx *Tx, tables []string) error {
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = pq.QuoteIdentifier(table)
+	}
+	_, err := tx.ExecContext(ctx, "TRUNCATE TABLE "+strings.Join(quoted, ", ")+" RESTART IDENTITY")
+	return err
+}
+
+// RefreshView แบบ CONCURRENTLY ไม่ block การอ่านระหว่าง refresh (ต้องมี unique index บน view)
+func (postgresDialect) RefreshView(ctx context.Context, q DBTX, view string) (bool, error) {
+	_, err := q.ExecContext(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+pq.QuoteIdentifier(view))
+	return err == nil, err
+}
+
+// SQLite (modernc.org/sqlite ไม่ต้องใช้ cgo)
+//
+// SQLite ไม่มี row lock: ทั้ง database มี writer ได้ทีละ transaction
+// connection จึงเปิดด้วย _txlock=immediate ให้ทุก transaction จอง write lock ตั้งแต่ BEGIN
+// ผลคือ SELECT ... FOR UPDATE ไม่จำเป็น (ตัดทิ้งใน Rebind) เพราะไม่มีใครแก้ข้อมูลแทรกได้ระหว่าง transaction
+// ส่วน SKIP LOCKED ก็ไม่มีแถวไหนถูกข้าม เพราะ relay ตัวอื่นต้องรอจน transaction นี้จบ
+
+type sqliteDialect struct{}
+
+var (
+	pgPlaceholder = regexp.MustCompile(`\$(\d+)`)
+	forUpdate     = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+SKIP\s+LOCKED)?`)
+	rebindCache   sync.Map // query ต้นฉบับ → query ที่แปลงแล้ว
+)
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite" }
+
+// Rebind: $1 → ?1 และตัด FOR UPDATE [SKIP LOCKED]
+func (sqliteDialect) Rebind(query string) string {
+	if cached, ok := rebindCache.Load(query); ok {
+		return cached.(string)
+	}
+	rebound := pgPlaceholder.ReplaceAllString(query, "?$1")
+	rebound = forUpdate.ReplaceAllString(rebound, "")
+	rebindCache.Store(query, rebound)
+	return rebound
+}
+
+// BindArgs แปลงเวลาเป็น UTC เพราะ SQLite เก็บเวลาเป็นข้อความและเปรียบเทียบแบบข้อความ
+// (CURRENT_TIMESTAMP เป็น UTC เสมอ ถ้าเวลาจาก Go เป็น timezone อื่นผลเปรียบเทียบจะผิด)
+func (sqliteDialect) BindArgs(args []interface{}) []interface{} {
+	var bound []interface{} // copy เมื่อต้องแก้ เพื่อไม่แก้ slice ของผู้เรียก
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			if bound == nil {
+				bound = append([]interface{}(nil), args...)
+			}
+			bound[i] = t.UTC()
+		}
+	}
+	if bound == nil {
+		return args
+	}
+	return bound
+}
+
+// LockMigrations ไม่ต้องทำอะไร: transaction ของแต่ละ migration จอง write lock ของทั้งไฟล์อยู่แล้ว
+func (sqliteDialect) LockMigrations(ctx context.Context, conn *sql.Conn) (func(), error) {
+	return func() {}, nil
+}
+
+// ReplicationLag: SQLite ไม่มี replication ในตัว
+func (sqliteDialect) ReplicationLag(ctx context.Context, db *DB) (time.Duration, error) {
+	return 0, nil
+}
+
+func (sqliteDialect) ListTables(ctx context.Context, q DBTX) ([]string, error) {
+	return queryStrings(ctx, q, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+// TruncateTables: SQLite ไม่มี TRUNCATE จึง DELETE ทีละตาราง
+// defer_foreign_keys ให้ตรวจ foreign keys ตอน commit ลำดับการลบจึงไม่สำคัญ
+// และลบแถวใน sqlite_sequence เพื่อให้ AUTOINCREMENT เริ่มที่ 1 ใหม่
+func (sqliteDialect) TruncateTables(ctx context.Context, tx *Tx, tables []string) error {
+	if _, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON"); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "`+strings.ReplaceAll(table, `"`, `""`)+`"`); err != nil {
+			return err
+		}
+	}
+
+	var hasSequence int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'").Scan(&hasSequence); err != nil {
+		return err
+	}
+	if hasSequence == 0 {
+		return nil
+	}
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sqlite_sequence WHERE name = $1", table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshView: SQLite ไม่มี materialized view (view ธรรมดาคำนวณใหม่ทุกครั้งที่อ่าน)
+func (sqliteDialect) RefreshView(ctx context.Context, q DBTX, view string) (bool, error) {
+	return false, nil
+}
+
+func (sqliteDialect) IsRetryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff // primary result code
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+
+func (sqliteDialect) ConstraintViolation(err error) string {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return ""
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return "unique"
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return "foreign_key"
+	case sqlite3.SQLITE_CONSTRAINT_CHECK, sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+		// CHECK ที่เพิ่มทีหลังใน SQLite เป็น trigger ที่ RAISE(ABORT)
+		return "check"
+	}
+	return ""
+}
+
+// constraintViolation / isRetryable ถามทุก dialect (แต่ละ driver มี error type ของตัวเอง จึงไม่ชนกัน)
+// repository จึงแปลง error ได้โดยไม่ต้องรู้ว่ากำลังคุยกับ database ไหน
+func constraintViolation(err error) string {
+	for _, d := range dialects {
+		if kind := d.ConstraintViolation(err); kind != "" {
+			return kind
+		}
+	}
+	return ""
+}
+
+func isRetryable(err error) bool {
+	for _, d := range dialects {
+		if d.IsRetryable(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============ DB / Tx ============
+
+// DB ห่อ *sql.DB ให้ทุก query ผ่าน dialect ก่อนถึง driver
+// (ไม่ embed *sql.DB เพื่อไม่ให้เผลอเรียก Exec/Query ที่ข้ามการแปลง)
+type DB struct {
+	sql     *sql.DB
+	dialect Dialect
+}
+
+// OpenDB เปิด connection ตาม dialect
+func OpenDB(dialect Dialect, dsn string) (*DB, error) {
+	sqlDB, err := sql.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{sql: sqlDB, dialect: dialect}, nil
+}
+
+func (db *DB) Dialect() Dialect { return db.dialect }
+
+// SQL คืน *sql.DB ตัวจริง (ใช้ตั้งค่า pool หรือส่งให้ library อื่น)
+func (db *DB) SQL() *sql.DB { return db.sql }
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.sql.ExecContext(ctx, db.dialect.Rebind(query), db.dialect.BindArgs(args)...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.sql.QueryContext(ctx, db.dialect.Rebind(query), db.dialect.BindArgs(args)...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.sql.QueryRowContext(ctx, db.dialect.Rebind(query), db.dialect.BindArgs(args)...)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.sql.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, dialect: db.dialect}, nil
+}
+
+// Conn จอง connection หนึ่งเส้น (query ผ่าน conn ต้อง Rebind เอง)
+func (db *DB) Conn(ctx context.Context) (*sql.Conn, error) {
+	return db.sql.Conn(ctx)
+}
+
+func (db *DB) PingContext(ctx context.Context) error { return db.sql.PingContext(ctx) }
+func (db *DB) Close() error                          { return db.sql.Close() }
+
+// Tx ห่อ *sql.Tx แบบเดียวกับ DB
+type Tx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.tx.ExecContext(ctx, tx.dialect.Rebind(query), tx.dialect.BindArgs(args)...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.tx.QueryContext(ctx, tx.dialect.Rebind(query), tx.dialect.BindArgs(args)...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.tx.QueryRowContext(ctx, tx.dialect.Rebind(query), tx.dialect.BindArgs(args)...)
+}
+
+func (tx *Tx) Commit() error   { return tx.tx.Commit() }
+func (tx *Tx) Rollback() error { return tx.tx.Rollback() }
+
+// lookupDialect หา dialect จากชื่อ (ค่าว่าง = postgres)
+func lookupDialect(name string) (Dialect, error) {
+	if name == "" {
+		name = "postgres"
+	}
+	dialect, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DB_DIALECT %q (supported: postgres, sqlite)", name)
+	}
+	return dialect, nil
+}
+
+func queryStrings(ctx context.Context, q DBTX, query string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
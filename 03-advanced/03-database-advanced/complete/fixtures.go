@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ============ Fixtures ============
+//
+// ชุดข้อมูลอยู่ใน fixtures/<env>.yaml (หรือ .yml / .json) หนึ่งไฟล์ต่อหนึ่ง environment
+//
+//	include: [dev]           # โหลดชุดอื่นก่อน (ไม่บังคับ)
+//	users:                   # ชื่อตาราง → รายการแถว เรียงตามลำดับที่ insert
+//	  - _key: john           # ชื่อที่แถวอื่นใช้อ้างถึง
+//	    email: john@example.com
+//	orders:
+//	  - user_id: "@users.john"           # id ของแถวที่มี _key = john ในตาราง users
+//	    total: "@money 999.99 THB"       # เงินในหน่วยย่อย (99999)
+//	    created_at: "@now-48h"           # เวลาปัจจุบัน ± duration
+//
+// ตารางต้องมาก่อนตารางที่อ้างถึงมัน ค่าที่เป็น object/array จะถูกเก็บเป็น JSON
+// ข้อความที่ขึ้นต้นด้วย @ จริง ๆ ให้เขียน @@
+
+//go:embed fixtures
+var fixtureFiles embed.FS
+
+const fixturesDir = "fixtures"
+
+var fixtureExtensions = []string{".yaml", ".yml", ".json"}
+
+// ตารางที่ reset ไม่แตะ: ประวัติ migrations และ audit log (append-only)
+var fixtureKeepTables = map[string]bool{
+	"schema_migrations": true,
+	"audit_log":         true,
+}
+
+var (
+	fixtureIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	fixtureReference  = regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z0-9_-]+)$`)
+	fixtureNow        = regexp.MustCompile(`^@now(?:([+-])(\S+))?$`)
+	fixtureMoney      = regexp.MustCompile(`^@money\s+(\S+)\s+([A-Z]{3})$`)
+)
+
+// Dataset ข้อมูลของหนึ่ง environment (รวม include แล้ว)
+type Dataset struct {
+	Name   string
+	Tables []FixtureTable
+}
+
+type FixtureTable struct {
+	Name string
+	Rows []FixtureRow
+}
+
+type FixtureRow struct {
+	Key    string
+	Values map[string]interface{}
+}
+
+// FixtureRefs id ของแถวที่มี _key แยกตาม "table.key" เช่น refs["users.john"]
+type FixtureRefs map[string]int64
+
+// ID คืน id ของแถว (panic ถ้าไม่มี เพราะหมายถึงชุดข้อมูลไม่ตรงกับโค้ดที่เรียก)
+func (r FixtureRefs) ID(ref string) int64 {
+	id, ok := r[ref]
+	if !ok {
+		panic(fmt.Sprintf("fixture reference %q not found", ref))
+	}
+	return id
+}
+
+// Parsing
+
+// LoadDataset อ่านชุดข้อมูล name จาก fsys (ไฟล์อยู่ใน fixtures/) พร้อมชุดที่ include
+func LoadDataset(fsys fs.FS, name string) (*Dataset, error) {
+	ds := &Dataset{Name: name}
+	if err := ds.include(fsys, name, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func (ds *Dataset) include(fsys fs.FS, name string, visiting map[string]bool) error {
+	if visiting[name] {
+		return fmt.Errorf("fixtures: include cycle at %q", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	file, content, err := readFixtureFile(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil // ไฟล์ว่าง
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level must be a mapping of table → rows", file)
+	}
+
+	// ใช้ yaml.Node เพื่อรักษาลำดับของตารางตามไฟล์ (map ของ Go ไม่มีลำดับ)
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		if key == "include" {
+			var includes []string
+			if value.Kind == yaml.ScalarNode {
+				includes = []string{value.Value}
+			} else if err := value.Decode(&includes); err != nil {
+				return fmt.Errorf("%s: include: %w", file, err)
+			}
+			for _, inc := range includes {
+				if err := ds.include(fsys, inc, visiting); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !fixtureIdentifier.MatchString(key) {
+			return fmt.Errorf("%s: invalid table name %q", file, key)
+		}
+		var rows []map[string]interface{}
+		if err := value.Decode(&rows); err != nil {
+			return fmt.Errorf("%s: %s: %w", file, key, err)
+		}
+		table := ds.table(key)
+		for n, values := range rows {
+			row, err := newFixtureRow(values)
+			if err != nil {
+				return fmt.Errorf("%s: %s[%d]: %w", file, key, n, err)
+			}
+			table.Rows = append(table.Rows, row)
+		}
+	}
+	return nil
+}
+
+// table คืนตารางชื่อ name (ตารางที่ซ้ำกันระหว่างไฟล์จะต่อแถวกัน ลำดับตามที่เจอครั้งแรก)
+func (ds *Dataset) table(name string) *FixtureTable {
+	for i := range ds.Tables {
+		if ds.Tables[i].Name == name {
+			return &ds.Tables[i]
+		}
+	}
+	ds.Tables = append(ds.Tables, FixtureTable{Name: name})
+	return &ds.Tables[len(ds.Tables)-1]
+}
+
+func newFixtureRow(values map[string]interface{}) (FixtureRow, error) {
+	row := FixtureRow{Values: make(map[string]interface{}, len(values))}
+	for column, value := range values {
+		switch {
+		case column == "_key":
+			key, ok := value.(string)
+			if !ok || key == "" {
+				return row, fmt.Errorf("_key must be a non-empty string")
+			}
+			row.Key = key
+		case column == "id":
+			// id ที่กำหนดเองทำให้ sequence ของ PostgreSQL ไม่ตรงกับข้อมูล
+			return row, fmt.Errorf("set _key instead of id")
+		case !fixtureIdentifier.MatchString(column):
+			return row, fmt.Errorf("invalid column name %q", column)
+		default:
+			row.Values[column] = value
+		}
+	}
+	return row, nil
+}
+
+func readFixtureFile(fsys fs.FS, name string) (string, []byte, error) {
+	if !fixtureIdentifier.MatchString(name) {
+		return "", nil, fmt.Errorf("fixtures: invalid dataset name %q", name)
+	}
+	for _, ext := range fixtureExtensions {
+		file := path.Join(fixturesDir, name+ext)
+		content, err := fs.ReadFile(fsys, file)
+		if err == nil {
+			return file, content, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+	}
+	return "", nil, fmt.Errorf("fixtures: dataset %q not found in %s/", name, fixturesDir)
+}
+
+// listDatasets ชื่อชุดข้อมูลทั้งหมดใน fixtures/
+func listDatasets(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, fixturesDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		for _, known := range fixtureExtensions {
+			if ext == known {
+				names = append(names, strings.TrimSuffix(entry.Name(), ext))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Loading
+
+// FixtureLoader insert ชุดข้อมูลลง database ใน transaction เดียว (ผิดพลาดแถวไหน = ไม่มีอะไรถูกเขียน)
+type FixtureLoader struct {
+	db  *DB
+	txm *TxManager
+	now func() time.Time
+}
+
+func NewFixtureLoader(db *DB) *FixtureLoader {
+	return &FixtureLoader{db: db, txm: NewTxManager(db), now: time.Now}
+}
+
+// Load เพิ่มข้อมูลต่อจากที่มีอยู่
+func (l *FixtureLoader) Load(ctx context.Context, ds *Dataset) (FixtureRefs, error) {
+	var refs FixtureRefs
+	err := l.txm.WithTx(ctx, nil, func(tx *Tx) error {
+		var err error
+		refs, err = l.insert(ctx, tx, ds)
+		return err
+	})
+	return refs, err
+}
+
+// Reset ล้างข้อมูลทุกตาราง (ยกเว้น schema_migrations และ audit_log) แล้วโหลดชุดข้อมูล
+// ใช้คืน database ให้อยู่ในสถานะที่รู้แน่นอน เช่น ก่อน demo หรือใน tests
+func (l *FixtureLoader) Reset(ctx context.Context, ds *Dataset) (FixtureRefs, error) {
+	var refs FixtureRefs
+	err := l.txm.WithTx(ctx, nil, func(tx *Tx) error {
+		tables, err := l.db.Dialect().ListTables(ctx, tx)
+		if err != nil {
+			return err
+		}
+		var reset []string
+		for _, table := range tables {
+			if !fixtureKeepTables[table] {
+				reset = append(reset, table)
+			}
+		}
+		if len(reset) > 0 {
+			if err := l.db.Dialect().TruncateTables(ctx, tx, reset); err != nil {
+				return fmt.Errorf("reset tables: %w", err)
+			}
+		}
+
+		refs, err = l.insert(ctx, tx, ds)
+		return err
+	})
+	return refs, err
+}
+
+// LoadIfEmpty โหลดเฉพาะเมื่อทุกตารางในชุดข้อมูลยังว่าง (ใช้ตอน start จึงรันซ้ำได้ไม่ซ้ำข้อมูล)
+func (l *FixtureLoader) LoadIfEmpty(ctx context.Context, ds *Dataset) (bool, error) {
+	for _, table := range ds.Tables {
+		var one int
+		err := l.db.QueryRowContext(ctx, "SELECT 1 FROM "+table.Name+" LIMIT 1").Scan(&one)
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", table.Name, err)
+		}
+	}
+	_, err := l.Load(ctx, ds)
+	return err == nil, err
+}
+
+func (l *FixtureLoader) insert(ctx context.Context, tx *Tx, ds *Dataset) (FixtureRefs, error) {
+	refs := FixtureRefs{}
+	now := l.now()
+	for _, table := range ds.Tables {
+		for n, row := range table.Rows {
+			columns := make([]string, 0, len(row.Values))
+			for column := range row.Values {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+
+			args := make([]interface{}, len(columns))
+			placeholders := make([]string, len(columns))
+			for i, column := range columns {
+				value, err := resolveFixtureValue(row.Values[column], refs, now)
+				if err != nil {
+					return nil, fmt.Errorf("%s[%d].%s: %w", table.Name, n, column, err)
+				}
+				args[i] = value
+				placeholders[i] = fmt.Sprintf("$%d", i+1)
+			}
+
+			query := "INSERT INTO " + table.Name
+			if len(columns) > 0 {
+				query += " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+			} else {
+				query += " DEFAULT VALUES"
+			}
+
+			if row.Key == "" {
+				if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+					return nil, fmt.Errorf("%s[%d]: %w", table.Name, n, err)
+				}
+				continue
+			}
+
+			ref := table.Name + "." + row.Key
+			if _, exists := refs[ref]; exists {
+				return nil, fmt.Errorf("%s[%d]: duplicate _key %q", table.Name, n, row.Key)
+			}
+			var id int64
+			if err := tx.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id); err != nil {
+				return nil, fmt.Errorf("%s[%d] (%s): %w", table.Name, n, row.Key, err)
+			}
+			refs[ref] = id
+		}
+	}
+	return refs, nil
+}
+
+// resolveFixtureValue แปลงค่าพิเศษ (@table.key, @now, @money) และ object/array → JSON
+func resolveFixtureValue(value interface{}, refs FixtureRefs, now time.Time) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	case string:
+		if !strings.HasPrefix(v, "@") {
+			return v, nil
+		}
+		if strings.HasPrefix(v, "@@") {
+			return v[1:], nil
+		}
+
+		if m := fixtureNow.FindStringSubmatch(v); m != nil {
+			if m[1] == "" {
+				return now, nil
+			}
+			d, err := time.ParseDuration(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration in %q", v)
+			}
+			if m[1] == "-" {
+				d = -d
+			}
+			return now.Add(d), nil
+		}
+		if m := fixtureMoney.FindStringSubmatch(v); m != nil {
+			money, err := ParseMoney(m[1], m[2])
+			if err != nil {
+				return nil, err
+			}
+			return money.Amount, nil
+		}
+		if m := fixtureReference.FindStringSubmatch(v); m != nil {
+			id, ok := refs[m[1]+"."+m[2]]
+			if !ok {
+				return nil, fmt.Errorf("unknown reference %q (the referenced row must be defined earlier)", v)
+			}
+			return id, nil
+		}
+		return nil, fmt.Errorf("unknown directive %q (use @@ for a literal @)", v)
+	}
+	return value, nil
+}
+
+// CLI
+
+// runFixturesCommand จัดการ subcommand `fixtures list | load ENV | reset ENV`
+func runFixturesCommand(args []string) error {
+	usage := errors.New("usage: fixtures list | load ENV | reset ENV")
+	if len(args) == 0 {
+		return usage
+	}
+
+	if args[0] == "list" {
+		names, err := listDatasets(fixtureFiles)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	if len(args) != 2 || (args[0] != "load" && args[0] != "reset") {
+		return usage
+	}
+
+	ds, err := LoadDataset(fixtureFiles, args[1])
+	if err != nil {
+		return err
+	}
+
+	initDatabase()
+	ctx := context.Background()
+	if err := runMigrations(ctx); err != nil {
+		return err
+	}
+
+	loader := NewFixtureLoader(db)
+	var refs FixtureRefs
+	if args[0] == "reset" {
+		refs, err = loader.Reset(ctx, ds)
+	} else {
+		refs, err = loader.Load(ctx, ds)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ Loaded fixtures %q (%s, %d keyed rows)", ds.Name, ds.summary(), len(refs))
+	return nil
+}
+
+func (ds *Dataset) summary() string {
+	parts := make([]string, len(ds.Tables))
+	for i, table := range ds.Tables {
+		parts[i] = fmt.Sprintf("%s: %d", table.Name, len(table.Rows))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// seedData โหลดชุดข้อมูล FIXTURES (ค่าเริ่มต้น dev) ตอน start ถ้า database ยังว่าง
+// FIXTURES=none = ไม่โหลด
+func seedData() {
+	name := os.Getenv("FIXTURES")
+	if name == "" {
+		name = "dev"
+	}
+	if name == "none" {
+		return
+	}
+
+	ds, err := LoadDataset(fixtureFiles, name)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	loaded, err := NewFixtureLoader(db).LoadIfEmpty(context.Background(), ds)
+	if err != nil {
+		log.Fatal("❌ Loading fixtures failed: ", err)
+	}
+	if loaded {
+		log.Printf("✅ Sample data loaded from fixtures %q", name)
+	}
+}
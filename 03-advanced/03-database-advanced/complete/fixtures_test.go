@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFixturesAllDatasetsLoad(t *testing.T) {
+	names, err := listDatasets(fixtureFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no datasets in fixtures/")
+	}
+
+	testDB := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	for _, name := range names {
+		// Reset ซ้ำบน database เดียวกันได้ทุกชุด (ไม่ชน unique จากชุดก่อนหน้า)
+		refs := loadTestFixtures(t, testDB, name)
+		if len(refs) == 0 {
+			t.Errorf("%s: no keyed rows", name)
+		}
+	}
+}
+
+func TestFixturesReferencesAndDirectives(t *testing.T) {
+	testDB := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	ctx := context.Background()
+	refs := loadTestFixtures(t, testDB, "demo")
+
+	// demo include dev: ได้ทั้ง users ของ dev และของ demo
+	for _, ref := range []string{"users.john", "users.jane", "users.somchai", "products.monitor"} {
+		if _, ok := refs[ref]; !ok {
+			t.Errorf("missing %s", ref)
+		}
+	}
+
+	var userID int64
+	var total int64
+	var createdAt time.Time
+	err := testDB.QueryRowContext(ctx, "SELECT user_id, total, created_at FROM orders WHERE id = $1",
+		refs.ID("orders.jane_paid")).Scan(&userID, &total, &createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != refs.ID("users.jane") {
+		t.Errorf("user_id = %d, want %d", userID, refs.ID("users.jane"))
+	}
+	if total != 799000 {
+		t.Errorf("total = %d, want 799000 (@money 7990.00 THB)", total)
+	}
+	if age := time.Since(createdAt); age < 25*time.Hour || age > 27*time.Hour {
+		t.Errorf("created_at is %s ago, want about 26h (@now-26h)", age)
+	}
+
+	var items int
+	if err := testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM order_items WHERE order_id = $1",
+		refs.ID("orders.john_delivered")).Scan(&items); err != nil {
+		t.Fatal(err)
+	}
+	if items != 2 {
+		t.Errorf("john_delivered items = %d, want 2", items)
+	}
+}
+
+func TestFixturesResetRestoresKnownState(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 3})
+	f.createProduct(t, "EXTRA-001", NewMoney(100, "THB"), 1)
+
+	refs := loadTestFixtures(t, f.db, "test")
+
+	// id เริ่มใหม่ และข้อมูลที่เพิ่มหลังโหลดหายไป
+	if refs.ID("users.john") != 1 || refs.ID("products.laptop") != 1 || refs.ID("products.mouse") != 2 {
+		t.Errorf("ids not restarted: %v", refs)
+	}
+	assertStock(t, f.product(t, f.laptop.ID), 10, 0)
+	for _, table := range []string{"orders", "order_items", "stock_reservations", "outbox"} {
+		var n int
+		if err := f.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%s has %d rows after reset", table, n)
+		}
+	}
+	var products int
+	if err := f.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products").Scan(&products); err != nil {
+		t.Fatal(err)
+	}
+	if products != 2 {
+		t.Errorf("products = %d, want 2", products)
+	}
+
+	// audit_log เป็น append-only จึงไม่ถูกล้าง
+	entries, err := (&auditRepository{}).List(ctx, f.db, AuditFilter{EntityType: "product", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Error("audit_log was cleared by reset")
+	}
+}
+
+func TestFixturesLoadIfEmpty(t *testing.T) {
+	testDB := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	ctx := context.Background()
+	ds, err := LoadDataset(fixtureFiles, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewFixtureLoader(testDB)
+	for i, want := range []bool{true, false} {
+		loaded, err := loader.LoadIfEmpty(ctx, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded != want {
+			t.Errorf("run %d: loaded = %v, want %v", i+1, loaded, want)
+		}
+	}
+
+	var users int
+	if err := testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 2 {
+		t.Errorf("users = %d, want 2", users)
+	}
+}
+
+func TestFixturesErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fixtures/cycle_a.yaml":   {Data: []byte("include: cycle_b\n")},
+		"fixtures/cycle_b.yaml":   {Data: []byte("include: [cycle_a]\n")},
+		"fixtures/with_id.yaml":   {Data: []byte("users:\n  - id: 1\n    email: a@example.com\n    name: A\n")},
+		"fixtures/bad_ref.yaml":   {Data: []byte("orders:\n  - user_id: \"@users.nobody\"\n    total: 0\n")},
+		"fixtures/forward.yaml":   {Data: []byte("orders:\n  - user_id: \"@users.john\"\n    total: 0\nusers:\n  - _key: john\n    email: j@example.com\n    name: J\n")},
+		"fixtures/dup_key.yaml":   {Data: []byte("users:\n  - {_key: a, email: a@example.com, name: A}\n  - {_key: a, email: b@example.com, name: B}\n")},
+		"fixtures/directive.yaml": {Data: []byte("users:\n  - {email: \"@someone\", name: A}\n")},
+		"fixtures/escaped.json":   {Data: []byte(`{"users": [{"_key": "at", "email": "@@handle", "name": "At"}]}`)},
+	}
+
+	for _, name := range []string{"cycle_a", "with_id", "missing"} {
+		if _, err := LoadDataset(fsys, name); err == nil {
+			t.Errorf("LoadDataset(%s) succeeded, want error", name)
+		}
+	}
+
+	testDB := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	ctx := context.Background()
+	loader := NewFixtureLoader(testDB)
+	for name, want := range map[string]string{
+		"bad_ref":   "unknown reference",
+		"forward":   "unknown reference",
+		"dup_key":   "duplicate _key",
+		"directive": "unknown directive",
+	} {
+		ds, err := LoadDataset(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loader.Load(ctx, ds); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load(%s) error = %v, want %q", name, err, want)
+		}
+	}
+
+	// ผิดพลาดกลางทาง = ไม่มีอะไรถูกเขียน
+	var users int
+	if err := testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Errorf("users = %d after failed loads, want 0", users)
+	}
+
+	ds, err := LoadDataset(fsys, "escaped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := loader.Load(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var email string
+	if err := testDB.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1", refs.ID("users.at")).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != "@handle" {
+		t.Errorf("email = %q, want @handle", email)
+	}
+}
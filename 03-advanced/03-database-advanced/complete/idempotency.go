@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Idempotency-Key ============
+
+// สถานะของ idempotency key
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord คือ request ที่เคยเห็น key นี้แล้ว พร้อม response ที่เก็บไว้
+type IdempotencyRecord struct {
+	Scope               string
+	Key                 string
+	Fingerprint         string
+	Status              string
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        []byte
+	ExpiresAt           time.Time
+}
+
+// IdempotencyStore ที่เก็บ idempotency keys (แยก interface ไว้เพื่อเปลี่ยนไปใช้ Redis ได้)
+type IdempotencyStore interface {
+	// Begin จอง key ถ้ายังไม่มี, หมดอายุแล้ว หรือค้าง processing นานเกิน lease (acquired = true)
+	// ถ้ามีคนจองอยู่แล้วจะส่ง record เดิมกลับมาแทน
+	Begin(ctx context.Context, scope, key, fingerprint string, ttl, lease time.Duration) (record *IdempotencyRecord, acquired bool, err error)
+	// Complete เก็บ response ของ request ที่จองไว้
+	Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte) error
+	// Release ปล่อย key เมื่อ request ล้มเหลว เพื่อให้ client retry ได้
+	Release(ctx context.Context, scope, key string) error
+	// DeleteExpired ลบ keys ที่หมดอายุแล้ว
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type sqlIdempotencyStore struct {
+	db *DB
+}
+
+func NewSQLIdempotencyStore(db *DB) IdempotencyStore {
+	return &sqlIdempotencyStore{db: db}
+}
+
+func (s *sqlIdempotencyStore) Begin(ctx context.Context, scope, key, fingerprint string, ttl, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	leaseExpiresAt := now.Add(lease)
+
+	// INSERT ใหม่ หรือยึด key ที่หมดอายุแล้ว/ค้าง processing เกิน lease ในคำสั่งเดียว (atomic)
+	// ถ้ามี key ที่ยังไม่หมดอายุจะไม่มีแถวกลับมา
+	var inserted string
+	err := s.db.QueryRowContext(ctx, `INSERT INTO idempotency_keys (scope, key, fingerprint, status, expires_at, processing_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint, status = EXCLUDED.status,
+			response_status = NULL, response_content_type = NULL, response_body = NULL,
+			created_at = $7, expires_at = EXCLUDED.expires_at, processing_expires_at = EXCLUDED.processing_expires_at
+		WHERE idempotency_keys.expires_at < $7
+			OR (idempotency_keys.status = $4 AND idempotency_keys.processing_expires_at < $7)
+		RETURNING key`,
+		scope, key, fingerprint, IdempotencyProcessing, expiresAt, leaseExpiresAt, now).Scan(&inserted)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	record := IdempotencyRecord{Scope: scope, Key: key}
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = s.db.QueryRowContext(ctx, `SELECT fingerprint, status, response_status, response_content_type, response_body, expires_at
+		FROM idempotency_keys WHERE scope = $1 AND key = $2`, scope, key).
+		Scan(&record.Fingerprint, &record.Status, &status, &contentType, &record.ResponseBody, &record.ExpiresAt)
+	if err != nil {
+		return nil, false, err
+	}
+	record.ResponseStatus = int(status.Int64)
+	record.ResponseContentType = contentType.String
+	return &record, false, nil
+}
+
+func (s *sqlIdempotencyStore) Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys
+		SET status = $1, response_status = $2, response_content_type = $3, response_body = $4, processing_expires_at = NULL
+		WHERE scope = $5 AND key = $6`,
+		IdempotencyCompleted, status, contentType, body, scope, key)
+	return err
+}
+
+func (s *sqlIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status = $3",
+		scope, key, IdempotencyProcessing)
+	return err
+}
+
+func (s *sqlIdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	// ใช้เวลาจาก Go แทน NOW() ให้ SQL เดียวกันรันได้ทุก dialect
+	result, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// IdempotencyConfig ตั้งค่า Idempotency middleware
+type IdempotencyConfig struct {
+	Store    IdempotencyStore
+	TTL      time.Duration // เก็บ response ไว้ replay นานเท่าไร
+	Required bool          // true = ไม่มี header ตอบ 400
+	// Lease เวลาที่ key อยู่ในสถานะ processing ได้ก่อนให้ request อื่นยึดต่อ (ค่าเริ่มต้น 1 นาที)
+	// กัน key ค้างทั้ง TTL เมื่อ process ตายก่อน Complete/Release ควรนานกว่าเวลาที่ handler ทำงานจริง
+	Lease time.Duration
+	// Caller ระบุว่าใครเป็นเจ้าของ key (ค่าเริ่มต้น idempotencyCaller)
+	// client สองคนใช้ key เดียวกันได้โดยไม่เห็น response ของกันและกัน
+	Caller func(c *fiber.Ctx) string
+}
+
+// Idempotency middleware ทำให้ POST endpoint ปลอดภัยต่อการ retry ด้วย header Idempotency-Key
+//
+//   - key ใหม่                       → ทำงานตามปกติ แล้วเก็บ response
+//   - key เดิม + body เดิม (เสร็จแล้ว) → ส่ง response เดิมกลับ (Idempotent-Replayed: true)
+//   - key เดิม + กำลังทำงานอยู่        → 409 Conflict
+//   - key เดิม + body ต่างจากเดิม      → 422 Unprocessable Entity
+func Idempotency(config IdempotencyConfig) fiber.Handler {
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.Lease == 0 {
+		config.Lease = time.Minute
+	}
+	if config.Caller == nil {
+		config.Caller = idempotencyCaller
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			if config.Required {
+				return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key header is required"})
+			}
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		// scope แยก key ของแต่ละผู้เรียกและแต่ละ endpoint ออกจากกัน, fingerprint ใช้ตรวจว่า body เหมือนเดิมไหม
+		scope := config.Caller(c) + " " + c.Method() + " " + c.Route().Path
+		sum := sha256.Sum256(append([]byte(c.Method()+" "+c.Path()+"\n"), c.Body()...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		ctx := c.UserContext()
+		record, acquired, err := config.Store.Begin(ctx, scope, key, fingerprint, config.TTL, config.Lease)
+		if err != nil {
+			return err
+		}
+
+		if !acquired {
+			switch {
+			case record.Fingerprint != fingerprint:
+				return c.Status(422).JSON(fiber.Map{"error": "Idempotency-Key was already used with a different request"})
+			case record.Status == IdempotencyProcessing:
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.Status(409).JSON(fiber.Map{"error": "A request with this Idempotency-Key is already in progress"})
+			}
+
+			c.Set("Idempotent-Replayed", "true")
+			if record.ResponseContentType != "" {
+				c.Set(fiber.HeaderContentType, record.ResponseContentType)
+			}
+			return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+		}
+
+		err = c.Next()
+
+		// error หรือ 5xx = ไม่ได้ทำงานสำเร็จ ปล่อย key ให้ retry ได้
+		status := c.Response().StatusCode()
+		if err != nil || status >= 500 {
+			if releaseErr := config.Store.Release(context.Background(), scope, key); releaseErr != nil {
+				log.Printf("Idempotency release error: %v", releaseErr)
+			}
+			return err
+		}
+
+		body := append([]byte(nil), c.Response().Body()...)
+		contentType := string(c.Response().Header.ContentType())
+		if err := config.Store.Complete(context.Background(), scope, key, status, contentType, body); err != nil {
+			log.Printf("Idempotency complete error: %v", err)
+		}
+		return nil
+	}
+}
+
+// idempotencyCaller ใช้ actor เดียวกับ audit log (Locals "actor" หรือ "user_id" จาก auth middleware)
+// ไม่มี identity = แยกตาม IP ของ client
+func idempotencyCaller(c *fiber.Ctx) string {
+	if actor, ok := c.Locals("actor").(string); ok && actor != "" {
+		return actor
+	}
+	if userID := c.Locals("user_id"); userID != nil {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return "ip:" + c.IP()
+}
+
+// startIdempotencyCleanup ลบ keys ที่หมดอายุเป็นระยะ
+func startIdempotencyCleanup(store IdempotencyStore, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := store.DeleteExpired(context.Background()); err != nil {
+				log.Printf("Idempotency cleanup error: %v", err)
+			} else if n > 0 {
+				log.Printf("🧹 Removed %d expired idempotency keys", n)
+			}
+		}
+	}()
+}
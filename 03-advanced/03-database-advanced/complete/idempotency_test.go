@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newIdempotencyApp สร้าง app ที่มีแค่ Idempotency middleware หน้า handler ที่นับจำนวนครั้งที่ถูกเรียก
+// header X-Test-Actor จำลอง auth middleware, body "fail" ตอบ 500, body "block" รอจนกว่า release จะถูกปิด
+func newIdempotencyApp(t *testing.T) (*fiber.App, *int32, chan struct{}) {
+	t.Helper()
+	f := newTestFixture(t)
+	calls := new(int32)
+	release := make(chan struct{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if actor := c.Get("X-Test-Actor"); actor != "" {
+			c.Locals("actor", actor)
+		}
+		return c.Next()
+	})
+	app.Post("/orders", Idempotency(IdempotencyConfig{Store: NewSQLIdempotencyStore(f.db), TTL: time.Hour}),
+		func(c *fiber.Ctx) error {
+			n := atomic.AddInt32(calls, 1)
+			switch string(c.Body()) {
+			case "fail":
+				return c.Status(500).JSON(fiber.Map{"error": "boom"})
+			case "block":
+				<-release
+			}
+			return c.Status(201).JSON(fiber.Map{"call": n})
+		})
+	return app, calls, release
+}
+
+type idempotencyResponse struct {
+	status   int
+	body     string
+	replayed bool
+}
+
+func postOrder(t *testing.T, app *fiber.App, actor, key, body string) idempotencyResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	if actor != "" {
+		req.Header.Set("X-Test-Actor", actor)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return idempotencyResponse{status: resp.StatusCode, body: string(data), replayed: resp.Header.Get("Idempotent-Replayed") == "true"}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	app, calls, _ := newIdempotencyApp(t)
+
+	for _, step := range []struct {
+		name     string
+		actor    string
+		key      string
+		body     string
+		status   int
+		replayed bool
+		calls    int32 // จำนวนครั้งที่ handler ถูกเรียกสะสมหลัง step นี้
+	}{
+		{"first request", "user:1", "k1", "a", 201, false, 1},
+		{"replay", "user:1", "k1", "a", 201, true, 1},
+		{"different body", "user:1", "k1", "b", 422, false, 1},
+		{"same key other caller", "user:2", "k1", "a", 201, false, 2},
+		{"same key anonymous", "", "k1", "a", 201, false, 3},
+		{"failure", "user:1", "k2", "fail", 500, false, 4},
+		{"retry after failure", "user:1", "k2", "fail", 500, false, 5},
+	} {
+		resp := postOrder(t, app, step.actor, step.key, step.body)
+		if resp.status != step.status || resp.replayed != step.replayed {
+			t.Errorf("%s: status = %d replayed = %v, want %d %v (body %s)",
+				step.name, resp.status, resp.replayed, step.status, step.replayed, resp.body)
+		}
+		if got := atomic.LoadInt32(calls); got != step.calls {
+			t.Errorf("%s: handler called %d times, want %d", step.name, got, step.calls)
+		}
+	}
+
+	if first, replay := postOrder(t, app, "user:2", "k1", "a"), postOrder(t, app, "user:2", "k1", "a"); first.body != replay.body {
+		t.Errorf("replayed body = %s, want %s", replay.body, first.body)
+	}
+}
+
+func TestIdempotencyMiddlewareInFlight(t *testing.T) {
+	app, calls, release := newIdempotencyApp(t)
+
+	done := make(chan idempotencyResponse)
+	go func() { done <- postOrder(t, app, "user:1", "k1", "block") }()
+
+	// รอให้ request แรกจอง key และเข้า handler ก่อน
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(calls) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first request never reached the handler")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if resp := postOrder(t, app, "user:1", "k1", "block"); resp.status != 409 {
+		t.Errorf("concurrent request: status = %d, want 409", resp.status)
+	}
+	close(release)
+
+	if resp := <-done; resp.status != 201 {
+		t.Errorf("first request: status = %d, want 201", resp.status)
+	}
+	if resp := postOrder(t, app, "user:1", "k1", "block"); resp.status != 201 || !resp.replayed {
+		t.Errorf("after completion: status = %d replayed = %v, want replay of 201", resp.status, resp.replayed)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("handler called %d times, want 1", got)
+	}
+}
+
+func TestIdempotencyStoreProcessingLease(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	store := NewSQLIdempotencyStore(f.db)
+
+	for _, step := range []struct {
+		name     string
+		key      string
+		lease    time.Duration
+		complete bool // Complete หลัง Begin สำเร็จ
+		acquired bool
+		status   string // สถานะของ record เดิมเมื่อจองไม่ได้
+	}{
+		{"first request", "k1", time.Minute, false, true, ""},
+		{"lease still held", "k1", time.Minute, false, false, IdempotencyProcessing},
+		// process แรกตายระหว่างทำงาน: lease หมดก่อน TTL (1 ชั่วโมง) มาก
+		{"crashed owner", "k2", -time.Second, false, true, ""},
+		{"takeover after lease", "k2", time.Minute, true, true, ""},
+		{"completed is replayed", "k2", time.Minute, false, false, IdempotencyCompleted},
+		// lease ใช้กับ processing เท่านั้น response ที่เก็บไว้ยังอยู่จนครบ TTL
+		{"completed ignores lease", "k3", -time.Second, true, true, ""},
+		{"completed after lease", "k3", time.Minute, false, false, IdempotencyCompleted},
+	} {
+		record, acquired, err := store.Begin(ctx, "orders", step.key, "fp", time.Hour, step.lease)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if acquired != step.acquired {
+			t.Errorf("%s: acquired = %v, want %v", step.name, acquired, step.acquired)
+			continue
+		}
+		if !acquired && record.Status != step.status {
+			t.Errorf("%s: status = %s, want %s", step.name, record.Status, step.status)
+		}
+		if acquired && step.complete {
+			if err := store.Complete(ctx, "orders", step.key, 201, "application/json", []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
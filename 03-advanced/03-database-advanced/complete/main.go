@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
@@ -20,63 +28,75 @@ type User struct {
 }
 
 type Product struct {
-	ID    int     `json:"id" db:"id"`
-	Name  string  `json:"name" db:"name"`
-	Price float64 `json:"price" db:"price"`
-	Stock int     `json:"stock" db:"stock"`
+	ID        int    `json:"id" db:"id"`
+	SKU       string `json:"sku" db:"sku"`
+	Name      string `json:"name" db:"name"`
+	Category  string `json:"category" db:"category"`
+	Price     Money  `json:"price" db:"price"`       // db: หน่วยย่อย + column currency
+	Stock     int    `json:"stock" db:"stock"`       // ของในคลังจริง
+	Reserved  int    `json:"reserved" db:"reserved"` // ถูกจองโดย orders ที่ยังไม่จ่ายเงิน
+	Available int    `json:"available" db:"-"`       // stock - reserved = ขายได้อีกเท่าไร
 }
 
 type Order struct {
-	ID        int       `json:"id" db:"id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	Total     float64   `json:"total" db:"total"`
-	Status    string    `json:"status" db:"status"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int         `json:"id" db:"id"`
+	UserID    int         `json:"user_id" db:"user_id"`
+	Total     Money       `json:"total" db:"total"`
+	Status    OrderStatus `json:"status" db:"status"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
 }
 
 type OrderItem struct {
-	ID        int     `json:"id" db:"id"`
-	OrderID   int     `json:"order_id" db:"order_id"`
-	ProductID int     `json:"product_id" db:"product_id"`
-	Quantity  int     `json:"quantity" db:"quantity"`
-	Price     float64 `json:"price" db:"price"`
+	ID        int   `json:"id" db:"id"`
+	OrderID   int   `json:"order_id" db:"order_id"`
+	ProductID int   `json:"product_id" db:"product_id"`
+	Quantity  int   `json:"quantity" db:"quantity"`
+	Price     Money `json:"price" db:"price"` // ราคาต่อชิ้น ณ ตอนสั่ง (สกุลเงินตาม order)
 }
 
 // Repository Interfaces
+// ทุก method รับ context และ DBTX (*DB หรือ *Tx) เพื่อให้ service เป็นคนเลือกว่าจะรันใน transaction ไหน
 type UserRepository interface {
-	GetAll() ([]User, error)
-	GetByID(id int) (*User, error)
-	Create(user *User) error
+	GetAll(ctx context.Context, q DBTX) ([]User, error)
+	GetByID(ctx context.Context, q DBTX, id int) (*User, error)
+	Create(ctx context.Context, q DBTX, user *User) error
 }
 
 type ProductRepository interface {
-	GetAll() ([]Product, error)
-	GetByID(id int) (*Product, error)
-	UpdateStock(id int, newStock int) error
+	Search(ctx context.Context, q DBTX, filter ProductFilter) ([]Product, error)
+	GetByID(ctx context.Context, q DBTX, id int) (*Product, error)
+	GetByIDForUpdate(ctx context.Context, q DBTX, id int) (*Product, error)
+	Create(ctx context.Context, q DBTX, product *Product) error
+	Update(ctx context.Context, q DBTX, product *Product) error
+	Delete(ctx context.Context, q DBTX, id int) error
+	Reserve(ctx context.Context, q DBTX, id int, quantity int) error
+	ReleaseReserved(ctx context.Context, q DBTX, id int, quantity int) error
+	CommitReserved(ctx context.Context, q DBTX, id int, quantity int) error
+	RestockOrder(ctx context.Context, q DBTX, orderID int) error
 }
 
 type OrderRepository interface {
-	Create(order *Order) error
-	GetByID(id int) (*Order, error)
-	CreateOrderItem(item *OrderItem) error
+	Create(ctx context.Context, q DBTX, order *Order) error
+	GetByID(ctx context.Context, q DBTX, id int) (*Order, error)
+	GetByIDForUpdate(ctx context.Context, q DBTX, id int) (*Order, error)
+	UpdateStatus(ctx context.Context, q DBTX, id int, from, to OrderStatus) error
+	CreateOrderItem(ctx context.Context, q DBTX, item *OrderItem) error
+	AddStatusChange(ctx context.Context, q DBTX, change *OrderStatusChange) error
+	StatusHistory(ctx context.Context, q DBTX, orderID int) ([]OrderStatusChange, error)
+	List(ctx context.Context, q DBTX, filter OrderFilter) ([]Order, error)
+	ItemsForOrders(ctx context.Context, q DBTX, orderIDs []int) (map[int][]OrderItemDetail, error)
 }
 
-// Repository Implementations
-type userRepository struct {
-	db *sql.DB
-}
+// Repository Implementations (ไม่เก็บ connection เอง ใช้ DBTX ที่ส่งเข้ามา)
+type userRepository struct{}
 
-type productRepository struct {
-	db *sql.DB
-}
+type productRepository struct{}
 
-type orderRepository struct {
-	db *sql.DB
-}
+type orderRepository struct{}
 
 // User Repository Implementation
-func (r *userRepository) GetAll() ([]User, error) {
-	rows, err := r.db.Query("SELECT id, email, name, created_at FROM users ORDER BY id")
+func (r *userRepository) GetAll(ctx context.Context, q DBTX) ([]User, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, email, name, created_at FROM users ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
@@ -91,12 +111,12 @@ func (r *userRepository) GetAll() ([]User, error) {
 		}
 		users = append(users, user)
 	}
-	return users, nil
+	return users, rows.Err()
 }
 
-func (r *userRepository) GetByID(id int) (*User, error) {
+func (r *userRepository) GetByID(ctx context.Context, q DBTX, id int) (*User, error) {
 	var user User
-	err := r.db.QueryRow("SELECT id, email, name, created_at FROM users WHERE id = $1", id).
+	err := q.QueryRowContext(ctx, "SELECT id, email, name, created_at FROM users WHERE id = $1", id).
 		Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt)
 	if err != nil {
 		return nil, err
@@ -104,144 +124,397 @@ func (r *userRepository) GetByID(id int) (*User, error) {
 	return &user, nil
 }
 
-func (r *userRepository) Create(user *User) error {
-	return r.db.QueryRow(
+func (r *userRepository) Create(ctx context.Context, q DBTX, user *User) error {
+	if err := q.QueryRowContext(ctx,
 		"INSERT INTO users (email, name) VALUES ($1, $2) RETURNING id, created_at",
 		user.Email, user.Name,
-	).Scan(&user.ID, &user.CreatedAt)
+	).Scan(&user.ID, &user.CreatedAt); err != nil {
+		return err
+	}
+	return recordAudit(ctx, q, "user", user.ID, AuditCreate, nil, user)
 }
 
 // Product Repository Implementation
-func (r *productRepository) GetAll() ([]Product, error) {
-	rows, err := r.db.Query("SELECT id, name, price, stock FROM products ORDER BY id")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+const productColumns = "id, sku, name, category, price, currency, stock, reserved"
 
-	var products []Product
-	for rows.Next() {
-		var product Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Stock)
-		if err != nil {
-			return nil, err
-		}
-		products = append(products, product)
-	}
-	return products, nil
-}
-
-func (r *productRepository) GetByID(id int) (*Product, error) {
+func scanProduct(row interface {
+	Scan(dest ...interface{}) error
+}) (*Product, error) {
 	var product Product
-	err := r.db.QueryRow("SELECT id, name, price, stock FROM products WHERE id = $1", id).
-		Scan(&product.ID, &product.Name, &product.Price, &product.Stock)
+	err := row.Scan(&product.ID, &product.SKU, &product.Name, &product.Category,
+		&product.Price, &product.Price.Currency, &product.Stock, &product.Reserved)
 	if err != nil {
 		return nil, err
 	}
+	product.Available = product.Stock - product.Reserved
 	return &product, nil
 }
 
-func (r *productRepository) UpdateStock(id int, newStock int) error {
-	_, err := r.db.Exec("UPDATE products SET stock = $1 WHERE id = $2", newStock, id)
+func (r *productRepository) GetByID(ctx context.Context, q DBTX, id int) (*Product, error) {
+	return scanProduct(q.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE id = $1", id))
+}
+
+// GetByIDForUpdate อ่านพร้อม lock แถว (ต้องเรียกใน transaction)
+func (r *productRepository) GetByIDForUpdate(ctx context.Context, q DBTX, id int) (*Product, error) {
+	return scanProduct(q.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE id = $1 FOR UPDATE", id))
+}
+
+// RestockOrder คืน stock ของทุก item ใน order
+func (r *productRepository) RestockOrder(ctx context.Context, q DBTX, orderID int) error {
+	// รวม quantity ต่อ product ก่อน เพราะ UPDATE ... FROM จะ apply แค่แถวเดียวต่อ product
+	// (ใช้ AS เต็มรูปเพราะ SQLite ไม่รับ alias แบบไม่มี AS ใน UPDATE)
+	_, err := q.ExecContext(ctx, `UPDATE products AS p SET stock = p.stock + items.quantity
+		FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items
+		      WHERE order_id = $1 GROUP BY product_id) AS items
+		WHERE p.id = items.product_id`, orderID)
 	return err
 }
 
 // Order Repository Implementation
-func (r *orderRepository) Create(order *Order) error {
-	return r.db.QueryRow(
-		"INSERT INTO orders (user_id, total, status) VALUES ($1, $2, $3) RETURNING id, created_at",
-		order.UserID, order.Total, order.Status,
-	).Scan(&order.ID, &order.CreatedAt)
-}
+const orderColumns = "id, user_id, total, currency, status, created_at"
 
-func (r *orderRepository) GetByID(id int) (*Order, error) {
+func scanOrder(row interface {
+	Scan(dest ...interface{}) error
+}) (*Order, error) {
 	var order Order
-	err := r.db.QueryRow("SELECT id, user_id, total, status, created_at FROM orders WHERE id = $1", id).
-		Scan(&order.ID, &order.UserID, &order.Total, &order.Status, &order.CreatedAt)
+	err := row.Scan(&order.ID, &order.UserID, &order.Total, &order.Total.Currency, &order.Status, &order.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &order, nil
 }
 
-func (r *orderRepository) CreateOrderItem(item *OrderItem) error {
-	return r.db.QueryRow(
+func (r *orderRepository) Create(ctx context.Context, q DBTX, order *Order) error {
+	if err := q.QueryRowContext(ctx,
+		"INSERT INTO orders (user_id, total, currency, status) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		order.UserID, order.Total, order.Total.Currency, order.Status,
+	).Scan(&order.ID, &order.CreatedAt); err != nil {
+		return err
+	}
+	return recordAudit(ctx, q, "order", order.ID, AuditCreate, nil, order)
+}
+
+func (r *orderRepository) GetByID(ctx context.Context, q DBTX, id int) (*Order, error) {
+	return scanOrder(q.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", id))
+}
+
+// GetByIDForUpdate อ่านพร้อม lock แถว (ต้องเรียกใน transaction)
+func (r *orderRepository) GetByIDForUpdate(ctx context.Context, q DBTX, id int) (*Order, error) {
+	return scanOrder(q.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", id))
+}
+
+// UpdateStatus เปลี่ยนสถานะ (from คือสถานะปัจจุบันที่ผู้เรียกอ่านและ lock ไว้แล้ว ใช้บันทึก audit)
+func (r *orderRepository) UpdateStatus(ctx context.Context, q DBTX, id int, from, to OrderStatus) error {
+	if _, err := q.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2", to, id); err != nil {
+		return err
+	}
+	return recordAudit(ctx, q, "order", id, AuditUpdate,
+		map[string]OrderStatus{"status": from}, map[string]OrderStatus{"status": to})
+}
+
+func (r *orderRepository) CreateOrderItem(ctx context.Context, q DBTX, item *OrderItem) error {
+	return q.QueryRowContext(ctx,
 		"INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4) RETURNING id",
 		item.OrderID, item.ProductID, item.Quantity, item.Price,
 	).Scan(&item.ID)
 }
 
+func (r *orderRepository) AddStatusChange(ctx context.Context, q DBTX, change *OrderStatusChange) error {
+	return q.QueryRowContext(ctx,
+		"INSERT INTO order_status_history (order_id, from_status, to_status, note) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		change.OrderID, change.FromStatus, change.ToStatus, change.Note,
+	).Scan(&change.ID, &change.CreatedAt)
+}
+
+func (r *orderRepository) StatusHistory(ctx context.Context, q DBTX, orderID int) ([]OrderStatusChange, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, order_id, from_status, to_status, note, created_at
+		FROM order_status_history WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []OrderStatusChange{}
+	for rows.Next() {
+		var change OrderStatusChange
+		if err := rows.Scan(&change.ID, &change.OrderID, &change.FromStatus, &change.ToStatus,
+			&change.Note, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
 // Service Layer
 type OrderService struct {
-	db          *sql.DB
-	orderRepo   OrderRepository
-	productRepo ProductRepository
+	db              DBTX // อ่านผ่าน router (replica ได้) ส่วนการเขียนทำใน tx บน primary
+	tx              *TxManager
+	orderRepo       OrderRepository
+	productRepo     ProductRepository
+	reservationRepo ReservationRepository
+	outboxRepo      OutboxRepository
+	couponRepo      CouponRepository
+	reservationTTL  time.Duration
+	lowStockLevel   int // available ต่ำกว่านี้ = ส่ง StockLow
+}
+
+func NewOrderService(router *DBRouter) *OrderService {
+	return &OrderService{
+		db:              router,
+		tx:              NewTxManager(router.Primary()),
+		orderRepo:       &orderRepository{},
+		productRepo:     &productRepository{},
+		reservationRepo: &reservationRepository{},
+		outboxRepo:      &outboxRepository{},
+		couponRepo:      &couponRepository{},
+		reservationTTL:  15 * time.Minute,
+		lowStockLevel:   defaultLowStockLevel,
+	}
 }
 
-func NewOrderService(db *sql.DB) *OrderService {
-	return &OrderService{
-		db:          db,
-		orderRepo:   &orderRepository{db: db},
-		productRepo: &productRepository{db: db},
-	}
-}
-
-// Migration System
-type Migration struct {
-	Version string
-	Up      string
-	Down    string
-}
-
-var migrations = []Migration{
-	{
-		Version: "001_create_users",
-		Up: `CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			name VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT NOW()
-		)`,
-		Down: `DROP TABLE IF EXISTS users`,
-	},
-	{
-		Version: "002_create_products",
-		Up: `CREATE TABLE IF NOT EXISTS products (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			price DECIMAL(10,2) NOT NULL,
-			stock INTEGER NOT NULL DEFAULT 0,
-			created_at TIMESTAMP DEFAULT NOW()
-		)`,
-		Down: `DROP TABLE IF EXISTS products`,
-	},
-	{
-		Version: "003_create_orders",
-		Up: `CREATE TABLE IF NOT EXISTS orders (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id),
-			total DECIMAL(10,2) NOT NULL,
-			status VARCHAR(50) DEFAULT 'pending',
-			created_at TIMESTAMP DEFAULT NOW()
-		)`,
-		Down: `DROP TABLE IF EXISTS orders`,
-	},
-	{
-		Version: "004_create_order_items",
-		Up: `CREATE TABLE IF NOT EXISTS order_items (
-			id SERIAL PRIMARY KEY,
-			order_id INTEGER REFERENCES orders(id),
-			product_id INTEGER REFERENCES products(id),
-			quantity INTEGER NOT NULL,
-			price DECIMAL(10,2) NOT NULL
-		)`,
-		Down: `DROP TABLE IF EXISTS order_items`,
-	},
-}
-
-var db *sql.DB
+var (
+	ErrInvalidOrder      = errors.New("order must have at least one item with quantity > 0")
+	ErrProductNotFound   = errors.New("product not found")
+	ErrInsufficientStock = errors.New("insufficient stock for product")
+)
+
+// PlaceOrderRequest ข้อมูลสำหรับสร้าง order
+type PlaceOrderRequest struct {
+	UserID     int                     `json:"user_id"`
+	Items      []PlaceOrderItemRequest `json:"items"`
+	CouponCode string                  `json:"coupon_code,omitempty"`
+}
+
+type PlaceOrderItemRequest struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// OrderQuote ราคาของ order: ยอดก่อนส่วนลด ส่วนลดแต่ละบรรทัด และยอดที่ต้องจ่าย
+type OrderQuote struct {
+	Items     []OrderItem     `json:"items"`
+	Subtotal  Money           `json:"subtotal"`
+	Discounts []OrderDiscount `json:"discounts"`
+	Total     Money           `json:"total"`
+}
+
+// PlacedOrder ผลลัพธ์ของ PlaceOrder
+type PlacedOrder struct {
+	Order
+	Items         []OrderItem     `json:"items"`
+	Subtotal      Money           `json:"subtotal"`
+	Discounts     []OrderDiscount `json:"discounts"`
+	ReservedUntil time.Time       `json:"reserved_until"` // ต้องจ่ายเงินก่อนเวลานี้ ไม่งั้น order ถูกยกเลิก
+}
+
+// PlaceOrder ตรวจ stock, จอง stock, ใช้คูปอง, สร้าง order และ items ใน transaction เดียว
+// stock จะถูกตัดจริงตอนจ่ายเงิน (pending → paid) ถ้าไม่จ่ายภายใน reservationTTL ระบบจะยกเลิกให้
+func (s *OrderService) PlaceOrder(ctx context.Context, req PlaceOrderRequest) (*PlacedOrder, error) {
+	lines, err := normalizeOrderItems(req.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	var order *Order
+	var quote *OrderQuote
+	var expiresAt time.Time
+	err = s.tx.WithTx(ctx, nil, func(tx *Tx) error {
+		// เริ่มใหม่ทุกครั้งที่ retry
+		var products []*Product
+		var coupon *Coupon
+		var err error
+		quote, products, coupon, err = s.priceOrder(ctx, tx, req.UserID, lines, req.CouponCode, true)
+		if err != nil {
+			return err
+		}
+		order = &Order{UserID: req.UserID, Total: quote.Total, Status: OrderStatusPending}
+
+		// ยังไม่ตัด stock จริง แค่จองไว้จนกว่าจะจ่ายเงินหรือหมดเวลา
+		var lowStock []StockLowEvent
+		for i, product := range products {
+			quantity := quote.Items[i].Quantity
+			if err := s.productRepo.Reserve(ctx, tx, product.ID, quantity); err != nil {
+				return err
+			}
+			// แจ้งเฉพาะตอนเพิ่งลดลงต่ำกว่าเกณฑ์ ไม่แจ้งซ้ำทุกออเดอร์
+			if remaining := product.Available - quantity; product.Available >= s.lowStockLevel && remaining < s.lowStockLevel {
+				lowStock = append(lowStock, StockLowEvent{
+					ProductID: product.ID, SKU: product.SKU, Available: remaining, Threshold: s.lowStockLevel,
+				})
+			}
+		}
+
+		if err := s.orderRepo.Create(ctx, tx, order); err != nil {
+			return err
+		}
+		expiresAt = time.Now().Add(s.reservationTTL)
+		items := quote.Items
+		for i := range items {
+			items[i].OrderID = order.ID
+			if err := s.orderRepo.CreateOrderItem(ctx, tx, &items[i]); err != nil {
+				return err
+			}
+			if err := s.reservationRepo.Create(ctx, tx, &StockReservation{
+				OrderID:   order.ID,
+				ProductID: items[i].ProductID,
+				Quantity:  items[i].Quantity,
+				Status:    ReservationActive,
+				ExpiresAt: expiresAt,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// ส่วนลดและการใช้คูปองบันทึกพร้อม order: ถ้า rollback สิทธิ์คูปองก็ไม่ถูกใช้
+		for i := range quote.Discounts {
+			quote.Discounts[i].OrderID = order.ID
+			if err := s.couponRepo.AddOrderDiscount(ctx, tx, &quote.Discounts[i]); err != nil {
+				return err
+			}
+		}
+		if coupon != nil {
+			if err := s.couponRepo.Redeem(ctx, tx, coupon.ID, order.ID, order.UserID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orderRepo.AddStatusChange(ctx, tx, &OrderStatusChange{
+			OrderID:  order.ID,
+			ToStatus: OrderStatusPending,
+			Note:     "order created",
+		}); err != nil {
+			return err
+		}
+
+		// events เขียนใน transaction เดียวกับ order: commit พร้อมกันหรือหายไปพร้อมกัน
+		if err := s.recordEvent(ctx, tx, "order", order.ID, EventOrderPlaced, OrderPlacedEvent{
+			OrderID: order.ID, UserID: order.UserID, Total: order.Total, Items: items, Discounts: quote.Discounts,
+		}); err != nil {
+			return err
+		}
+		for _, event := range lowStock {
+			if err := s.recordEvent(ctx, tx, "product", event.ProductID, EventStockLow, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PlacedOrder{
+		Order: *order, Items: quote.Items, Subtotal: quote.Subtotal, Discounts: quote.Discounts, ReservedUntil: expiresAt,
+	}, nil
+}
+
+// QuoteOrder คำนวณราคาและส่วนลดแบบเดียวกับ PlaceOrder โดยไม่สร้าง order ไม่จอง stock และไม่ใช้สิทธิ์คูปอง
+// (ราคาอาจเปลี่ยนได้ก่อนสั่งจริง ถ้า stock หรือสิทธิ์คูปองถูกใช้ไประหว่างนั้น)
+func (s *OrderService) QuoteOrder(ctx context.Context, req PlaceOrderRequest) (*OrderQuote, error) {
+	lines, err := normalizeOrderItems(req.Items)
+	if err != nil {
+		return nil, err
+	}
+	quote, _, _, err := s.priceOrder(ctx, s.db, req.UserID, lines, req.CouponCode, false)
+	return quote, err
+}
+
+// priceOrder อ่านสินค้าตามลำดับ lines ตรวจ stock คำนวณยอดรวม แล้วหักส่วนลดจากคูปอง
+// forUpdate = lock แถวสินค้าและคูปองไว้จนจบ transaction (PlaceOrder) คืน products ตามลำดับเดียวกับ quote.Items
+func (s *OrderService) priceOrder(ctx context.Context, q DBTX, userID int, lines []PlaceOrderItemRequest,
+	couponCode string, forUpdate bool) (*OrderQuote, []*Product, *Coupon, error) {
+	getProduct := s.productRepo.GetByID
+	if forUpdate {
+		getProduct = s.productRepo.GetByIDForUpdate
+	}
+
+	quote := &OrderQuote{Items: make([]OrderItem, 0, len(lines))}
+	products := make([]*Product, 0, len(lines))
+	for _, line := range lines {
+		product, err := getProduct(ctx, q, line.ProductID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil, fmt.Errorf("%w: %d", ErrProductNotFound, line.ProductID)
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if product.Available < line.Quantity {
+			return nil, nil, nil, fmt.Errorf("%w: %d (requested %d, available %d)",
+				ErrInsufficientStock, product.ID, line.Quantity, product.Available)
+		}
+
+		// order หนึ่งใช้สกุลเงินเดียว ตามสินค้าชิ้นแรก
+		if len(quote.Items) == 0 {
+			quote.Subtotal = product.Price.Zero()
+		}
+		lineTotal, err := product.Price.Mul(int64(line.Quantity))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if quote.Subtotal, err = quote.Subtotal.Add(lineTotal); errors.Is(err, ErrCurrencyMismatch) {
+			return nil, nil, nil, fmt.Errorf("%w: products must share one currency (%v)", ErrInvalidOrder, err)
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+		quote.Items = append(quote.Items, OrderItem{ProductID: product.ID, Quantity: line.Quantity, Price: product.Price})
+		products = append(products, product)
+	}
+
+	coupon, discounts, err := s.applyCoupon(ctx, q, couponCode, userID, quote.Items, quote.Subtotal, forUpdate)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	quote.Discounts = discounts
+	quote.Total = quote.Subtotal
+	for _, discount := range discounts {
+		if quote.Total, err = quote.Total.Sub(discount.Amount); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return quote, products, coupon, nil
+}
+
+// normalizeOrderItems รวม product ที่ซ้ำกันและเรียงตาม product_id
+// การ lock แถวตามลำดับเดียวกันทุก transaction ช่วยลดโอกาส deadlock
+func normalizeOrderItems(reqItems []PlaceOrderItemRequest) ([]PlaceOrderItemRequest, error) {
+	quantities := make(map[int]int)
+	for _, item := range reqItems {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidOrder
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	if len(quantities) == 0 {
+		return nil, ErrInvalidOrder
+	}
+
+	lines := make([]PlaceOrderItemRequest, 0, len(quantities))
+	for productID, quantity := range quantities {
+		lines = append(lines, PlaceOrderItemRequest{ProductID: productID, Quantity: quantity})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].ProductID < lines[j].ProductID })
+	return lines, nil
+}
+
+var db *DB
 
 func main() {
+	// go run . migrate up|down N|status|redo|create NAME
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatal("❌ ", err)
+		}
+		return
+	}
+
+	// go run . fixtures list|load ENV|reset ENV
+	if len(os.Args) > 1 && os.Args[1] == "fixtures" {
+		if err := runFixturesCommand(os.Args[2:]); err != nil {
+			log.Fatal("❌ ", err)
+		}
+		return
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(500).JSON(fiber.Map{
@@ -252,20 +525,42 @@ func main() {
 	})
 
 	app.Use(logger.New())
+	app.Use(requestTimeout(10 * time.Second))
 
 	// เชื่อมต่อ Database
 	initDatabase()
 
-	// รัน Migrations
-	runMigrations()
+	// รัน Migrations (ถ้า migration ที่ apply ไปแล้วถูกแก้ไข จะไม่ยอม start)
+	if err := runMigrations(context.Background()); err != nil {
+		log.Fatal("❌ Migration failed: ", err)
+	}
 
-	// เตรียมข้อมูลตัวอย่าง
+	// เตรียมข้อมูลตัวอย่างจาก fixtures (เฉพาะตอน database ยังว่าง)
 	seedData()
 
+	// อ่านจาก replicas (ถ้ามี) เขียนที่ primary
+	router := NewDBRouter(db, openReplicas()...)
+	router.StartHealthChecks(5 * time.Second)
+	app.Use(readYourWrites(router))
+
+	// ทุก request มี request ID และข้อมูลผู้ทำรายการสำหรับ audit log
+	app.Use(requestid.New())
+	app.Use(identify())
+	app.Use(auditContext())
+
 	// สร้าง repositories
-	userRepo := &userRepository{db: db}
-	productRepo := &productRepository{db: db}
-	orderService := NewOrderService(db)
+	userRepo := &userRepository{}
+	productRepo := &productRepository{}
+	auditRepo := &auditRepository{}
+	couponRepo := &couponRepository{}
+	txm := NewTxManager(db)
+	orderService := NewOrderService(router)
+	idempotencyStore := NewSQLIdempotencyStore(db)
+	startIdempotencyCleanup(idempotencyStore, 10*time.Minute)
+	orderService.StartReservationSweeper(30 * time.Second)
+	NewOutboxRelay(db, newOutboxPublisher()).Start(2 * time.Second)
+	reportService := NewReportService(router)
+	reportService.StartRefresher(time.Minute)
 
 	// Basic routes
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -277,7 +572,7 @@ func main() {
 
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
-		err := db.Ping()
+		err := db.PingContext(c.UserContext())
 		if err != nil {
 			return c.Status(503).JSON(fiber.Map{
 				"status":   "unhealthy",
@@ -289,80 +584,119 @@ func main() {
 		return c.JSON(fiber.Map{
 			"status":   "healthy",
 			"database": "connected",
+			"replicas": router.ReplicaStatus(),
 			"time":     time.Now(),
 		})
 	})
 
 	// API routes
-	app.Get("/users", getUsersHandler(userRepo))
-	app.Post("/users", createUserHandler(userRepo))
-	app.Get("/products", getProductsHandler(productRepo))
-	app.Post("/orders", createOrderHandler(orderService))
-	app.Get("/orders/:id", getOrderHandler(orderService.orderRepo))
-	app.Post("/migrate", runMigrationsHandler)
+	app.Get("/users", getUsersHandler(router, userRepo))
+	app.Post("/users", createUserHandler(txm, userRepo))
+	app.Get("/products", searchProductsHandler(router, productRepo))
+	app.Get("/products/:id", getProductHandler(router, productRepo))
+	app.Post("/products", adminOnly(), createProductHandler(txm, productRepo))
+	app.Put("/products/:id", adminOnly(), updateProductHandler(txm, productRepo))
+	app.Delete("/products/:id", adminOnly(), deleteProductHandler(txm, productRepo))
+	app.Post("/orders", Idempotency(IdempotencyConfig{Store: idempotencyStore, TTL: 24 * time.Hour}),
+		createOrderHandler(orderService))
+	app.Post("/orders/quote", quoteOrderHandler(orderService))
+	app.Get("/users/:id/orders", getUserOrdersHandler(router, userRepo, orderService))
+	app.Get("/orders", listOrdersHandler(orderService))
+	app.Get("/orders/:id", getOrderHandler(orderService))
+	app.Patch("/orders/:id/status", updateOrderStatusHandler(orderService))
+	app.Get("/orders/:id/history", getOrderHistoryHandler(orderService))
+	app.Get("/coupons", adminOnly(), listCouponsHandler(router, couponRepo))
+	app.Post("/coupons", adminOnly(), createCouponHandler(txm, couponRepo))
+	app.Get("/audit", adminOnly(), listAuditHandler(router, auditRepo))
+	app.Get("/reports/sales", adminOnly(), salesReportHandler(reportService))
+	app.Get("/migrate/status", adminOnly(), migrationStatusHandler)
+	app.Post("/migrate", adminOnly(), runMigrationsHandler)
 
 	log.Println("🚀 Database Advanced API started on port 3000")
-	log.Println("🗄️ PostgreSQL connected successfully")
+	log.Printf("🗄️ %s connected successfully", db.Dialect().Name())
 	log.Fatal(app.Listen(":3000"))
 }
 
-// initDatabase เชื่อมต่อ PostgreSQL
+// defaultDSNs connection string เริ่มต้นของแต่ละ dialect (override ด้วย DATABASE_URL)
+// SQLite: WAL ให้อ่านได้ระหว่างมีคนเขียน, busy_timeout รอ lock แทนที่จะ error ทันที,
+// _txlock=immediate จอง write lock ตั้งแต่ BEGIN (ดู sqliteDialect)
+var defaultDSNs = map[string]string{
+	"postgres": "user=postgres password=password dbname=ecommerce sslmode=disable",
+	"sqlite": "file:ecommerce.db?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite",
+}
+
+// initDatabase เชื่อมต่อ database ตาม DB_DIALECT (postgres | sqlite, ค่าเริ่มต้น postgres)
 func initDatabase() {
-	var err error
-	connStr := "user=postgres password=password dbname=ecommerce sslmode=disable"
-	db, err = sql.Open("postgres", connStr)
+	dialect, err := lookupDialect(os.Getenv("DB_DIALECT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = defaultDSNs[dialect.Name()]
+	}
+
+	db, err = OpenDB(dialect, dsn)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	if err = db.Ping(); err != nil {
+	if err = db.PingContext(context.Background()); err != nil {
 		log.Fatal("Failed to ping database:", err)
 	}
 
-	// กำหนด connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	configurePool(db)
+	log.Printf("✅ Connected to %s", dialect.Name())
+}
 
-	log.Println("✅ Connected to PostgreSQL")
+// configurePool กำหนด connection pool
+func configurePool(d *DB) {
+	d.SQL().SetMaxOpenConns(25)
+	d.SQL().SetMaxIdleConns(5)
+	d.SQL().SetConnMaxLifetime(5 * time.Minute)
 }
 
-// runMigrations รัน database migrations
-func runMigrations() {
-	for _, migration := range migrations {
-		log.Printf("Running migration: %s", migration.Version)
-		_, err := db.Exec(migration.Up)
+// openReplicas เปิด read replicas จาก DATABASE_REPLICA_URLS (คั่นด้วย ,) ใช้ dialect เดียวกับ primary
+// replica ที่ต่อไม่ติดตอน start ยังถูกเพิ่มไว้ health check จะถอดออกและรับกลับเมื่อกลับมาได้
+func openReplicas() []*DB {
+	var replicas []*DB
+	for _, dsn := range strings.Split(os.Getenv("DATABASE_REPLICA_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn == "" {
+			continue
+		}
+		replica, err := OpenDB(db.Dialect(), dsn)
 		if err != nil {
-			log.Printf("Migration failed: %v", err)
-		} else {
-			log.Printf("✅ Migration %s completed", migration.Version)
+			log.Fatal("Failed to open replica:", err)
 		}
+		configurePool(replica)
+		replicas = append(replicas, replica)
+	}
+	if len(replicas) > 0 {
+		log.Printf("✅ Routing reads to %d replica(s)", len(replicas))
 	}
+	return replicas
 }
 
-// seedData เพิ่มข้อมูลตัวอย่าง
-func seedData() {
-	// เพิ่ม users ตัวอย่าง
-	db.Exec("INSERT INTO users (email, name) VALUES ($1, $2) ON CONFLICT (email) DO NOTHING",
-		"john@example.com", "John Doe")
-	db.Exec("INSERT INTO users (email, name) VALUES ($1, $2) ON CONFLICT (email) DO NOTHING",
-		"jane@example.com", "Jane Smith")
-
-	// เพิ่ม products ตัวอย่าง
-	db.Exec("INSERT INTO products (name, price, stock) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		"Laptop", 999.99, 10)
-	db.Exec("INSERT INTO products (name, price, stock) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		"Mouse", 29.99, 50)
-	db.Exec("INSERT INTO products (name, price, stock) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		"Keyboard", 79.99, 25)
+// runMigrations apply migrations ที่ยังไม่ได้รันทั้งหมด
+func runMigrations(ctx context.Context) error {
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(db.Dialect()))
+	if err != nil {
+		return err
+	}
 
-	log.Println("✅ Sample data seeded")
+	done, err := NewMigrator(db, migrations).Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ Migrations up to date (%d applied now)", len(done))
+	return nil
 }
 
 // Handler functions
-func getUsersHandler(userRepo UserRepository) fiber.Handler {
+func getUsersHandler(q DBTX, userRepo UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		users, err := userRepo.GetAll()
+		users, err := userRepo.GetAll(c.UserContext(), q)
 		if err != nil {
 			return err
 		}
@@ -375,7 +709,7 @@ func getUsersHandler(userRepo UserRepository) fiber.Handler {
 	}
 }
 
-func createUserHandler(userRepo UserRepository) fiber.Handler {
+func createUserHandler(txm *TxManager, userRepo UserRepository) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		type CreateUserRequest struct {
 			Email string `json:"email"`
@@ -396,7 +730,10 @@ func createUserHandler(userRepo UserRepository) fiber.Handler {
 			Name:  req.Name,
 		}
 
-		if err := userRepo.Create(user); err != nil {
+		ctx := c.UserContext()
+		if err := txm.WithTx(ctx, nil, func(tx *Tx) error {
+			return userRepo.Create(ctx, tx, user)
+		}); err != nil {
 			return err
 		}
 
@@ -407,115 +744,165 @@ func createUserHandler(userRepo UserRepository) fiber.Handler {
 	}
 }
 
-func getProductsHandler(productRepo ProductRepository) fiber.Handler {
+func createOrderHandler(orderService *OrderService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		products, err := productRepo.GetAll()
+		var req PlaceOrderRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if err := bindOrderUser(c, &req); err != nil {
+			return placeOrderError(c, err)
+		}
+
+		placed, err := orderService.PlaceOrder(c.UserContext(), req)
 		if err != nil {
-			return err
+			return placeOrderError(c, err)
 		}
 
-		return c.JSON(fiber.Map{
-			"success": true,
-			"data":    products,
-			"count":   len(products),
+		return c.Status(201).JSON(fiber.Map{
+			"success":        true,
+			"order_id":       placed.ID,
+			"subtotal":       placed.Subtotal,
+			"discounts":      placed.Discounts,
+			"total":          placed.Total,
+			"status":         placed.Status,
+			"created_at":     placed.CreatedAt,
+			"items":          placed.Items,
+			"reserved_until": placed.ReservedUntil,
 		})
 	}
 }
 
-func createOrderHandler(orderService *OrderService) fiber.Handler {
+// quoteOrderHandler คำนวณยอดของ order (รวมคูปอง) โดยไม่สร้าง order จริง
+func quoteOrderHandler(orderService *OrderService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		type CreateOrderRequest struct {
-			UserID int `json:"user_id"`
-			Items  []struct {
-				ProductID int `json:"product_id"`
-				Quantity  int `json:"quantity"`
-			} `json:"items"`
-		}
-
-		var req CreateOrderRequest
+		var req PlaceOrderRequest
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 		}
+		if err := bindOrderUser(c, &req); err != nil {
+			return placeOrderError(c, err)
+		}
 
-		// เริ่ม Transaction
-		tx, err := orderService.db.Begin()
+		quote, err := orderService.QuoteOrder(c.UserContext(), req)
 		if err != nil {
-			return err
+			return placeOrderError(c, err)
 		}
-		defer tx.Rollback() // Rollback หากมี error
-
-		// คำนวณ total และตรวจสอบ stock
-		var total float64
-		for _, item := range req.Items {
-			// ตรวจสอบ stock และ price
-			var stock int
-			var price float64
-			err := tx.QueryRow("SELECT stock, price FROM products WHERE id = $1 FOR UPDATE",
-				item.ProductID).Scan(&stock, &price)
-			if err != nil {
-				return fiber.NewError(404, "Product not found")
-			}
-
-			if stock < item.Quantity {
-				return fiber.NewError(400, "Insufficient stock for product")
-			}
 
-			// ลด stock
-			_, err = tx.Exec("UPDATE products SET stock = stock - $1 WHERE id = $2",
-				item.Quantity, item.ProductID)
-			if err != nil {
-				return err
-			}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"quote":   quote,
+		})
+	}
+}
 
-			total += price * float64(item.Quantity)
-		}
+var (
+	ErrOrderUserMismatch = errors.New("user_id does not match X-User-ID")
+	ErrCouponNeedsUser   = errors.New("coupons require an identified user (X-User-ID)")
+)
 
-		// สร้าง Order
-		var orderID int
-		var createdAt time.Time
-		err = tx.QueryRow("INSERT INTO orders (user_id, total, status) VALUES ($1, $2, $3) RETURNING id, created_at",
-			req.UserID, total, "pending").Scan(&orderID, &createdAt)
-		if err != nil {
-			return err
+// bindOrderUser ผูก order กับผู้เรียกที่ identify() ระบุได้ แทนการเชื่อ user_id ใน body
+// (per_user_limit ของคูปองนับตาม user นี้)
+//
+//	X-User-ID        → ใช้ id นั้น (body ระบุ user อื่น = 403)
+//	admin            → ใช้ user_id ใน body (สั่งแทนลูกค้า)
+//	ไม่ระบุตัวตน       → ใช้ user_id ใน body ได้ แต่ใช้คูปองไม่ได้ (401)
+func bindOrderUser(c *fiber.Ctx, req *PlaceOrderRequest) error {
+	if userID, ok := c.Locals("user_id").(int); ok {
+		if req.UserID != 0 && req.UserID != userID {
+			return ErrOrderUserMismatch
 		}
+		req.UserID = userID
+		return nil
+	}
+	if c.Locals("actor") == "admin" || req.CouponCode == "" {
+		return nil
+	}
+	return ErrCouponNeedsUser
+}
 
-		// สร้าง Order Items
-		for _, item := range req.Items {
-			var price float64
-			tx.QueryRow("SELECT price FROM products WHERE id = $1", item.ProductID).Scan(&price)
+var (
+	ErrCallerUnknown = errors.New("identify with X-User-ID or X-Admin-Token")
+	ErrNotOrderOwner = errors.New("order belongs to another user")
+)
 
-			_, err = tx.Exec("INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)",
-				orderID, item.ProductID, item.Quantity, price)
-			if err != nil {
-				return err
-			}
-		}
+// orderCaller ผู้เรียกตาม identify(): admin เข้าถึงได้ทุก order, X-User-ID เฉพาะ order ของตัวเอง
+// ok = false คือไม่ระบุตัวตน
+func orderCaller(c *fiber.Ctx) (userID int, admin bool, ok bool) {
+	if c.Locals("actor") == "admin" {
+		return 0, true, true
+	}
+	userID, ok = c.Locals("user_id").(int)
+	return userID, false, ok
+}
 
-		// Commit Transaction
-		if err = tx.Commit(); err != nil {
-			return err
-		}
+// authorizeOrder ตรวจว่าผู้เรียกเข้าถึง order นี้ได้ (ErrCallerUnknown, ErrNotOrderOwner, ErrOrderNotFound)
+func authorizeOrder(c *fiber.Ctx, orderService *OrderService, orderID int) error {
+	userID, admin, ok := orderCaller(c)
+	if !ok {
+		return ErrCallerUnknown
+	}
+	if admin {
+		return nil
+	}
+	order, err := orderService.GetOrder(c.UserContext(), orderID)
+	if err != nil {
+		return err
+	}
+	if order.UserID != userID {
+		return ErrNotOrderOwner
+	}
+	return nil
+}
+
+// orderAccessError แปลง error ของ authorizeOrder เป็น HTTP status
+func orderAccessError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrCallerUnknown):
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrNotOrderOwner):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrOrderNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	return err
+}
 
-		return c.Status(201).JSON(fiber.Map{
-			"success":    true,
-			"order_id":   orderID,
-			"total":      total,
-			"status":     "pending",
-			"created_at": createdAt,
-		})
+// placeOrderError แปลง error ของ PlaceOrder / QuoteOrder เป็น HTTP status
+func placeOrderError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidOrder), errors.Is(err, ErrInsufficientStock),
+		errors.Is(err, ErrCouponInvalid), errors.Is(err, ErrCouponNotApplicable):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrProductNotFound), errors.Is(err, ErrCouponNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrCouponUsageLimit):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrCouponNeedsUser):
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, ErrOrderUserMismatch):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
 	}
+	return err
 }
 
-func getOrderHandler(orderRepo OrderRepository) fiber.Handler {
+func getOrderHandler(orderService *OrderService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
 		}
 
-		order, err := orderRepo.GetByID(id)
+		userID, admin, ok := orderCaller(c)
+		if !ok {
+			return orderAccessError(c, ErrCallerUnknown)
+		}
+		order, err := orderService.GetOrder(c.UserContext(), id)
 		if err != nil {
-			return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+			return orderAccessError(c, err)
+		}
+		if !admin && order.UserID != userID {
+			return orderAccessError(c, ErrNotOrderOwner)
 		}
 
 		return c.JSON(fiber.Map{
@@ -525,10 +912,94 @@ func getOrderHandler(orderRepo OrderRepository) fiber.Handler {
 	}
 }
 
+// requestTimeout ใส่ deadline ให้ context ของทุก request
+// queries และ transactions ที่ใช้ c.UserContext() จะถูกยกเลิกเมื่อเกินเวลา
+func requestTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// identify ระบุผู้เรียกจาก headers ให้ auditContext และ Idempotency ใช้ (Locals "actor")
+// โมดูลนี้ไม่มีระบบ login ของตัวเอง จึงรับ identity แบบเดียวกับที่ gateway ส่งต่อมา (04-microservices)
+//
+//	X-Admin-Token ถูกต้อง → "admin"
+//	X-User-ID: 42        → "user:42" (เชื่อได้เฉพาะเมื่อมี gateway/auth อยู่ข้างหน้าที่ตั้ง header นี้เอง)
+//	ไม่มี                  → ไม่ตั้ง (audit บันทึกเป็น "anonymous")
+func identify() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token != "" && subtle.ConstantTimeCompare([]byte(c.Get("X-Admin-Token")), []byte(token)) == 1 {
+			c.Locals("actor", "admin")
+			return c.Next()
+		}
+		if header := c.Get("X-User-ID"); header != "" {
+			userID, err := strconv.Atoi(header)
+			if err != nil || userID <= 0 {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid X-User-ID"})
+			}
+			c.Locals("user_id", userID)
+			c.Locals("actor", fmt.Sprintf("user:%d", userID))
+		}
+		return c.Next()
+	}
+}
+
+// adminOnly ป้องกัน endpoints สำหรับ admin ด้วย header X-Admin-Token
+// ถ้าไม่ได้ตั้ง ADMIN_TOKEN ไว้ endpoints เหล่านี้จะถูกปิด
+func adminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			return c.Status(403).JSON(fiber.Map{"error": "Admin endpoints are disabled (ADMIN_TOKEN not set)"})
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Get("X-Admin-Token")), []byte(token)) != 1 {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid admin token"})
+		}
+		return c.Next()
+	}
+}
+
+func migrationStatusHandler(c *fiber.Ctx) error {
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(db.Dialect()))
+	if err != nil {
+		return err
+	}
+
+	statuses, err := NewMigrator(db, migrations).Status(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"migrations": statuses,
+	})
+}
+
 func runMigrationsHandler(c *fiber.Ctx) error {
-	runMigrations()
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(db.Dialect()))
+	if err != nil {
+		return err
+	}
+
+	done, err := NewMigrator(db, migrations).Up(c.UserContext(), 0)
+	if err != nil {
+		return err
+	}
+
+	applied := make([]string, len(done))
+	for i, m := range done {
+		applied[i] = fmt.Sprintf("%03d_%s", m.Version, m.Name)
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Migrations completed",
+		"applied": applied,
 	})
 }
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============ Migration Engine ============
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationsRoot คือโฟลเดอร์ของไฟล์ migration บน disk (ใช้ตอน `migrate create`)
+// แต่ละ dialect มีโฟลเดอร์ย่อยของตัวเอง เช่น migrations/postgres, migrations/sqlite
+const migrationsRoot = "migrations"
+
+// migrationsDir โฟลเดอร์ migrations ของ dialect
+func migrationsDir(dialect Dialect) string {
+	return migrationsRoot + "/" + dialect.Name()
+}
+
+// ชื่อไฟล์ต้องเป็นรูปแบบ 001_create_users.up.sql / 001_create_users.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration คือการเปลี่ยนแปลง schema หนึ่งเวอร์ชัน
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 ของ Up ใช้ตรวจว่าไฟล์ที่ apply ไปแล้วถูกแก้ไขหรือไม่
+}
+
+// AppliedMigration คือแถวใน schema_migrations
+type AppliedMigration struct {
+	Version    int64
+	Name       string
+	Checksum   string
+	AppliedAt  time.Time
+	DurationMs int64
+}
+
+// MigrationStatus สถานะของแต่ละ migration สำหรับ `migrate status` และ GET /migrate/status
+type MigrationStatus struct {
+	Version    int64      `json:"version"`
+	Name       string     `json:"name"`
+	Applied    bool       `json:"applied"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Modified   bool       `json:"modified"` // checksum ไม่ตรงกับที่ apply ไปแล้ว
+}
+
+// ErrChecksumMismatch เกิดเมื่อไฟล์ migration ที่ apply ไปแล้วถูกแก้ไข
+var ErrChecksumMismatch = errors.New("applied migration has been modified")
+
+// loadMigrations อ่านไฟล์ .up.sql/.down.sql จาก fsys แล้วเรียงตาม version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s is missing its .up.sql file", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator รัน migrations และบันทึกผลใน schema_migrations
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+func NewMigrator(db *DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// withLock จอง connection หนึ่งเส้นและถือ migration lock ของ dialect ไว้ตลอดการทำงานของ fn
+// (advisory lock ของ PostgreSQL ผูกกับ session จึงต้องใช้ connection เดียวกันทั้ง lock, migrate และ unlock)
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.db.Dialect().LockMigrations(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		duration_ms BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// applied อ่าน migrations ที่ apply ไปแล้ว เรียงตาม version
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]AppliedMigration, error) {
+	rows, err := conn.QueryContext(ctx,
+		"SELECT version, name, checksum, applied_at, duration_ms FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt, &a.DurationMs); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// verify ตรวจว่าไฟล์ของ migrations ที่ apply แล้วไม่ถูกแก้ไขหรือหายไป
+func (m *Migrator) verify(applied []AppliedMigration) error {
+	files := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		files[mig.Version] = mig
+	}
+
+	for _, a := range applied {
+		mig, exists := files[a.Version]
+		if !exists {
+			return fmt.Errorf("applied migration %03d_%s not found in %s/", a.Version, a.Name, migrationsDir(m.db.Dialect()))
+		}
+		if mig.Checksum != a.Checksum {
+			return fmt.Errorf("%w: %03d_%s (applied %s…, file %s…)",
+				ErrChecksumMismatch, a.Version, a.Name, a.Checksum[:8], mig.Checksum[:8])
+		}
+	}
+	return nil
+}
+
+// Up apply migrations ที่ยังไม่ได้รันสูงสุด n ตัว (n <= 0 คือทั้งหมด) และส่งรายการที่ apply
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		appliedSet := make(map[int64]bool, len(applied))
+		for _, a := range applied {
+			appliedSet[a.Version] = true
+		}
+
+		for _, mig := range m.migrations {
+			if appliedSet[mig.Version] {
+				continue
+			}
+			if n > 0 && len(done) >= n {
+				break
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rollback migrations ล่าสุด n ตัว และส่งรายการที่ rollback
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		files := make(map[int64]Migration, len(m.migrations))
+		for _, mig := range m.migrations {
+			files[mig.Version] = mig
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < n; i-- {
+			mig := files[applied[i].Version]
+			if mig.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no .down.sql file", mig.Version, mig.Name)
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Redo rollback migration ล่าสุดแล้ว apply ใหม่ (ใช้ตอนพัฒนา migration ที่ยังไม่ได้ deploy)
+func (m *Migrator) Redo(ctx context.Context) error {
+	down, err := m.Down(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if len(down) == 0 {
+		return errors.New("no applied migrations to redo")
+	}
+	_, err = m.Up(ctx, 1)
+	return err
+}
+
+// Verify ตรวจ checksum ของ migrations ที่ apply แล้ว โดยไม่ apply อะไรเพิ่ม
+func (m *Migrator) Verify(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.verify(applied)
+	})
+}
+
+// Status รวมไฟล์ migrations กับสิ่งที่อยู่ใน schema_migrations
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		byVersion := make(map[int64]AppliedMigration, len(applied))
+		for _, a := range applied {
+			byVersion[a.Version] = a
+		}
+
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if a, ok := byVersion[mig.Version]; ok {
+				appliedAt := a.AppliedAt
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+				status.DurationMs = a.DurationMs
+				status.Modified = a.Checksum != mig.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// apply รัน Up ของ migration เดียวใน transaction พร้อมบันทึกลง schema_migrations
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	log.Printf("⬆️  Applying migration %03d_%s", mig.Version, mig.Name)
+	start := time.Now()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+		return fmt.Errorf("migration %03d_%s up: %w", mig.Version, mig.Name, err)
+	}
+
+	duration := time.Since(start)
+	// conn/tx เป็นของ database/sql โดยตรง จึงต้อง Rebind เอง (ไฟล์ migration เขียนตาม dialect อยู่แล้ว)
+	if _, err := tx.ExecContext(ctx, m.db.Dialect().Rebind(
+		"INSERT INTO schema_migrations (version, name, checksum, duration_ms) VALUES ($1, $2, $3, $4)"),
+		mig.Version, mig.Name, mig.Checksum, duration.Milliseconds()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("✅ Migration %03d_%s completed in %s", mig.Version, mig.Name, duration)
+	return nil
+}
+
+// revert รัน Down ของ migration เดียวใน transaction และลบแถวออกจาก schema_migrations
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	log.Printf("⬇️  Reverting migration %03d_%s", mig.Version, mig.Name)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+		return fmt.Errorf("migration %03d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, m.db.Dialect().Rebind("DELETE FROM schema_migrations WHERE version = $1"), mig.Version); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("✅ Migration %03d_%s reverted", mig.Version, mig.Name)
+	return nil
+}
+
+// createMigration สร้างไฟล์ .up.sql/.down.sql ว่าง ๆ ด้วย version ถัดไปในทุกโฟลเดอร์ของ dirs
+// ทุก dialect ใช้ version เดียวกัน (ต่อจาก version สูงสุดของทุกโฟลเดอร์) เพื่อให้ schema ตรงกันเสมอ
+func createMigration(fsys fs.FS, dirs []string, name string) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	var next int64 = 1
+	for _, dir := range dirs {
+		migrations, err := loadMigrations(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(migrations) > 0 && migrations[len(migrations)-1].Version >= next {
+			next = migrations[len(migrations)-1].Version + 1
+		}
+	}
+
+	base := fmt.Sprintf("%03d_%s", next, name)
+	var files []string
+	for _, dir := range dirs {
+		for _, file := range []string{
+			filepath.Join(dir, base+".up.sql"),
+			filepath.Join(dir, base+".down.sql"),
+		} {
+			content := fmt.Sprintf("-- %s\n", filepath.Base(file))
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// runMigrateCommand จัดการ subcommand `migrate up|down N|status|redo|create NAME`
+func runMigrateCommand(args []string) error {
+	usage := errors.New("usage: migrate up [N] | down [N] | status | redo | create NAME")
+	if len(args) == 0 {
+		return usage
+	}
+
+	// create ไม่ต้องต่อ database และอ่านจาก disk เพื่อให้เห็นไฟล์ที่เพิ่งสร้างก่อน build ใหม่
+	if args[0] == "create" {
+		if len(args) < 2 {
+			return usage
+		}
+		dirs := make([]string, 0, len(dialects))
+		for _, dialect := range dialects {
+			dirs = append(dirs, migrationsDir(dialect))
+		}
+		sort.Strings(dirs)
+		files, err := createMigration(os.DirFS("."), dirs, strings.Join(args[1:], "_"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			log.Printf("📝 Created %s", file)
+		}
+		return nil
+	}
+
+	n := 0
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return fmt.Errorf("invalid N %q", args[1])
+		}
+	}
+
+	initDatabase()
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(db.Dialect()))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	migrator := NewMigrator(db, migrations)
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx, n)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migration(s)", len(done))
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := migrator.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migration(s)", len(done))
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-8s %-32s %-8s %-20s %s\n", "VERSION", "NAME", "STATE", "APPLIED AT", "DURATION")
+		for _, s := range statuses {
+			state, appliedAt, duration := "pending", "-", "-"
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+				duration = fmt.Sprintf("%dms", s.DurationMs)
+			}
+			if s.Modified {
+				state = "MODIFIED"
+			}
+			fmt.Printf("%03d      %-32s %-8s %-20s %s\n", s.Version, s.Name, state, appliedAt, duration)
+		}
+	default:
+		return usage
+	}
+	return nil
+}
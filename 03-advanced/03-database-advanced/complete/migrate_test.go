@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testMigrationFiles migrations เล็ก ๆ แยกจาก schema จริง ใช้ทดสอบ Migrator อย่างเดียว
+func testMigrationFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"m/001_create_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL)")},
+		"m/001_create_notes.down.sql": {Data: []byte("DROP TABLE notes")},
+		"m/002_create_tags.up.sql":    {Data: []byte("CREATE TABLE tags (name TEXT PRIMARY KEY)")},
+		"m/002_create_tags.down.sql":  {Data: []byte("DROP TABLE tags")},
+		"m/README.md":                 {Data: []byte("ไฟล์อื่นถูกข้าม")},
+	}
+}
+
+// newTestMigrator database เปล่า (ยังไม่ migrate) กับ migrations จาก files
+func newTestMigrator(t *testing.T, testDB *DB, files fstest.MapFS) *Migrator {
+	t.Helper()
+	migrations, err := loadMigrations(files, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMigrator(testDB, migrations)
+}
+
+func openEmptyTestDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "migrate.db") + "?_pragma=busy_timeout(5000)&_time_format=sqlite"
+	testDB, err := OpenDB(sqliteDialect{}, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+	return testDB
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files fstest.MapFS
+		count int
+		err   string // ว่าง = ต้องผ่าน
+	}{
+		{"valid", testMigrationFiles(), 2, ""},
+		{"missing up", fstest.MapFS{"m/001_a.down.sql": {Data: []byte("x")}}, 0, "missing its .up.sql"},
+		{"conflicting names", fstest.MapFS{
+			"m/001_a.up.sql": {Data: []byte("x")},
+			"m/001_b.up.sql": {Data: []byte("x")},
+		}, 0, "conflicting names"},
+		{"no migrations", fstest.MapFS{"m/notes.txt": {Data: []byte("x")}}, 0, ""},
+	} {
+		migrations, err := loadMigrations(tc.files, "m")
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: err = %v, want containing %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || len(migrations) != tc.count {
+			t.Errorf("%s: %d migrations, err = %v, want %d", tc.name, len(migrations), err, tc.count)
+		}
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	ctx := context.Background()
+	migrator := newTestMigrator(t, openEmptyTestDB(t), testMigrationFiles())
+
+	for _, step := range []struct {
+		name    string
+		run     func() error
+		applied []bool // ตาม version 1, 2
+	}{
+		{"nothing applied", func() error { return nil }, []bool{false, false}},
+		{"up 1", func() error { _, err := migrator.Up(ctx, 1); return err }, []bool{true, false}},
+		{"up all", func() error { _, err := migrator.Up(ctx, 0); return err }, []bool{true, true}},
+		{"down 1", func() error { _, err := migrator.Down(ctx, 1); return err }, []bool{true, false}},
+	} {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != 2 {
+			t.Fatalf("%s: %d statuses, want 2", step.name, len(statuses))
+		}
+		for i, s := range statuses {
+			if s.Version != int64(i+1) || s.Applied != step.applied[i] || s.Modified {
+				t.Errorf("%s: %03d_%s applied=%v modified=%v, want applied=%v",
+					step.name, s.Version, s.Name, s.Applied, s.Modified, step.applied[i])
+			}
+			if s.Applied != (s.AppliedAt != nil) {
+				t.Errorf("%s: %03d applied_at = %v", step.name, s.Version, s.AppliedAt)
+			}
+		}
+	}
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	testDB := openEmptyTestDB(t)
+	if _, err := newTestMigrator(t, testDB, testMigrationFiles()).Up(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// แก้ไฟล์ที่ apply ไปแล้ว
+	files := testMigrationFiles()
+	files["m/001_create_notes.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY)")}
+	edited := newTestMigrator(t, testDB, files)
+
+	for _, tc := range []struct {
+		name string
+		run  func() error
+	}{
+		{"up", func() error { _, err := edited.Up(ctx, 0); return err }},
+		{"down", func() error { _, err := edited.Down(ctx, 1); return err }},
+		{"redo", func() error { return edited.Redo(ctx) }},
+		{"verify", func() error { return edited.Verify(ctx) }},
+	} {
+		if err := tc.run(); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%s: err = %v, want ErrChecksumMismatch", tc.name, err)
+		}
+	}
+
+	statuses, err := edited.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Modified || statuses[1].Applied {
+		t.Errorf("statuses = %+v, want 001 modified and 002 pending", statuses)
+	}
+	// migration 002 ต้องไม่ถูก apply ทั้งที่ยัง pending
+	var tables int
+	testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'tags'").Scan(&tables)
+	if tables != 0 {
+		t.Error("pending migration applied despite checksum mismatch")
+	}
+
+	// ไฟล์ของ migration ที่ apply แล้วหายไป = error (แต่ไม่ใช่ checksum)
+	delete(files, "m/001_create_notes.up.sql")
+	delete(files, "m/001_create_notes.down.sql")
+	if err := newTestMigrator(t, testDB, files).Verify(ctx); err == nil || errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("missing file: err = %v", err)
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	ctx := context.Background()
+	testDB := openEmptyTestDB(t)
+	migrator := newTestMigrator(t, testDB, testMigrationFiles())
+
+	if err := migrator.Redo(ctx); err == nil {
+		t.Error("redo with nothing applied succeeded")
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"INSERT INTO notes (body) VALUES ('keep')", "INSERT INTO tags (name) VALUES ('gone')"} {
+		if _, err := testDB.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrator.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// redo ทำเฉพาะตัวล่าสุด: tags ถูกสร้างใหม่ (ว่าง) notes ไม่ถูกแตะ
+	for table, want := range map[string]int{"notes": 1, "tags": 0} {
+		var count int
+		if err := testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Errorf("%s has %d rows after redo, want %d", table, count, want)
+		}
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("%03d_%s not applied after redo", s.Version, s.Name)
+		}
+	}
+}
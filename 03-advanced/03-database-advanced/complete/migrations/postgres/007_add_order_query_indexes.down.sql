@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_order_items_order_id;
+DROP INDEX IF EXISTS idx_orders_created_at;
+DROP INDEX IF EXISTS idx_orders_status_id;
+DROP INDEX IF EXISTS idx_orders_user_id_id;
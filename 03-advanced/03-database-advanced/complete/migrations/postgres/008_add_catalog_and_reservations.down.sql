@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS stock_reservations;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_stock_check;
+DROP INDEX IF EXISTS idx_products_category;
+DROP INDEX IF EXISTS idx_products_sku;
+ALTER TABLE products DROP COLUMN IF EXISTS reserved;
+ALTER TABLE products DROP COLUMN IF EXISTS category;
+ALTER TABLE products DROP COLUMN IF EXISTS sku;
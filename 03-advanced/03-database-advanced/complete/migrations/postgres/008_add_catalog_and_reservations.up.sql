@@ -0,0 +1,27 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reserved INTEGER NOT NULL DEFAULT 0;
+
+UPDATE products SET sku = 'SKU-' || LPAD(id::text, 5, '0') WHERE sku IS NULL;
+ALTER TABLE products ALTER COLUMN sku SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products(sku);
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category);
+
+-- stock = ของในคลังจริง, reserved = ถูกจองโดย orders ที่ยังไม่จ่ายเงิน, available = stock - reserved
+ALTER TABLE products ADD CONSTRAINT products_stock_check
+    CHECK (stock >= 0 AND reserved >= 0 AND reserved <= stock);
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_active_expires_at
+    ON stock_reservations(expires_at) WHERE status = 'active';
@@ -0,0 +1,8 @@
+ALTER TABLE order_items ALTER COLUMN price TYPE DECIMAL(10,2) USING price / 100.0;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS currency;
+ALTER TABLE orders ALTER COLUMN total TYPE DECIMAL(10,2) USING total / 100.0;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_price_check;
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
+ALTER TABLE products ALTER COLUMN price TYPE DECIMAL(10,2) USING price / 100.0;
@@ -0,0 +1,14 @@
+-- เก็บเงินเป็นหน่วยย่อย (สตางค์) แบบ BIGINT แทน DECIMAL ที่ Go อ่านออกมาเป็น float64
+ALTER TABLE products ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+ALTER TABLE products ADD CONSTRAINT products_price_check CHECK (price >= 0);
+
+ALTER TABLE orders ALTER COLUMN total TYPE BIGINT USING ROUND(total * 100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+
+-- สกุลเงินของ order_items ใช้ตาม orders.currency
+ALTER TABLE order_items ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100);
+
+COMMENT ON COLUMN products.price IS 'minor units of products.currency';
+COMMENT ON COLUMN orders.total IS 'minor units of orders.currency';
+COMMENT ON COLUMN order_items.price IS 'minor units of orders.currency';
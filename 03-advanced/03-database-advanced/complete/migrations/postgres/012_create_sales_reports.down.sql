@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_products_available;
+DROP INDEX IF EXISTS idx_orders_status_created_at;
+DROP MATERIALIZED VIEW IF EXISTS sales_daily_products;
+DROP MATERIALIZED VIEW IF EXISTS sales_daily_orders;
@@ -0,0 +1,33 @@
+-- ยอดขายรายวัน (เฉพาะ orders ที่จ่ายเงินแล้ว) สำหรับ GET /reports/sales
+-- เป็น materialized view: รายงานอ่านจากผลรวมที่คำนวณไว้แล้ว และ refresh เป็นระยะ
+-- (unique index จำเป็นสำหรับ REFRESH MATERIALIZED VIEW CONCURRENTLY ซึ่งไม่ block การอ่าน)
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sales_daily_orders AS
+SELECT created_at::date AS day,
+       COALESCE(user_id, 0) AS user_id,
+       currency,
+       COUNT(*) AS orders,
+       SUM(total) AS revenue
+FROM orders
+WHERE status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sales_daily_orders_key ON sales_daily_orders(day, user_id, currency);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sales_daily_products AS
+SELECT o.created_at::date AS day,
+       i.product_id,
+       o.currency,
+       COUNT(DISTINCT o.id) AS orders,
+       SUM(i.quantity) AS quantity,
+       SUM(i.quantity * i.price) AS revenue
+FROM orders o
+JOIN order_items i ON i.order_id = o.id
+WHERE o.status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sales_daily_products_key ON sales_daily_products(day, product_id, currency);
+
+-- refresh view และ low-stock alerts
+CREATE INDEX IF NOT EXISTS idx_orders_status_created_at ON orders(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_products_available ON products((stock - reserved));
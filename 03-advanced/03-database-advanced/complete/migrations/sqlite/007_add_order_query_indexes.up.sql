@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_id ON orders(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_status_id ON orders(status, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS stock_reservations;
+
+DROP TRIGGER IF EXISTS products_stock_check_update;
+DROP TRIGGER IF EXISTS products_stock_check_insert;
+DROP INDEX IF EXISTS idx_products_category;
+DROP INDEX IF EXISTS idx_products_sku;
+ALTER TABLE products DROP COLUMN reserved;
+ALTER TABLE products DROP COLUMN category;
+ALTER TABLE products DROP COLUMN sku;
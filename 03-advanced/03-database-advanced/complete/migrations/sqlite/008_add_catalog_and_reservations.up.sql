@@ -0,0 +1,36 @@
+ALTER TABLE products ADD COLUMN sku VARCHAR(64);
+ALTER TABLE products ADD COLUMN category VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN reserved INTEGER NOT NULL DEFAULT 0;
+
+UPDATE products SET sku = 'SKU-' || substr('00000' || id, -5) WHERE sku IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products(sku);
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category);
+
+-- SQLite เพิ่ม CHECK ให้ตารางเดิมไม่ได้ จึงใช้ trigger แทน products_stock_check
+-- stock = ของในคลังจริง, reserved = ถูกจองโดย orders ที่ยังไม่จ่ายเงิน, available = stock - reserved
+CREATE TRIGGER IF NOT EXISTS products_stock_check_insert BEFORE INSERT ON products
+WHEN NEW.stock < 0 OR NEW.reserved < 0 OR NEW.reserved > NEW.stock
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: products_stock_check');
+END;
+
+CREATE TRIGGER IF NOT EXISTS products_stock_check_update BEFORE UPDATE ON products
+WHEN NEW.stock < 0 OR NEW.reserved < 0 OR NEW.reserved > NEW.stock
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: products_stock_check');
+END;
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_active_expires_at
+    ON stock_reservations(expires_at) WHERE status = 'active';
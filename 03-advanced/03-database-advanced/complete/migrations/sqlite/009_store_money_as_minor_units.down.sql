@@ -0,0 +1,9 @@
+UPDATE order_items SET price = price / 100.0;
+
+ALTER TABLE orders DROP COLUMN currency;
+UPDATE orders SET total = total / 100.0;
+
+DROP TRIGGER IF EXISTS products_price_check_update;
+DROP TRIGGER IF EXISTS products_price_check_insert;
+ALTER TABLE products DROP COLUMN currency;
+UPDATE products SET price = price / 100.0;
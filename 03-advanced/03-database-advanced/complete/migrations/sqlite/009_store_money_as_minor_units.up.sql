@@ -0,0 +1,22 @@
+-- เก็บเงินเป็นหน่วยย่อย (สตางค์) แบบ INTEGER แทนทศนิยม
+-- SQLite เปลี่ยนชนิด column ไม่ได้ แต่ column DECIMAL เก็บจำนวนเต็มเป็น INTEGER อยู่แล้ว จึงแปลงแค่ค่า
+UPDATE products SET price = CAST(ROUND(price * 100) AS INTEGER);
+ALTER TABLE products ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'THB';
+
+CREATE TRIGGER IF NOT EXISTS products_price_check_insert BEFORE INSERT ON products
+WHEN NEW.price < 0
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: products_price_check');
+END;
+
+CREATE TRIGGER IF NOT EXISTS products_price_check_update BEFORE UPDATE ON products
+WHEN NEW.price < 0
+BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: products_price_check');
+END;
+
+UPDATE orders SET total = CAST(ROUND(total * 100) AS INTEGER);
+ALTER TABLE orders ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'THB';
+
+-- สกุลเงินของ order_items ใช้ตาม orders.currency
+UPDATE order_items SET price = CAST(ROUND(price * 100) AS INTEGER);
@@ -0,0 +1,27 @@
+-- ยอดขายรายวัน (เฉพาะ orders ที่จ่ายเงินแล้ว) สำหรับ GET /reports/sales
+-- SQLite ไม่มี materialized view จึงเป็น view ธรรมดาชื่อเดียวกัน (คำนวณใหม่ทุกครั้ง ข้อมูลสดเสมอ)
+
+CREATE VIEW IF NOT EXISTS sales_daily_orders AS
+SELECT date(created_at) AS day,
+       COALESCE(user_id, 0) AS user_id,
+       currency,
+       COUNT(*) AS orders,
+       SUM(total) AS revenue
+FROM orders
+WHERE status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2, 3;
+
+CREATE VIEW IF NOT EXISTS sales_daily_products AS
+SELECT date(o.created_at) AS day,
+       i.product_id,
+       o.currency,
+       COUNT(DISTINCT o.id) AS orders,
+       SUM(i.quantity) AS quantity,
+       SUM(i.quantity * i.price) AS revenue
+FROM orders o
+JOIN order_items i ON i.order_id = o.id
+WHERE o.status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2, 3;
+
+CREATE INDEX IF NOT EXISTS idx_orders_status_created_at ON orders(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_products_available ON products((stock - reserved));
@@ -0,0 +1,50 @@
+-- คูปองส่วนลด: percentage (percent_off_bp เป็น basis points 1000 = 10%), fixed (amount_off หน่วยย่อย)
+-- และ buy_x_get_y (ซื้อ buy_quantity แถม get_quantity ของสินค้า product_id)
+CREATE TABLE IF NOT EXISTS coupons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('percentage', 'fixed', 'buy_x_get_y')),
+    description TEXT NOT NULL DEFAULT '',
+    percent_off_bp INTEGER NOT NULL DEFAULT 0 CHECK (percent_off_bp BETWEEN 0 AND 10000),
+    amount_off BIGINT NOT NULL DEFAULT 0 CHECK (amount_off >= 0),
+    buy_quantity INTEGER NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+    get_quantity INTEGER NOT NULL DEFAULT 0 CHECK (get_quantity >= 0),
+    product_id INTEGER REFERENCES products(id),
+    min_order BIGINT NOT NULL DEFAULT 0 CHECK (min_order >= 0),
+    currency CHAR(3) NOT NULL DEFAULT 'THB',
+    starts_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    usage_limit INTEGER CHECK (usage_limit > 0),
+    per_user_limit INTEGER CHECK (per_user_limit > 0),
+    times_used INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT coupons_usage_check CHECK (times_used >= 0 AND (usage_limit IS NULL OR times_used <= usage_limit))
+);
+
+-- การใช้คูปองต่อ order: released เมื่อ order ถูกยกเลิก (ไม่นับรวมใน per_user_limit)
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    coupon_id INTEGER NOT NULL REFERENCES coupons(id),
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    user_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (coupon_id, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_user
+    ON coupon_redemptions(coupon_id, user_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_order_id ON coupon_redemptions(order_id);
+
+-- ส่วนลดที่ใช้กับ order (orders.total เป็นยอดหลังหักส่วนลดแล้ว)
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    coupon_id INTEGER REFERENCES coupons(id),
+    code VARCHAR(50) NOT NULL,
+    description TEXT NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_discounts_order_id ON order_discounts(order_id);
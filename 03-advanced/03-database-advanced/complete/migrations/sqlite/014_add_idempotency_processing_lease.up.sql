@@ -0,0 +1,2 @@
+-- key ที่ค้างสถานะ processing (process ตายระหว่างทำงาน) ยึดใหม่ได้เมื่อ lease หมด ไม่ต้องรอ expires_at (24 ชั่วโมง)
+ALTER TABLE idempotency_keys ADD COLUMN processing_expires_at TIMESTAMP;
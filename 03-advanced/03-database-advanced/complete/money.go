@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ============ Money ============
+
+// DefaultCurrency สกุลเงินที่ใช้เมื่อไม่ได้ระบุ
+const DefaultCurrency = "THB"
+
+// currencyExponents จำนวนหลักของหน่วยย่อยในแต่ละสกุล (THB 2 = สตางค์, JPY 0 = ไม่มีหน่วยย่อย)
+var currencyExponents = map[string]int{
+	"THB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"JPY": 0,
+}
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrMoneyOverflow    = errors.New("money amount overflow")
+	ErrInvalidAmount    = errors.New("invalid money amount")
+)
+
+// Money จำนวนเงินเก็บเป็นหน่วยย่อย (เช่น สตางค์) แบบ int64 พร้อมรหัสสกุลเงิน
+// ไม่ใช้ float64 เพราะ 0.1 + 0.2 != 0.3 ยอดรวมจะเพี้ยนทีละเศษสตางค์
+type Money struct {
+	Amount   int64  // หน่วยย่อย เช่น 99999 = 999.99 บาท
+	Currency string // ISO 4217 เช่น "THB"
+}
+
+// NewMoney สร้าง Money จากหน่วยย่อย
+func NewMoney(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: currency}
+}
+
+// ParseMoney แปลงตัวเลขทศนิยมแบบข้อความ เช่น "999.99" เป็น Money โดยไม่ผ่าน float
+// ทศนิยมเกินกว่าที่สกุลเงินมีถือว่าผิด (ไม่ปัดเงียบ ๆ)
+func ParseMoney(s, currency string) (Money, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(s, "-")
+	whole, frac, hasPoint := strings.Cut(digits, ".")
+	if whole == "" || (hasPoint && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places for %s", ErrInvalidAmount, s, exp, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrMoneyOverflow, s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Zero คือ 0 ในสกุลเดียวกัน
+func (m Money) Zero() Money {
+	return Money{Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Add บวกเงินสกุลเดียวกัน (ต่างสกุลหรือ overflow = error)
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub ลบเงินสกุลเดียวกัน
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Mul คูณด้วยจำนวนเต็ม เช่น ราคาต่อชิ้น × จำนวน
+func (m Money) Mul(quantity int64) (Money, error) {
+	if m.Amount == 0 || quantity == 0 {
+		return m.Zero(), nil
+	}
+	product := m.Amount * quantity
+	if product/quantity != m.Amount || (m.Amount == -1 && quantity == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// MulRatio คูณด้วยเศษส่วน numerator/denominator แล้วปัดเศษหน่วยย่อยแบบ half-even
+// (banker's rounding: .5 ปัดไปหาเลขคู่ ยอดรวมจากการปัดหลายครั้งจึงไม่เอียงไปทางใดทางหนึ่ง)
+// เช่น ส่วนลด 7.5% = m.MulRatio(75, 1000)
+func (m Money) MulRatio(numerator, denominator int64) (Money, error) {
+	if denominator == 0 {
+		return Money{}, fmt.Errorf("%w: division by zero", ErrInvalidAmount)
+	}
+
+	r := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(numerator)),
+		big.NewInt(denominator),
+	)
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+
+	// เทียบเศษ×2 กับตัวหาร: มากกว่า = ปัดขึ้น, เท่ากัน = ปัดไปหาเลขคู่
+	twice := new(big.Int).Abs(new(big.Int).Lsh(rem, 1))
+	if c := twice.Cmp(r.Denom()); c > 0 || (c == 0 && quo.Bit(0) == 1) {
+		if rem.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	if !quo.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: quo.Int64(), Currency: m.Currency}, nil
+}
+
+// Allocate แบ่งเงินตามสัดส่วน weights โดยไม่มีเศษหาย (ผลรวมเท่ากับยอดเดิมเสมอ)
+// เศษหน่วยย่อยที่เหลือจะแจกให้ส่วนแรก ๆ ทีละ 1
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight", ErrInvalidAmount)
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: weights sum to zero", ErrInvalidAmount)
+	}
+
+	parts := make([]Money, len(weights))
+	remainder := m.Amount
+	for i, w := range weights {
+		share := new(big.Int).Quo(new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(w)), big.NewInt(total))
+		parts[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		remainder -= parts[i].Amount
+	}
+
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(parts) {
+		if weights[i] == 0 {
+			continue
+		}
+		parts[i].Amount += step
+		remainder -= step
+	}
+	return parts, nil
+}
+
+// Cmp เปรียบเทียบ (-1, 0, 1) ใช้ได้เฉพาะสกุลเดียวกัน
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Decimal แสดงเป็นทศนิยมตามจำนวนหลักของสกุลเงิน เช่น "999.99"
+func (m Money) Decimal() string {
+	exp := currencyExponents[m.Currency]
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(big.NewInt(amount)).String()
+	if exp == 0 {
+		return sign + abs
+	}
+	if len(abs) <= exp {
+		abs = strings.Repeat("0", exp-len(abs)+1) + abs
+	}
+	return sign + abs[:len(abs)-exp] + "." + abs[len(abs)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// JSON
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON ส่งจำนวนเงินเป็น string ทศนิยม ({"amount": "999.99", "currency": "THB"})
+// เพื่อไม่ให้ client ที่ parse เป็น float ทำตัวเลขเพี้ยน
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON รับได้ทั้ง {"amount": "12.50", "currency": "USD"}, "999.99" และ 999.99
+// (ตัวเลขอ่านจากข้อความดิบ ไม่ผ่าน float) สองแบบหลังใช้ DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		var v struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if v.Currency == "" {
+			v.Currency = DefaultCurrency
+		}
+		parsed, err := ParseMoney(strings.Trim(string(v.Amount), `"`), strings.ToUpper(v.Currency))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+
+	parsed, err := ParseMoney(string(data), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// SQL
+
+// Value เก็บลง database เป็นหน่วยย่อย (BIGINT) ส่วนสกุลเงินเก็บแยกอีก column
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan อ่านหน่วยย่อยจาก database (ไม่แตะ Currency ต้อง scan column currency แยก)
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		m.Amount = v
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidAmount, v)
+		}
+		m.Amount = amount
+	case nil:
+		m.Amount = 0
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
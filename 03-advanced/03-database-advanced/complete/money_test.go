@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func thb(minor int64) Money { return NewMoney(minor, "THB") }
+
+func TestParseMoney(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		currency string
+		want     Money
+		err      error
+	}{
+		{"999.99", "THB", thb(99999), nil},
+		{"0.1", "THB", thb(10), nil},
+		{"12", "USD", NewMoney(1200, "USD"), nil},
+		{" 5.05 ", "THB", thb(505), nil},
+		{"-12.34", "THB", thb(-1234), nil},
+		{"-0.01", "THB", thb(-1), nil},
+		{"1500", "JPY", NewMoney(1500, "JPY"), nil},
+		// ทศนิยมเกินที่สกุลเงินมี ไม่ปัดเงียบ ๆ
+		{"0.001", "THB", Money{}, ErrInvalidAmount},
+		{"100.5", "JPY", Money{}, ErrInvalidAmount},
+		{"1.", "THB", Money{}, ErrInvalidAmount},
+		{".5", "THB", Money{}, ErrInvalidAmount},
+		{"", "THB", Money{}, ErrInvalidAmount},
+		{"1,000", "THB", Money{}, ErrInvalidAmount},
+		{"1e3", "THB", Money{}, ErrInvalidAmount},
+		{"+1", "THB", Money{}, ErrInvalidAmount},
+		{"--1", "THB", Money{}, ErrInvalidAmount},
+		{"92233720368547758.08", "THB", Money{}, ErrMoneyOverflow},
+		{"92233720368547758.07", "THB", thb(math.MaxInt64), nil},
+		{"1.00", "XXX", Money{}, ErrUnknownCurrency},
+	} {
+		got, err := ParseMoney(tc.in, tc.currency)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("ParseMoney(%q, %s): err = %v, want %v", tc.in, tc.currency, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseMoney(%q, %s) = %+v, want %+v", tc.in, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	usd := NewMoney(100, "USD")
+	for _, tc := range []struct {
+		name string
+		op   func() (Money, error)
+		want Money
+		err  error
+	}{
+		{"add", func() (Money, error) { return thb(10).Add(thb(20)) }, thb(30), nil},
+		{"add mismatch", func() (Money, error) { return thb(10).Add(usd) }, Money{}, ErrCurrencyMismatch},
+		{"add overflow", func() (Money, error) { return thb(math.MaxInt64).Add(thb(1)) }, Money{}, ErrMoneyOverflow},
+		{"add underflow", func() (Money, error) { return thb(math.MinInt64).Add(thb(-1)) }, Money{}, ErrMoneyOverflow},
+		{"sub", func() (Money, error) { return thb(10).Sub(thb(25)) }, thb(-15), nil},
+		{"sub mismatch", func() (Money, error) { return thb(10).Sub(usd) }, Money{}, ErrCurrencyMismatch},
+		{"sub min int", func() (Money, error) { return thb(0).Sub(thb(math.MinInt64)) }, Money{}, ErrMoneyOverflow},
+		{"mul", func() (Money, error) { return thb(2999).Mul(3) }, thb(8997), nil},
+		{"mul zero", func() (Money, error) { return thb(2999).Mul(0) }, thb(0), nil},
+		{"mul overflow", func() (Money, error) { return thb(math.MaxInt64 / 2).Mul(3) }, Money{}, ErrMoneyOverflow},
+		{"mul min int", func() (Money, error) { return thb(-1).Mul(math.MinInt64) }, Money{}, ErrMoneyOverflow},
+	} {
+		got, err := tc.op()
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := thb(1).Cmp(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp across currencies: err = %v, want ErrCurrencyMismatch", err)
+	}
+	if c, err := thb(1).Cmp(thb(2)); err != nil || c != -1 {
+		t.Errorf("Cmp(1, 2) = %d, %v, want -1", c, err)
+	}
+}
+
+func TestMoneyMulRatio(t *testing.T) {
+	for _, tc := range []struct {
+		amount      int64
+		numerator   int64
+		denominator int64
+		want        int64
+		err         error
+	}{
+		{1000, 75, 1000, 75, nil}, // 7.5% ของ 10.00
+		{10, 1, 4, 2, nil},        // 2.5 → 2 (ปัดไปหาเลขคู่)
+		{30, 1, 4, 8, nil},        // 7.5 → 8
+		{50, 1, 4, 12, nil},       // 12.5 → 12
+		{11, 1, 4, 3, nil},        // 2.75 → 3
+		{9, 1, 4, 2, nil},         // 2.25 → 2
+		{-10, 1, 4, -2, nil},      // -2.5 → -2
+		{-30, 1, 4, -8, nil},      // -7.5 → -8
+		{-11, 1, 4, -3, nil},      // -2.75 → -3
+		{10, -1, 4, -2, nil},      // ตัวเศษติดลบ
+		{99999, 1, 3, 33333, nil},
+		{math.MaxInt64, 1, 1, math.MaxInt64, nil},
+		{math.MaxInt64, 2, 1, 0, ErrMoneyOverflow},
+		{100, 1, 0, 0, ErrInvalidAmount},
+	} {
+		got, err := thb(tc.amount).MulRatio(tc.numerator, tc.denominator)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d × %d/%d: err = %v, want %v", tc.amount, tc.numerator, tc.denominator, err, tc.err)
+			continue
+		}
+		if err == nil && got != thb(tc.want) {
+			t.Errorf("%d × %d/%d = %+v, want %d", tc.amount, tc.numerator, tc.denominator, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+		err     error
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int64{300, 300, 300}, nil},
+		{"remainder to first parts", 100, []int64{1, 1, 1}, []int64{34, 33, 33}, nil},
+		{"proportional", 1000, []int64{3, 1}, []int64{750, 250}, nil},
+		{"proportional remainder", 1001, []int64{2, 1, 1}, []int64{501, 250, 250}, nil},
+		{"zero weight gets nothing", 100, []int64{0, 1, 1}, []int64{0, 50, 50}, nil},
+		{"remainder skips zero weight", 101, []int64{1, 0, 1}, []int64{51, 0, 50}, nil},
+		{"negative amount", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}, nil},
+		{"more parts than minor units", 2, []int64{1, 1, 1}, []int64{1, 1, 0}, nil},
+		{"large amount", math.MaxInt64, []int64{1, 1}, []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}, nil},
+		{"all zero weights", 100, []int64{0, 0}, nil, ErrInvalidAmount},
+		{"no weights", 100, nil, nil, ErrInvalidAmount},
+		{"negative weight", 100, []int64{1, -1}, nil, ErrInvalidAmount},
+	} {
+		parts, err := thb(tc.amount).Allocate(tc.weights...)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		sum := thb(0)
+		for i, part := range parts {
+			if part != thb(tc.want[i]) {
+				t.Errorf("%s: part %d = %+v, want %d", tc.name, i, part, tc.want[i])
+			}
+			if sum, err = sum.Add(part); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+		if sum.Amount != tc.amount {
+			t.Errorf("%s: parts sum to %d, want %d", tc.name, sum.Amount, tc.amount)
+		}
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		money Money
+		want  string
+	}{
+		{thb(99999), "999.99"},
+		{thb(5), "0.05"},
+		{thb(0), "0.00"},
+		{thb(-1), "-0.01"},
+		{thb(-12345), "-123.45"},
+		{NewMoney(1500, "JPY"), "1500"},
+		{thb(math.MinInt64), "-92233720368547758.08"},
+	} {
+		if got := tc.money.Decimal(); got != tc.want {
+			t.Errorf("%d %s: Decimal = %q, want %q", tc.money.Amount, tc.money.Currency, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	// Marshal แล้ว Unmarshal ต้องได้ค่าเดิม
+	for _, m := range []Money{thb(99999), thb(-1), thb(0), NewMoney(1250, "USD"), NewMoney(1500, "JPY")} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Errorf("unmarshal %s: %v", data, err)
+			continue
+		}
+		if got != m {
+			t.Errorf("round trip %s = %+v, want %+v", data, got, m)
+		}
+	}
+
+	if data, _ := json.Marshal(thb(99999)); string(data) != `{"amount":"999.99","currency":"THB"}` {
+		t.Errorf("marshal = %s", data)
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{`{"amount": "12.50", "currency": "USD"}`, NewMoney(1250, "USD"), false},
+		{`{"amount": 12.5, "currency": "usd"}`, NewMoney(1250, "USD"), false},
+		{`{"amount": "3"}`, thb(300), false},
+		{`"999.99"`, thb(99999), false},
+		{`999.99`, thb(99999), false},
+		{`0.30000000000000004`, Money{}, true}, // ไม่ปัดเงียบ ๆ แบบ float
+		{`"abc"`, Money{}, true},
+		{`{"amount": "1.00", "currency": "XXX"}`, Money{}, true},
+	} {
+		var got Money
+		err := json.Unmarshal([]byte(tc.in), &got)
+		if (err != nil) != tc.err {
+			t.Errorf("unmarshal %s: err = %v, want error %v", tc.in, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("unmarshal %s = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMoneySQL(t *testing.T) {
+	// Value แล้ว Scan ต้องได้หน่วยย่อยเดิม (Currency scan แยก column)
+	for _, amount := range []int64{0, 99999, -1, math.MaxInt64, math.MinInt64} {
+		value, err := thb(amount).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Money{Currency: "THB"}
+		if err := got.Scan(value); err != nil {
+			t.Errorf("scan %v: %v", value, err)
+			continue
+		}
+		if got != thb(amount) {
+			t.Errorf("round trip %d = %+v", amount, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		src  interface{}
+		want int64
+		err  bool
+	}{
+		{int64(505), 505, false},
+		{[]byte("505"), 505, false},
+		{"-42", -42, false},
+		{nil, 0, false},
+		{"5.05", 0, true},
+		{3.14, 0, true},
+	} {
+		got := thb(7)
+		err := got.Scan(tc.src)
+		if (err != nil) != tc.err {
+			t.Errorf("scan %#v: err = %v, want error %v", tc.src, err, tc.err)
+			continue
+		}
+		if !tc.err && got != thb(tc.want) {
+			t.Errorf("scan %#v = %+v, want %d", tc.src, got, tc.want)
+		}
+	}
+
+	// ผ่าน database จริง: BIGINT เก็บได้ครบทุกหลัก
+	testDB := openEmptyTestDB(t)
+	var got Money
+	if err := testDB.QueryRowContext(context.Background(), "SELECT $1", thb(math.MaxInt64)).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Amount != math.MaxInt64 {
+		t.Errorf("database round trip = %d, want %d", got.Amount, int64(math.MaxInt64))
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Order Queries ============
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// OrderFilter เงื่อนไขการค้นหา orders (field ที่เป็น nil = ไม่กรอง)
+type OrderFilter struct {
+	UserID *int
+	Status *OrderStatus
+	From   *time.Time // created_at >= From
+	To     *time.Time // created_at < To
+	Cursor int        // keyset: เอาเฉพาะ id < Cursor (0 = หน้าแรก)
+	Limit  int
+}
+
+// OrderItemDetail คือ order item พร้อมชื่อสินค้า
+type OrderItemDetail struct {
+	OrderItem
+	ProductName string `json:"product_name"`
+}
+
+// OrderDetail คือ order พร้อม items
+type OrderDetail struct {
+	Order
+	Items     []OrderItemDetail `json:"items"`
+	Subtotal  Money             `json:"subtotal"` // ยอดก่อนหักส่วนลด (total = subtotal - discounts)
+	Discounts []OrderDiscount   `json:"discounts"`
+}
+
+// List ค้นหา orders เรียงจากใหม่ไปเก่าแบบ keyset pagination
+// (WHERE id < cursor ORDER BY id DESC ใช้ index ได้ตรง ๆ ไม่ต้อง OFFSET ข้ามแถว)
+func (r *orderRepository) List(ctx context.Context, q DBTX, filter OrderFilter) ([]Order, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserID != nil {
+		where = append(where, "user_id = "+arg(*filter.UserID))
+	}
+	if filter.Status != nil {
+		where = append(where, "status = "+arg(*filter.Status))
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < "+arg(*filter.To))
+	}
+	if filter.Cursor > 0 {
+		where = append(where, "id < "+arg(filter.Cursor))
+	}
+
+	query := "SELECT " + orderColumns + " FROM orders"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + arg(filter.Limit)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	return orders, rows.Err()
+}
+
+// ItemsForOrders โหลด items ของหลาย orders ใน query เดียว (กัน N+1) แล้วจัดกลุ่มตาม order_id
+func (r *orderRepository) ItemsForOrders(ctx context.Context, q DBTX, orderIDs []int) (map[int][]OrderItemDetail, error) {
+	items := make(map[int][]OrderItemDetail, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return items, nil
+	}
+
+	placeholders := make([]string, len(orderIDs))
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT oi.id, oi.order_id, oi.product_id, oi.quantity, oi.price, o.currency, p.name
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY oi.order_id, oi.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItemDetail
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity,
+			&item.Price, &item.Price.Currency, &item.ProductName); err != nil {
+			return nil, err
+		}
+		items[item.OrderID] = append(items[item.OrderID], item)
+	}
+	return items, rows.Err()
+}
+
+// ListOrders ค้นหา orders พร้อม items และส่ง cursor ของหน้าถัดไป (0 = ไม่มีหน้าถัดไป)
+func (s *OrderService) ListOrders(ctx context.Context, filter OrderFilter) ([]OrderDetail, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultOrderPageSize
+	}
+	if filter.Limit > maxOrderPageSize {
+		filter.Limit = maxOrderPageSize
+	}
+
+	// ขอเกินมา 1 แถวเพื่อรู้ว่ามีหน้าถัดไปหรือไม่
+	pageSize := filter.Limit
+	filter.Limit++
+	orders, err := s.orderRepo.List(ctx, s.db, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nextCursor := 0
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		nextCursor = orders[pageSize-1].ID
+	}
+
+	details, err := s.withItems(ctx, orders)
+	if err != nil {
+		return nil, 0, err
+	}
+	return details, nextCursor, nil
+}
+
+// GetOrder ดึง order เดียวพร้อม items
+func (s *OrderService) GetOrder(ctx context.Context, id int) (*OrderDetail, error) {
+	order, err := s.orderRepo.GetByID(ctx, s.db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.withItems(ctx, []Order{*order})
+	if err != nil {
+		return nil, err
+	}
+	return &details[0], nil
+}
+
+func (s *OrderService) withItems(ctx context.Context, orders []Order) ([]OrderDetail, error) {
+	ids := make([]int, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+
+	itemsByOrder, err := s.orderRepo.ItemsForOrders(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	discountsByOrder, err := s.couponRepo.DiscountsForOrders(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]OrderDetail, len(orders))
+	for i, order := range orders {
+		items := itemsByOrder[order.ID]
+		if items == nil {
+			items = []OrderItemDetail{}
+		}
+		discounts := discountsByOrder[order.ID]
+		if discounts == nil {
+			discounts = []OrderDiscount{}
+		}
+		subtotal := order.Total
+		for _, discount := range discounts {
+			if subtotal, err = subtotal.Add(discount.Amount); err != nil {
+				return nil, err
+			}
+		}
+		details[i] = OrderDetail{Order: order, Items: items, Subtotal: subtotal, Discounts: discounts}
+	}
+	return details, nil
+}
+
+// parseOrderFilter อ่าน query string: status, from, to (RFC3339 หรือ YYYY-MM-DD), cursor, limit
+func parseOrderFilter(c *fiber.Ctx) (OrderFilter, error) {
+	var filter OrderFilter
+
+	if v := c.Query("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id %q", v)
+		}
+		filter.UserID = &userID
+	}
+	if v := c.Query("status"); v != "" {
+		status := OrderStatus(v)
+		if !status.Valid() {
+			return filter, fmt.Errorf("%w: %q", ErrUnknownStatus, v)
+		}
+		filter.Status = &status
+	}
+	for _, p := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseDateParam(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q (use RFC3339 or YYYY-MM-DD)", p.name, v)
+		}
+		*p.target = &t
+	}
+
+	var err error
+	if filter.Cursor, err = strconv.Atoi(c.Query("cursor", "0")); err != nil || filter.Cursor < 0 {
+		return filter, fmt.Errorf("invalid cursor %q", c.Query("cursor"))
+	}
+	if filter.Limit, err = strconv.Atoi(c.Query("limit", "0")); err != nil || filter.Limit < 0 {
+		return filter, fmt.Errorf("invalid limit %q", c.Query("limit"))
+	}
+	return filter, nil
+}
+
+func parseDateParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// scopeOrderFilter จำกัด filter ให้เห็นแค่ order ของผู้เรียก (admin เห็นทั้งหมด)
+// ขอ user_id ของคนอื่น = ErrNotOrderOwner, ไม่ระบุตัวตน = ErrCallerUnknown
+func scopeOrderFilter(c *fiber.Ctx, filter *OrderFilter) error {
+	userID, admin, ok := orderCaller(c)
+	switch {
+	case !ok:
+		return ErrCallerUnknown
+	case admin:
+		return nil
+	case filter.UserID != nil && *filter.UserID != userID:
+		return ErrNotOrderOwner
+	}
+	filter.UserID = &userID
+	return nil
+}
+
+// Handlers
+
+func listOrdersHandler(orderService *OrderService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter, err := parseOrderFilter(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := scopeOrderFilter(c, &filter); err != nil {
+			return orderAccessError(c, err)
+		}
+		return respondOrderPage(c, orderService, filter)
+	}
+}
+
+func getUserOrdersHandler(q DBTX, userRepo UserRepository, orderService *OrderService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		// ตรวจสิทธิ์ก่อนหา user จะได้ไม่บอกคนอื่นว่ามี user id นี้หรือไม่
+		filter, err := parseOrderFilter(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		filter.UserID = &userID
+		if err := scopeOrderFilter(c, &filter); err != nil {
+			return orderAccessError(c, err)
+		}
+
+		if _, err := userRepo.GetByID(c.UserContext(), q, userID); errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		} else if err != nil {
+			return err
+		}
+		return respondOrderPage(c, orderService, filter)
+	}
+}
+
+func respondOrderPage(c *fiber.Ctx, orderService *OrderService, filter OrderFilter) error {
+	orders, nextCursor, err := orderService.ListOrders(c.UserContext(), filter)
+	if err != nil {
+		return err
+	}
+
+	response := fiber.Map{
+		"success":     true,
+		"data":        orders,
+		"count":       len(orders),
+		"next_cursor": nil,
+	}
+	if nextCursor > 0 {
+		response["next_cursor"] = nextCursor
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Order State Machine ============
+
+// OrderStatus สถานะของ order
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions สถานะถัดไปที่อนุญาตจากแต่ละสถานะ
+//
+//	pending → paid → shipped → delivered
+//	   ↓        ↓                  ↓
+//	cancelled  cancelled/refunded  refunded
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrInvalidTransition = errors.New("invalid order status transition")
+)
+
+// TransitionError บอกว่าเปลี่ยนจากสถานะไหนไปไหนไม่ได้ (errors.Is กับ ErrInvalidTransition ได้)
+type TransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: %s → %s", ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// Valid ตรวจว่าเป็นสถานะที่รู้จัก
+func (s OrderStatus) Valid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// CanTransitionTo ตรวจว่าเปลี่ยนจากสถานะนี้ไปเป็น next ได้หรือไม่
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// restocks บอกว่าการเปลี่ยนสถานะนี้ต้องคืน stock หรือไม่
+// จ่ายเงินแล้ว (stock ถูกตัดจริง) แต่ยกเลิกหรือ refund ก่อนส่งของ = สินค้ายังอยู่ในคลัง
+// ส่วน order ที่ยัง pending แค่จองไว้ ใช้ releaseReservations แทน
+func restocks(from, to OrderStatus) bool {
+	return from == OrderStatusPaid && (to == OrderStatusCancelled || to == OrderStatusRefunded)
+}
+
+// OrderStatusChange หนึ่งแถวใน order_status_history
+type OrderStatusChange struct {
+	ID         int          `json:"id"`
+	OrderID    int          `json:"order_id"`
+	FromStatus *OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus  `json:"to_status"`
+	Note       string       `json:"note"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// UpdateStatus เปลี่ยนสถานะ order ตาม state machine ใน transaction เดียว
+// จ่ายเงิน = ตัด stock ตามที่จองไว้, ยกเลิก = ปล่อยการจองหรือคืน stock และคืนสิทธิ์คูปองใน transaction เดียวกัน
+func (s *OrderService) UpdateStatus(ctx context.Context, orderID int, next OrderStatus, note string) (*Order, error) {
+	if !next.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, next)
+	}
+
+	var order *Order
+	err := s.tx.WithTx(ctx, nil, func(tx *Tx) error {
+		// Lock แถว order กันไม่ให้สอง request เปลี่ยนสถานะพร้อมกัน
+		var err error
+		order, err = s.orderRepo.GetByIDForUpdate(ctx, tx, orderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		current := order.Status
+		if !current.CanTransitionTo(next) {
+			return &TransitionError{From: current, To: next}
+		}
+
+		switch {
+		case current == OrderStatusPending && next == OrderStatusPaid:
+			if _, err := s.confirmReservations(ctx, tx, orderID); err != nil {
+				return err
+			}
+		case current == OrderStatusPending && next == OrderStatusCancelled:
+			released, err := s.releaseReservations(ctx, tx, orderID)
+			if err != nil {
+				return err
+			}
+			// order ที่สร้างก่อนมีระบบจองตัด stock ไปแล้ว ต้องคืนแบบเดิม
+			if released == 0 {
+				if err := s.productRepo.RestockOrder(ctx, tx, orderID); err != nil {
+					return err
+				}
+			}
+		case restocks(current, next):
+			if err := s.productRepo.RestockOrder(ctx, tx, orderID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orderRepo.UpdateStatus(ctx, tx, orderID, current, next); err != nil {
+			return err
+		}
+		order.Status = next
+
+		if next == OrderStatusCancelled {
+			// order ที่ถูกยกเลิกคืนสิทธิ์คูปอง (refund ไม่คืน เพราะ order นั้นถูกใช้จริงไปแล้ว)
+			if err := s.releaseCoupons(ctx, tx, orderID); err != nil {
+				return err
+			}
+			if err := s.recordEvent(ctx, tx, "order", orderID, EventOrderCancelled, OrderCancelledEvent{
+				OrderID: orderID, UserID: order.UserID, FromStatus: current, Reason: note,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return s.orderRepo.AddStatusChange(ctx, tx, &OrderStatusChange{
+			OrderID:    orderID,
+			FromStatus: &current,
+			ToStatus:   next,
+			Note:       note,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// StatusHistory ดึงประวัติการเปลี่ยนสถานะของ order เรียงตามเวลา
+func (s *OrderService) StatusHistory(ctx context.Context, orderID int) ([]OrderStatusChange, error) {
+	return s.orderRepo.StatusHistory(ctx, s.db, orderID)
+}
+
+// Handlers
+
+func updateOrderStatusHandler(orderService *OrderService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+		}
+
+		var req struct {
+			Status OrderStatus `json:"status"`
+			Note   string      `json:"note"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		// admin เปลี่ยนได้ทุกสถานะ เจ้าของ order ยกเลิกได้อย่างเดียว
+		if err := authorizeOrder(c, orderService, id); err != nil {
+			return orderAccessError(c, err)
+		}
+		if _, admin, _ := orderCaller(c); !admin && req.Status != OrderStatusCancelled {
+			return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("Only admins can set status %q", req.Status)})
+		}
+
+		order, err := orderService.UpdateStatus(c.UserContext(), id, req.Status, req.Note)
+		var transitionErr *TransitionError
+		switch {
+		case errors.Is(err, ErrUnknownStatus):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, ErrOrderNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+		case errors.Is(err, ErrReservationExpired):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case errors.As(err, &transitionErr):
+			return c.Status(409).JSON(fiber.Map{
+				"error":   err.Error(),
+				"current": transitionErr.From,
+				"allowed": orderTransitions[transitionErr.From],
+			})
+		case err != nil:
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"order":   order,
+		})
+	}
+}
+
+func getOrderHistoryHandler(orderService *OrderService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+		}
+
+		if err := authorizeOrder(c, orderService, id); err != nil {
+			return orderAccessError(c, err)
+		}
+
+		history, err := orderService.StatusHistory(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"history": history,
+		})
+	}
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tests รันกับ SQLite ในไฟล์ชั่วคราว ไม่ต้องมี PostgreSQL (go test ./...)
+
+type testFixture struct {
+	db       *DB
+	service  *OrderService
+	products *productRepository
+	userID   int
+	laptop   *Product
+	mouse    *Product
+}
+
+func newTestFixture(t *testing.T) *testFixture {
+	t.Helper()
+	testDB := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+
+	f := &testFixture{db: testDB, service: NewOrderService(NewDBRouter(testDB)), products: &productRepository{}}
+
+	// fixtures/test.yaml: user john, laptop (stock 10, 999.99) และ mouse (stock 50, 29.99)
+	refs := loadTestFixtures(t, testDB, "test")
+	f.userID = int(refs.ID("users.john"))
+	f.laptop = f.product(t, int(refs.ID("products.laptop")))
+	f.mouse = f.product(t, int(refs.ID("products.mouse")))
+	return f
+}
+
+// loadTestFixtures reset database แล้วโหลดชุดข้อมูล name จาก fixtures/
+func loadTestFixtures(t *testing.T, testDB *DB, name string) FixtureRefs {
+	t.Helper()
+	ds, err := LoadDataset(fixtureFiles, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := NewFixtureLoader(testDB).Reset(context.Background(), ds)
+	if err != nil {
+		t.Fatalf("load fixtures %q: %v", name, err)
+	}
+	return refs
+}
+
+// openTestDB เปิด SQLite ที่ path แล้ว migrate ให้พร้อมใช้
+func openTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+	testDB, err := OpenDB(sqliteDialect{}, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(testDB.Dialect()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMigrator(testDB, migrations).Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return testDB
+}
+
+func (f *testFixture) createProduct(t *testing.T, sku string, price Money, stock int) *Product {
+	t.Helper()
+	product := &Product{SKU: sku, Name: sku, Category: "test", Price: price, Stock: stock}
+	if err := f.products.Create(context.Background(), f.db, product); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func (f *testFixture) product(t *testing.T, id int) *Product {
+	t.Helper()
+	product, err := f.products.GetByID(context.Background(), f.db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func (f *testFixture) placeOrder(t *testing.T, items ...PlaceOrderItemRequest) *PlacedOrder {
+	t.Helper()
+	placed, err := f.service.PlaceOrder(context.Background(), PlaceOrderRequest{UserID: f.userID, Items: items})
+	if err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+	return placed
+}
+
+func (f *testFixture) createUser(t *testing.T, email string) int {
+	t.Helper()
+	user := &User{Email: email, Name: email}
+	if err := (&userRepository{}).Create(context.Background(), f.db, user); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// newOrderAPI app ที่มี identify() และ order endpoints เหมือน main (ADMIN_TOKEN = secret)
+func (f *testFixture) newOrderAPI(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("ADMIN_TOKEN", "secret")
+	app := fiber.New()
+	app.Use(identify())
+	app.Get("/users/:id/orders", getUserOrdersHandler(f.db, &userRepository{}, f.service))
+	app.Get("/orders", listOrdersHandler(f.service))
+	app.Get("/orders/:id", getOrderHandler(f.service))
+	app.Patch("/orders/:id/status", updateOrderStatusHandler(f.service))
+	app.Get("/orders/:id/history", getOrderHistoryHandler(f.service))
+	return app
+}
+
+// callOrderAPI เรียกในนาม caller: "admin", "" (ไม่ระบุตัวตน) หรือ user ID
+func callOrderAPI(t *testing.T, app *fiber.App, caller, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	switch caller {
+	case "":
+	case "admin":
+		req.Header.Set("X-Admin-Token", "secret")
+	default:
+		req.Header.Set("X-User-ID", caller)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func assertStock(t *testing.T, product *Product, stock, reserved int) {
+	t.Helper()
+	if product.Stock != stock || product.Reserved != reserved {
+		t.Errorf("%s: stock=%d reserved=%d, want stock=%d reserved=%d",
+			product.SKU, product.Stock, product.Reserved, stock, reserved)
+	}
+}
+
+func TestPlaceOrderReservesStock(t *testing.T) {
+	f := newTestFixture(t)
+
+	placed := f.placeOrder(t,
+		PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 2},
+		PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1},
+	)
+
+	if placed.Status != OrderStatusPending {
+		t.Errorf("status = %s, want pending", placed.Status)
+	}
+	if want := NewMoney(2*99999+2999, "THB"); placed.Total != want {
+		t.Errorf("total = %s, want %s", placed.Total, want)
+	}
+	// ยังไม่จ่ายเงิน: stock เท่าเดิม แค่ถูกจอง
+	assertStock(t, f.product(t, f.laptop.ID), 10, 2)
+	assertStock(t, f.product(t, f.mouse.ID), 50, 1)
+}
+
+func TestPlaceOrderInsufficientStockRollsBack(t *testing.T) {
+	f := newTestFixture(t)
+
+	_, err := f.service.PlaceOrder(context.Background(), PlaceOrderRequest{UserID: f.userID, Items: []PlaceOrderItemRequest{
+		{ProductID: f.laptop.ID, Quantity: 1},
+		{ProductID: f.mouse.ID, Quantity: 51},
+	}})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err = %v, want ErrInsufficientStock", err)
+	}
+
+	// การจอง laptop ที่ทำไปก่อนต้องถูก rollback ด้วย
+	assertStock(t, f.product(t, f.laptop.ID), 10, 0)
+	orders, _, err := f.service.ListOrders(context.Background(), OrderFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("orders = %d, want 0", len(orders))
+	}
+}
+
+func TestPayConfirmsReservation(t *testing.T) {
+	f := newTestFixture(t)
+	placed := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 3})
+
+	if _, err := f.service.UpdateStatus(context.Background(), placed.ID, OrderStatusPaid, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, f.product(t, f.laptop.ID), 7, 0)
+
+	// จ่ายแล้วยกเลิก = คืนของเข้าคลัง
+	if _, err := f.service.UpdateStatus(context.Background(), placed.ID, OrderStatusCancelled, "changed mind"); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, f.product(t, f.laptop.ID), 10, 0)
+}
+
+func TestCancelReleasesReservation(t *testing.T) {
+	f := newTestFixture(t)
+	placed := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 3})
+
+	if _, err := f.service.UpdateStatus(context.Background(), placed.ID, OrderStatusCancelled, ""); err != nil {
+		t.Fatal(err)
+	}
+	assertStock(t, f.product(t, f.laptop.ID), 10, 0)
+
+	_, err := f.service.UpdateStatus(context.Background(), placed.ID, OrderStatusPaid, "")
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("pay after cancel: err = %v, want ErrInvalidTransition", err)
+	}
+
+	history, err := f.service.StatusHistory(context.Background(), placed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[1].ToStatus != OrderStatusCancelled {
+		t.Errorf("history = %+v, want pending → cancelled", history)
+	}
+}
+
+func TestOrderStatusRequiresOwnerOrAdmin(t *testing.T) {
+	f := newTestFixture(t)
+	app := f.newOrderAPI(t)
+	placed := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 2})
+	john := strconv.Itoa(f.userID)
+	jane := strconv.Itoa(f.createUser(t, "jane@example.com"))
+	order := fmt.Sprintf("/orders/%d", placed.ID)
+
+	for _, tc := range []struct {
+		name   string
+		caller string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"anonymous", "", "PATCH", order + "/status", `{"status": "paid"}`, 401},
+		{"owner cannot mark paid", john, "PATCH", order + "/status", `{"status": "paid"}`, 403},
+		{"other user cannot cancel", jane, "PATCH", order + "/status", `{"status": "cancelled"}`, 403},
+		{"other user cannot read history", jane, "GET", order + "/history", "", 403},
+		{"anonymous cannot read history", "", "GET", order + "/history", "", 401},
+		{"owner reads history", john, "GET", order + "/history", "", 200},
+		{"missing order", john, "PATCH", "/orders/999999/status", `{"status": "cancelled"}`, 404},
+		{"admin marks paid", "admin", "PATCH", order + "/status", `{"status": "paid"}`, 200},
+		{"owner cancels", john, "PATCH", order + "/status", `{"status": "cancelled"}`, 200},
+	} {
+		if status, body := callOrderAPI(t, app, tc.caller, tc.method, tc.path, tc.body); status != tc.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tc.name, status, tc.status, body)
+		}
+	}
+
+	// จ่ายโดย admin แล้วเจ้าของยกเลิก = คืนของเข้าคลัง
+	assertStock(t, f.product(t, f.laptop.ID), 10, 0)
+}
+
+// orderIDs ดึง id และ user_id ของ orders จาก response แบบหน้า
+func orderIDs(body map[string]interface{}) (ids []int, owners map[int]bool) {
+	owners = map[int]bool{}
+	data, _ := body["data"].([]interface{})
+	for _, item := range data {
+		order, _ := item.(map[string]interface{})
+		id, _ := order["id"].(float64)
+		userID, _ := order["user_id"].(float64)
+		ids = append(ids, int(id))
+		owners[int(userID)] = true
+	}
+	return ids, owners
+}
+
+func TestOrderQueriesScopedToCaller(t *testing.T) {
+	f := newTestFixture(t)
+	app := f.newOrderAPI(t)
+	johnOrder := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+	janeID := f.createUser(t, "jane@example.com")
+	if _, err := f.service.PlaceOrder(context.Background(), PlaceOrderRequest{
+		UserID: janeID, Items: []PlaceOrderItemRequest{{ProductID: f.mouse.ID, Quantity: 1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	john, jane := strconv.Itoa(f.userID), strconv.Itoa(janeID)
+
+	for _, tc := range []struct {
+		name   string
+		caller string
+		path   string
+		status int
+		count  int   // จำนวน orders ในหน้า (ถ้า 200 และเป็น list)
+		owners []int // เจ้าของ orders ที่ต้องเห็น
+	}{
+		{"anonymous list", "", "/orders", 401, 0, nil},
+		{"user sees own orders", john, "/orders", 200, 2, []int{f.userID}},
+		{"user filters by self", john, "/orders?user_id=" + john, 200, 2, []int{f.userID}},
+		{"user asks for another user", john, "/orders?user_id=" + jane, 403, 0, nil},
+		{"admin sees all", "admin", "/orders", 200, 3, []int{f.userID, janeID}},
+		{"admin filters by user", "admin", "/orders?user_id=" + jane, 200, 1, []int{janeID}},
+		{"anonymous user orders", "", "/users/" + jane + "/orders", 401, 0, nil},
+		{"own user orders", jane, "/users/" + jane + "/orders", 200, 1, []int{janeID}},
+		{"other user orders", john, "/users/" + jane + "/orders", 403, 0, nil},
+		// ไม่บอกคนอื่นว่ามี user id นี้หรือไม่
+		{"other missing user", john, "/users/999999/orders", 403, 0, nil},
+		{"admin missing user", "admin", "/users/999999/orders", 404, 0, nil},
+		{"admin user orders", "admin", "/users/" + john + "/orders", 200, 2, []int{f.userID}},
+	} {
+		status, body := callOrderAPI(t, app, tc.caller, "GET", tc.path, "")
+		if status != tc.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tc.name, status, tc.status, body)
+			continue
+		}
+		if status != 200 {
+			continue
+		}
+		ids, owners := orderIDs(body)
+		if len(ids) != tc.count || len(owners) != len(tc.owners) {
+			t.Errorf("%s: %d orders of users %v, want %d of %v", tc.name, len(ids), owners, tc.count, tc.owners)
+		}
+		for _, owner := range tc.owners {
+			if !owners[owner] {
+				t.Errorf("%s: missing orders of user %d", tc.name, owner)
+			}
+		}
+	}
+
+	order := fmt.Sprintf("/orders/%d", johnOrder.ID)
+	for _, tc := range []struct {
+		name   string
+		caller string
+		path   string
+		status int
+	}{
+		{"anonymous detail", "", order, 401},
+		{"owner detail", john, order, 200},
+		{"other user detail", jane, order, 403},
+		{"admin detail", "admin", order, 200},
+		{"missing order", john, "/orders/999999", 404},
+		{"invalid id", john, "/orders/abc", 400},
+	} {
+		status, body := callOrderAPI(t, app, tc.caller, "GET", tc.path, "")
+		if status != tc.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tc.name, status, tc.status, body)
+			continue
+		}
+		if status == 200 {
+			detail, _ := body["order"].(map[string]interface{})
+			items, _ := detail["items"].([]interface{})
+			if id, _ := detail["id"].(float64); int(id) != johnOrder.ID || len(items) != 1 {
+				t.Errorf("%s: order = %v, want order %d with 1 item", tc.name, detail, johnOrder.ID)
+			}
+		}
+	}
+}
+
+func TestOrderQueryFiltersAndPagination(t *testing.T) {
+	f := newTestFixture(t)
+	app := f.newOrderAPI(t)
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1}).ID)
+	}
+	// ids[0] สร้างเมื่อต้นปี 2024, ids[1] จ่ายแล้ว
+	if _, err := f.db.ExecContext(context.Background(), "UPDATE orders SET created_at = $1 WHERE id = $2",
+		time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.UpdateStatus(context.Background(), ids[1], OrderStatusPaid, ""); err != nil {
+		t.Fatal(err)
+	}
+	john := strconv.Itoa(f.userID)
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		status int
+		ids    []int // เรียง id มากไปน้อย
+		next   int   // next_cursor (0 = ไม่มีหน้าถัดไป)
+	}{
+		{"all", "", 200, []int{ids[4], ids[3], ids[2], ids[1], ids[0]}, 0},
+		{"status", "?status=paid", 200, []int{ids[1]}, 0},
+		{"pending", "?status=pending", 200, []int{ids[4], ids[3], ids[2], ids[0]}, 0},
+		{"date range", "?from=2024-01-01&to=2024-02-01", 200, []int{ids[0]}, 0},
+		{"from date", "?from=2025-01-01", 200, []int{ids[4], ids[3], ids[2], ids[1]}, 0},
+		{"rfc3339", "?to=2024-01-15T13:00:00Z", 200, []int{ids[0]}, 0},
+		{"first page", "?limit=2", 200, []int{ids[4], ids[3]}, ids[3]},
+		{"second page", fmt.Sprintf("?limit=2&cursor=%d", ids[3]), 200, []int{ids[2], ids[1]}, ids[1]},
+		{"last page", fmt.Sprintf("?limit=2&cursor=%d", ids[1]), 200, []int{ids[0]}, 0},
+		{"exact page", "?limit=5", 200, []int{ids[4], ids[3], ids[2], ids[1], ids[0]}, 0},
+		{"page with filter", "?status=pending&limit=3", 200, []int{ids[4], ids[3], ids[2]}, ids[2]},
+		{"unknown status", "?status=lost", 400, nil, 0},
+		{"invalid date", "?from=yesterday", 400, nil, 0},
+		{"invalid cursor", "?cursor=-1", 400, nil, 0},
+		{"invalid limit", "?limit=x", 400, nil, 0},
+	} {
+		for _, path := range []string{"/orders", "/users/" + john + "/orders"} {
+			status, body := callOrderAPI(t, app, john, "GET", path+tc.query, "")
+			if status != tc.status {
+				t.Errorf("%s %s: status = %d, want %d (%v)", tc.name, path, status, tc.status, body)
+				continue
+			}
+			if status != 200 {
+				continue
+			}
+			got, _ := orderIDs(body)
+			if fmt.Sprint(got) != fmt.Sprint(tc.ids) {
+				t.Errorf("%s %s: ids = %v, want %v", tc.name, path, got, tc.ids)
+			}
+			if count, _ := body["count"].(float64); int(count) != len(tc.ids) {
+				t.Errorf("%s %s: count = %v, want %d", tc.name, path, body["count"], len(tc.ids))
+			}
+			next, _ := body["next_cursor"].(float64)
+			if int(next) != tc.next {
+				t.Errorf("%s %s: next_cursor = %v, want %d", tc.name, path, body["next_cursor"], tc.next)
+			}
+		}
+	}
+}
+
+func TestExpireReservations(t *testing.T) {
+	f := newTestFixture(t)
+	f.service.reservationTTL = -time.Minute // หมดอายุทันที
+	expired := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 2})
+	f.service.reservationTTL = 15 * time.Minute
+	active := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 1})
+
+	_, err := f.service.UpdateStatus(context.Background(), expired.ID, OrderStatusPaid, "")
+	if !errors.Is(err, ErrReservationExpired) {
+		t.Errorf("pay expired order: err = %v, want ErrReservationExpired", err)
+	}
+
+	n, err := f.service.ExpireReservations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expired = %d, want 1", n)
+	}
+
+	order, err := f.service.GetOrder(context.Background(), expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderStatusCancelled {
+		t.Errorf("expired order status = %s, want cancelled", order.Status)
+	}
+	order, err = f.service.GetOrder(context.Background(), active.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != OrderStatusPending {
+		t.Errorf("active order status = %s, want pending", order.Status)
+	}
+	assertStock(t, f.product(t, f.laptop.ID), 10, 1)
+}
+
+func TestOutboxRelayPublishesOnce(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 6}) // available 10 → 4 = StockLow
+
+	bus := NewEventBus()
+	received := map[string]int{}
+	bus.Subscribe("*", func(ctx context.Context, event OutboxEvent) error {
+		received[event.EventType]++
+		return nil
+	})
+	relay := NewOutboxRelay(f.db, bus)
+
+	published, err := relay.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 2 || received[EventOrderPlaced] != 1 || received[EventStockLow] != 1 {
+		t.Errorf("published = %d, received = %v, want OrderPlaced and StockLow once", published, received)
+	}
+
+	// รอบถัดไปไม่มีอะไรค้าง
+	if published, err = relay.RelayOnce(ctx); err != nil || published != 0 {
+		t.Errorf("second relay: published = %d, err = %v, want 0", published, err)
+	}
+
+	// relay ส่งซ้ำ (เช่น commit ไม่ทัน) bus ต้องไม่เรียก subscribers อีก
+	var event OutboxEvent
+	if err := f.db.QueryRowContext(ctx,
+		"SELECT event_id, event_type FROM outbox WHERE event_type = $1", EventOrderPlaced).
+		Scan(&event.EventID, &event.EventType); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if received[EventOrderPlaced] != 1 {
+		t.Errorf("duplicate delivery: OrderPlaced received %d times", received[EventOrderPlaced])
+	}
+}
+
+// publisherFunc ให้ tests สร้าง Publisher จาก function
+type publisherFunc func(ctx context.Context, event OutboxEvent) error
+
+func (f publisherFunc) Publish(ctx context.Context, event OutboxEvent) error { return f(ctx, event) }
+
+func TestOutboxRelayPublishesOutsideTransaction(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+
+	// SQLite เปิด transaction ด้วย write lock ถ้า relay ยังถือ transaction อยู่ระหว่าง publish
+	// การเขียนจาก publisher จะต้องรอ busy_timeout แล้ว error
+	fail := true
+	relay := NewOutboxRelay(f.db, publisherFunc(func(ctx context.Context, event OutboxEvent) error {
+		if err := NewTxManager(f.db).WithTx(ctx, nil, func(tx *Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE products SET name = name WHERE id = $1", f.mouse.ID)
+			return err
+		}); err != nil {
+			t.Errorf("write during publish: %v", err)
+		}
+		if fail {
+			return errors.New("broker down")
+		}
+		return nil
+	}))
+
+	for _, step := range []struct {
+		name      string
+		fail      bool
+		advance   time.Duration // เลื่อน next_attempt_at ของทุกแถวย้อนหลังเท่านี้ก่อนรัน (จำลองเวลาผ่านไป)
+		published int
+		attempts  int
+	}{
+		{"publish fails", true, 0, 0, 1},
+		{"backing off", false, 0, 0, 1},
+		{"retry succeeds", false, time.Hour, 1, 1},
+		{"nothing pending", false, time.Hour, 0, 1},
+	} {
+		fail = step.fail
+		if step.advance > 0 {
+			if _, err := f.db.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = $1 WHERE published_at IS NULL",
+				time.Now().Add(-step.advance)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		published, err := relay.RelayOnce(ctx)
+		if err != nil || published != step.published {
+			t.Errorf("%s: published = %d, err = %v, want %d", step.name, published, err, step.published)
+		}
+		var attempts int
+		if err := f.db.QueryRowContext(ctx, "SELECT attempts FROM outbox WHERE event_type = $1", EventOrderPlaced).
+			Scan(&attempts); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != step.attempts {
+			t.Errorf("%s: attempts = %d, want %d", step.name, attempts, step.attempts)
+		}
+	}
+}
+
+func TestOutboxClaimLease(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	repo := &outboxRepository{}
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+
+	now := time.Now()
+	claimed, err := repo.ClaimPending(ctx, f.db, now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("first claim: %d events, err = %v, want 1", len(claimed), err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"other relay during lease", now.Add(time.Second), 0},
+		{"after lease expired", now.Add(2 * time.Minute), 1},
+	} {
+		if pending, err := repo.HasPending(ctx, f.db, tc.at); err != nil || pending != (tc.want > 0) {
+			t.Errorf("%s: pending = %v, err = %v", tc.name, pending, err)
+		}
+		events, err := repo.ClaimPending(ctx, f.db, tc.at, tc.at.Add(time.Minute), 10)
+		if err != nil || len(events) != tc.want {
+			t.Errorf("%s: claimed %d events, err = %v, want %d", tc.name, len(events), err, tc.want)
+		}
+	}
+}
+
+func TestProductConstraintErrors(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+
+	duplicate := &Product{SKU: "LAP-001", Name: "Another laptop", Category: "test", Price: NewMoney(100, "THB")}
+	if err := productConstraintError(f.products.Create(ctx, f.db, duplicate)); !errors.Is(err, ErrDuplicateSKU) {
+		t.Errorf("duplicate sku: err = %v, want ErrDuplicateSKU", err)
+	}
+
+	f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.laptop.ID, Quantity: 4})
+	laptop := f.product(t, f.laptop.ID)
+	laptop.Stock = 3 // น้อยกว่าที่จองไว้
+	if err := productConstraintError(f.products.Update(ctx, f.db, laptop)); !errors.Is(err, ErrStockBelowReserved) {
+		t.Errorf("stock below reserved: err = %v, want ErrStockBelowReserved", err)
+	}
+
+	if err := productConstraintError(f.products.Delete(ctx, f.db, f.laptop.ID)); !errors.Is(err, ErrProductInUse) {
+		t.Errorf("delete ordered product: err = %v, want ErrProductInUse", err)
+	}
+}
+
+func TestMigrationsDownAndUp(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations(migrationFiles, migrationsDir(f.db.Dialect()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := NewMigrator(f.db, migrations)
+
+	down, err := migrator.Down(ctx, len(migrations))
+	if err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if len(down) != len(migrations) {
+		t.Errorf("reverted %d, want %d", len(down), len(migrations))
+	}
+
+	up, err := migrator.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+	if len(up) != len(migrations) {
+		t.Errorf("applied %d, want %d", len(up), len(migrations))
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.Modified {
+			t.Errorf("migration %03d_%s: applied=%v modified=%v", s.Version, s.Name, s.Applied, s.Modified)
+		}
+	}
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	var versions [][]string
+	for _, dialect := range []Dialect{postgresDialect{}, sqliteDialect{}} {
+		migrations, err := loadMigrations(migrationFiles, migrationsDir(dialect))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range migrations {
+			names = append(names, m.Name)
+		}
+		versions = append(versions, names)
+	}
+	if len(versions[0]) != len(versions[1]) {
+		t.Fatalf("postgres has %d migrations, sqlite has %d", len(versions[0]), len(versions[1]))
+	}
+	for i := range versions[0] {
+		if versions[0][i] != versions[1][i] {
+			t.Errorf("migration %d: postgres %q, sqlite %q", i+1, versions[0][i], versions[1][i])
+		}
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	f := newTestFixture(t)
+	ctx := context.Background()
+	store := NewSQLIdempotencyStore(f.db)
+
+	if _, acquired, err := store.Begin(ctx, "orders", "key-1", "fp", time.Hour, time.Minute); err != nil || !acquired {
+		t.Fatalf("first begin: acquired = %v, err = %v", acquired, err)
+	}
+	if err := store.Complete(ctx, "orders", "key-1", 201, "application/json", []byte(`{"ok":true}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	record, acquired, err := store.Begin(ctx, "orders", "key-1", "fp", time.Hour, time.Minute)
+	if err != nil || acquired {
+		t.Fatalf("replay: acquired = %v, err = %v", acquired, err)
+	}
+	if record.Status != IdempotencyCompleted || record.ResponseStatus != 201 || string(record.ResponseBody) != `{"ok":true}` {
+		t.Errorf("replay record = %+v", record)
+	}
+
+	// key ที่หมดอายุแล้วถูกยึดใหม่ได้
+	if _, acquired, err := store.Begin(ctx, "orders", "key-2", "fp", -time.Minute, time.Minute); err != nil || !acquired {
+		t.Fatalf("begin expired: acquired = %v, err = %v", acquired, err)
+	}
+	if _, acquired, err := store.Begin(ctx, "orders", "key-2", "fp", time.Hour, time.Minute); err != nil || !acquired {
+		t.Errorf("reclaim expired key: acquired = %v, err = %v", acquired, err)
+	}
+
+	if n, err := store.DeleteExpired(ctx); err != nil || n != 0 {
+		t.Errorf("delete expired: n = %d, err = %v, want 0", n, err)
+	}
+}
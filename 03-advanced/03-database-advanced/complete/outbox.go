@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ============ Transactional Outbox ============
+
+// Domain events ของ order
+const (
+	EventOrderPlaced    = "OrderPlaced"
+	EventOrderCancelled = "OrderCancelled"
+	EventStockLow       = "StockLow"
+)
+
+// OutboxEvent หนึ่งแถวในตาราง outbox
+// EventID คือ dedupe ID: relay ส่งแบบ at-least-once ผู้รับจึงต้องใช้ EventID กันประมวลผลซ้ำ
+type OutboxEvent struct {
+	ID            int64           `json:"-"`
+	EventID       string          `json:"event_id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Attempts      int             `json:"-"`
+}
+
+// Payloads
+
+type OrderPlacedEvent struct {
+	OrderID   int             `json:"order_id"`
+	UserID    int             `json:"user_id"`
+	Total     Money           `json:"total"`
+	Items     []OrderItem     `json:"items"`
+	Discounts []OrderDiscount `json:"discounts,omitempty"`
+}
+
+type OrderCancelledEvent struct {
+	OrderID    int         `json:"order_id"`
+	UserID     int         `json:"user_id"`
+	FromStatus OrderStatus `json:"from_status"`
+	Reason     string      `json:"reason"`
+}
+
+type StockLowEvent struct {
+	ProductID int    `json:"product_id"`
+	SKU       string `json:"sku"`
+	Available int    `json:"available"`
+	Threshold int    `json:"threshold"`
+}
+
+// NewOutboxEvent สร้าง event พร้อม dedupe ID ใหม่
+func NewOutboxEvent(aggregateType string, aggregateID int, eventType string, payload interface{}) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEvent{
+		EventID:       uuid.NewString(),
+		AggregateType: aggregateType,
+		AggregateID:   strconv.Itoa(aggregateID),
+		EventType:     eventType,
+		Payload:       data,
+	}, nil
+}
+
+// OutboxRepository
+type OutboxRepository interface {
+	// Add เขียน event (ต้องใช้ tx เดียวกับการเปลี่ยนแปลงข้อมูล event จึงไม่หายและไม่เกินจริง)
+	Add(ctx context.Context, q DBTX, event *OutboxEvent) error
+	// HasPending มี event ที่ถึงเวลาส่งไหม (อ่านอย่างเดียว ไม่จอง lock)
+	HasPending(ctx context.Context, q DBTX, now time.Time) (bool, error)
+	// ClaimPending จอง events ที่ถึงเวลาส่งไว้จนถึง leaseUntil โดยเลื่อน next_attempt_at ออกไป
+	// relay ตัวอื่นจะไม่เห็นแถวเหล่านี้จนกว่า lease หมด (relay ที่จองไว้ตายกลางทาง = ส่งใหม่ทีหลัง)
+	ClaimPending(ctx context.Context, q DBTX, now, leaseUntil time.Time, limit int) ([]OutboxEvent, error)
+	// Unclaim คืน event ที่จองไว้แต่ยังไม่ได้ส่ง ให้ส่งได้ทันทีในรอบถัดไป
+	Unclaim(ctx context.Context, q DBTX, id int64, at time.Time) error
+	MarkPublished(ctx context.Context, q DBTX, id int64, at time.Time) error
+	MarkFailed(ctx context.Context, q DBTX, id int64, errMsg string, nextAttemptAt time.Time) error
+}
+
+type outboxRepository struct{}
+
+func (r *outboxRepository) Add(ctx context.Context, q DBTX, event *OutboxEvent) error {
+	// payload ส่งเป็น string เพราะ lib/pq ส่ง []byte เป็น bytea ซึ่ง column jsonb ไม่รับ
+	return q.QueryRowContext(ctx,
+		`INSERT INTO outbox (event_id, aggregate_type, aggregate_id, event_type, payload)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		event.EventID, event.AggregateType, event.AggregateID, event.EventType, string(event.Payload),
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (r *outboxRepository) HasPending(ctx context.Context, q DBTX, now time.Time) (bool, error) {
+	var exists int
+	err := q.QueryRowContext(ctx,
+		"SELECT 1 FROM outbox WHERE published_at IS NULL AND next_attempt_at <= $1 LIMIT 1", now).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *outboxRepository) ClaimPending(ctx context.Context, q DBTX, now, leaseUntil time.Time, limit int) ([]OutboxEvent, error) {
+	// UPDATE เดียว (atomic) ไม่ต้องถือ transaction ไว้ระหว่าง publish
+	// PostgreSQL: SKIP LOCKED ข้ามแถวที่ relay ตัวอื่นกำลังจองอยู่ในวินาทีเดียวกัน
+	rows, err := q.QueryContext(ctx, `UPDATE outbox SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND next_attempt_at <= $1
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, event_id, aggregate_type, aggregate_id, event_type, payload, created_at, attempts`,
+		now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.EventID, &event.AggregateType, &event.AggregateID,
+			&event.EventType, &payload, &event.CreatedAt, &event.Attempts); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING ไม่รับประกันลำดับ ส่งตามลำดับที่เขียนลง outbox
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *outboxRepository) Unclaim(ctx context.Context, q DBTX, id int64, at time.Time) error {
+	_, err := q.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = $1 WHERE id = $2 AND published_at IS NULL", at, id)
+	return err
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, q DBTX, id int64, at time.Time) error {
+	_, err := q.ExecContext(ctx, "UPDATE outbox SET published_at = $1, last_error = NULL WHERE id = $2", at, id)
+	return err
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, q DBTX, id int64, errMsg string, nextAttemptAt time.Time) error {
+	_, err := q.ExecContext(ctx,
+		"UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3",
+		errMsg, nextAttemptAt, id)
+	return err
+}
+
+// recordEvent เขียน event ลง outbox ภายใน transaction ของ service
+func (s *OrderService) recordEvent(ctx context.Context, tx DBTX, aggregateType string, aggregateID int, eventType string, payload interface{}) error {
+	event, err := NewOutboxEvent(aggregateType, aggregateID, eventType, payload)
+	if err != nil {
+		return err
+	}
+	return s.outboxRepo.Add(ctx, tx, event)
+}
+
+// Publishers
+
+// Publisher ปลายทางของ events (เปลี่ยนได้โดยไม่ต้องแก้ relay)
+type Publisher interface {
+	Publish(ctx context.Context, event OutboxEvent) error
+}
+
+// EventHandler ผู้รับ event ใน process เดียวกัน
+type EventHandler func(ctx context.Context, event OutboxEvent) error
+
+// EventBus ส่ง events ให้ subscribers ใน process เดียวกัน
+// จำ EventID ที่ส่งสำเร็จไว้ช่วงหนึ่ง ถ้า relay ส่งซ้ำจะไม่เรียก subscribers อีก
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[string][]EventHandler // "*" = ทุก event
+	seen        map[string]time.Time
+	dedupeTTL   time.Duration
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string][]EventHandler),
+		seen:        make(map[string]time.Time),
+		dedupeTTL:   time.Hour,
+	}
+}
+
+func (b *EventBus) Subscribe(eventType string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], handler)
+}
+
+func (b *EventBus) Publish(ctx context.Context, event OutboxEvent) error {
+	b.mu.Lock()
+	now := time.Now()
+	for id, at := range b.seen {
+		if now.Sub(at) > b.dedupeTTL {
+			delete(b.seen, id)
+		}
+	}
+	if _, dup := b.seen[event.EventID]; dup {
+		b.mu.Unlock()
+		return nil
+	}
+	handlers := append(append([]EventHandler(nil), b.subscribers[event.EventType]...), b.subscribers["*"]...)
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.seen[event.EventID] = now
+	b.mu.Unlock()
+	return nil
+}
+
+// JobQueuePublisher ส่ง events ไปเป็น jobs ของ message queue (03-advanced/06-message-queue)
+// ใช้ EventID เป็น job ID ฝั่ง queue จึงตัด event ที่ส่งซ้ำทิ้งได้
+type JobQueuePublisher struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewJobQueuePublisher(baseURL string) *JobQueuePublisher {
+	return &JobQueuePublisher{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *JobQueuePublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	body, err := json.Marshal(eventJobRequest{ID: event.EventID, Type: event.EventType, Payload: event.Payload})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/jobs/events", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("message queue responded %s", resp.Status)
+	}
+	return nil
+}
+
+// eventJobRequest รูปแบบ request ของ POST /jobs/events
+type eventJobRequest struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Relay
+
+// OutboxRelay อ่าน events จาก outbox แล้วส่งให้ Publisher
+//
+// จอง batch ด้วย UPDATE สั้น ๆ (lease) → publish นอก transaction → บันทึกผลใน transaction สั้นอีกครั้ง
+// ไม่ถือ row lock (PostgreSQL) หรือ write lock ของทั้ง database (SQLite) ไว้ระหว่างรอ network
+// ถ้า publish สำเร็จแต่บันทึกผลไม่ทัน event จะถูกส่งซ้ำเมื่อ lease หมด (at-least-once) ไม่มีวันหาย
+// รันหลาย instance พร้อมกันได้ เพราะแถวที่ถูกจองแล้วไม่ถึงเวลาส่งสำหรับ relay ตัวอื่น
+type OutboxRelay struct {
+	db         *DB
+	tx         *TxManager
+	repo       OutboxRepository
+	publisher  Publisher
+	batchSize  int
+	lease      time.Duration // ต้องนานกว่าเวลา publish ทั้ง batch ไม่อย่างนั้น relay ตัวอื่นจะส่งซ้ำ
+	maxBackoff time.Duration
+}
+
+func NewOutboxRelay(db *DB, publisher Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		db:         db,
+		tx:         NewTxManager(db),
+		repo:       &outboxRepository{},
+		publisher:  publisher,
+		batchSize:  50,
+		lease:      time.Minute,
+		maxBackoff: 5 * time.Minute,
+	}
+}
+
+// RelayOnce ส่ง events หนึ่งรอบ คืนจำนวนที่ส่งสำเร็จ
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	// outbox ว่าง (กรณีส่วนใหญ่) = อ่านครั้งเดียวจบ ไม่เปิด write transaction
+	now := time.Now()
+	pending, err := r.repo.HasPending(ctx, r.db, now)
+	if err != nil || !pending {
+		return 0, err
+	}
+
+	leaseUntil := now.Add(r.lease)
+	events, err := r.repo.ClaimPending(ctx, r.db, now, leaseUntil, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// publish นอก transaction ตัดรอบก่อน lease หมด ตัวที่ยังไม่ได้ส่งคืนให้รอบถัดไป
+	type outcome struct {
+		event     OutboxEvent
+		err       error
+		attempted bool
+	}
+	deadline := now.Add(r.lease / 2)
+	outcomes := make([]outcome, len(events))
+	for i, event := range events {
+		outcomes[i].event = event
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			continue
+		}
+		outcomes[i].attempted = true
+		outcomes[i].err = r.publisher.Publish(ctx, event)
+	}
+
+	// บันทึกผลแม้ ctx ถูกยกเลิกระหว่าง publish (ไม่อย่างนั้นที่ส่งไปแล้วจะถูกส่งซ้ำเมื่อ lease หมด)
+	saveCtx := context.WithoutCancel(ctx)
+	published := 0
+	err = r.tx.WithTx(saveCtx, nil, func(tx *Tx) error {
+		published = 0
+		at := time.Now()
+		for _, o := range outcomes {
+			event := o.event
+			switch {
+			case !o.attempted:
+				if err := r.repo.Unclaim(saveCtx, tx, event.ID, at); err != nil {
+					return err
+				}
+			case o.err != nil:
+				// ลองใหม่ภายหลังแบบ exponential backoff ไม่ให้ event ที่พังขวางตัวอื่น
+				backoff := time.Second << min(event.Attempts, 16)
+				if backoff > r.maxBackoff {
+					backoff = r.maxBackoff
+				}
+				log.Printf("Outbox publish error (%s %s, attempt %d): %v",
+					event.EventType, event.EventID, event.Attempts+1, o.err)
+				if err := r.repo.MarkFailed(saveCtx, tx, event.ID, o.err.Error(), at.Add(backoff)); err != nil {
+					return err
+				}
+			default:
+				if err := r.repo.MarkPublished(saveCtx, tx, event.ID, at); err != nil {
+					return err
+				}
+				published++
+			}
+		}
+		return nil
+	})
+	return published, err
+}
+
+// Start รัน relay เป็นระยะ
+func (r *OutboxRelay) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := r.RelayOnce(context.Background()); err != nil {
+				log.Printf("Outbox relay error: %v", err)
+			}
+		}
+	}()
+}
+
+// newOutboxPublisher เลือก publisher จาก env
+// MESSAGE_QUEUE_URL=http://localhost:3001 → ส่งเข้า message queue, ไม่ตั้ง → EventBus ใน process
+func newOutboxPublisher() Publisher {
+	if url := os.Getenv("MESSAGE_QUEUE_URL"); url != "" {
+		log.Printf("📤 Outbox publishing to message queue at %s", url)
+		return NewJobQueuePublisher(url)
+	}
+
+	bus := NewEventBus()
+	bus.Subscribe("*", func(ctx context.Context, event OutboxEvent) error {
+		log.Printf("📣 %s %s/%s %s", event.EventType, event.AggregateType, event.AggregateID, event.Payload)
+		return nil
+	})
+	return bus
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Sales Reports ============
+//
+// ยอดขายนับเฉพาะ orders ที่จ่ายเงินแล้ว (paid, shipped, delivered) แยกตามวันแบบ UTC
+// ผลรวมรายวันอยู่ใน sales_daily_orders / sales_daily_products (migration 012)
+// PostgreSQL เป็น materialized view ที่ refresh เป็นระยะ, SQLite เป็น view ธรรมดา
+
+const (
+	defaultReportDays    = 30
+	maxReportDays        = 1096 // 3 ปี
+	defaultTopProducts   = 5
+	maxTopProducts       = 50
+	defaultLowStockLevel = 5 // เท่ากับเกณฑ์ของ StockLow event
+	maxLowStockProducts  = 100
+	reportCacheTTL       = time.Minute
+	maxCachedReports     = 500
+)
+
+// การจัดกลุ่มที่รองรับ
+const (
+	GroupByDay     = "day"
+	GroupByWeek    = "week"
+	GroupByMonth   = "month"
+	GroupByProduct = "product"
+	GroupByUser    = "user"
+)
+
+var reportViews = []string{"sales_daily_orders", "sales_daily_products"}
+
+// SalesReportRequest เงื่อนไขของรายงาน (From <= วัน < To)
+type SalesReportRequest struct {
+	From          time.Time
+	To            time.Time
+	GroupBy       string
+	Currency      string
+	Top           int
+	LowStockLevel int
+}
+
+type SalesSummary struct {
+	Orders            int64 `json:"orders"`
+	Revenue           Money `json:"revenue"`
+	AverageOrderValue Money `json:"average_order_value"`
+}
+
+// SalesPeriod ยอดขายของหนึ่งช่วงเวลา (ช่วงที่ไม่มียอดขายก็มี เป็น 0 เพื่อให้นำไปวาดกราฟได้ทันที)
+type SalesPeriod struct {
+	Period string `json:"period"` // 2024-01-15, 2024-W03, 2024-01
+	Start  string `json:"start"`  // วันแรกของช่วง (สัปดาห์เริ่มวันจันทร์)
+	SalesSummary
+}
+
+type ProductSales struct {
+	ProductID int    `json:"product_id"`
+	SKU       string `json:"sku"`
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	Orders    int64  `json:"orders"`
+	Revenue   Money  `json:"revenue"`
+}
+
+type UserSales struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	SalesSummary
+}
+
+type LowStockProduct struct {
+	ProductID int    `json:"product_id"`
+	SKU       string `json:"sku"`
+	Name      string `json:"name"`
+	Stock     int    `json:"stock"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+type SalesReport struct {
+	From        string            `json:"from"`
+	To          string            `json:"to"` // ไม่รวมวันที่ To
+	GroupBy     string            `json:"group_by"`
+	Currency    string            `json:"currency"`
+	Summary     SalesSummary      `json:"summary"`
+	Groups      interface{}       `json:"groups"` // []SalesPeriod, []ProductSales หรือ []UserSales ตาม GroupBy
+	TopProducts []ProductSales    `json:"top_products"`
+	LowStock    []LowStockProduct `json:"low_stock"`
+	DataAsOf    time.Time         `json:"data_as_of"` // ยอดขายเป็นข้อมูล ณ เวลานี้ (refresh ล่าสุดของ materialized view)
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+func newSalesSummary(orders, revenue int64, currency string) (SalesSummary, error) {
+	summary := SalesSummary{Orders: orders, Revenue: NewMoney(revenue, currency), AverageOrderValue: NewMoney(0, currency)}
+	if orders > 0 {
+		avg, err := summary.Revenue.MulRatio(1, orders)
+		if err != nil {
+			return summary, err
+		}
+		summary.AverageOrderValue = avg
+	}
+	return summary, nil
+}
+
+// Repository
+
+type dailySales struct {
+	Day     string // YYYY-MM-DD
+	Orders  int64
+	Revenue int64
+}
+
+type reportRepository struct{}
+
+// วันส่งเป็นข้อความ YYYY-MM-DD: เทียบกับ DATE ของ PostgreSQL และข้อความ date() ของ SQLite ได้ตรงกัน
+func reportDay(t time.Time) string { return t.UTC().Format("2006-01-02") }
+
+// DailySales ยอดขายรวมรายวัน
+func (r *reportRepository) DailySales(ctx context.Context, q DBTX, from, to time.Time, currency string) ([]dailySales, error) {
+	rows, err := q.QueryContext(ctx, `SELECT day, SUM(orders), SUM(revenue)
+		FROM sales_daily_orders
+		WHERE currency = $1 AND day >= $2 AND day < $3
+		GROUP BY day
+		ORDER BY day`,
+		currency, reportDay(from), reportDay(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []dailySales
+	for rows.Next() {
+		var d dailySales
+		if err := rows.Scan(&d.Day, &d.Orders, &d.Revenue); err != nil {
+			return nil, err
+		}
+		// PostgreSQL คืน DATE เป็นเวลา (2024-01-15T00:00:00Z) SQLite คืนข้อความ
+		if len(d.Day) > 10 {
+			d.Day = d.Day[:10]
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// ProductSales ยอดขายแยกตามสินค้า เรียงจากยอดขายมากไปน้อย (limit 0 = ทั้งหมด)
+func (r *reportRepository) ProductSales(ctx context.Context, q DBTX, from, to time.Time, currency string, limit int) ([]ProductSales, error) {
+	query := `SELECT s.product_id, COALESCE(p.sku, ''), COALESCE(p.name, ''),
+			SUM(s.quantity), SUM(s.orders), SUM(s.revenue)
+		FROM sales_daily_products s
+		LEFT JOIN products p ON p.id = s.product_id
+		WHERE s.currency = $1 AND s.day >= $2 AND s.day < $3
+		GROUP BY s.product_id, p.sku, p.name
+		ORDER BY SUM(s.revenue) DESC, s.product_id`
+	args := []interface{}{currency, reportDay(from), reportDay(to)}
+	if limit > 0 {
+		query += " LIMIT $4"
+		args = append(args, limit)
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []ProductSales{}
+	for rows.Next() {
+		var p ProductSales
+		var revenue int64
+		if err := rows.Scan(&p.ProductID, &p.SKU, &p.Name, &p.Quantity, &p.Orders, &revenue); err != nil {
+			return nil, err
+		}
+		p.Revenue = NewMoney(revenue, currency)
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// UserSales ยอดซื้อแยกตามผู้ใช้ เรียงจากยอดมากไปน้อย
+func (r *reportRepository) UserSales(ctx context.Context, q DBTX, from, to time.Time, currency string) ([]UserSales, error) {
+	rows, err := q.QueryContext(ctx, `SELECT s.user_id, COALESCE(u.name, ''), COALESCE(u.email, ''),
+			SUM(s.orders), SUM(s.revenue)
+		FROM sales_daily_orders s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.currency = $1 AND s.day >= $2 AND s.day < $3
+		GROUP BY s.user_id, u.name, u.email
+		ORDER BY SUM(s.revenue) DESC, s.user_id`,
+		currency, reportDay(from), reportDay(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSales{}
+	for rows.Next() {
+		var u UserSales
+		var orders, revenue int64
+		if err := rows.Scan(&u.UserID, &u.Name, &u.Email, &orders, &revenue); err != nil {
+			return nil, err
+		}
+		if u.SalesSummary, err = newSalesSummary(orders, revenue, currency); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// LowStock สินค้าที่ขายได้ (stock - reserved) เหลือน้อยกว่า level อ่านจากตาราง products โดยตรง
+// ใช้ index idx_products_available
+func (r *reportRepository) LowStock(ctx context.Context, q DBTX, level int) ([]LowStockProduct, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, sku, name, stock, reserved
+		FROM products
+		WHERE stock - reserved < $1
+		ORDER BY stock - reserved, id
+		LIMIT $2`, level, maxLowStockProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []LowStockProduct{}
+	for rows.Next() {
+		var p LowStockProduct
+		if err := rows.Scan(&p.ProductID, &p.SKU, &p.Name, &p.Stock, &p.Reserved); err != nil {
+			return nil, err
+		}
+		p.Available = p.Stock - p.Reserved
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// Service
+
+type cachedReport struct {
+	report    *SalesReport
+	expiresAt time.Time
+}
+
+// ReportService สร้างรายงานจาก replica (ยอมรับข้อมูลช้ากว่า primary เล็กน้อยได้) และ cache ผลไว้ reportCacheTTL
+type ReportService struct {
+	db      DBTX // router
+	primary *DB  // refresh materialized views ต้องทำที่ primary
+	repo    *reportRepository
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	cache     map[SalesReportRequest]cachedReport
+	refreshed time.Time // refresh materialized views ล่าสุด (zero = view สดเสมอ)
+}
+
+func NewReportService(router *DBRouter) *ReportService {
+	return &ReportService{
+		db:      router,
+		primary: router.Primary(),
+		repo:    &reportRepository{},
+		ttl:     reportCacheTTL,
+		now:     time.Now,
+		cache:   make(map[SalesReportRequest]cachedReport),
+	}
+}
+
+// SalesReport คืนรายงาน (cached = true ถ้ามาจาก cache)
+func (s *ReportService) SalesReport(ctx context.Context, req SalesReportRequest) (*SalesReport, bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	if entry, ok := s.cache[req]; ok && now.Before(entry.expiresAt) {
+		s.mu.Unlock()
+		return entry.report, true, nil
+	}
+	dataAsOf := s.refreshed
+	s.mu.Unlock()
+
+	report, err := s.build(ReadFromReplica(ctx), req)
+	if err != nil {
+		return nil, false, err
+	}
+	report.GeneratedAt = now
+	report.DataAsOf = now
+	if !dataAsOf.IsZero() {
+		report.DataAsOf = dataAsOf
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedReports {
+		s.cache = make(map[SalesReportRequest]cachedReport)
+	}
+	s.cache[req] = cachedReport{report: report, expiresAt: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return report, false, nil
+}
+
+func (s *ReportService) build(ctx context.Context, req SalesReportRequest) (*SalesReport, error) {
+	report := &SalesReport{
+		From:     reportDay(req.From),
+		To:       reportDay(req.To),
+		GroupBy:  req.GroupBy,
+		Currency: req.Currency,
+	}
+
+	days, err := s.repo.DailySales(ctx, s.db, req.From, req.To, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	var orders, revenue int64
+	for _, d := range days {
+		orders += d.Orders
+		revenue += d.Revenue
+	}
+	if report.Summary, err = newSalesSummary(orders, revenue, req.Currency); err != nil {
+		return nil, err
+	}
+
+	switch req.GroupBy {
+	case GroupByDay, GroupByWeek, GroupByMonth:
+		report.Groups, err = bucketSales(days, req)
+	case GroupByProduct:
+		report.Groups, err = s.repo.ProductSales(ctx, s.db, req.From, req.To, req.Currency, 0)
+	case GroupByUser:
+		report.Groups, err = s.repo.UserSales(ctx, s.db, req.From, req.To, req.Currency)
+	default:
+		err = fmt.Errorf("unknown group_by %q", req.GroupBy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if report.TopProducts, err = s.repo.ProductSales(ctx, s.db, req.From, req.To, req.Currency, req.Top); err != nil {
+		return nil, err
+	}
+	if report.LowStock, err = s.repo.LowStock(ctx, s.db, req.LowStockLevel); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// bucketSales รวมยอดรายวันเป็นวัน/สัปดาห์ (ISO, เริ่มวันจันทร์)/เดือน ครบทุกช่วงในระยะเวลาที่ขอ
+func bucketSales(days []dailySales, req SalesReportRequest) ([]SalesPeriod, error) {
+	type bucket struct {
+		period, start   string
+		orders, revenue int64
+	}
+	var buckets []*bucket
+	byPeriod := make(map[string]*bucket)
+	periodOf := make(map[string]string) // วัน → ช่วง
+
+	for day := req.From; day.Before(req.To); day = day.AddDate(0, 0, 1) {
+		period, start := day.Format("2006-01-02"), day
+		switch req.GroupBy {
+		case GroupByWeek:
+			year, week := day.ISOWeek()
+			period = fmt.Sprintf("%d-W%02d", year, week)
+			start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		case GroupByMonth:
+			period = day.Format("2006-01")
+			start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+		if _, ok := byPeriod[period]; !ok {
+			b := &bucket{period: period, start: start.Format("2006-01-02")}
+			byPeriod[period] = b
+			buckets = append(buckets, b)
+		}
+		periodOf[day.Format("2006-01-02")] = period
+	}
+
+	for _, d := range days {
+		if b, ok := byPeriod[periodOf[d.Day]]; ok {
+			b.orders += d.Orders
+			b.revenue += d.Revenue
+		}
+	}
+
+	periods := make([]SalesPeriod, len(buckets))
+	for i, b := range buckets {
+		summary, err := newSalesSummary(b.orders, b.revenue, req.Currency)
+		if err != nil {
+			return nil, err
+		}
+		periods[i] = SalesPeriod{Period: b.period, Start: b.start, SalesSummary: summary}
+	}
+	return periods, nil
+}
+
+// Refresh คำนวณ materialized views ใหม่แล้วล้าง cache
+func (s *ReportService) Refresh(ctx context.Context) error {
+	materialized := false
+	for _, view := range reportViews {
+		refreshed, err := s.primary.Dialect().RefreshView(ctx, s.primary, view)
+		if err != nil {
+			return fmt.Errorf("refresh %s: %w", view, err)
+		}
+		materialized = materialized || refreshed
+	}
+
+	s.mu.Lock()
+	if materialized {
+		s.refreshed = s.now()
+	}
+	s.cache = make(map[SalesReportRequest]cachedReport)
+	s.mu.Unlock()
+	return nil
+}
+
+// StartRefresher refresh views ทันทีหนึ่งครั้งแล้วทุก interval
+func (s *ReportService) StartRefresher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Refresh(context.Background()); err != nil {
+				log.Printf("⚠️ Report refresh failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Handlers
+
+// parseSalesReportRequest อ่าน query string: from, to (YYYY-MM-DD, to ไม่รวม), group_by, currency, top, low_stock
+func parseSalesReportRequest(c *fiber.Ctx, now time.Time) (SalesReportRequest, error) {
+	today := time.Date(now.UTC().Year(), now.UTC().Month(), now.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	req := SalesReportRequest{
+		To:            today.AddDate(0, 0, 1), // รวมวันนี้
+		GroupBy:       strings.ToLower(c.Query("group_by", GroupByDay)),
+		Currency:      strings.ToUpper(c.Query("currency", DefaultCurrency)),
+		Top:           defaultTopProducts,
+		LowStockLevel: defaultLowStockLevel,
+	}
+
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"from", &req.From}, {"to", &req.To}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s %q (use YYYY-MM-DD)", p.name, v)
+		}
+		*p.target = t
+	}
+	if req.From.IsZero() {
+		req.From = req.To.AddDate(0, 0, -defaultReportDays)
+	}
+	if !req.From.Before(req.To) {
+		return req, fmt.Errorf("from must be before to")
+	}
+	if req.To.Sub(req.From) > maxReportDays*24*time.Hour {
+		return req, fmt.Errorf("date range must be at most %d days", maxReportDays)
+	}
+
+	switch req.GroupBy {
+	case GroupByDay, GroupByWeek, GroupByMonth, GroupByProduct, GroupByUser:
+	default:
+		return req, fmt.Errorf("invalid group_by %q (use day, week, month, product or user)", req.GroupBy)
+	}
+	if len(req.Currency) != 3 {
+		return req, fmt.Errorf("invalid currency %q", req.Currency)
+	}
+
+	var err error
+	if req.Top, err = strconv.Atoi(c.Query("top", strconv.Itoa(defaultTopProducts))); err != nil || req.Top < 1 || req.Top > maxTopProducts {
+		return req, fmt.Errorf("top must be between 1 and %d", maxTopProducts)
+	}
+	if req.LowStockLevel, err = strconv.Atoi(c.Query("low_stock", strconv.Itoa(defaultLowStockLevel))); err != nil || req.LowStockLevel < 0 {
+		return req, fmt.Errorf("invalid low_stock %q", c.Query("low_stock"))
+	}
+	return req, nil
+}
+
+func salesReportHandler(reports *ReportService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := parseSalesReportRequest(c, time.Now())
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		report, cached, err := reports.SalesReport(c.UserContext(), req)
+		if err != nil {
+			return err
+		}
+		if cached {
+			c.Set("X-Cache", "HIT")
+		} else {
+			c.Set("X-Cache", "MISS")
+		}
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    report,
+		})
+	}
+}
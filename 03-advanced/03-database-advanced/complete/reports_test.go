@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newReportFixture: orders ที่จ่ายแล้วสามรายการในวันต่างกัน และหนึ่งรายการที่ยกเลิก (ไม่นับเป็นยอดขาย)
+//
+//	2024-01-01 (จันทร์)  laptop x1           99999
+//	2024-01-03 (พุธ)     mouse x2             5998
+//	2024-02-10          laptop x1 + mouse x1 102998
+//	2024-02-11          mouse x1 (cancelled)
+func newReportFixture(t *testing.T) (*testFixture, *ReportService) {
+	t.Helper()
+	f := newTestFixture(t)
+	ctx := context.Background()
+
+	for _, o := range []struct {
+		day    string
+		status OrderStatus
+		items  []PlaceOrderItemRequest
+	}{
+		{"2024-01-01", OrderStatusPaid, []PlaceOrderItemRequest{{ProductID: f.laptop.ID, Quantity: 1}}},
+		{"2024-01-03", OrderStatusPaid, []PlaceOrderItemRequest{{ProductID: f.mouse.ID, Quantity: 2}}},
+		{"2024-02-10", OrderStatusPaid, []PlaceOrderItemRequest{{ProductID: f.laptop.ID, Quantity: 1}, {ProductID: f.mouse.ID, Quantity: 1}}},
+		{"2024-02-11", OrderStatusCancelled, []PlaceOrderItemRequest{{ProductID: f.mouse.ID, Quantity: 1}}},
+	} {
+		placed := f.placeOrder(t, o.items...)
+		if _, err := f.service.UpdateStatus(ctx, placed.ID, o.status, ""); err != nil {
+			t.Fatal(err)
+		}
+		createdAt, _ := time.Parse("2006-01-02", o.day)
+		if _, err := f.db.ExecContext(ctx, "UPDATE orders SET created_at = $1 WHERE id = $2",
+			createdAt.Add(10*time.Hour), placed.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f, NewReportService(NewDBRouter(f.db))
+}
+
+func reportRequest(from, to, groupBy string) SalesReportRequest {
+	fromDay, _ := time.Parse("2006-01-02", from)
+	toDay, _ := time.Parse("2006-01-02", to)
+	return SalesReportRequest{
+		From: fromDay, To: toDay, GroupBy: groupBy, Currency: "THB",
+		Top: defaultTopProducts, LowStockLevel: defaultLowStockLevel,
+	}
+}
+
+func TestSalesReportSummaryAndPeriods(t *testing.T) {
+	_, reports := newReportFixture(t)
+	ctx := context.Background()
+
+	report, _, err := reports.SalesReport(ctx, reportRequest("2024-01-01", "2024-03-01", GroupByMonth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summary.Orders != 3 || report.Summary.Revenue.Amount != 208995 {
+		t.Errorf("summary = %+v, want 3 orders / 208995", report.Summary)
+	}
+	if report.Summary.AverageOrderValue.Amount != 69665 {
+		t.Errorf("average = %d, want 69665", report.Summary.AverageOrderValue.Amount)
+	}
+
+	months := report.Groups.([]SalesPeriod)
+	if len(months) != 2 || months[0].Period != "2024-01" || months[0].Orders != 2 || months[0].Revenue.Amount != 105997 ||
+		months[1].Period != "2024-02" || months[1].Revenue.Amount != 102998 {
+		t.Errorf("months = %+v", months)
+	}
+
+	// รายสัปดาห์: 2024-01-01 เป็นวันจันทร์ของ W01 และทุกสัปดาห์ในช่วงมีแถว แม้ไม่มียอดขาย
+	report, _, err = reports.SalesReport(ctx, reportRequest("2024-01-01", "2024-01-22", GroupByWeek))
+	if err != nil {
+		t.Fatal(err)
+	}
+	weeks := report.Groups.([]SalesPeriod)
+	if len(weeks) != 3 || weeks[0].Period != "2024-W01" || weeks[0].Start != "2024-01-01" || weeks[0].Orders != 2 ||
+		weeks[1].Orders != 0 || weeks[1].Revenue.Currency != "THB" {
+		t.Errorf("weeks = %+v", weeks)
+	}
+
+	// รายวัน: to ไม่รวม
+	report, _, err = reports.SalesReport(ctx, reportRequest("2024-02-10", "2024-02-12", GroupByDay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	days := report.Groups.([]SalesPeriod)
+	if len(days) != 2 || days[0].Orders != 1 || days[1].Orders != 0 {
+		t.Errorf("days = %+v (cancelled order must not count)", days)
+	}
+}
+
+func TestSalesReportProductsUsersAndLowStock(t *testing.T) {
+	f, reports := newReportFixture(t)
+	ctx := context.Background()
+
+	req := reportRequest("2024-01-01", "2024-03-01", GroupByProduct)
+	req.Top = 1
+	report, _, err := reports.SalesReport(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	products := report.Groups.([]ProductSales)
+	if len(products) != 2 || products[0].ProductID != f.laptop.ID || products[0].Quantity != 2 || products[0].Revenue.Amount != 199998 ||
+		products[1].ProductID != f.mouse.ID || products[1].Quantity != 3 || products[1].Orders != 2 {
+		t.Errorf("products = %+v", products)
+	}
+	if len(report.TopProducts) != 1 || report.TopProducts[0].SKU != "LAP-001" {
+		t.Errorf("top products = %+v", report.TopProducts)
+	}
+
+	// laptop: stock 10 ขายไป 2 เหลือ 8 → ยังไม่ต่ำ, เกณฑ์ 9 → ต่ำ
+	if len(report.LowStock) != 0 {
+		t.Errorf("low stock = %+v, want none", report.LowStock)
+	}
+	req.LowStockLevel = 9
+	if report, _, err = reports.SalesReport(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.LowStock) != 1 || report.LowStock[0].ProductID != f.laptop.ID || report.LowStock[0].Available != 8 {
+		t.Errorf("low stock = %+v, want laptop with 8 available", report.LowStock)
+	}
+
+	report, _, err = reports.SalesReport(ctx, reportRequest("2024-01-01", "2024-03-01", GroupByUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := report.Groups.([]UserSales)
+	if len(users) != 1 || users[0].UserID != f.userID || users[0].Email != "john@example.com" || users[0].Orders != 3 {
+		t.Errorf("users = %+v", users)
+	}
+}
+
+func TestSalesReportCache(t *testing.T) {
+	f, reports := newReportFixture(t)
+	ctx := context.Background()
+	req := reportRequest("2024-01-01", "2024-03-01", GroupByDay)
+
+	first, cached, err := reports.SalesReport(ctx, req)
+	if err != nil || cached {
+		t.Fatalf("first: cached = %v, err = %v", cached, err)
+	}
+
+	// ข้อมูลใหม่ยังไม่เห็นจนกว่า cache หมดอายุหรือ refresh
+	placed := f.placeOrder(t, PlaceOrderItemRequest{ProductID: f.mouse.ID, Quantity: 1})
+	if _, err := f.service.UpdateStatus(ctx, placed.ID, OrderStatusPaid, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.db.ExecContext(ctx, "UPDATE orders SET created_at = $1 WHERE id = $2",
+		time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC), placed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	second, cached, err := reports.SalesReport(ctx, req)
+	if err != nil || !cached || second != first {
+		t.Fatalf("second: cached = %v, err = %v", cached, err)
+	}
+
+	if err := reports.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	third, cached, err := reports.SalesReport(ctx, req)
+	if err != nil || cached {
+		t.Fatalf("after refresh: cached = %v, err = %v", cached, err)
+	}
+	if third.Summary.Orders != 4 {
+		t.Errorf("orders after refresh = %d, want 4", third.Summary.Orders)
+	}
+
+	// หมดอายุตาม TTL
+	reports.now = func() time.Time { return time.Now().Add(2 * reportCacheTTL) }
+	if _, cached, _ := reports.SalesReport(ctx, req); cached {
+		t.Error("expired report served from cache")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ============ Inventory Reservations ============
+
+// สถานะของการจอง stock
+const (
+	ReservationActive    = "active"    // จองอยู่ รอจ่ายเงิน
+	ReservationConfirmed = "confirmed" // จ่ายเงินแล้ว stock ถูกตัดจริง
+	ReservationReleased  = "released"  // ยกเลิกหรือหมดเวลา คืนของให้ขายต่อได้
+)
+
+var ErrReservationExpired = errors.New("stock reservation has expired")
+
+// StockReservation หนึ่งแถวใน stock_reservations (จองสินค้าหนึ่งชนิดให้ order หนึ่ง)
+type StockReservation struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReservationRepository interface {
+	Create(ctx context.Context, q DBTX, reservation *StockReservation) error
+	ActiveByOrder(ctx context.Context, q DBTX, orderID int) ([]StockReservation, error)
+	SetOrderStatus(ctx context.Context, q DBTX, orderID int, from, to string) error
+	ExpiredOrderIDs(ctx context.Context, q DBTX, now time.Time, limit int) ([]int, error)
+}
+
+type reservationRepository struct{}
+
+func (r *reservationRepository) Create(ctx context.Context, q DBTX, reservation *StockReservation) error {
+	if err := q.QueryRowContext(ctx,
+		`INSERT INTO stock_reservations (order_id, product_id, quantity, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		reservation.OrderID, reservation.ProductID, reservation.Quantity, reservation.Status, reservation.ExpiresAt,
+	).Scan(&reservation.ID, &reservation.CreatedAt); err != nil {
+		return err
+	}
+	return recordAudit(ctx, q, "stock_reservation", reservation.ID, AuditCreate, nil, reservation)
+}
+
+// ActiveByOrder อ่านการจองที่ยัง active ของ order พร้อม lock แถว (ต้องเรียกใน transaction)
+func (r *reservationRepository) ActiveByOrder(ctx context.Context, q DBTX, orderID int) ([]StockReservation, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, order_id, product_id, quantity, status, expires_at, created_at
+		FROM stock_reservations WHERE order_id = $1 AND status = $2
+		ORDER BY product_id FOR UPDATE`, orderID, ReservationActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []StockReservation
+	for rows.Next() {
+		var res StockReservation
+		if err := rows.Scan(&res.ID, &res.OrderID, &res.ProductID, &res.Quantity,
+			&res.Status, &res.ExpiresAt, &res.CreatedAt); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+	return reservations, rows.Err()
+}
+
+// SetOrderStatus เปลี่ยนสถานะการจองทั้งหมดของ order และบันทึก audit ทีละการจอง
+func (r *reservationRepository) SetOrderStatus(ctx context.Context, q DBTX, orderID int, from, to string) error {
+	rows, err := q.QueryContext(ctx, `UPDATE stock_reservations SET status = $1 WHERE order_id = $2 AND status = $3
+		RETURNING id, product_id, quantity`, to, orderID, from)
+	if err != nil {
+		return err
+	}
+	var changed []StockReservation
+	for rows.Next() {
+		res := StockReservation{OrderID: orderID}
+		if err := rows.Scan(&res.ID, &res.ProductID, &res.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		changed = append(changed, res)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, res := range changed {
+		state := func(status string) map[string]interface{} {
+			return map[string]interface{}{
+				"order_id": res.OrderID, "product_id": res.ProductID, "quantity": res.Quantity, "status": status,
+			}
+		}
+		if err := recordAudit(ctx, q, "stock_reservation", res.ID, AuditUpdate, state(from), state(to)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpiredOrderIDs หา orders ที่มีการจองหมดอายุแล้วแต่ยังไม่ถูกปล่อย
+func (r *reservationRepository) ExpiredOrderIDs(ctx context.Context, q DBTX, now time.Time, limit int) ([]int, error) {
+	rows, err := q.QueryContext(ctx, `SELECT DISTINCT order_id FROM stock_reservations
+		WHERE status = $1 AND expires_at < $2 ORDER BY order_id LIMIT $3`, ReservationActive, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// confirmReservations ตัด stock จริงตามที่จองไว้ (ตอนจ่ายเงิน)
+// คืนจำนวนการจองที่ถูกยืนยัน - 0 หมายถึง order เก่าที่ตัด stock ไปตั้งแต่ตอนสร้างแล้ว
+func (s *OrderService) confirmReservations(ctx context.Context, tx *Tx, orderID int) (int, error) {
+	reservations, err := s.reservationRepo.ActiveByOrder(ctx, tx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, res := range reservations {
+		if res.ExpiresAt.Before(now) {
+			return 0, ErrReservationExpired
+		}
+		if err := s.productRepo.CommitReserved(ctx, tx, res.ProductID, res.Quantity); err != nil {
+			return 0, err
+		}
+	}
+	if len(reservations) == 0 {
+		return 0, nil
+	}
+	return len(reservations), s.reservationRepo.SetOrderStatus(ctx, tx, orderID, ReservationActive, ReservationConfirmed)
+}
+
+// releaseReservations คืนของที่จองไว้ให้ขายต่อได้ (ตอนยกเลิกหรือหมดเวลา)
+func (s *OrderService) releaseReservations(ctx context.Context, tx *Tx, orderID int) (int, error) {
+	reservations, err := s.reservationRepo.ActiveByOrder(ctx, tx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, res := range reservations {
+		if err := s.productRepo.ReleaseReserved(ctx, tx, res.ProductID, res.Quantity); err != nil {
+			return 0, err
+		}
+	}
+	if len(reservations) == 0 {
+		return 0, nil
+	}
+	return len(reservations), s.reservationRepo.SetOrderStatus(ctx, tx, orderID, ReservationActive, ReservationReleased)
+}
+
+// ExpireReservations ปล่อยการจองที่หมดเวลาและยกเลิก orders ที่ยังไม่จ่ายเงิน
+// แต่ละ order ทำใน transaction ของตัวเอง ถ้า order หนึ่งพังจะไม่กระทบ order อื่น
+func (s *OrderService) ExpireReservations(ctx context.Context) (int, error) {
+	orderIDs, err := s.reservationRepo.ExpiredOrderIDs(ctx, s.db, time.Now(), 100)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, orderID := range orderIDs {
+		err := s.tx.WithTx(ctx, nil, func(tx *Tx) error {
+			// lock order ก่อนเหมือน UpdateStatus กันชนกับการจ่ายเงินที่เข้ามาพร้อมกัน
+			order, err := s.orderRepo.GetByIDForUpdate(ctx, tx, orderID)
+			if err != nil {
+				return err
+			}
+			if _, err := s.releaseReservations(ctx, tx, orderID); err != nil {
+				return err
+			}
+			if order.Status != OrderStatusPending {
+				return nil
+			}
+
+			current := order.Status
+			if err := s.orderRepo.UpdateStatus(ctx, tx, orderID, current, OrderStatusCancelled); err != nil {
+				return err
+			}
+			if err := s.releaseCoupons(ctx, tx, orderID); err != nil {
+				return err
+			}
+			if err := s.orderRepo.AddStatusChange(ctx, tx, &OrderStatusChange{
+				OrderID:    orderID,
+				FromStatus: &current,
+				ToStatus:   OrderStatusCancelled,
+				Note:       "reservation expired",
+			}); err != nil {
+				return err
+			}
+			return s.recordEvent(ctx, tx, "order", orderID, EventOrderCancelled, OrderCancelledEvent{
+				OrderID: orderID, UserID: order.UserID, FromStatus: current, Reason: "reservation expired",
+			})
+		})
+		if err != nil {
+			log.Printf("Reservation expiry error (order %d): %v", orderID, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// StartReservationSweeper ปล่อยการจองที่หมดเวลาเป็นระยะ
+func (s *OrderService) StartReservationSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := s.ExpireReservations(context.Background()); err != nil {
+				log.Printf("Reservation sweeper error: %v", err)
+			} else if n > 0 {
+				log.Printf("⏰ Released reservations of %d expired orders", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Read/Write Router ============
+
+// DBRouter ส่ง query ไปยัง primary หรือ replicas
+//
+//   - เขียน (INSERT/UPDATE/DELETE, SELECT ... FOR UPDATE) และ transactions → primary เสมอ
+//   - อ่าน (SELECT) → replicas แบบ round-robin เฉพาะตัวที่ยัง healthy (ไม่มีเหลือ = primary)
+//   - read-your-writes: session ที่เพิ่งเขียนจะอ่านจาก primary ต่ออีก stickiness
+//     เพราะ replica อาจยังตามไม่ทัน (replication lag) ผู้ใช้จะไม่เห็นข้อมูลที่ตัวเองเพิ่งสร้างหายไป
+//
+// DBRouter เป็น DBTX จึงส่งให้ repositories ได้เหมือน *DB
+// ส่วน transactions ให้ใช้ TxManager กับ Primary()
+type DBRouter struct {
+	primary     *DB
+	replicas    []*replica
+	next        atomic.Uint64
+	stickiness  time.Duration
+	maxFailures int           // ผิดพลาดติดกันกี่ครั้งถึงถอด replica ออก
+	maxLag      time.Duration // replica ที่ตามหลังเกินนี้ถูกถอดออก
+
+	mu        sync.Mutex
+	lastWrite map[string]time.Time // session → เวลาที่เขียนล่าสุด
+}
+
+type replica struct {
+	name     string // ไม่ใช้ DSN เพราะมีรหัสผ่าน
+	db       *DB
+	healthy  atomic.Bool
+	failures atomic.Int32
+
+	mu        sync.Mutex
+	lag       time.Duration
+	lastError string
+}
+
+// ReplicaStatus สถานะของ replica สำหรับ GET /health
+type ReplicaStatus struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int    `json:"failures"`
+	LagMs     int64  `json:"lag_ms"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func NewDBRouter(primary *DB, replicas ...*DB) *DBRouter {
+	r := &DBRouter{
+		primary:     primary,
+		stickiness:  5 * time.Second,
+		maxFailures: 3,
+		maxLag:      10 * time.Second,
+		lastWrite:   make(map[string]time.Time),
+	}
+	for i, db := range replicas {
+		rep := &replica{name: fmt.Sprintf("replica-%d", i+1), db: db}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+	return r
+}
+
+// Primary คืน database หลัก (ใช้กับ TxManager และงานที่ต้องอ่านข้อมูลล่าสุดเสมอ)
+func (r *DBRouter) Primary() *DB { return r.primary }
+
+// Per-query overrides
+
+type routeModeKey struct{}
+
+type routeMode int
+
+const (
+	routeAuto    routeMode = iota
+	routePrimary           // อ่านจาก primary เสมอ (ต้องการข้อมูลล่าสุด)
+	routeReplica           // อ่านจาก replica ได้แม้อยู่ในช่วง read-your-writes (ยอมรับข้อมูลเก่าได้)
+)
+
+// ReadFromPrimary บังคับให้ query ที่ใช้ ctx นี้อ่านจาก primary
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeModeKey{}, routePrimary)
+}
+
+// ReadFromReplica ให้ query ที่ใช้ ctx นี้อ่านจาก replica ได้เสมอ เช่น รายงานที่ไม่ต้องสดมาก
+func ReadFromReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeModeKey{}, routeReplica)
+}
+
+// Read-your-writes session
+
+type routeSessionKey struct{}
+
+// WithRouteSession ผูก ctx กับ session (เช่น client หนึ่งคน) เพื่อจำว่า session นี้เพิ่งเขียนเมื่อไร
+func WithRouteSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, routeSessionKey{}, session)
+}
+
+// MarkWrite บันทึกว่า session ใน ctx เพิ่งเขียน (อ่านครั้งถัดไปภายใน stickiness จะไปที่ primary)
+func (r *DBRouter) MarkWrite(ctx context.Context) {
+	session, _ := ctx.Value(routeSessionKey{}).(string)
+	if session == "" || len(r.replicas) == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.lastWrite[session] = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *DBRouter) recentlyWrote(ctx context.Context) bool {
+	session, _ := ctx.Value(routeSessionKey{}).(string)
+	if session == "" {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	at, ok := r.lastWrite[session]
+	return ok && time.Since(at) < r.stickiness
+}
+
+// Routing
+
+var (
+	selectQuery  = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+	lockingQuery = regexp.MustCompile(`(?i)\bFOR\s+(NO\s+KEY\s+)?(UPDATE|SHARE)\b`)
+)
+
+// isReadQuery: เฉพาะ SELECT ที่ไม่ lock แถว (INSERT ... RETURNING ผ่าน QueryRowContext ก็เป็นการเขียน)
+func isReadQuery(query string) bool {
+	return selectQuery.MatchString(query) && !lockingQuery.MatchString(query)
+}
+
+// reader เลือก replica สำหรับการอ่าน (nil = ใช้ primary)
+func (r *DBRouter) reader(ctx context.Context, query string) *replica {
+	if len(r.replicas) == 0 || !isReadQuery(query) {
+		return nil
+	}
+	switch mode, _ := ctx.Value(routeModeKey{}).(routeMode); mode {
+	case routePrimary:
+		return nil
+	case routeAuto:
+		if r.recentlyWrote(ctx) {
+			return nil
+		}
+	}
+
+	n := uint64(len(r.replicas))
+	start := r.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+func (r *DBRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := r.primary.ExecContext(ctx, query, args...)
+	if err == nil {
+		r.MarkWrite(ctx)
+	}
+	return result, err
+}
+
+// QueryContext อ่านจาก replica ถ้าได้ ถ้า replica ติดต่อไม่ได้จะถอยไปอ่านจาก primary
+func (r *DBRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if rep := r.reader(ctx, query); rep != nil {
+		rows, err := rep.db.QueryContext(ctx, query, args...)
+		if !isConnectionError(err) {
+			return rows, err
+		}
+		r.reportFailure(rep, err)
+	}
+
+	rows, err := r.primary.QueryContext(ctx, query, args...)
+	if err == nil && !isReadQuery(query) {
+		r.MarkWrite(ctx)
+	}
+	return rows, err
+}
+
+func (r *DBRouter) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if rep := r.reader(ctx, query); rep != nil {
+		row := rep.db.QueryRowContext(ctx, query, args...)
+		err := row.Err()
+		if !isConnectionError(err) {
+			return row
+		}
+		r.reportFailure(rep, err)
+	}
+
+	row := r.primary.QueryRowContext(ctx, query, args...)
+	if row.Err() == nil && !isReadQuery(query) {
+		r.MarkWrite(ctx)
+	}
+	return row
+}
+
+// isConnectionError แยก error ที่แปลว่า replica มีปัญหา ออกจาก error ของ query เอง (เช่น ErrNoRows)
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Health checks
+
+// reportFailure นับความผิดพลาดติดกัน ครบ maxFailures = ถอด replica ออกจนกว่า health check จะผ่าน
+func (r *DBRouter) reportFailure(rep *replica, err error) {
+	rep.mu.Lock()
+	rep.lastError = err.Error()
+	rep.mu.Unlock()
+
+	if int(rep.failures.Add(1)) >= r.maxFailures && rep.healthy.CompareAndSwap(true, false) {
+		log.Printf("🚫 %s ejected: %v", rep.name, err)
+	}
+}
+
+// CheckReplicas ping และวัด replication lag ของทุก replica หนึ่งรอบ
+func (r *DBRouter) CheckReplicas(ctx context.Context) {
+	for _, rep := range r.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := rep.db.PingContext(checkCtx)
+		var lag time.Duration
+		if err == nil {
+			lag, err = rep.db.Dialect().ReplicationLag(checkCtx, rep.db)
+		}
+		cancel()
+		if err == nil && lag > r.maxLag {
+			err = fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), r.maxLag)
+			rep.failures.Store(int32(r.maxFailures)) // lag สูงถอดทันที ไม่ต้องรอครบจำนวนครั้ง
+		}
+
+		if err != nil {
+			r.reportFailure(rep, err)
+			continue
+		}
+
+		rep.mu.Lock()
+		rep.lag = lag
+		rep.lastError = ""
+		rep.mu.Unlock()
+		rep.failures.Store(0)
+		if rep.healthy.CompareAndSwap(false, true) {
+			log.Printf("✅ %s is healthy again", rep.name)
+		}
+	}
+
+	// ลบ sessions ที่พ้นช่วง read-your-writes แล้ว
+	r.mu.Lock()
+	for session, at := range r.lastWrite {
+		if time.Since(at) >= r.stickiness {
+			delete(r.lastWrite, session)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// StartHealthChecks ตรวจ replicas เป็นระยะ
+func (r *DBRouter) StartHealthChecks(interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.CheckReplicas(context.Background())
+			<-ticker.C
+		}
+	}()
+}
+
+func (r *DBRouter) ReplicaStatus() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		rep.mu.Lock()
+		statuses = append(statuses, ReplicaStatus{
+			Name:      rep.name,
+			Healthy:   rep.healthy.Load(),
+			Failures:  int(rep.failures.Load()),
+			LagMs:     rep.lag.Milliseconds(),
+			LastError: rep.lastError,
+		})
+		rep.mu.Unlock()
+	}
+	return statuses
+}
+
+// readYourWrites ผูกแต่ละ request กับ session ของ client (X-Session-ID หรือ IP)
+// request ที่เขียนสำเร็จ (POST/PUT/PATCH/DELETE) จะทำให้ session อ่านจาก primary ต่ออีกช่วงหนึ่ง
+// client ขอข้อมูลล่าสุดเองได้ด้วย header X-Read-Consistency: strong
+func readYourWrites(router *DBRouter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session := c.Get("X-Session-ID")
+		if session == "" {
+			session = c.IP()
+		}
+		ctx := WithRouteSession(c.UserContext(), session)
+		if c.Get("X-Read-Consistency") == "strong" {
+			ctx = ReadFromPrimary(ctx)
+		}
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		default:
+			// รวมการเขียนใน transaction ที่ไม่ได้ผ่าน router ด้วย
+			if err == nil && c.Response().StatusCode() < 400 {
+				router.MarkWrite(ctx)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// primary กับ replica เป็นคนละไฟล์และไม่ได้ sync กัน จึงดูได้จากข้อมูลว่า query ไปที่ไหน
+
+func newTestRouter(t *testing.T) (*DBRouter, *DB, *DB) {
+	t.Helper()
+	dir := t.TempDir()
+	primary := openTestDB(t, filepath.Join(dir, "primary.db"))
+	replica := openTestDB(t, filepath.Join(dir, "replica.db"))
+
+	ctx := context.Background()
+	if _, err := primary.ExecContext(ctx, "INSERT INTO users (email, name) VALUES ($1, $2)", "p@example.com", "primary"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.ExecContext(ctx, "INSERT INTO users (email, name) VALUES ($1, $2)", "r@example.com", "replica"); err != nil {
+		t.Fatal(err)
+	}
+	return NewDBRouter(primary, replica), primary, replica
+}
+
+func readSource(t *testing.T, ctx context.Context, q DBTX) string {
+	t.Helper()
+	var name string
+	if err := q.QueryRowContext(ctx, "SELECT name FROM users WHERE id = 1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRouterSplitsReadsAndWrites(t *testing.T) {
+	router, primary, _ := newTestRouter(t)
+	ctx := context.Background()
+
+	if got := readSource(t, ctx, router); got != "replica" {
+		t.Errorf("read went to %s, want replica", got)
+	}
+
+	// INSERT ... RETURNING ผ่าน QueryRowContext ต้องไป primary
+	user := &User{Email: "new@example.com", Name: "New"}
+	if err := (&userRepository{}).Create(ctx, router, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&userRepository{}).GetByID(ctx, primary, user.ID); err != nil {
+		t.Errorf("user not written to primary: %v", err)
+	}
+
+	var name string
+	if err := router.QueryRowContext(ctx, "SELECT name FROM users WHERE id = 1 FOR UPDATE").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "primary" {
+		t.Errorf("locking read went to %s, want primary", name)
+	}
+}
+
+func TestRouterReadYourWrites(t *testing.T) {
+	router, _, _ := newTestRouter(t)
+	alice := WithRouteSession(context.Background(), "alice")
+	bob := WithRouteSession(context.Background(), "bob")
+
+	if _, err := router.ExecContext(alice, "UPDATE users SET name = name WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSource(t, alice, router); got != "primary" {
+		t.Errorf("alice read after write went to %s, want primary", got)
+	}
+	if got := readSource(t, bob, router); got != "replica" {
+		t.Errorf("bob read went to %s, want replica", got)
+	}
+
+	// per-query overrides
+	if got := readSource(t, ReadFromReplica(alice), router); got != "replica" {
+		t.Errorf("ReadFromReplica went to %s, want replica", got)
+	}
+	if got := readSource(t, ReadFromPrimary(bob), router); got != "primary" {
+		t.Errorf("ReadFromPrimary went to %s, want primary", got)
+	}
+
+	router.stickiness = 0 // พ้นช่วง read-your-writes
+	if got := readSource(t, alice, router); got != "replica" {
+		t.Errorf("alice read after stickiness went to %s, want replica", got)
+	}
+}
+
+func TestRouterEjectsUnhealthyReplica(t *testing.T) {
+	dir := t.TempDir()
+	primary := openTestDB(t, filepath.Join(dir, "primary.db"))
+	missing := filepath.Join(dir, "down", "replica.db") // โฟลเดอร์ยังไม่มี เปิดไม่ได้
+	replica, err := OpenDB(sqliteDialect{}, "file:"+missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	router := NewDBRouter(primary, replica)
+	ctx := context.Background()
+
+	for i := 0; i < router.maxFailures; i++ {
+		router.CheckReplicas(ctx)
+	}
+	status := router.ReplicaStatus()[0]
+	if status.Healthy || status.LastError == "" {
+		t.Fatalf("replica status = %+v, want ejected", status)
+	}
+	// replica ถูกถอดแล้ว อ่านจาก primary แทน
+	var count int
+	if err := router.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Errorf("read with ejected replica: %v", err)
+	}
+
+	// replica กลับมาได้ → health check รับกลับ
+	if err := os.Mkdir(filepath.Dir(missing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	router.CheckReplicas(ctx)
+	if status := router.ReplicaStatus()[0]; !status.Healthy || status.Failures != 0 {
+		t.Errorf("replica status = %+v, want healthy", status)
+	}
+}
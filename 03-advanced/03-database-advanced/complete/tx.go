@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ============ Unit of Work ============
+
+// DBTX คือสิ่งที่ทั้ง *DB และ *Tx ทำได้
+// repository รับ DBTX จึงใช้ได้ทั้งนอกและใน transaction โดยไม่ต้องรู้ว่าเป็นแบบไหน
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TxManager รัน function ใน transaction และ retry เมื่อ database ขอให้ลองใหม่
+type TxManager struct {
+	db         *DB
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+func NewTxManager(db *DB) *TxManager {
+	return &TxManager{
+		db:         db,
+		maxRetries: 3,
+		baseDelay:  20 * time.Millisecond,
+	}
+}
+
+// WithTx เปิด transaction, รัน fn แล้ว commit (หรือ rollback ถ้า fn error)
+//
+// ถ้าล้มเหลวเพราะ serialization failure, deadlock (PostgreSQL) หรือ database busy (SQLite) จะ retry ทั้ง fn ใหม่
+// ด้วย exponential backoff + jitter ดังนั้น fn ต้องเริ่มคำนวณใหม่ทุกครั้ง (ห้ามสะสม state ไว้ข้างนอก)
+// ถ้า ctx ถูกยกเลิก (client หลุด / timeout) จะหยุดทันทีและ rollback
+func (m *TxManager) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = m.runOnce(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt >= m.maxRetries {
+			return err
+		}
+
+		delay := m.baseDelay << attempt
+		delay += time.Duration(rand.Int63n(int64(delay)))
+		log.Printf("🔁 Transaction retry %d/%d in %s: %v", attempt+1, m.maxRetries, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (m *TxManager) runOnce(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // ไม่มีผลถ้า commit ไปแล้ว
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestTxManagerWithTxRetry(t *testing.T) {
+	ctx := context.Background()
+	testDB := openEmptyTestDB(t)
+	if _, err := testDB.ExecContext(ctx, "CREATE TABLE attempts (n INTEGER NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewTxManager(testDB)
+	manager.baseDelay = time.Millisecond
+
+	serialization := &pq.Error{Code: "40001"}
+	broken := errors.New("broken")
+
+	for _, tc := range []struct {
+		name  string
+		fails []error // error ที่ fn คืนในแต่ละรอบ (หมดแล้ว = สำเร็จ)
+		err   error
+		calls int
+		rows  int // แถวที่ commit จริง
+	}{
+		{"success", nil, nil, 1, 1},
+		{"retryable once", []error{serialization}, nil, 2, 1},
+		{"not retryable", []error{broken}, broken, 1, 0},
+		{"retryable then not", []error{serialization, broken}, broken, 2, 0},
+		{"retries exhausted", []error{serialization, serialization, serialization, serialization}, serialization, 4, 0},
+	} {
+		if _, err := testDB.ExecContext(ctx, "DELETE FROM attempts"); err != nil {
+			t.Fatal(err)
+		}
+
+		calls := 0
+		err := manager.WithTx(ctx, nil, func(tx *Tx) error {
+			calls++
+			// เขียนก่อนล้มเหลว: รอบที่ error ต้องถูก rollback
+			if _, err := tx.ExecContext(ctx, "INSERT INTO attempts (n) VALUES ($1)", calls); err != nil {
+				return err
+			}
+			if calls <= len(tc.fails) {
+				return tc.fails[calls-1]
+			}
+			return nil
+		})
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: fn called %d times, want %d", tc.name, calls, tc.calls)
+		}
+		var rows int
+		if err := testDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM attempts").Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != tc.rows {
+			t.Errorf("%s: %d rows committed, want %d", tc.name, rows, tc.rows)
+		}
+	}
+}
+
+func TestTxManagerWithTxStopsWhenCancelled(t *testing.T) {
+	manager := NewTxManager(openEmptyTestDB(t))
+	manager.baseDelay = time.Hour // ถ้าไม่ดู ctx จะค้างอยู่ใน backoff
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := manager.WithTx(ctx, nil, func(tx *Tx) error {
+		calls++
+		cancel()
+		return &pq.Error{Code: "40P01"}
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
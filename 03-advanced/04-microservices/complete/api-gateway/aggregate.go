@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ============ Fan-out Aggregator ============
+
+// Source หนึ่งแหล่งข้อมูลของ aggregator แต่ละแหล่งมี deadline และ cache ของตัวเอง
+// แหล่งหนึ่งช้าหรือพังไม่ทำให้แหล่งอื่นรอหรือหายไปด้วย
+type Source struct {
+	Name     string
+	Timeout  time.Duration // deadline ของการดึงหนึ่งครั้ง
+	CacheTTL time.Duration // ผลที่ใหม่กว่านี้ใช้เลยไม่ต้องดึง, 0 = ไม่ cache
+	MaxStale time.Duration // ดึงไม่สำเร็จ = ใช้ผลเก่าที่ไม่เก่ากว่านี้แทน (status stale)
+	Fetch    func(ctx context.Context) (interface{}, error)
+}
+
+// สถานะของแต่ละแหล่งใน SourceStatus.Status
+const (
+	SourceOK      = "ok"
+	SourceCached  = "cached"
+	SourceStale   = "stale"
+	SourceTimeout = "timeout"
+	SourceError   = "error"
+)
+
+// SourceStatus ผลของแหล่งหนึ่ง ส่งกลับให้ client ด้วยเพื่อให้รู้ว่าข้อมูลส่วนไหนขาดหรือเก่า
+type SourceStatus struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Latency   string    `json:"latency"`
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+}
+
+// Aggregation ผลรวมของทุกแหล่ง Data มีเฉพาะแหล่งที่ได้ข้อมูล (ok, cached, stale)
+type Aggregation struct {
+	Data    map[string]interface{}
+	Sources map[string]SourceStatus
+}
+
+// Partial มีอย่างน้อยหนึ่งแหล่งที่ไม่ได้ข้อมูลสดใหม่
+func (a Aggregation) Partial() bool {
+	for _, status := range a.Sources {
+		if status.Status != SourceOK && status.Status != SourceCached {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCachedSources จำนวนผลใน cache สูงสุด (หนึ่งผลต่อผู้เรียกต่อแหล่ง)
+const maxCachedSources = 10000
+
+// Aggregator cache แยกตามผู้เรียก (identity ใน ctx) เพราะ upstream ตอบตามสิทธิ์ของผู้เรียก
+// เช่น todo-service ให้ user ทั่วไปเห็นเฉพาะ todos ของตัวเอง
+type Aggregator struct {
+	sources []Source
+	retain  time.Duration // ผลที่เก่ากว่านี้ไม่มีแหล่งไหนใช้ได้แล้ว
+
+	mu    sync.Mutex
+	cache map[string]cachedSource
+}
+
+type cachedSource struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+func NewAggregator(sources ...Source) *Aggregator {
+	agg := &Aggregator{sources: sources, cache: make(map[string]cachedSource)}
+	for _, source := range sources {
+		agg.retain = max(agg.retain, source.CacheTTL, source.MaxStale)
+	}
+	return agg
+}
+
+// cacheKey ผลของแหล่งเดียวกันแยกตามผู้เรียก แบบเดียวกับ withCache
+func cacheKey(ctx context.Context, source string) string {
+	if caller, ok := identityFrom(ctx); ok {
+		return caller.UserID + "|" + source
+	}
+	return "|" + source
+}
+
+// Fetch ดึงทุกแหล่งพร้อมกัน รอไม่เกิน deadline ของแหล่งที่ช้าที่สุด
+// goroutines ส่งผลลง channel ที่มีที่ว่างพอเสมอ จึงไม่ค้างแม้ผู้เรียกจะเลิกรอไปแล้ว
+func (a *Aggregator) Fetch(ctx context.Context) Aggregation {
+	type result struct {
+		name   string
+		value  interface{}
+		status SourceStatus
+	}
+	results := make(chan result, len(a.sources))
+
+	var longest time.Duration
+	for _, source := range a.sources {
+		longest = max(longest, source.Timeout)
+		go func(source Source) {
+			value, status := a.fetchSource(ctx, source)
+			results <- result{name: source.Name, value: value, status: status}
+		}(source)
+	}
+
+	agg := Aggregation{Data: make(map[string]interface{}), Sources: make(map[string]SourceStatus)}
+	// เผื่อเวลาเล็กน้อยให้แหล่งที่หมด deadline รายงานผลเอง (Fetch ที่ไม่สนใจ ctx จะถูกนับเป็น timeout)
+	wait := time.NewTimer(longest + 100*time.Millisecond)
+	defer wait.Stop()
+	for range a.sources {
+		select {
+		case r := <-results:
+			agg.Sources[r.name] = r.status
+			if r.value != nil {
+				agg.Data[r.name] = r.value
+			}
+		case <-wait.C:
+			for _, source := range a.sources {
+				if _, ok := agg.Sources[source.Name]; !ok {
+					agg.Sources[source.Name] = SourceStatus{Status: SourceTimeout, Error: "no response", Latency: longest.String()}
+				}
+			}
+			return agg
+		}
+	}
+	return agg
+}
+
+func (a *Aggregator) fetchSource(ctx context.Context, source Source) (interface{}, SourceStatus) {
+	key := cacheKey(ctx, source.Name)
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < source.CacheTTL {
+		return cached.value, SourceStatus{Status: SourceCached, Latency: "0s", FetchedAt: cached.fetchedAt}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, source.Timeout)
+	defer cancel()
+	value, err := source.Fetch(ctx)
+	latency := time.Since(start).Round(time.Millisecond).String()
+
+	if err == nil {
+		now := time.Now()
+		if source.CacheTTL > 0 || source.MaxStale > 0 {
+			a.store(key, cachedSource{value: value, fetchedAt: now})
+		}
+		return value, SourceStatus{Status: SourceOK, Latency: latency, FetchedAt: now}
+	}
+
+	status := SourceStatus{Status: SourceError, Error: err.Error(), Latency: latency}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		status.Status = SourceTimeout
+	}
+	if ok && time.Since(cached.fetchedAt) < source.MaxStale {
+		status.Status, status.FetchedAt = SourceStale, cached.fetchedAt
+		return cached.value, status
+	}
+	return nil, status
+}
+
+// store เก็บผลลง cache เต็มเมื่อไรล้างผลที่หมดอายุทุกแหล่งก่อน ยังเต็มอยู่ = ไม่เก็บ
+func (a *Aggregator) store(key string, entry cachedSource) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, exists := a.cache[key]; !exists && len(a.cache) >= maxCachedSources {
+		for k, e := range a.cache {
+			if entry.fetchedAt.Sub(e.fetchedAt) >= a.retain {
+				delete(a.cache, k)
+			}
+		}
+		if len(a.cache) >= maxCachedSources {
+			return
+		}
+	}
+	a.cache[key] = entry
+}
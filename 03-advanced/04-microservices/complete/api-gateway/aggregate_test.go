@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAggregatorFetch(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	agg := NewAggregator(
+		Source{Name: "fast", Timeout: 100 * time.Millisecond, Fetch: func(ctx context.Context) (interface{}, error) {
+			return "users", nil
+		}},
+		Source{Name: "slow", Timeout: 50 * time.Millisecond, Fetch: func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+		// ไม่สนใจ ctx เลย ต้องไม่ทำให้ Fetch ค้าง
+		Source{Name: "hanging", Timeout: 100 * time.Millisecond, Fetch: func(ctx context.Context) (interface{}, error) {
+			<-release
+			return "too late", nil
+		}},
+		Source{Name: "broken", Timeout: 100 * time.Millisecond, Fetch: func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("status 500")
+		}},
+	)
+
+	start := time.Now()
+	result := agg.Fetch(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Fetch took %v with a hanging source", elapsed)
+	}
+
+	for _, tc := range []struct {
+		source string
+		status string
+		data   bool
+	}{
+		{"fast", SourceOK, true},
+		{"slow", SourceTimeout, false},
+		{"hanging", SourceTimeout, false},
+		{"broken", SourceError, false},
+	} {
+		if got := result.Sources[tc.source].Status; got != tc.status {
+			t.Errorf("%s: status = %s, want %s", tc.source, got, tc.status)
+		}
+		if _, ok := result.Data[tc.source]; ok != tc.data {
+			t.Errorf("%s: has data = %v, want %v", tc.source, ok, tc.data)
+		}
+	}
+	if !result.Partial() {
+		t.Error("Partial = false with failed sources")
+	}
+}
+
+func TestAggregatorCacheAndStale(t *testing.T) {
+	calls := 0
+	var fail error
+	agg := NewAggregator(Source{
+		Name:     "todos",
+		Timeout:  100 * time.Millisecond,
+		CacheTTL: 5 * time.Second,
+		MaxStale: time.Minute,
+		Fetch: func(ctx context.Context) (interface{}, error) {
+			calls++
+			if fail != nil {
+				return nil, fail
+			}
+			return calls, nil
+		},
+	})
+	// age ทำให้ผลใน cache เก่าลงตามที่ต้องการ
+	age := func(d time.Duration) func() {
+		return func() {
+			key := cacheKey(context.Background(), "todos")
+			cached := agg.cache[key]
+			cached.fetchedAt = time.Now().Add(-d)
+			agg.cache[key] = cached
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		before  func()
+		status  string
+		value   interface{} // nil = ไม่มีข้อมูล
+		calls   int
+		partial bool
+	}{
+		{"first fetch", nil, SourceOK, 1, 1, false},
+		{"within cache ttl", nil, SourceCached, 1, 1, false},
+		{"cache expired", age(10 * time.Second), SourceOK, 2, 2, false},
+		{"failure serves stale", func() { age(30 * time.Second)(); fail = errors.New("down") }, SourceStale, 2, 3, true},
+		{"too stale", age(2 * time.Minute), SourceError, nil, 4, true},
+	} {
+		if tc.before != nil {
+			tc.before()
+		}
+		result := agg.Fetch(context.Background())
+		if got := result.Sources["todos"].Status; got != tc.status {
+			t.Errorf("%s: status = %s, want %s", tc.name, got, tc.status)
+		}
+		if got := result.Data["todos"]; got != tc.value {
+			t.Errorf("%s: data = %v, want %v", tc.name, got, tc.value)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: fetched %d times, want %d", tc.name, calls, tc.calls)
+		}
+		if result.Partial() != tc.partial {
+			t.Errorf("%s: partial = %v, want %v", tc.name, result.Partial(), tc.partial)
+		}
+	}
+}
+
+func TestAggregatorCachePerCaller(t *testing.T) {
+	calls := map[string]int{}
+	agg := NewAggregator(Source{
+		Name:     "todos",
+		Timeout:  100 * time.Millisecond,
+		CacheTTL: 5 * time.Second,
+		MaxStale: time.Minute,
+		// ตอบตามผู้เรียกแบบเดียวกับ todo-service ที่ scope ตาม X-User-ID
+		Fetch: func(ctx context.Context) (interface{}, error) {
+			caller, _ := identityFrom(ctx)
+			calls[caller.UserID]++
+			return "todos of " + caller.UserID, nil
+		},
+	})
+	as := func(userID string) context.Context {
+		return context.WithValue(context.Background(), identityKey{}, Identity{UserID: userID, Roles: []string{"user"}})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		caller string
+		status string
+		calls  int // จำนวนครั้งที่ดึงด้วย identity ของ caller
+	}{
+		{"user 1 first fetch", "1", SourceOK, 1},
+		{"user 2 not served user 1's cache", "2", SourceOK, 1},
+		{"user 1 cached", "1", SourceCached, 1},
+		{"user 2 cached", "2", SourceCached, 1},
+	} {
+		result := agg.Fetch(as(tc.caller))
+		if got := result.Sources["todos"].Status; got != tc.status {
+			t.Errorf("%s: status = %s, want %s", tc.name, got, tc.status)
+		}
+		if got, want := result.Data["todos"], "todos of "+tc.caller; got != want {
+			t.Errorf("%s: data = %v, want %v", tc.name, got, want)
+		}
+		if calls[tc.caller] != tc.calls {
+			t.Errorf("%s: fetched %d times, want %d", tc.name, calls[tc.caller], tc.calls)
+		}
+	}
+}
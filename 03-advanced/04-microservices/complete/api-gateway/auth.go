@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"shared/identity"
+)
+
+// ============ Edge Authentication ============
+
+// ค่าเริ่มต้นสำหรับ dev เท่านั้น (JWT secret เดียวกับบท 01-jwt-auth ใช้ token จากบทนั้นได้เลย)
+const devJWTSecret = "your-secret-key-keep-it-safe"
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity ผู้เรียกที่ผ่านการตรวจที่ edge แล้ว
+type Identity struct {
+	UserID string   `json:"user_id"`
+	Roles  []string `json:"roles"`
+	Method string   `json:"method"` // jwt | api_key
+}
+
+// apiKey client ที่ใช้ API key แทน JWT (เช่น service ภายนอก / script)
+type apiKey struct {
+	subject string
+	roles   []string
+}
+
+// EdgeAuth ตรวจ JWT (Authorization: Bearer) หรือ API key (X-API-Key) ของ client
+// identity ที่ผ่านแล้วส่งต่อให้ services ด้วยลายเซ็นของ shared/identity (INTERNAL_AUTH_SECRET)
+type EdgeAuth struct {
+	jwtSecret []byte
+	apiKeys   map[string]apiKey // key = sha256 ของ API key (ไม่เก็บ key ตรง ๆ)
+}
+
+var edgeAuth *EdgeAuth
+
+// initEdgeAuth อ่าน JWT_SECRET, INTERNAL_AUTH_SECRET และ API_KEYS
+// API_KEYS = "key:subject:role1|role2,key2:subject2:role" (roles ไม่ใส่ = user)
+func initEdgeAuth() {
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Println("⚠️ JWT_SECRET not set, using development secret")
+		jwtSecret = devJWTSecret
+	}
+	identity.Init()
+
+	apiKeys, err := parseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		log.Fatal("Invalid API_KEYS: ", err)
+	}
+	edgeAuth = &EdgeAuth{jwtSecret: []byte(jwtSecret), apiKeys: apiKeys}
+}
+
+func parseAPIKeys(value string) (map[string]apiKey, error) {
+	keys := make(map[string]apiKey)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("entry %q must be key:subject[:roles]", entry)
+		}
+		roles := []string{"user"}
+		if len(parts) == 3 && parts[2] != "" {
+			roles = strings.Split(parts[2], "|")
+		}
+		keys[hashKey(parts[0])] = apiKey{subject: parts[1], roles: roles}
+	}
+	return keys, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate ตรวจ credentials ของ client คืน identity ที่จะส่งต่อให้ services
+func (a *EdgeAuth) Authenticate(c *fiber.Ctx) (Identity, error) {
+	if key := c.Get("X-API-Key"); key != "" {
+		client, ok := a.apiKeys[hashKey(key)]
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: invalid API key", ErrUnauthenticated)
+		}
+		return Identity{UserID: client.subject, Roles: client.roles, Method: "api_key"}, nil
+	}
+
+	header := c.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		return Identity{}, fmt.Errorf("%w: missing Authorization header or X-API-Key", ErrUnauthenticated)
+	}
+	tokenString, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: Authorization header must start with 'Bearer '", ErrUnauthenticated)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid or expired token", ErrUnauthenticated)
+	}
+	return identityFromClaims(claims)
+}
+
+// identityFromClaims รองรับทั้ง "sub" และ "user_id" (แบบบท 01-jwt-auth) และ "roles" หรือ "role"
+func identityFromClaims(claims jwt.MapClaims) (Identity, error) {
+	identity := Identity{Method: "jwt"}
+	switch id := claims["user_id"].(type) {
+	case float64:
+		identity.UserID = strconv.FormatInt(int64(id), 10)
+	case string:
+		identity.UserID = id
+	}
+	if identity.UserID == "" {
+		identity.UserID, _ = claims.GetSubject()
+	}
+	if identity.UserID == "" {
+		return Identity{}, fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	}
+
+	switch roles := claims["roles"].(type) {
+	case []interface{}:
+		for _, role := range roles {
+			if role, ok := role.(string); ok && role != "" {
+				identity.Roles = append(identity.Roles, role)
+			}
+		}
+	case string:
+		identity.Roles = strings.Split(roles, ",")
+	}
+	if role, ok := claims["role"].(string); ok && role != "" {
+		identity.Roles = append(identity.Roles, role)
+	}
+	if len(identity.Roles) == 0 {
+		identity.Roles = []string{"user"}
+	}
+	return identity, nil
+}
+
+// RequireAuth middleware สำหรับ group ของ fiber (เช่น /admin)
+func (a *EdgeAuth) RequireAuth() fiber.Handler {
+	return a.Wrap(func(c *fiber.Ctx) error { return c.Next() })
+}
+
+// Wrap ครอบ handler ของ route ที่ตั้ง auth: true ไม่ผ่าน = 401 ที่ edge ไม่ถึง services
+func (a *EdgeAuth) Wrap(next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, err := a.Authenticate(c)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api-gateway"`)
+			return c.Status(401).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		c.Locals("identity", identity)
+		c.SetUserContext(context.WithValue(c.UserContext(), identityKey{}, identity))
+		return next(c)
+	}
+}
+
+// RequireRole ใช้หลัง RequireAuth
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, _ := c.Locals("identity").(Identity)
+		for _, r := range identity.Roles {
+			if r == role {
+				return c.Next()
+			}
+		}
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"error":   "Requires role " + role,
+		})
+	}
+}
+
+type identityKey struct{}
+
+func identityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// ============ Internal Identity Header ============
+
+// signIdentity ลบ identity headers ที่ client ส่งมา แล้วใส่ identity ที่ gateway รับรองพร้อมลายเซ็น
+// ลายเซ็นผูกกับ method + URI + เวลา เอาไปใช้กับ URI อื่นหรือหลังหมดอายุไม่ได้
+// แต่ไม่ครอบคลุม body (body ถูก stream ต่อ) ภายในอายุลายเซ็นจึงส่งซ้ำไป URI เดิมด้วย body อื่นได้
+func signIdentity(req *http.Request, caller Identity, ok bool) {
+	if !ok {
+		identity.StripHeaders(req.Header)
+		return
+	}
+	identity.SignRequest(req, caller.internal())
+}
+
+// internal identity ที่ส่งต่อให้ services (วิธียืนยันตัวตนที่ edge ไม่ถูกส่งต่อ)
+func (i Identity) internal() identity.Identity {
+	return identity.Identity{UserID: i.UserID, Roles: i.Roles}
+}
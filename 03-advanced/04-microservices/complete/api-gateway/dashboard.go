@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Dashboard ============
+
+// dashboardUser / dashboardTodo เฉพาะ fields ที่ dashboard ใช้
+type dashboardUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type dashboardTodo struct {
+	ID        int  `json:"id"`
+	Completed bool `json:"completed"`
+	UserID    int  `json:"user_id"`
+}
+
+// dashboard ดึง users และ todos ทั้งหมด (ทุกหน้า) ด้วย identity ของผู้เรียก แยก deadline และ cache ต่อแหล่ง
+// cache แยกตามผู้เรียกด้วย เพราะ todo-service ให้ user ทั่วไปเห็นเฉพาะ todos ของตัวเอง
+var dashboard = NewAggregator(
+	Source{
+		Name:     "users",
+		Timeout:  2 * time.Second,
+		CacheTTL: 10 * time.Second,
+		MaxStale: 5 * time.Minute,
+		Fetch: func(ctx context.Context) (interface{}, error) {
+			return fetchAllPages[dashboardUser](ctx, UserService, "/users")
+		},
+	},
+	Source{
+		Name:     "todos",
+		Timeout:  3 * time.Second,
+		CacheTTL: 5 * time.Second,
+		MaxStale: 5 * time.Minute,
+		Fetch: func(ctx context.Context) (interface{}, error) {
+			return fetchAllPages[dashboardTodo](ctx, TodoService, "/todos")
+		},
+	},
+)
+
+// dashboardHandler ตอบเท่าที่ได้เสมอ (partial: true + สถานะของแต่ละแหล่งใน sources)
+// ไม่ได้ข้อมูลจากแหล่งไหนเลย = 503
+func dashboardHandler(c *fiber.Ctx) error {
+	agg := dashboard.Fetch(c.UserContext())
+	users, hasUsers := agg.Data["users"].([]dashboardUser)
+	todos, hasTodos := agg.Data["todos"].([]dashboardTodo)
+
+	stats := fiber.Map{"generated_at": time.Now()}
+	if hasUsers {
+		stats["total_users"] = len(users)
+	}
+	if hasTodos {
+		completed := 0
+		for _, todo := range todos {
+			if todo.Completed {
+				completed++
+			}
+		}
+		stats["total_todos"] = len(todos)
+		stats["completed_todos"] = completed
+		stats["pending_todos"] = len(todos) - completed
+		stats["completion_rate"] = completionRate(completed, len(todos))
+	}
+
+	dashboardData := fiber.Map{"stats": stats}
+	if hasTodos {
+		perUser, withoutTodos, orphaned := todosPerUser(users, hasUsers, todos)
+		dashboardData["todos_per_user"] = perUser
+		if hasUsers {
+			stats["users_without_todos"] = withoutTodos
+			stats["orphaned_todos"] = orphaned
+			if len(users) > 0 {
+				stats["avg_todos_per_user"] = math.Round(float64(len(todos)-orphaned)/float64(len(users))*100) / 100
+			}
+		}
+	}
+
+	status := 200
+	if len(agg.Data) == 0 {
+		status = 503
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success":   len(agg.Data) > 0,
+		"partial":   agg.Partial(),
+		"dashboard": dashboardData,
+		"sources":   agg.Sources,
+	})
+}
+
+type userTodoStats struct {
+	UserID         int     `json:"user_id"`
+	Name           string  `json:"name,omitempty"`
+	Total          int     `json:"total"`
+	Completed      int     `json:"completed"`
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// todosPerUser นับ todos ของแต่ละ user (มากไปน้อย) ถ้ามีรายชื่อ users จะใส่ชื่อ, นับ users ที่ไม่มี todo
+// และ todos ที่เจ้าของไม่มีอยู่แล้ว ไม่มีรายชื่อ = นับตาม user_id ที่เจอใน todos อย่างเดียว
+func todosPerUser(users []dashboardUser, hasUsers bool, todos []dashboardTodo) ([]userTodoStats, int, int) {
+	byUser := make(map[int]*userTodoStats)
+	if hasUsers {
+		for _, user := range users {
+			byUser[user.ID] = &userTodoStats{UserID: user.ID, Name: user.Name}
+		}
+	}
+
+	orphaned := 0
+	for _, todo := range todos {
+		stats, ok := byUser[todo.UserID]
+		if !ok {
+			if hasUsers {
+				orphaned++
+				continue
+			}
+			stats = &userTodoStats{UserID: todo.UserID}
+			byUser[todo.UserID] = stats
+		}
+		stats.Total++
+		if todo.Completed {
+			stats.Completed++
+		}
+	}
+
+	result := make([]userTodoStats, 0, len(byUser))
+	withoutTodos := 0
+	for _, stats := range byUser {
+		if stats.Total == 0 {
+			withoutTodos++
+		}
+		stats.CompletionRate = completionRate(stats.Completed, stats.Total)
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].UserID < result[j].UserID
+	})
+	return result, withoutTodos, orphaned
+}
+
+// completionRate เป็น % ทศนิยม 1 ตำแหน่ง (ไม่มี todo = 0)
+func completionRate(completed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(completed)/float64(total)*1000) / 10
+}
+
+// ============ Paged Fetch ============
+
+// maxDashboardPages กันวนไม่จบถ้า service ตอบ has_next ผิด (100 หน้า x 100 = 10,000 รายการ)
+const maxDashboardPages = 100
+
+// fetchAllPages ดึง ?page=1..n&limit=100 จนหมด (identity และ request ID ของผู้เรียกไปกับ ctx)
+func fetchAllPages[T any](ctx context.Context, service, path string) ([]T, error) {
+	var all []T
+	for page := 1; page <= maxDashboardPages; page++ {
+		var resp struct {
+			Data       []T `json:"data"`
+			Pagination struct {
+				HasNext bool `json:"has_next"`
+			} `json:"pagination"`
+		}
+		if err := fetchJSON(ctx, service, path+"?limit=100&page="+strconv.Itoa(page), &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Data...)
+		if !resp.Pagination.HasNext {
+			return all, nil
+		}
+	}
+	return all, fmt.Errorf("%s%s has more than %d pages", service, path, maxDashboardPages)
+}
+
+// fetchJSON GET ผ่าน resilience layer แล้ว decode body ลง out, status ไม่ใช่ 2xx = error พร้อมข้อความของ service
+func fetchJSON(ctx context.Context, service, path string, out interface{}) error {
+	resp, err := upstreamFor(service).Do(ctx, UpstreamRequest{
+		Method: http.MethodGet,
+		Path:   path,
+		Header: http.Header{"Accept": {"application/json"}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s: status %d: %s", service, resp.StatusCode, failure.Error)
+		}
+		return fmt.Errorf("%s: status %d", service, resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
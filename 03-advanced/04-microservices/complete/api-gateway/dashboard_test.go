@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTodosPerUser(t *testing.T) {
+	users := []dashboardUser{{ID: 1, Name: "John"}, {ID: 2, Name: "Jane"}, {ID: 3, Name: "Bob"}}
+	todos := []dashboardTodo{
+		{ID: 1, UserID: 1, Completed: true},
+		{ID: 2, UserID: 1},
+		{ID: 3, UserID: 2, Completed: true},
+		{ID: 4, UserID: 1},
+		{ID: 5, UserID: 9}, // เจ้าของถูกลบไปแล้ว
+	}
+
+	for _, tc := range []struct {
+		name         string
+		users        []dashboardUser
+		hasUsers     bool
+		todos        []dashboardTodo
+		want         []userTodoStats
+		withoutTodos int
+		orphaned     int
+	}{
+		{"with users", users, true, todos, []userTodoStats{
+			{UserID: 1, Name: "John", Total: 3, Completed: 1, CompletionRate: 33.3},
+			{UserID: 2, Name: "Jane", Total: 1, Completed: 1, CompletionRate: 100},
+			{UserID: 3, Name: "Bob"},
+		}, 1, 1},
+		{"users unavailable", nil, false, todos, []userTodoStats{
+			{UserID: 1, Total: 3, Completed: 1, CompletionRate: 33.3},
+			{UserID: 2, Total: 1, Completed: 1, CompletionRate: 100},
+			{UserID: 9, Total: 1},
+		}, 0, 0},
+		{"no todos", users[:2], true, nil, []userTodoStats{
+			{UserID: 1, Name: "John"},
+			{UserID: 2, Name: "Jane"},
+		}, 2, 0},
+		{"nothing", nil, true, nil, []userTodoStats{}, 0, 0},
+	} {
+		got, withoutTodos, orphaned := todosPerUser(tc.users, tc.hasUsers, tc.todos)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: stats = %+v, want %+v", tc.name, got, tc.want)
+		}
+		if withoutTodos != tc.withoutTodos || orphaned != tc.orphaned {
+			t.Errorf("%s: without todos = %d orphaned = %d, want %d %d", tc.name, withoutTodos, orphaned, tc.withoutTodos, tc.orphaned)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"shared/identity"
+)
+
+// ============ gRPC Upstreams ============
+
+// ที่อยู่ gRPC ของแต่ละ service: <SERVICE>_GRPC_ADDR เช่น USER_SERVICE_GRPC_ADDR
+// ไม่ตั้ง = ค่าเริ่มต้นด้านล่าง (ไม่มีค่าเริ่มต้น = route ที่ใช้ grpc: ของ service นั้นโหลดไม่ผ่าน)
+var defaultGRPCAddrs = map[string]string{
+	UserService: "localhost:50052",
+}
+
+var (
+	grpcConnsMu sync.Mutex
+	grpcConns   = make(map[string]*grpc.ClientConn)
+)
+
+// grpcConn connection เดียวต่อ service ใช้ร่วมทุก route และไม่ปิดตอนโหลด routes ใหม่
+// NewClient ไม่ต่อทันที ต่อเมื่อเรียกครั้งแรกและต่อใหม่เองถ้าหลุด
+func grpcConn(service string) (*grpc.ClientConn, error) {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	if conn, ok := grpcConns[service]; ok {
+		return conn, nil
+	}
+
+	env := strings.ToUpper(strings.ReplaceAll(service, "-", "_")) + "_GRPC_ADDR"
+	addr := os.Getenv(env)
+	if addr == "" {
+		addr = defaultGRPCAddrs[service]
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("%s is not set", env)
+	}
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(unaryOutgoingMetadata()),
+		grpc.WithChainStreamInterceptor(streamOutgoingMetadata()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	grpcConns[service] = conn
+	log.Printf("🔌 %s via gRPC at %s", service, addr)
+	return conn, nil
+}
+
+// outgoingMetadata ส่ง request ID และ identity ที่ลงลายเซ็นแบบเดียวกับ HTTP headers
+// ลายเซ็นใช้ identity.MethodGRPC + full method name แทน method + path (ดู user-service/grpc_server.go)
+func outgoingMetadata(ctx context.Context, fullMethod string) context.Context {
+	if id := requestIDFrom(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", id)
+	}
+	caller, ok := identityFrom(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, identity.SignGRPC(fullMethod, caller.internal())...)
+}
+
+func unaryOutgoingMetadata() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingMetadata(ctx, method), method, req, reply, cc, opts...)
+	}
+}
+
+func streamOutgoingMetadata() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingMetadata(ctx, method), desc, cc, method, opts...)
+	}
+}
+
+// grpcError ตอบ error ของ gRPC เป็น JSON ด้วย HTTP status ที่ตรงกัน
+func grpcError(c *fiber.Ctx, err error) error {
+	st := status.Convert(err)
+	return c.Status(httpStatusFromCode(st.Code())).JSON(fiber.Map{
+		"success": false,
+		"error":   st.Message(),
+		"code":    st.Code().String(),
+	})
+}
+
+// httpStatusFromCode ตาม mapping มาตรฐานของ gRPC-HTTP gateways
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return 200
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return 400
+	case codes.Unauthenticated:
+		return 401
+	case codes.PermissionDenied:
+		return 403
+	case codes.NotFound:
+		return 404
+	case codes.AlreadyExists, codes.Aborted:
+		return 409
+	case codes.ResourceExhausted:
+		return 429
+	case codes.Unimplemented:
+		return 501
+	case codes.Unavailable:
+		return 503
+	case codes.DeadlineExceeded:
+		return 504
+	}
+	return 500
+}
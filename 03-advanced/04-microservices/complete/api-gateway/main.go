@@ -1,40 +1,35 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
-// Service URLs
-const (
-	UserServiceURL = "http://localhost:3001"
-	TodoServiceURL = "http://localhost:3002"
-)
+// registry ที่อยู่ของทุก instance (ดู registry.go)
+var registry *Registry
 
 // Response structures
-type ServiceResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
-
 type HealthCheck struct {
-	Service string `json:"service"`
-	Status  string `json:"status"`
-	URL     string `json:"url"`
+	Service   string                   `json:"service"`
+	Status    string                   `json:"status"`
+	URL       string                   `json:"url,omitempty"`
+	Healthy   int                      `json:"healthy_instances"`
+	Instances []Instance               `json:"instances,omitempty"`
+	Circuits  map[string]BreakerStatus `json:"circuits,omitempty"` // instance URL → วงจรของ instance นั้น
 }
 
 func main() {
 	app := fiber.New(fiber.Config{
+		// body ของ client stream ตรงไป upstream ได้ (ไม่ต้องอ่านทั้งก้อนก่อน และไม่แกะ multipart เอง)
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(500).JSON(fiber.Map{
 				"success": false,
@@ -43,68 +38,113 @@ func main() {
 		},
 	})
 
-	app.Use(logger.New())
+	// X-Request-ID: ใช้ของ client ถ้าส่งมา ไม่งั้นสร้างใหม่ แล้วส่งต่อทุก upstream (ดู proxy.go)
+	app.Use(requestid.New())
+	app.Use(requestIDContext())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${locals:requestid} | ${method} ${path}\n",
+	}))
 	app.Use(cors.New())
 
+	// ที่อยู่ของ services: REGISTRY_FILE (static) + services ที่ลงทะเบียนเองผ่าน /registry
+	initRegistry()
+
+	// JWT / API key ที่ edge แล้วส่ง identity ที่ลงลายเซ็นไปให้ services (ดู auth.go)
+	initEdgeAuth()
+
+	// เส้นทางจาก ROUTES_FILE (ค่าเริ่มต้น routes.yaml) ใช้ edgeAuth จึงต้องโหลดทีหลัง
+	initRouter()
+
 	// API Gateway info
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
-			"service": "API Gateway",
-			"version": "1.0.0",
-			"status":  "running",
-			"services": map[string]string{
-				"users": UserServiceURL,
-				"todos": TodoServiceURL,
-			},
+			"service":  "API Gateway",
+			"version":  "1.0.0",
+			"status":   "running",
+			"services": registry.Services(),
 		})
 	})
 
 	// Health check for all services
 	app.Get("/health", healthCheckHandler)
 
-	// User service routes
-	app.Post("/api/users", proxyToUserService)
-	app.Get("/api/users/:id", proxyToUserService)
-	app.Get("/api/users", proxyToUserService)
+	// Admin: ดูตารางเส้นทางที่ใช้อยู่และสั่งโหลดใหม่ (ต้องเป็น admin)
+	admin := app.Group("/admin", edgeAuth.RequireAuth(), RequireRole("admin"))
+	admin.Get("/routes", listRoutesHandler)
+	admin.Post("/routes/reload", reloadRoutesHandler)
 
-	// Todo service routes
-	app.Post("/api/todos", proxyToTodoService)
-	app.Get("/api/todos/:id", proxyToTodoService)
-	app.Get("/api/todos", proxyToTodoService)
-	app.Put("/api/todos/:id", proxyToTodoService)
-	app.Delete("/api/todos/:id", proxyToTodoService)
+	// Service registry: services ลงทะเบียน ส่ง heartbeat และถอนตัวเอง
+	reg := app.Group("/registry", registryAuth())
+	reg.Get("/services", listRegistryHandler)
+	reg.Post("/services/:service/instances", registerInstanceHandler)
+	reg.Put("/services/:service/instances/:id/heartbeat", heartbeatHandler)
+	reg.Delete("/services/:service/instances/:id", deregisterInstanceHandler)
 
-	// Aggregate endpoints
-	app.Get("/api/dashboard", dashboardHandler)
+	// /api/* และ route อื่นตาม routes.yaml (โหลดใหม่ได้ไม่ต้อง restart ดู routes.go)
+	app.Use(router.Handler())
 
 	log.Println("🌐 API Gateway started on port 3000")
-	log.Println("📡 Proxying requests to microservices:")
-	log.Println("   👥 Users: " + UserServiceURL)
-	log.Println("   📝 Todos: " + TodoServiceURL)
+	log.Printf("📡 Proxying requests to microservices (%s):", registry.strategy)
+	for _, service := range registry.Services() {
+		for _, instance := range registry.Instances(service) {
+			log.Printf("   %s: %s", service, instance.URL)
+		}
+	}
 	log.Fatal(app.Listen(":3000"))
 }
 
+// initRegistry สร้าง registry จาก REGISTRY_FILE (ไม่ตั้ง = localhost:3001/3002 แบบเดิม)
+// LB_STRATEGY = round_robin (ค่าเริ่มต้น) | least_conn
+func initRegistry() {
+	var err error
+	registry, err = NewRegistry(os.Getenv("LB_STRATEGY"), 30*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if path := os.Getenv("REGISTRY_FILE"); path != "" {
+		err = registry.LoadStatic(path)
+	} else {
+		err = registry.AddStatic(defaultInstances)
+	}
+	if err != nil {
+		log.Fatal("Failed to load service registry: ", err)
+	}
+	if names := os.Getenv("REGISTRY_SERVICES"); names != "" {
+		registry.Allow(strings.Split(names, ",")...)
+	}
+
+	// instance ที่ไม่ผ่าน /health ไม่ถูกเลือก และ dynamic instance ที่พังติดกันถูกถอด
+	registry.StartHealthChecks(10 * time.Second)
+}
+
 // Health check handler
+// สถานะมาจาก health check ล่าสุดของ registry (ไม่ยิงไปทุก instance ทุกครั้งที่มีคนเรียก)
 func healthCheckHandler(c *fiber.Ctx) error {
 	services := []HealthCheck{
-		{Service: "api-gateway", Status: "healthy", URL: "localhost:3000"},
+		{Service: "api-gateway", Status: "healthy", URL: "localhost:3000", Healthy: 1},
 	}
 
-	// Check User Service
-	userHealth := checkServiceHealth(UserServiceURL + "/health")
-	services = append(services, HealthCheck{
-		Service: "user-service",
-		Status:  userHealth,
-		URL:     UserServiceURL,
-	})
-
-	// Check Todo Service
-	todoHealth := checkServiceHealth(TodoServiceURL + "/health")
-	services = append(services, HealthCheck{
-		Service: "todo-service",
-		Status:  todoHealth,
-		URL:     TodoServiceURL,
-	})
+	for _, name := range registry.Services() {
+		instances := registry.Instances(name)
+		circuits := upstreamFor(name).Circuits()
+		check := HealthCheck{Service: name, Instances: instances, Circuits: circuits}
+		// instance ที่ผ่าน health check แต่วงจรยังไม่ปิดไม่นับว่า healthy (ไม่ได้รับ traffic ตามปกติ)
+		for _, instance := range instances {
+			if state := circuits[instance.URL].State; instance.Healthy && (state == "" || state == BreakerClosed) {
+				check.Healthy++
+			}
+		}
+		switch {
+		case check.Healthy == 0:
+			check.Status = "unhealthy"
+		case check.Healthy < len(instances):
+			check.Status = "degraded"
+		default:
+			check.Status = "healthy"
+		}
+		services = append(services, check)
+	}
 
 	// Overall status
 	overallStatus := "healthy"
@@ -122,139 +162,9 @@ func healthCheckHandler(c *fiber.Ctx) error {
 	})
 }
 
-// User service proxy
-func proxyToUserService(c *fiber.Ctx) error {
-	return proxyRequest(c, UserServiceURL, "/users")
-}
-
-// Todo service proxy
-func proxyToTodoService(c *fiber.Ctx) error {
-	return proxyRequest(c, TodoServiceURL, "/todos")
-}
-
-// Dashboard aggregator
-func dashboardHandler(c *fiber.Ctx) error {
-	// Get data from both services concurrently
-	usersChan := make(chan ServiceResponse)
-	todosChan := make(chan ServiceResponse)
-
-	// Fetch users
-	go func() {
-		resp, err := makeRequest("GET", UserServiceURL+"/users", nil)
-		if err != nil {
-			usersChan <- ServiceResponse{Success: false, Error: err.Error()}
-			return
-		}
-		usersChan <- resp
-	}()
-
-	// Fetch todos
-	go func() {
-		resp, err := makeRequest("GET", TodoServiceURL+"/todos", nil)
-		if err != nil {
-			todosChan <- ServiceResponse{Success: false, Error: err.Error()}
-			return
-		}
-		todosChan <- resp
-	}()
-
-	// Wait for both responses
-	usersResp := <-usersChan
-	todosResp := <-todosChan
-
-	dashboard := fiber.Map{
-		"users": usersResp,
-		"todos": todosResp,
-		"stats": fiber.Map{
-			"generated_at": time.Now(),
-		},
-	}
-
-	// Add some statistics if data is available
-	if usersResp.Success && todosResp.Success {
-		if usersData, ok := usersResp.Data.(map[string]interface{}); ok {
-			if todosData, ok := todosResp.Data.(map[string]interface{}); ok {
-				dashboard["stats"] = fiber.Map{
-					"total_users":    usersData["count"],
-					"total_todos":    todosData["count"],
-					"generated_at":   time.Now(),
-					"services_up":    2,
-					"services_total": 2,
-				}
-			}
-		}
-	}
-
-	return c.JSON(fiber.Map{
-		"success":   true,
-		"dashboard": dashboard,
-	})
-}
-
-// Generic proxy function
-func proxyRequest(c *fiber.Ctx, serviceURL, basePath string) error {
-	// Build target URL
-	targetURL := serviceURL + basePath
-
-	// Add path parameters
-	if c.Params("id") != "" {
-		targetURL += "/" + c.Params("id")
-	}
-
-	// Add query parameters
-	if c.Request().URI().QueryString() != nil {
-		targetURL += "?" + string(c.Request().URI().QueryString())
-	}
-
-	// Get request body
-	var body io.Reader
-	if c.Method() != "GET" && c.Method() != "DELETE" {
-		body = bytes.NewReader(c.Body())
-	}
-
-	// Create request
-	req, err := http.NewRequest(c.Method(), targetURL, body)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-	}
-
-	// Copy headers
-	req.Header.Set("Content-Type", "application/json")
-
-	// Make request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return c.Status(503).JSON(fiber.Map{
-			"success": false,
-			"error":   "Service unavailable: " + err.Error(),
-		})
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to read response: " + err.Error(),
-		})
-	}
-
-	// Set response status and headers
-	c.Status(resp.StatusCode)
-	c.Set("Content-Type", "application/json")
-
-	return c.Send(responseBody)
-}
-
 // Helper functions
 func checkServiceHealth(url string) string {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+	resp, err := healthClient.Get(url)
 	if err != nil {
 		return "unhealthy"
 	}
@@ -265,40 +175,3 @@ func checkServiceHealth(url string) string {
 	}
 	return "unhealthy"
 }
-
-func makeRequest(method, url string, body interface{}) (ServiceResponse, error) {
-	var reqBody io.Reader
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return ServiceResponse{}, err
-		}
-		reqBody = bytes.NewBuffer(jsonBody)
-	}
-
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return ServiceResponse{}, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return ServiceResponse{}, err
-	}
-	defer resp.Body.Close()
-
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ServiceResponse{}, err
-	}
-
-	var serviceResp ServiceResponse
-	if err := json.Unmarshal(responseBody, &serviceResp); err != nil {
-		return ServiceResponse{}, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return serviceResp, nil
-}
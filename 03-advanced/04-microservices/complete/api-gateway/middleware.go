@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Route Middleware: Rate Limit ============
+
+// RateLimitConfig จำนวน requests ต่อ window ต่อ client (user ที่ผ่าน auth แล้ว หรือ IP)
+type RateLimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
+func (config RateLimitConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fiber.Map{"requests": config.Requests, "window": config.Window.String()})
+}
+
+// fixedWindow นับ requests ของหนึ่ง client ใน window ปัจจุบัน
+type fixedWindow struct {
+	start time.Time
+	count int
+}
+
+// withRateLimit ครอบ handler ด้วย fixed-window limiter (state อยู่กับ route ตารางใหม่ = นับใหม่)
+func withRateLimit(config RateLimitConfig, next fiber.Handler) (fiber.Handler, error) {
+	if config.Requests <= 0 || config.Window <= 0 {
+		return nil, errors.New("rate_limit needs requests > 0 and window > 0")
+	}
+
+	var mu sync.Mutex
+	windows := make(map[string]*fixedWindow)
+
+	return func(c *fiber.Ctx) error {
+		key := c.IP()
+		if identity, ok := c.Locals("identity").(Identity); ok {
+			key = "user:" + identity.UserID
+		}
+		now := time.Now()
+
+		mu.Lock()
+		if len(windows) > 10000 {
+			for k, w := range windows {
+				if now.Sub(w.start) >= config.Window {
+					delete(windows, k)
+				}
+			}
+		}
+		w, ok := windows[key]
+		if !ok || now.Sub(w.start) >= config.Window {
+			w = &fixedWindow{start: now}
+			windows[key] = w
+		}
+		w.count++
+		count, reset := w.count, w.start.Add(config.Window).Sub(now)
+		mu.Unlock()
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(config.Requests))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(max(config.Requests-count, 0)))
+		if count > config.Requests {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+			return c.Status(429).JSON(fiber.Map{
+				"success": false,
+				"error":   "Too many requests",
+			})
+		}
+		return next(c)
+	}, nil
+}
+
+// ============ Route Middleware: Response Cache ============
+
+// CacheConfig เก็บ response 200 ของ GET ไว้ TTL (แยกตาม user และ URL รวม query)
+type CacheConfig struct {
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+func (config CacheConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fiber.Map{"ttl": config.TTL.String(), "max_entries": config.MaxEntries})
+}
+
+type cachedResponse struct {
+	body      []byte
+	header    [][2]string
+	expiresAt time.Time
+}
+
+// headers ที่ไม่เก็บลง cache (เป็นของ response แต่ละครั้ง)
+var uncachedHeaders = map[string]bool{
+	"Date":           true,
+	"Content-Length": true,
+	"X-Request-Id":   true,
+	"X-Cache":        true,
+
+	"X-Ratelimit-Limit":     true,
+	"X-Ratelimit-Remaining": true,
+}
+
+// withCache ครอบ handler ด้วย cache ในหน่วยความจำ (ตั้งค่าเริ่มต้นลงใน config ให้ /admin/routes แสดงค่าจริง)
+func withCache(config *CacheConfig, next fiber.Handler) (fiber.Handler, error) {
+	if config.TTL <= 0 {
+		return nil, errors.New("cache needs ttl > 0")
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	ttl, maxEntries := config.TTL, config.MaxEntries
+
+	var mu sync.Mutex
+	entries := make(map[string]*cachedResponse)
+
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || strings.Contains(c.Get(fiber.HeaderCacheControl), "no-cache") {
+			return next(c)
+		}
+		key := c.OriginalURL()
+		if identity, ok := c.Locals("identity").(Identity); ok {
+			key = identity.UserID + "|" + key
+		}
+		now := time.Now()
+
+		mu.Lock()
+		entry, ok := entries[key]
+		mu.Unlock()
+		if ok && now.Before(entry.expiresAt) {
+			// ค่าแรกของแต่ละ header ใช้ Set ทับของ middleware ก่อนหน้า (เช่น CORS) ค่าถัดไปจึง Add
+			seen := make(map[string]bool, len(entry.header))
+			for _, kv := range entry.header {
+				if seen[kv[0]] {
+					c.Response().Header.Add(kv[0], kv[1])
+				} else {
+					c.Response().Header.Set(kv[0], kv[1])
+					seen[kv[0]] = true
+				}
+			}
+			c.Set("X-Cache", "HIT")
+			return c.Status(200).Send(entry.body)
+		}
+
+		c.Set("X-Cache", "MISS")
+		if err := next(c); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() != 200 || hasCookies(c) {
+			return nil
+		}
+
+		// Body() อ่าน stream ของ upstream ทั้งก้อน (ต้อง copy เพราะ buffer ถูกใช้ซ้ำหลังตอบเสร็จ)
+		entry = &cachedResponse{
+			body:      append([]byte(nil), c.Response().Body()...),
+			expiresAt: now.Add(ttl),
+		}
+		c.Response().Header.VisitAll(func(key, value []byte) {
+			if !uncachedHeaders[string(key)] {
+				entry.header = append(entry.header, [2]string{string(key), string(value)})
+			}
+		})
+
+		mu.Lock()
+		if len(entries) >= maxEntries {
+			for k, e := range entries {
+				if now.After(e.expiresAt) {
+					delete(entries, k)
+				}
+			}
+		}
+		if len(entries) < maxEntries {
+			entries[key] = entry
+		}
+		mu.Unlock()
+		return nil
+	}, nil
+}
+
+// hasCookies response ที่ตั้ง cookie เป็นของ client คนนั้น ห้ามเก็บลง cache
+func hasCookies(c *fiber.Ctx) bool {
+	found := false
+	c.Response().Header.VisitAllCookie(func(key, value []byte) { found = true })
+	return found
+}
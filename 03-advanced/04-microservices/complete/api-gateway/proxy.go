@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Reverse Proxy ============
+
+// hopHeaders ใช้ได้แค่ระหว่าง client กับ gateway ห้ามส่งต่อ (RFC 7230 section 6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// maxReplayBody body ของ method ที่ retry ได้ ถ้าไม่เกินขนาดนี้จะเก็บไว้ส่งซ้ำ ใหญ่กว่านั้น stream ครั้งเดียว
+const maxReplayBody = 64 << 10
+
+// requestIDKey เก็บ X-Request-ID ใน context เพื่อส่งต่อทุกครั้งที่เรียก upstream (รวมถึง dashboard)
+type requestIDKey struct{}
+
+// requestIDContext ใส่ request ID (จาก requestid middleware) ลงใน UserContext
+func requestIDContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if id, _ := c.Locals("requestid").(string); id != "" {
+			c.SetUserContext(context.WithValue(c.UserContext(), requestIDKey{}, id))
+		}
+		return c.Next()
+	}
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// proxyTo proxy ทุก path ใต้ prefix ไปที่ basePath ของ service: /api/users/5?x=1 → /users/5?x=1
+func proxyTo(service, prefix, basePath string, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return proxyRequest(c, service, rewritePath(c, prefix, basePath), timeout)
+	}
+}
+
+// rewritePath เปลี่ยน prefix ของ path เดิม (ไม่ decode) แล้วต่อ query string เดิม
+func rewritePath(c *fiber.Ctx, prefix, basePath string) string {
+	path := string(c.Request().URI().PathOriginal())
+	if len(path) >= len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+		path = basePath + path[len(prefix):]
+	}
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		path += "?" + string(query)
+	}
+	return path
+}
+
+// proxyRequest ส่ง request ของ client ไป service ตามจริง (headers, body ทุกชนิด) แล้ว stream response กลับ
+func proxyRequest(c *fiber.Ctx, service, path string, timeout time.Duration) error {
+	r := UpstreamRequest{
+		Method:  c.Method(),
+		Path:    path,
+		Header:  forwardHeaders(c),
+		Timeout: timeout,
+	}
+
+	// body เล็กของ method ที่ retry ได้ = เก็บเป็น bytes ส่งซ้ำได้, นอกนั้น stream ตรงไป upstream (ไม่ retry)
+	if length := c.Request().Header.ContentLength(); length != 0 {
+		stream := c.Request().BodyStream()
+		if stream == nil || (isIdempotent(r.Method) && length > 0 && length <= maxReplayBody) {
+			r.Body = c.Body()
+		} else {
+			r.BodyStream, r.ContentLength = stream, int64(length)
+		}
+	}
+
+	// เลือก instance, timeout, retry และ circuit breaker อยู่ใน Upstream.Do
+	resp, err := upstreamFor(service).Do(c.UserContext(), r)
+	if err != nil {
+		return upstreamError(c, service, err)
+	}
+
+	c.Status(resp.StatusCode)
+	copyResponseHeaders(c, resp.Header)
+
+	// fasthttp อ่าน body ระหว่างเขียน response แล้วปิดเอง (ปิดแล้วจึงคืน connection และ in-flight ของ instance)
+	c.Context().SetBodyStream(resp.Body, int(resp.ContentLength))
+	return nil
+}
+
+// forwardHeaders headers ที่ส่งต่อ upstream: ทุกอย่างของ client ยกเว้น hop-by-hop แล้วเติม X-Forwarded-*
+func forwardHeaders(c *fiber.Ctx) http.Header {
+	header := make(http.Header)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+	removeHopHeaders(header)
+	header.Del("Host")           // ใช้ host ของ instance, host เดิมไปอยู่ใน X-Forwarded-Host
+	header.Del("Content-Length") // net/http ตั้งเองจาก body
+	header.Del("X-API-Key")      // credential ของ gateway ไม่ส่งต่อ (identity ไปทาง X-User-ID ที่ลงลายเซ็นแล้ว)
+
+	clientIP := c.Context().RemoteIP().String()
+	if prior := header.Values("X-Forwarded-For"); len(prior) > 0 {
+		clientIP = strings.Join(prior, ", ") + ", " + clientIP
+	}
+	header.Set("X-Forwarded-For", clientIP)
+	header.Set("X-Forwarded-Host", string(c.Request().Host()))
+	if c.Context().IsTLS() {
+		header.Set("X-Forwarded-Proto", "https")
+	} else {
+		header.Set("X-Forwarded-Proto", "http")
+	}
+	return header
+}
+
+// copyResponseHeaders คัด headers ของ upstream กลับไปให้ client (Set-Cookie หลายค่า, ETag, Cache-Control ฯลฯ)
+func copyResponseHeaders(c *fiber.Ctx, upstream http.Header) {
+	header := upstream.Clone()
+	removeHopHeaders(header)
+	header.Del("Content-Length") // SetBodyStream ตั้งให้จาก resp.ContentLength
+
+	for key, values := range header {
+		for i, value := range values {
+			if i == 0 {
+				c.Response().Header.Set(key, value)
+			} else {
+				c.Response().Header.Add(key, value)
+			}
+		}
+	}
+}
+
+// removeHopHeaders ลบ hop-by-hop headers รวมถึงชื่อที่ประกาศไว้ใน Connection
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// upstreamError ตอบ client เมื่อเรียก upstream ไม่สำเร็จ
+// วงจรของทุก instance เปิดอยู่ = ตอบ 503 ทันทีพร้อม fallback body และ Retry-After ไม่ต้องรอ timeout
+func upstreamError(c *fiber.Ctx, service string, err error) error {
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		retryAfter := int(math.Ceil(upstreamFor(service).RetryAfter().Seconds()))
+		c.Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.Status(503).JSON(fiber.Map{
+			"success":             false,
+			"error":               service + " is temporarily unavailable, please try again later",
+			"fallback":            true,
+			"retry_after_seconds": retryAfter,
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		return c.Status(504).JSON(fiber.Map{
+			"success": false,
+			"error":   "Service timeout: " + err.Error(),
+		})
+	}
+	return c.Status(503).JSON(fiber.Map{
+		"success": false,
+		"error":   "Service unavailable: " + err.Error(),
+	})
+}
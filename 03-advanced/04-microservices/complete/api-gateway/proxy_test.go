@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"shared/identity"
+)
+
+// capturedRequest สิ่งที่ upstream ได้รับจาก gateway
+type capturedRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+// newProxyTestUpstream upstream ที่จำ request ล่าสุดไว้ แล้วตอบด้วย respond (nil = 200 ว่าง)
+func newProxyTestUpstream(t *testing.T, service string, respond http.HandlerFunc) *capturedRequest {
+	t.Helper()
+	captured := &capturedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*captured = capturedRequest{method: r.Method, uri: r.RequestURI, header: r.Header.Clone(), body: body}
+		if respond != nil {
+			respond(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	useTestRegistry(t, service, server.URL)
+	return captured
+}
+
+// useTestEdgeAuth แทน edgeAuth ด้วย API key "test-key" (subject svc-bot, role admin)
+func useTestEdgeAuth(t *testing.T) *EdgeAuth {
+	t.Helper()
+	keys, err := parseAPIKeys("test-key:svc-bot:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := edgeAuth
+	edgeAuth = &EdgeAuth{jwtSecret: []byte("jwt"), apiKeys: keys}
+	t.Cleanup(func() { edgeAuth = previous })
+	return edgeAuth
+}
+
+// newProxyTestApp app แบบเดียวกับ main: stream body, X-Request-ID, /api/users (ไม่ต้อง auth) และ /api/me (ต้อง auth)
+func newProxyTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	auth := useTestEdgeAuth(t)
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
+	app.Use(requestid.New())
+	app.Use(requestIDContext())
+	app.All("/api/users*", proxyTo(UserService, "/api/users", "/users", time.Second))
+	app.All("/api/me*", auth.Wrap(proxyTo(UserService, "/api/me", "", time.Second)))
+	return app
+}
+
+func TestProxyForwardHeaders(t *testing.T) {
+	captured := newProxyTestUpstream(t, UserService, nil)
+	app := newProxyTestApp(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/5", nil)
+	req.Host = "shop.example.com"
+	for key, value := range map[string]string{
+		"Connection":          "keep-alive, X-Hop-Only",
+		"X-Hop-Only":          "secret",
+		"Keep-Alive":          "timeout=5",
+		"Proxy-Authorization": "Basic Zm9vOmJhcg==",
+		"Te":                  "trailers",
+		"X-Forwarded-For":     "203.0.113.7",
+		"X-Request-ID":        "req-123",
+		"Accept":              "application/json",
+		"X-Trace":             "abc",
+		// client ปลอม identity และส่ง credential ของ gateway มาเอง
+		identity.HeaderUserID:            "1",
+		identity.HeaderUserRoles:         "admin",
+		identity.HeaderIdentityTimestamp: "1700000000",
+		identity.HeaderIdentitySignature: "forged",
+		"X-API-Key":                      "not-a-key",
+	} {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	for _, name := range []string{"Connection", "X-Hop-Only", "Keep-Alive", "Proxy-Authorization", "Te",
+		identity.HeaderUserID, identity.HeaderUserRoles, identity.HeaderIdentityTimestamp, identity.HeaderIdentitySignature, "X-API-Key"} {
+		if value := captured.header.Get(name); value != "" {
+			t.Errorf("%s forwarded as %q", name, value)
+		}
+	}
+	for name, want := range map[string]string{
+		"Accept":            "application/json",
+		"X-Trace":           "abc",
+		"X-Request-ID":      "req-123",
+		"X-Forwarded-Host":  "shop.example.com",
+		"X-Forwarded-Proto": "http",
+	} {
+		if got := captured.header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	// ต่อท้าย IP ของ client (app.Test = 0.0.0.0) หลัง proxy ก่อนหน้า ไม่ใช่แทนที่
+	if got := captured.header.Values("X-Forwarded-For"); len(got) != 1 || got[0] != "203.0.113.7, 0.0.0.0" {
+		t.Errorf("X-Forwarded-For = %q, want %q", got, "203.0.113.7, 0.0.0.0")
+	}
+}
+
+func TestProxyRequestIDGenerated(t *testing.T) {
+	captured := newProxyTestUpstream(t, UserService, nil)
+	app := newProxyTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/users", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// client ไม่ส่งมา = gateway สร้างให้ ค่าเดียวกับที่ตอบ client
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" || captured.header.Get("X-Request-ID") != id {
+		t.Errorf("upstream X-Request-ID = %q, response = %q", captured.header.Get("X-Request-ID"), id)
+	}
+}
+
+func TestProxySignsIdentity(t *testing.T) {
+	captured := newProxyTestUpstream(t, UserService, nil)
+	app := newProxyTestApp(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me/profile?full=1", nil)
+	req.Header.Set("X-API-Key", "test-key")
+	req.Header.Set(identity.HeaderUserID, "1") // ปลอม ต้องถูกแทนด้วย identity จาก API key
+	req.Header.Set(identity.HeaderUserRoles, "superuser")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	header := captured.header
+	if header.Get(identity.HeaderUserID) != "svc-bot" || header.Get(identity.HeaderUserRoles) != "admin" {
+		t.Errorf("identity = %q %q, want svc-bot admin", header.Get(identity.HeaderUserID), header.Get(identity.HeaderUserRoles))
+	}
+	if header.Get("X-API-Key") != "" {
+		t.Error("X-API-Key forwarded to upstream")
+	}
+	// services ตรวจด้วย shared/identity กับ URI หลัง rewrite
+	if _, err := identity.Verify(http.MethodGet, "/profile?full=1", header.Get(identity.HeaderUserID), header.Get(identity.HeaderUserRoles),
+		header.Get(identity.HeaderIdentityTimestamp), header.Get(identity.HeaderIdentitySignature)); err != nil {
+		t.Errorf("signature rejected by services: %v", err)
+	}
+
+	// ไม่มี credentials = 401 ที่ edge ไม่ถึง upstream
+	captured.uri = ""
+	req = httptest.NewRequest(http.MethodGet, "/api/me/profile", nil)
+	req.Header.Set(identity.HeaderUserID, "1")
+	if resp, err := app.Test(req, -1); err != nil || resp.StatusCode != 401 || captured.uri != "" {
+		t.Errorf("anonymous: status = %v err = %v upstream uri = %q", resp.StatusCode, err, captured.uri)
+	}
+}
+
+func TestProxyRewritePath(t *testing.T) {
+	captured := newProxyTestUpstream(t, UserService, nil)
+	app := newProxyTestApp(t)
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"/api/users", "/users"},
+		{"/api/users/5", "/users/5"},
+		{"/api/users/5?x=1&y=a%20b", "/users/5?x=1&y=a%20b"},
+		{"/api/users?tag=a&tag=b", "/users?tag=a&tag=b"},
+		{"/API/Users/5", "/users/5"},                  // เทียบ prefix แบบไม่สนตัวพิมพ์
+		{"/api/users/a%2Fb", "/users/a%2Fb"},          // ไม่ decode path ก่อนส่ง
+		{"/api/me/settings?tab=2", "/settings?tab=2"}, // ตัด prefix ทิ้ง (basePath ว่าง)
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("X-API-Key", "test-key")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if captured.uri != tc.want {
+			t.Errorf("%s → %q, want %q", tc.path, captured.uri, tc.want)
+		}
+	}
+}
+
+func TestProxyCopiesResponseHeaders(t *testing.T) {
+	newProxyTestUpstream(t, UserService, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=abc; HttpOnly")
+		w.Header().Add("Set-Cookie", "theme=dark")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "internal")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	app := newProxyTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/users", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || string(body) != "created" {
+		t.Errorf("response = %d %q, want 201 created", resp.StatusCode, body)
+	}
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) != 2 ||
+		!strings.HasPrefix(cookies[0], "session=abc") || !strings.HasPrefix(cookies[1], "theme=dark") {
+		t.Errorf("Set-Cookie = %q, want both cookies", cookies)
+	}
+	for name, want := range map[string]string{
+		"ETag":           `"v1"`,
+		"Cache-Control":  "no-store",
+		"Content-Type":   "text/plain",
+		"X-Upstream-Hop": "",
+		"Keep-Alive":     "",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProxyStreamsBodies(t *testing.T) {
+	const chunks = 5
+	// ตอบแบบ chunked (ไม่รู้ความยาวล่วงหน้า) ทีละส่วน
+	captured := newProxyTestUpstream(t, UserService, func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			fmt.Fprintf(w, "chunk %d\n", i)
+			w.(http.Flusher).Flush()
+		}
+	})
+	app := newProxyTestApp(t)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		size   int
+	}{
+		{"small replayable body", http.MethodPut, 1 << 10},
+		{"large body streamed", http.MethodPut, maxReplayBody + 1},
+		{"non idempotent body streamed", http.MethodPost, 256 << 10},
+	} {
+		payload := bytes.Repeat([]byte("0123456789abcdef"), tc.size/16+1)[:tc.size]
+		req := httptest.NewRequest(tc.method, "/api/users/upload", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if captured.method != tc.method || !bytes.Equal(captured.body, payload) {
+			t.Errorf("%s: upstream got %s with %d bytes, want %s with %d", tc.name, captured.method, len(captured.body), tc.method, len(payload))
+		}
+		if got := captured.header.Get("Content-Type"); got != "application/octet-stream" {
+			t.Errorf("%s: Content-Type = %q", tc.name, got)
+		}
+		var want strings.Builder
+		for i := 0; i < chunks; i++ {
+			fmt.Fprintf(&want, "chunk %d\n", i)
+		}
+		if string(body) != want.String() {
+			t.Errorf("%s: response body = %q, want %q", tc.name, body, want.String())
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ============ Service Registry ============
+
+// ชื่อ services ที่ gateway รู้จัก
+const (
+	UserService = "user-service"
+	TodoService = "todo-service"
+)
+
+// knownServices services ที่ลงทะเบียนเองผ่าน /registry ได้ (เพิ่มด้วย REGISTRY_SERVICES=a,b หรือ REGISTRY_FILE)
+var knownServices = []string{UserService, TodoService}
+
+// defaultInstances ใช้เมื่อไม่มี REGISTRY_FILE (รันครบ 3 services บนเครื่องเดียวแบบเดิมได้ทันที)
+var defaultInstances = map[string][]string{
+	UserService: {"http://localhost:3001"},
+	TodoService: {"http://localhost:3002"},
+}
+
+var (
+	ErrUnknownService    = errors.New("unknown service")
+	ErrNoHealthyInstance = errors.New("no healthy instance")
+	ErrInstanceNotFound  = errors.New("instance not found")
+	// ErrNoAvailableInstance มี instance ที่ healthy แต่ทุกตัวถูกตัดออก (เช่น circuit breaker เปิดอยู่)
+	ErrNoAvailableInstance = errors.New("no available instance")
+)
+
+// Instance หนึ่ง instance ของ service
+// Static = มาจากไฟล์ (ไม่หมดอายุ ไม่ถูกถอด แค่ไม่ถูกเลือกตอนไม่ healthy)
+// Dynamic = ลงทะเบียนผ่าน /registry ต้องส่ง heartbeat ก่อน TTL หมด และถูกถอดเมื่อ health check พังติดกัน
+type Instance struct {
+	ID            string    `json:"id"`
+	Service       string    `json:"service"`
+	URL           string    `json:"url"`
+	Static        bool      `json:"static"`
+	Healthy       bool      `json:"healthy"`
+	Failures      int       `json:"consecutive_failures"`
+	InFlight      int64     `json:"in_flight"` // ค่า ณ ตอน snapshot (ดู Registry.Instances)
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"`
+	LastChecked   time.Time `json:"last_checked,omitempty"`
+	RegisteredAt  time.Time `json:"registered_at"`
+
+	inFlight int64 // atomic: requests ที่กำลังส่งไป instance นี้ (ใช้กับ least connections)
+}
+
+// Acquire นับ request ที่กำลังส่งไป instance นี้ ต้องเรียก release เมื่อจบ request
+func (i *Instance) Acquire() (release func()) {
+	atomic.AddInt64(&i.inFlight, 1)
+	var once sync.Once
+	return func() { once.Do(func() { atomic.AddInt64(&i.inFlight, -1) }) }
+}
+
+// ============ Load Balancing ============
+
+// Balancer เลือก instance หนึ่งจาก instances ที่ healthy (ไม่ว่าง)
+type Balancer interface {
+	Pick(instances []*Instance) *Instance
+}
+
+// roundRobin วนไปทีละ instance
+type roundRobin struct {
+	next uint64
+}
+
+func (b *roundRobin) Pick(instances []*Instance) *Instance {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return instances[n%uint64(len(instances))]
+}
+
+// leastConnections เลือก instance ที่มี requests ค้างน้อยที่สุด (เท่ากันเลือกตัวแรก ซึ่งเรียงตาม ID)
+type leastConnections struct{}
+
+func (leastConnections) Pick(instances []*Instance) *Instance {
+	best := instances[0]
+	for _, instance := range instances[1:] {
+		if atomic.LoadInt64(&instance.inFlight) < atomic.LoadInt64(&best.inFlight) {
+			best = instance
+		}
+	}
+	return best
+}
+
+// newBalancer สร้าง balancer ตาม LB_STRATEGY (round_robin | least_conn)
+func newBalancer(strategy string) (func() Balancer, error) {
+	switch strategy {
+	case "", "round_robin":
+		return func() Balancer { return &roundRobin{} }, nil
+	case "least_conn":
+		return func() Balancer { return leastConnections{} }, nil
+	}
+	return nil, fmt.Errorf("unknown LB_STRATEGY %q (round_robin | least_conn)", strategy)
+}
+
+// ============ Registry ============
+
+// Registry เก็บ instances ของแต่ละ service, ตรวจ health และเลือก instance ให้ proxy
+type Registry struct {
+	mu          sync.RWMutex
+	services    map[string]map[string]*Instance // service → instance ID → instance
+	known       map[string]bool                 // ชื่อ services ที่ Register ยอมรับ
+	balancers   map[string]Balancer
+	newBalancer func() Balancer
+	strategy    string
+	ttl         time.Duration // dynamic instance ที่ไม่ส่ง heartbeat นานกว่านี้ถูกถอด
+	evictAfter  int           // health check พังติดกันกี่ครั้งถึงถอด dynamic instance
+}
+
+func NewRegistry(strategy string, ttl time.Duration) (*Registry, error) {
+	factory, err := newBalancer(strategy)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		strategy = "round_robin"
+	}
+	r := &Registry{
+		services:    make(map[string]map[string]*Instance),
+		known:       make(map[string]bool),
+		balancers:   make(map[string]Balancer),
+		newBalancer: factory,
+		strategy:    strategy,
+		ttl:         ttl,
+		evictAfter:  3,
+	}
+	r.Allow(knownServices...)
+	return r, nil
+}
+
+// Allow เพิ่มชื่อ services ที่ลงทะเบียนผ่าน /registry ได้
+func (r *Registry) Allow(services ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, service := range services {
+		if service = strings.TrimSpace(service); service != "" {
+			r.known[service] = true
+		}
+	}
+}
+
+// LoadStatic อ่านไฟล์ JSON {"user-service": ["http://host:3001", ...], ...}
+func (r *Registry) LoadStatic(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var services map[string][]string
+	if err := json.Unmarshal(data, &services); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return r.AddStatic(services)
+}
+
+// AddStatic เพิ่ม instances ที่ไม่ต้องส่ง heartbeat (ชื่อ services ในไฟล์ถือว่ารู้จักด้วย)
+func (r *Registry) AddStatic(services map[string][]string) error {
+	for service, urls := range services {
+		r.Allow(service)
+		for _, rawURL := range urls {
+			if _, err := r.register(service, rawURL, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Register ลงทะเบียน (หรือลงทะเบียนซ้ำหลัง restart) instance ของ service
+// URL เดิมได้ instance เดิมกลับไป จึงไม่มี instance ซ้ำ
+// service ต้องอยู่ใน known (ErrUnknownService) กันการสร้าง service ใหม่ใน registry ตามใจผู้เรียก
+func (r *Registry) Register(service, rawURL string) (*Instance, error) {
+	r.mu.RLock()
+	known := r.known[service]
+	r.mu.RUnlock()
+	if !known {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, service)
+	}
+	return r.register(service, rawURL, false)
+}
+
+func (r *Registry) register(service, rawURL string, static bool) (*Instance, error) {
+	service = strings.TrimSpace(service)
+	baseURL, err := normalizeInstanceURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if service == "" {
+		return nil, errors.New("service name is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	instances := r.services[service]
+	if instances == nil {
+		instances = make(map[string]*Instance)
+		r.services[service] = instances
+		r.balancers[service] = r.newBalancer()
+	}
+
+	now := time.Now()
+	for _, instance := range instances {
+		if instance.URL == baseURL {
+			instance.LastHeartbeat = now
+			instance.Static = instance.Static || static
+			return instance, nil
+		}
+	}
+
+	// เพิ่งลงทะเบียน = เพิ่ง start ถือว่า healthy จนกว่า health check จะบอกเป็นอย่างอื่น
+	instance := &Instance{
+		ID: newInstanceID(), Service: service, URL: baseURL, Static: static,
+		Healthy: true, LastHeartbeat: now, RegisteredAt: now,
+	}
+	instances[instance.ID] = instance
+	log.Printf("📒 Registered %s instance %s (%s)", service, instance.ID, baseURL)
+	return instance, nil
+}
+
+// Heartbeat ต่ออายุ dynamic instance (ErrInstanceNotFound = ถูกถอดไปแล้ว ต้อง Register ใหม่)
+func (r *Registry) Heartbeat(service, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance, ok := r.services[service][id]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	instance.LastHeartbeat = time.Now()
+	return nil
+}
+
+// Deregister ถอด instance ออก (service ปิดตัวแบบ graceful)
+func (r *Registry) Deregister(service, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance, ok := r.services[service][id]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	// instance จากไฟล์ถอดไม่ได้ แค่หยุดส่ง traffic จนกว่า health check จะผ่านอีกครั้ง
+	if instance.Static {
+		instance.Healthy = false
+		log.Printf("📕 Static %s instance %s (%s) went offline", service, id, instance.URL)
+		return nil
+	}
+	delete(r.services[service], id)
+	log.Printf("📕 Deregistered %s instance %s (%s)", service, id, instance.URL)
+	return nil
+}
+
+// Pick เลือก instance ที่ healthy ตาม strategy
+func (r *Registry) Pick(service string) (*Instance, error) {
+	return r.PickAvailable(service, nil)
+}
+
+// PickAvailable เหมือน Pick แต่ข้าม instance ที่ available ตอบ false (nil = ทุกตัว)
+func (r *Registry) PickAvailable(service string, available func(*Instance) bool) (*Instance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	instances, ok := r.services[service]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, service)
+	}
+	healthy := make([]*Instance, 0, len(instances))
+	var anyHealthy bool
+	for _, instance := range instances {
+		if instance.Healthy {
+			anyHealthy = true
+			if available == nil || available(instance) {
+				healthy = append(healthy, instance)
+			}
+		}
+	}
+	if !anyHealthy {
+		return nil, fmt.Errorf("%w of %s", ErrNoHealthyInstance, service)
+	}
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("%w of %s", ErrNoAvailableInstance, service)
+	}
+	// map ไม่มีลำดับ เรียงก่อนเพื่อให้ round robin วนครบทุกตัวจริง ๆ
+	sort.Slice(healthy, func(i, j int) bool { return healthy[i].ID < healthy[j].ID })
+	return r.balancers[service].Pick(healthy), nil
+}
+
+// Services ชื่อ services ทั้งหมด เรียงตามชื่อ
+func (r *Registry) Services() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instances snapshot ของ instances ใน service (ปลอดภัยที่จะส่งออกเป็น JSON)
+func (r *Registry) Instances(service string) []Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snapshot := make([]Instance, 0, len(r.services[service]))
+	for _, instance := range r.services[service] {
+		copied := *instance
+		copied.InFlight = atomic.LoadInt64(&instance.inFlight)
+		snapshot = append(snapshot, copied)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].ID < snapshot[j].ID })
+	return snapshot
+}
+
+// CheckHealth เรียก /health ของทุก instance พร้อมกัน แล้วอัปเดตสถานะ
+// dynamic instance ที่พังติดกัน evictAfter ครั้ง หรือไม่ส่ง heartbeat เกิน TTL ถูกถอดออก
+func (r *Registry) CheckHealth() {
+	type target struct{ service, id, url string }
+	var targets []target
+	r.mu.RLock()
+	for service, instances := range r.services {
+		for id, instance := range instances {
+			targets = append(targets, target{service, id, instance.URL})
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]bool, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = checkServiceHealth(url+"/health") == "healthy"
+		}(i, t.url)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range targets {
+		instance, ok := r.services[t.service][t.id]
+		if !ok {
+			continue // ถูก deregister ระหว่างตรวจ
+		}
+		instance.LastChecked = now
+		if results[i] {
+			if !instance.Healthy {
+				log.Printf("💚 %s instance %s is healthy again", t.service, t.id)
+			}
+			instance.Healthy, instance.Failures = true, 0
+			continue
+		}
+
+		instance.Failures++
+		if instance.Healthy {
+			log.Printf("💔 %s instance %s failed health check", t.service, t.id)
+		}
+		instance.Healthy = false
+		if !instance.Static && instance.Failures >= r.evictAfter {
+			delete(r.services[t.service], t.id)
+			log.Printf("🗑️ Evicted %s instance %s after %d failed health checks", t.service, t.id, instance.Failures)
+		}
+	}
+
+	for service, instances := range r.services {
+		for id, instance := range instances {
+			if !instance.Static && now.Sub(instance.LastHeartbeat) > r.ttl {
+				delete(instances, id)
+				log.Printf("⌛ Evicted %s instance %s (no heartbeat for %s)", service, id, r.ttl)
+			}
+		}
+	}
+}
+
+// StartHealthChecks ตรวจ health ทันทีหนึ่งรอบ แล้วทุก interval
+func (r *Registry) StartHealthChecks(interval time.Duration) {
+	go func() {
+		r.CheckHealth()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.CheckHealth()
+		}
+	}()
+}
+
+func normalizeInstanceURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid instance URL %q", rawURL)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
+func newInstanceID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ============ Registry Endpoints ============
+
+// registryAuth services ต้องส่ง header X-Registry-Token ให้ตรงกับ REGISTRY_TOKEN
+// ไม่ได้ตั้ง REGISTRY_TOKEN = รับเฉพาะ requests จากเครื่องเดียวกัน (loopback) สำหรับรันทดลองบนเครื่องตัวเอง
+func registryAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := os.Getenv("REGISTRY_TOKEN")
+		if token == "" {
+			if !isLoopback(c.IP()) {
+				return c.Status(403).JSON(fiber.Map{
+					"success": false,
+					"error":   "Registry accepts only localhost (REGISTRY_TOKEN not set)",
+				})
+			}
+			return c.Next()
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Get("X-Registry-Token")), []byte(token)) != 1 {
+			return c.Status(401).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid registry token",
+			})
+		}
+		return c.Next()
+	}
+}
+
+func listRegistryHandler(c *fiber.Ctx) error {
+	services := fiber.Map{}
+	for _, name := range registry.Services() {
+		services[name] = registry.Instances(name)
+	}
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"strategy": registry.strategy,
+		"services": services,
+	})
+}
+
+func registerInstanceHandler(c *fiber.Ctx) error {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request",
+		})
+	}
+
+	instance, err := registry.Register(c.Params("service"), req.URL)
+	if errors.Is(err, ErrUnknownService) {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success":     true,
+		"data":        instance,
+		"ttl_seconds": int(registry.ttl.Seconds()),
+	})
+}
+
+func heartbeatHandler(c *fiber.Ctx) error {
+	if err := registry.Heartbeat(c.Params("service"), c.Params("id")); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "Instance not registered",
+		})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func deregisterInstanceHandler(c *fiber.Ctx) error {
+	if err := registry.Deregister(c.Params("service"), c.Params("id")); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "Instance not registered",
+		})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
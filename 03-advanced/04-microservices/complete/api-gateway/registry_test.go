@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestRegistry(t *testing.T, strategy string) *Registry {
+	t.Helper()
+	r, err := NewRegistry(strategy, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegistryPick(t *testing.T) {
+	r := newTestRegistry(t, "round_robin")
+	if err := r.AddStatic(map[string][]string{
+		UserService: {"http://a:3001", "http://b:3001", "http://c:3001"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	instances := r.Instances(UserService)
+	r.services[UserService][instances[1].ID].Healthy = false
+
+	// round robin วนเฉพาะตัวที่ healthy
+	var picked []string
+	for i := 0; i < 4; i++ {
+		instance, err := r.Pick(UserService)
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked = append(picked, instance.ID)
+	}
+	want := []string{instances[0].ID, instances[2].ID, instances[0].ID, instances[2].ID}
+	if strings.Join(picked, ",") != strings.Join(want, ",") {
+		t.Errorf("picked %v, want %v", picked, want)
+	}
+
+	for _, instance := range instances {
+		r.services[UserService][instance.ID].Healthy = false
+	}
+	for _, tc := range []struct {
+		service string
+		want    error
+	}{
+		{UserService, ErrNoHealthyInstance},
+		{"billing-service", ErrUnknownService},
+	} {
+		if _, err := r.Pick(tc.service); !errors.Is(err, tc.want) {
+			t.Errorf("Pick(%s) err = %v, want %v", tc.service, err, tc.want)
+		}
+	}
+}
+
+func TestRegistryPickLeastConnections(t *testing.T) {
+	r := newTestRegistry(t, "least_conn")
+	if err := r.AddStatic(map[string][]string{TodoService: {"http://a:3002", "http://b:3002"}}); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := r.Pick(TodoService)
+	release := first.Acquire()
+	if second, _ := r.Pick(TodoService); second == first {
+		t.Errorf("picked busy instance %s again", first.ID)
+	}
+	release()
+	if again, _ := r.Pick(TodoService); again != first {
+		t.Errorf("after release picked %s, want %s", again.ID, first.ID)
+	}
+}
+
+func TestRegistryRegisterKnownServices(t *testing.T) {
+	r := newTestRegistry(t, "")
+	r.Allow(" billing-service ")
+
+	for _, tc := range []struct {
+		service string
+		url     string
+		want    error // nil = สำเร็จ
+	}{
+		{UserService, "http://localhost:3001", nil},
+		{"billing-service", "http://localhost:3005", nil},
+		{"evil-service", "http://localhost:6666", ErrUnknownService},
+		{"", "http://localhost:6666", ErrUnknownService},
+	} {
+		_, err := r.Register(tc.service, tc.url)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("Register(%q) err = %v, want %v", tc.service, err, tc.want)
+		}
+	}
+	if got := r.Services(); strings.Join(got, ",") != "billing-service,user-service" {
+		t.Errorf("services = %v", got)
+	}
+}
+
+func TestRegistryCheckHealthEvicts(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	r := newTestRegistry(t, "")
+	if err := r.AddStatic(map[string][]string{UserService: {broken.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	static := r.Instances(UserService)[0]
+	dynamicBroken, _ := r.Register(UserService, broken.URL+"/dynamic")
+	dynamicOK, _ := r.Register(UserService, healthy.URL)
+	stale, _ := r.Register(TodoService, healthy.URL+"/stale")
+	stale.LastHeartbeat = time.Now().Add(-2 * r.ttl)
+
+	for round := 1; round <= r.evictAfter; round++ {
+		r.CheckHealth()
+	}
+
+	ids := map[string]bool{}
+	for _, service := range []string{UserService, TodoService} {
+		for _, instance := range r.Instances(service) {
+			ids[instance.ID] = instance.Healthy
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		id      string
+		present bool
+		healthy bool
+	}{
+		{"static broken stays but unhealthy", static.ID, true, false},
+		{"dynamic broken evicted", dynamicBroken.ID, false, false},
+		{"dynamic healthy stays", dynamicOK.ID, true, true},
+		{"no heartbeat evicted", stale.ID, false, false},
+	} {
+		isHealthy, present := ids[tc.id]
+		if present != tc.present || isHealthy != tc.healthy {
+			t.Errorf("%s: present = %v healthy = %v, want %v %v", tc.name, present, isHealthy, tc.present, tc.healthy)
+		}
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	app := fiber.New()
+	app.Get("/registry", registryAuth(), func(c *fiber.Ctx) error { return c.SendStatus(200) })
+
+	for _, tc := range []struct {
+		name   string
+		token  string // REGISTRY_TOKEN ของ gateway
+		header string
+		status int
+	}{
+		// app.Test ส่งจาก 0.0.0.0 (ไม่ใช่ loopback)
+		{"no token configured is closed to remote", "", "", 403},
+		{"valid token", "secret", "secret", 200},
+		{"wrong token", "secret", "guess", 401},
+		{"missing token", "secret", "", 401},
+	} {
+		t.Setenv("REGISTRY_TOKEN", tc.token)
+		req := httptest.NewRequest(http.MethodGet, "/registry", nil)
+		if tc.header != "" {
+			req.Header.Set("X-Registry-Token", tc.header)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+
+	for ip, want := range map[string]bool{"127.0.0.1": true, "::1": true, "10.0.0.5": false, "0.0.0.0": false, "": false} {
+		if got := isLoopback(ip); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ============ Resilience: Transport, Retries, Circuit Breaker ============
+
+// upstreamTransport ใช้ร่วมกันทุก request ไป services (connection pool แทนการสร้าง client ใหม่ทุกครั้ง)
+var upstreamTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   2 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          200,
+	MaxIdleConnsPerHost:   50,
+	IdleConnTimeout:       90 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	DisableCompression:    true, // ส่ง Content-Encoding ของ upstream ผ่านไปตามจริง ไม่ถอด gzip เอง
+}
+
+// upstreamClient ไม่มี Timeout รวม: แต่ละ route กำหนด deadline เองผ่าน context
+var upstreamClient = &http.Client{Transport: upstreamTransport}
+
+// healthClient ใช้ pool เดียวกัน แต่ health check ต้องตอบเร็ว
+var healthClient = &http.Client{Transport: upstreamTransport, Timeout: 2 * time.Second}
+
+// defaultRouteTimeout เวลาสูงสุดที่รอ response headers ต่อหนึ่งครั้ง (ไม่รวม retry)
+// และเวลาที่ body เงียบได้นานที่สุดหลังจากนั้น (stream/SSE ยาวแค่ไหนก็ได้ ถ้ายังมีข้อมูลมาเรื่อย ๆ)
+const defaultRouteTimeout = 5 * time.Second
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ResilienceConfig ค่าของ retry และ circuit breaker ต่อ upstream
+type ResilienceConfig struct {
+	MaxAttempts      int           // รวมครั้งแรก (1 = ไม่ retry)
+	BaseBackoff      time.Duration // backoff รอบแรก เพิ่มเท่าตัวทุกรอบ แล้วสุ่ม (full jitter)
+	MaxBackoff       time.Duration
+	FailureThreshold int           // พังติดกันกี่ครั้งถึงเปิดวงจร
+	OpenTimeout      time.Duration // เปิดวงจรนานเท่าไรก่อนลอง half-open
+}
+
+var defaultResilience = ResilienceConfig{
+	MaxAttempts:      3,
+	BaseBackoff:      100 * time.Millisecond,
+	MaxBackoff:       time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// ============ Circuit Breaker ============
+
+// BreakerState สถานะของวงจร
+//
+//	closed --(พังติดกัน threshold ครั้ง)--> open --(ครบ OpenTimeout)--> half-open
+//	half-open --(probe สำเร็จ)--> closed, --(probe พัง)--> open
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// CircuitBreaker หยุดส่ง requests ไป instance ที่พังอยู่ ให้เวลามันฟื้นตัวและตอบ client ได้ทันที
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	state     BreakerState
+	failures  int // พังติดกัน (ตอน closed)
+	threshold int
+	timeout   time.Duration
+	openedAt  time.Time
+	probing   bool // half-open ยอมให้ผ่านทีละหนึ่ง request
+	now       func() time.Time
+}
+
+func NewCircuitBreaker(name string, threshold int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, state: BreakerClosed, threshold: threshold, timeout: timeout, now: time.Now}
+}
+
+// Available วงจรจะยอมให้ส่ง request ไหม (ไม่เปลี่ยนสถานะ ใช้เลือก instance)
+func (b *CircuitBreaker) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return b.now().Sub(b.openedAt) >= b.timeout
+	case BreakerHalfOpen:
+		return !b.probing
+	}
+	return true
+}
+
+// Allow ขออนุญาตส่ง request ถ้าได้ ต้องเรียก done(success) เมื่อรู้ผล
+func (b *CircuitBreaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Sub(b.openedAt) < b.timeout {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing {
+			return nil, fmt.Errorf("%w: %s (probing)", ErrCircuitOpen, b.name)
+		}
+		b.probing = true
+	}
+
+	var once sync.Once
+	return func(success bool) { once.Do(func() { b.record(success) }) }, nil
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if success {
+			b.setState(BreakerClosed)
+		} else {
+			b.trip()
+		}
+		return
+	}
+
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.trip()
+	}
+}
+
+func (b *CircuitBreaker) trip() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state != state {
+		logBreakerChange(b.name, b.state, state)
+	}
+	b.state = state
+	if state == BreakerClosed {
+		b.failures = 0
+	}
+}
+
+func logBreakerChange(name string, from, to BreakerState) {
+	switch to {
+	case BreakerOpen:
+		log.Printf("🔴 Circuit %s: %s → open", name, from)
+	case BreakerHalfOpen:
+		log.Printf("🟡 Circuit %s: open → half-open (probing)", name)
+	case BreakerClosed:
+		log.Printf("🟢 Circuit %s: %s → closed", name, from)
+	}
+}
+
+// BreakerStatus สถานะของวงจรสำหรับ /health
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"consecutive_failures"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+	RetryAt  *time.Time   `json:"retry_at,omitempty"` // ลอง half-open ได้หลังเวลานี้
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt, retryAt := b.openedAt, b.openedAt.Add(b.timeout)
+		status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+	}
+	return status
+}
+
+// RetryAfter เหลือเวลาอีกเท่าไรก่อนวงจรจะลอง half-open
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	if remaining := b.timeout - b.now().Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// ============ Upstream ============
+
+// Upstream เรียก service ผ่าน registry พร้อม timeout, retry และ circuit breaker ต่อ instance
+// instance ที่พังเปิดวงจรเฉพาะของตัวเอง requests ยังไปยัง instances อื่นของ service ได้
+type Upstream struct {
+	service  string
+	config   ResilienceConfig
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker // instance URL → breaker (URL เดิมหลังลงทะเบียนใหม่ = breaker เดิม)
+}
+
+var upstreams = struct {
+	sync.Mutex
+	byService map[string]*Upstream
+}{byService: make(map[string]*Upstream)}
+
+// upstreamFor คืน Upstream ของ service (สร้างครั้งแรกที่ใช้)
+func upstreamFor(service string) *Upstream {
+	upstreams.Lock()
+	defer upstreams.Unlock()
+	u, ok := upstreams.byService[service]
+	if !ok {
+		u = &Upstream{service: service, config: defaultResilience, breakers: make(map[string]*CircuitBreaker)}
+		upstreams.byService[service] = u
+	}
+	return u
+}
+
+// breakerFor คืน breaker ของ instance (สร้างครั้งแรกที่ใช้)
+func (u *Upstream) breakerFor(instanceURL string) *CircuitBreaker {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b, ok := u.breakers[instanceURL]
+	if !ok {
+		b = NewCircuitBreaker(u.service+" "+instanceURL, u.config.FailureThreshold, u.config.OpenTimeout)
+		u.breakers[instanceURL] = b
+	}
+	return b
+}
+
+// Circuits สถานะวงจรของแต่ละ instance (key = URL) สำหรับ /health
+func (u *Upstream) Circuits() map[string]BreakerStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	circuits := make(map[string]BreakerStatus, len(u.breakers))
+	for url, b := range u.breakers {
+		circuits[url] = b.Status()
+	}
+	return circuits
+}
+
+// RetryAfter เวลาที่เหลือจนกว่าวงจรแรกของ service จะลอง half-open
+func (u *Upstream) RetryAfter() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var soonest time.Duration
+	for _, b := range u.breakers {
+		if remaining := b.RetryAfter(); remaining > 0 && (soonest == 0 || remaining < soonest) {
+			soonest = remaining
+		}
+	}
+	return soonest
+}
+
+// UpstreamRequest สิ่งที่ต้องส่งไป upstream
+// Body เป็น bytes ส่งซ้ำได้ตอน retry ส่วน BodyStream อ่านได้ครั้งเดียว จึงไม่ retry
+type UpstreamRequest struct {
+	Method        string
+	Path          string // รวม query string
+	Header        http.Header
+	Body          []byte
+	BodyStream    io.Reader
+	ContentLength int64         // ของ BodyStream, -1 = ไม่รู้ (chunked)
+	Timeout       time.Duration // รอ headers ต่อหนึ่งครั้ง และ body เงียบได้นานสุด, 0 = defaultRouteTimeout
+}
+
+// Do ส่ง request ไป instance ที่ registry เลือก ถ้าพังและ method เป็น idempotent จะลองใหม่กับ instance ถัดไป
+// ผู้เรียกต้องปิด resp.Body (ปิดแล้วจึงคืน context และตัวนับ in-flight ของ instance)
+func (u *Upstream) Do(ctx context.Context, r UpstreamRequest) (*http.Response, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultRouteTimeout
+	}
+	attempts := 1
+	if isIdempotent(r.Method) && r.BodyStream == nil {
+		attempts = u.config.MaxAttempts
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, u.backoff(attempt)); err != nil {
+				return nil, lastErr
+			}
+		}
+
+		resp, err := u.attempt(ctx, r, timeout)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoHealthyInstance) || errors.Is(err, ErrUnknownService) {
+			return nil, err // ลองใหม่ก็ไม่ช่วย
+		}
+		if attempt == attempts-1 || ctx.Err() != nil {
+			return resp, err // ส่ง response สุดท้าย (เช่น 503 ของ upstream) กลับไปตามจริง
+		}
+		if resp != nil {
+			// อ่านทิ้งให้ connection กลับเข้า pool ได้
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s responded %d", u.service, resp.StatusCode)
+		} else {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+func (u *Upstream) attempt(ctx context.Context, r UpstreamRequest, timeout time.Duration) (*http.Response, error) {
+	instance, err := registry.PickAvailable(u.service, func(i *Instance) bool { return u.breakerFor(i.URL).Available() })
+	if errors.Is(err, ErrNoAvailableInstance) {
+		return nil, fmt.Errorf("%w: every instance of %s", ErrCircuitOpen, u.service)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// timeout ใช้กับการรอ headers เท่านั้น ได้ headers แล้วหยุดนับ แล้วใช้เป็น idle timeout ของ body แทน
+	attemptCtx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	stop := func() { timer.Stop(); cancel() }
+
+	var body io.Reader = bytes.NewReader(r.Body)
+	if r.BodyStream != nil {
+		body = io.NopCloser(r.BodyStream) // stream เป็นของ fasthttp ไม่ให้ transport ปิด
+	}
+	req, err := http.NewRequestWithContext(attemptCtx, r.Method, instance.URL+r.Path, body)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if r.BodyStream != nil {
+		req.ContentLength = r.ContentLength
+	}
+	for key, values := range r.Header {
+		req.Header[key] = values
+	}
+	if id := requestIDFrom(ctx); id != "" && req.Header.Get("X-Request-ID") == "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	identity, ok := identityFrom(ctx)
+	signIdentity(req, identity, ok)
+
+	done, err := u.breakerFor(instance.URL).Allow()
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	release := instance.Acquire()
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		timedOut := !timer.Stop() && ctx.Err() == nil
+		stop()
+		release()
+		done(ctx.Err() != nil) // client ยกเลิกเอง ไม่ใช่ความผิดของ upstream
+		if timedOut {
+			err = context.DeadlineExceeded
+		}
+		return nil, fmt.Errorf("%s (%s): %w", u.service, instance.URL, err)
+	}
+
+	timer.Stop()
+	done(resp.StatusCode < 500)
+	resp.Body = &releasingBody{
+		ReadCloser: &idleTimeoutBody{ReadCloser: resp.Body, timer: timer, idle: timeout},
+		release:    func() { stop(); release() },
+	}
+	return resp, nil
+}
+
+// backoff exponential backoff แบบ full jitter: สุ่มระหว่าง 0 ถึง base*2^(attempt-1) (ไม่เกิน MaxBackoff)
+// กันไม่ให้ทุก client retry พร้อมกันเป็นจังหวะเดียว
+func (u *Upstream) backoff(attempt int) time.Duration {
+	ceiling := u.config.BaseBackoff << (attempt - 1)
+	if ceiling <= 0 || ceiling > u.config.MaxBackoff {
+		ceiling = u.config.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// releasingBody คืน resource ของ request เมื่อปิด body
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// idleTimeoutBody ยกเลิก request เมื่อ upstream ไม่ส่งข้อมูลมาเลยนานกว่า idle ระหว่างที่รออ่าน
+// (นับเฉพาะตอนรอ upstream ไม่นับเวลาที่ client ฝั่งเราอ่านช้า)
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer *time.Timer // timer เดียวกับตอนรอ headers (เรียก cancel ของ request)
+	idle  time.Duration
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.idle)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	return n, err
+}
+
+// isIdempotent method ที่ส่งซ้ำได้โดยไม่เกิดผลซ้ำ (POST / PATCH ไม่ retry)
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus upstream ตอบแบบนี้ = ลอง instance อื่นอาจสำเร็จ
+func isRetryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	b := NewCircuitBreaker("test", 2, 10*time.Second)
+	b.now = func() time.Time { return clock }
+
+	for _, step := range []struct {
+		name    string
+		advance time.Duration
+		result  string // "ok", "fail" หรือ "rejected" (Allow ต้องไม่ยอม)
+		want    BreakerState
+	}{
+		{"first failure", 0, "fail", BreakerClosed},
+		{"success resets count", 0, "ok", BreakerClosed},
+		{"failure after reset", 0, "fail", BreakerClosed},
+		{"threshold trips", 0, "fail", BreakerOpen},
+		{"open rejects", 5 * time.Second, "rejected", BreakerOpen},
+		{"probe fails reopens", 5 * time.Second, "fail", BreakerOpen},
+		{"reopened rejects", 9 * time.Second, "rejected", BreakerOpen},
+		{"probe succeeds closes", time.Second, "ok", BreakerClosed},
+	} {
+		clock = clock.Add(step.advance)
+		done, err := b.Allow()
+		switch step.result {
+		case "rejected":
+			if !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("%s: Allow err = %v, want ErrCircuitOpen", step.name, err)
+			}
+		default:
+			if err != nil {
+				t.Fatalf("%s: Allow: %v", step.name, err)
+			}
+			done(step.result == "ok")
+		}
+		if state := b.Status().State; state != step.want {
+			t.Errorf("%s: state = %s, want %s", step.name, state, step.want)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	b := NewCircuitBreaker("test", 1, time.Second)
+	b.now = func() time.Time { return clock }
+
+	done, _ := b.Allow()
+	done(false)
+	if b.Available() || b.RetryAfter() != time.Second {
+		t.Fatalf("just opened: available = %v retry after = %v", b.Available(), b.RetryAfter())
+	}
+
+	clock = clock.Add(time.Second)
+	if !b.Available() {
+		t.Fatal("not available after open timeout")
+	}
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) || b.Available() {
+		t.Errorf("second request while probing: err = %v, available = %v", err, b.Available())
+	}
+	probe(true)
+	probe(false) // เรียกซ้ำไม่มีผล
+	if state := b.Status().State; state != BreakerClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+// useTestRegistry แทน registry ของ gateway ด้วย instances ใน urls แล้วคืนค่าเดิมเมื่อจบ test
+func useTestRegistry(t *testing.T, service string, urls ...string) {
+	t.Helper()
+	r := newTestRegistry(t, "round_robin")
+	if err := r.AddStatic(map[string][]string{service: urls}); err != nil {
+		t.Fatal(err)
+	}
+	previous := registry
+	registry = r
+	t.Cleanup(func() { registry = previous })
+}
+
+func newTestUpstream(service string) *Upstream {
+	config := defaultResilience
+	config.BaseBackoff, config.MaxBackoff = time.Millisecond, time.Millisecond
+	return &Upstream{service: service, config: config, breakers: make(map[string]*CircuitBreaker)}
+}
+
+func TestUpstreamBreakerPerInstance(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	useTestRegistry(t, UserService, good.URL, bad.URL)
+	u := newTestUpstream(UserService)
+
+	statuses := map[int]int{}
+	for i := 0; i < 20; i++ {
+		resp, err := u.Do(context.Background(), UpstreamRequest{Method: http.MethodGet, Path: "/users"})
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+		statuses[resp.StatusCode]++
+	}
+	// bad ได้ requests จน breaker ของมันเปิด (threshold) ที่เหลือไป good ทั้งหมด
+	if statuses[500] != u.config.FailureThreshold || statuses[200] != 20-u.config.FailureThreshold {
+		t.Errorf("statuses = %v, want %d × 500 then only 200", statuses, u.config.FailureThreshold)
+	}
+	circuits := u.Circuits()
+	if circuits[bad.URL].State != BreakerOpen || circuits[good.URL].State != BreakerClosed {
+		t.Errorf("circuits = %+v, want bad open and good closed", circuits)
+	}
+
+	// วงจรของทุก instance เปิด = ErrCircuitOpen ทันที
+	useTestRegistry(t, UserService, bad.URL)
+	if _, err := u.Do(context.Background(), UpstreamRequest{Method: http.MethodGet, Path: "/users"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("all circuits open: err = %v, want ErrCircuitOpen", err)
+	}
+	if u.RetryAfter() <= 0 {
+		t.Error("RetryAfter = 0 while a circuit is open")
+	}
+}
+
+func TestUpstreamTimeouts(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			time.Sleep(3 * timeout)
+		case "/stream": // ยาวกว่า timeout รวม แต่มีข้อมูลมาทุก timeout/2
+			for i := 0; i < 6; i++ {
+				w.Write([]byte("data: tick\n\n"))
+				w.(http.Flusher).Flush()
+				time.Sleep(timeout / 2)
+			}
+		case "/stall": // ส่ง headers แล้วเงียบนานกว่า timeout
+			w.(http.Flusher).Flush()
+			time.Sleep(3 * timeout)
+			w.Write([]byte("late"))
+		}
+	}))
+	defer server.Close()
+	useTestRegistry(t, TodoService, server.URL)
+
+	for _, tc := range []struct {
+		path     string
+		doErr    error // error จาก Do (ก่อนได้ headers)
+		readErr  bool  // อ่าน body ไม่ครบ
+		bodySize int
+	}{
+		{"/slow-headers", context.DeadlineExceeded, false, 0},
+		{"/stream", nil, false, 6 * len("data: tick\n\n")},
+		{"/stall", nil, true, 0},
+	} {
+		u := newTestUpstream(TodoService)
+		u.config.MaxAttempts = 1
+		resp, err := u.Do(context.Background(), UpstreamRequest{Method: http.MethodPost, Path: tc.path, Timeout: timeout})
+		if tc.doErr != nil {
+			if !errors.Is(err, tc.doErr) {
+				t.Errorf("%s: err = %v, want %v", tc.path, err, tc.doErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if (err != nil) != tc.readErr {
+			t.Errorf("%s: read err = %v, want error %v", tc.path, err, tc.readErr)
+		}
+		if !tc.readErr && len(body) != tc.bodySize {
+			t.Errorf("%s: read %d bytes, want %d", tc.path, len(body), tc.bodySize)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ============ Declarative Routing ============
+
+// defaultRoutes สำเนาของ routes.yaml ที่ฝังไว้ในไฟล์ binary ใช้เมื่อหาไฟล์ ROUTES_FILE ไม่เจอ
+//
+//go:embed routes.yaml
+var defaultRoutes []byte
+
+// RoutesFile รูปแบบของ routes.yaml
+type RoutesFile struct {
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// RouteConfig หนึ่งเส้นทาง: path + methods → upstream (หรือ handler ในตัว gateway)
+type RouteConfig struct {
+	Name        string           `yaml:"name" json:"name"`
+	Path        string           `yaml:"path" json:"path"`       // /api/users, /api/users/:id, /api/users/*
+	Methods     []string         `yaml:"methods" json:"methods"` // ว่าง = ทุก method
+	Upstream    string           `yaml:"upstream" json:"upstream,omitempty"`
+	Handler     string           `yaml:"handler" json:"handler,omitempty"` // handler ในตัว gateway เช่น dashboard
+	StripPrefix string           `yaml:"strip_prefix" json:"strip_prefix,omitempty"`
+	AddPrefix   string           `yaml:"add_prefix" json:"add_prefix,omitempty"`
+	Timeout     time.Duration    `yaml:"timeout" json:"-"`
+	Auth        bool             `yaml:"auth" json:"auth"`
+	RateLimit   *RateLimitConfig `yaml:"rate_limit" json:"rate_limit,omitempty"`
+	Cache       *CacheConfig     `yaml:"cache" json:"cache,omitempty"`
+	GRPC        *GRPCConfig      `yaml:"grpc" json:"grpc,omitempty"` // เรียก upstream ทาง gRPC (ดู transcode.go)
+}
+
+// builtinHandlers handlers ที่ route อ้างถึงด้วย handler: <name>
+var builtinHandlers = map[string]fiber.Handler{
+	"dashboard": dashboardHandler,
+}
+
+// route ที่ compile แล้ว พร้อม middleware ครบ
+type route struct {
+	config  RouteConfig
+	pattern pathPattern
+	methods map[string]bool
+	handler fiber.Handler
+}
+
+// routeTable ตารางที่ใช้อยู่ สร้างใหม่ทั้งชุดทุกครั้งที่โหลด แล้วสลับทีเดียว (ไม่มีช่วงที่ใช้ครึ่งเก่าครึ่งใหม่)
+type routeTable struct {
+	routes   []*route
+	source   string
+	checksum string
+	loadedAt time.Time
+}
+
+// Router ส่ง request ไปตาม routeTable ปัจจุบัน
+type Router struct {
+	path  string
+	table atomic.Pointer[routeTable]
+
+	mu        sync.Mutex // กันโหลดซ้อนกัน
+	version   int
+	lastError string
+	modTime   time.Time
+}
+
+var router *Router
+
+// initRouter โหลด ROUTES_FILE (ค่าเริ่มต้น routes.yaml) แล้วเฝ้าดูการแก้ไข
+func initRouter() {
+	path := os.Getenv("ROUTES_FILE")
+	if path == "" {
+		path = "routes.yaml"
+	}
+	router = &Router{path: path}
+
+	if err := router.Reload(); err != nil {
+		if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+			log.Fatal("Failed to load routes: ", err)
+		}
+		log.Printf("⚠️ %s not found, using built-in routes", path)
+		if err := router.apply(defaultRoutes, "built-in"); err != nil {
+			log.Fatal("Failed to load built-in routes: ", err)
+		}
+	}
+
+	router.Watch(2 * time.Second)
+}
+
+// Reload อ่านไฟล์ใหม่ ถ้าไม่ถูกต้องจะเก็บตารางเดิมไว้และรายงาน error
+func (rt *Router) Reload() error {
+	data, err := os.ReadFile(rt.path)
+	if err != nil {
+		rt.setError(err)
+		return err
+	}
+	return rt.apply(data, rt.path)
+}
+
+func (rt *Router) apply(data []byte, source string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:8])
+	if current := rt.table.Load(); current != nil && current.checksum == checksum {
+		rt.lastError = ""
+		return nil
+	}
+
+	table, err := buildRouteTable(data)
+	if err != nil {
+		rt.lastError = err.Error()
+		log.Printf("❌ Routes from %s rejected, keeping previous table: %v", source, err)
+		return err
+	}
+	table.source, table.checksum, table.loadedAt = source, checksum, time.Now()
+
+	rt.table.Store(table)
+	rt.version++
+	rt.lastError = ""
+	log.Printf("🧭 Loaded %d routes from %s (version %d)", len(table.routes), source, rt.version)
+	return nil
+}
+
+func (rt *Router) setError(err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.lastError = err.Error()
+}
+
+// Watch โหลดใหม่เมื่อไฟล์เปลี่ยน (เช็กทุก interval) หรือเมื่อได้ SIGHUP
+func (rt *Router) Watch(interval time.Duration) {
+	if info, err := os.Stat(rt.path); err == nil {
+		rt.modTime = info.ModTime()
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(rt.path)
+				if err != nil || info.ModTime().Equal(rt.modTime) {
+					continue
+				}
+				rt.modTime = info.ModTime()
+			case <-hup:
+				log.Println("🔄 SIGHUP received, reloading routes")
+			}
+			rt.Reload()
+		}
+	}()
+}
+
+// buildRouteTable ตรวจและ compile ทุก route ก่อน ผิดแม้แต่ route เดียว = ไม่ใช้ทั้งไฟล์
+func buildRouteTable(data []byte) (*routeTable, error) {
+	var file RoutesFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if len(file.Routes) == 0 {
+		return nil, errors.New("no routes defined")
+	}
+
+	table := &routeTable{}
+	names := make(map[string]bool)
+	for i, config := range file.Routes {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("route-%d", i+1)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("route %s: duplicate name", config.Name)
+		}
+		names[config.Name] = true
+
+		r, err := compileRoute(config)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", config.Name, err)
+		}
+		table.routes = append(table.routes, r)
+	}
+	return table, nil
+}
+
+func compileRoute(config RouteConfig) (*route, error) {
+	pattern, err := compilePattern(config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &route{pattern: pattern}
+	if len(config.Methods) > 0 {
+		r.methods = make(map[string]bool)
+		for i, method := range config.Methods {
+			method = strings.ToUpper(method)
+			config.Methods[i] = method
+			r.methods[method] = true
+		}
+		if r.methods[http.MethodGet] {
+			r.methods[http.MethodHead] = true
+		}
+	}
+	if config.Timeout < 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+
+	var handler fiber.Handler
+	switch {
+	case config.Upstream != "" && config.Handler != "":
+		return nil, errors.New("set either upstream or handler, not both")
+	case config.Upstream != "":
+		if !strings.HasPrefix(config.StripPrefix+"/", "/") || !strings.HasPrefix(config.AddPrefix+"/", "/") {
+			return nil, errors.New("strip_prefix and add_prefix must start with /")
+		}
+		if config.Timeout == 0 {
+			config.Timeout = defaultRouteTimeout
+		}
+		if config.GRPC != nil {
+			if handler, err = newTranscoder(config, pattern); err != nil {
+				return nil, err
+			}
+		} else {
+			handler = proxyTo(config.Upstream, config.StripPrefix, config.AddPrefix, config.Timeout)
+		}
+	case config.Handler != "":
+		if config.GRPC != nil {
+			return nil, errors.New("grpc requires an upstream")
+		}
+		var ok bool
+		if handler, ok = builtinHandlers[config.Handler]; !ok {
+			return nil, fmt.Errorf("unknown handler %q", config.Handler)
+		}
+	default:
+		return nil, errors.New("upstream or handler is required")
+	}
+
+	// ลำดับ: auth → rate limit (นับต่อ user ถ้ามี) → cache → upstream
+	if config.Cache != nil {
+		if handler, err = withCache(config.Cache, handler); err != nil {
+			return nil, err
+		}
+	}
+	if config.RateLimit != nil {
+		if handler, err = withRateLimit(*config.RateLimit, handler); err != nil {
+			return nil, err
+		}
+	}
+	if config.Auth {
+		handler = edgeAuth.Wrap(handler)
+	}
+
+	r.config, r.handler = config, handler
+	return r, nil
+}
+
+// Handler ส่ง request ไป route แรกที่ตรง (ต้องลงทะเบียนเป็นตัวสุดท้าย ไม่ตรงเลย = 404)
+func (rt *Router) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		table := rt.table.Load()
+		var allowed []string
+		for _, r := range table.routes {
+			if !r.pattern.match(c.Path()) {
+				continue
+			}
+			if r.methods == nil || r.methods[c.Method()] {
+				return r.handler(c)
+			}
+			allowed = append(allowed, r.config.Methods...)
+		}
+		if len(allowed) > 0 {
+			c.Set(fiber.HeaderAllow, strings.Join(allowed, ", "))
+			return c.Status(405).JSON(fiber.Map{
+				"success": false,
+				"error":   "Method not allowed",
+			})
+		}
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "Route not found: " + c.Method() + " " + c.Path(),
+		})
+	}
+}
+
+// ============ Path Patterns ============
+
+// pathPattern รองรับ segment ตรงตัว, :param (หนึ่ง segment) และ * ท้ายสุด (ศูนย์ segment ขึ้นไป)
+type pathPattern struct {
+	raw      string
+	segments []string
+	wildcard bool
+}
+
+func compilePattern(path string) (pathPattern, error) {
+	if !strings.HasPrefix(path, "/") {
+		return pathPattern{}, fmt.Errorf("path %q must start with /", path)
+	}
+	p := pathPattern{raw: path}
+	segments := splitPath(path)
+	for i, segment := range segments {
+		if strings.Contains(segment, "*") {
+			if segment != "*" || i != len(segments)-1 {
+				return pathPattern{}, fmt.Errorf("path %q: * is only allowed as the last segment", path)
+			}
+			p.wildcard = true
+			continue
+		}
+		p.segments = append(p.segments, segment)
+	}
+	return p, nil
+}
+
+func (p pathPattern) match(path string) bool {
+	segments := splitPath(path)
+	if len(segments) < len(p.segments) || (!p.wildcard && len(segments) != len(p.segments)) {
+		return false
+	}
+	for i, want := range p.segments {
+		if strings.HasPrefix(want, ":") {
+			continue
+		}
+		if !strings.EqualFold(want, segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// params ชื่อของ :param ตามลำดับใน path
+func (p pathPattern) params() []string {
+	var names []string
+	for _, segment := range p.segments {
+		if strings.HasPrefix(segment, ":") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// values ค่าของ :param จาก path ที่ match แล้ว
+func (p pathPattern) values(path string) map[string]string {
+	segments := splitPath(path)
+	values := make(map[string]string)
+	for i, segment := range p.segments {
+		if strings.HasPrefix(segment, ":") {
+			values[segment[1:]] = segments[i]
+		}
+	}
+	return values
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// ============ Admin Endpoints ============
+
+// listRoutesHandler GET /admin/routes ตารางเส้นทางที่ใช้อยู่จริงตอนนี้
+func listRoutesHandler(c *fiber.Ctx) error {
+	table := router.table.Load()
+	type routeView struct {
+		RouteConfig
+		Timeout string `json:"timeout,omitempty"` // "2s" แทน nanoseconds
+	}
+	routes := make([]routeView, 0, len(table.routes))
+	for _, r := range table.routes {
+		view := routeView{RouteConfig: r.config}
+		if r.config.Timeout > 0 {
+			view.Timeout = r.config.Timeout.String()
+		}
+		routes = append(routes, view)
+	}
+
+	router.mu.Lock()
+	version, lastError := router.version, router.lastError
+	router.mu.Unlock()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"source":     table.source,
+			"version":    version,
+			"checksum":   table.checksum,
+			"loaded_at":  table.loadedAt,
+			"last_error": lastError,
+			"routes":     routes,
+		},
+	})
+}
+
+// reloadRoutesHandler POST /admin/routes/reload โหลดไฟล์ใหม่ทันที (ไม่ต้องรอรอบเช็ก)
+func reloadRoutesHandler(c *fiber.Ctx) error {
+	if err := router.Reload(); err != nil {
+		return c.Status(422).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	return listRoutesHandler(c)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		want    bool
+		values  map[string]string
+	}{
+		{"/api/users", "/api/users", true, map[string]string{}},
+		{"/api/users", "/api/users/", true, map[string]string{}},
+		{"/api/users", "/API/Users", true, map[string]string{}},
+		{"/api/users", "/api/users/1", false, nil},
+		{"/api/users", "/api", false, nil},
+		{"/api/users/:id", "/api/users/42", true, map[string]string{"id": "42"}},
+		{"/api/users/:id", "/api/users", false, nil},
+		{"/api/users/:id", "/api/users/42/todos", false, nil},
+		{"/api/users/:id/todos/:todo", "/api/users/7/todos/3", true, map[string]string{"id": "7", "todo": "3"}},
+		{"/api/todos/*", "/api/todos", true, map[string]string{}},
+		{"/api/todos/*", "/api/todos/1/items", true, map[string]string{}},
+		{"/api/todos/*", "/api/users/1", false, nil},
+		{"/api/:service/*", "/api/todos/1", true, map[string]string{"service": "todos"}},
+		{"/", "/", true, map[string]string{}},
+	} {
+		p, err := compilePattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("compilePattern(%q): %v", tc.pattern, err)
+		}
+		if got := p.match(tc.path); got != tc.want {
+			t.Errorf("%s match %s = %v, want %v", tc.pattern, tc.path, got, tc.want)
+			continue
+		}
+		if !tc.want {
+			continue
+		}
+		values := p.values(tc.path)
+		if len(values) != len(tc.values) {
+			t.Errorf("%s values(%s) = %v, want %v", tc.pattern, tc.path, values, tc.values)
+			continue
+		}
+		for name, want := range tc.values {
+			if values[name] != want {
+				t.Errorf("%s values(%s)[%s] = %q, want %q", tc.pattern, tc.path, name, values[name], want)
+			}
+		}
+	}
+}
+
+func TestCompilePatternRejects(t *testing.T) {
+	for _, path := range []string{"api/users", "", "/api/*/users", "/api/users*", "/api/*/*"} {
+		if _, err := compilePattern(path); err == nil {
+			t.Errorf("compilePattern(%q) accepted", path)
+		}
+	}
+}
+
+func TestBuildRouteTable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		yaml string
+		err  string // ว่าง = ต้องผ่าน
+	}{
+		{"valid", `
+routes:
+  - path: /api/users/:id
+    methods: [get]
+    upstream: user-service
+    strip_prefix: /api
+  - path: /api/dashboard
+    handler: dashboard
+`, ""},
+		{"invalid yaml", "routes: [", "invalid YAML"},
+		{"unknown field", `
+routes:
+  - path: /api/users
+    upstream: user-service
+    upstreem: todo-service
+`, "invalid YAML"},
+		{"no routes", "routes: []", "no routes defined"},
+		{"duplicate name", `
+routes:
+  - name: users
+    path: /api/users
+    upstream: user-service
+  - name: users
+    path: /api/users/:id
+    upstream: user-service
+`, "duplicate name"},
+		{"bad path", `
+routes:
+  - path: api/users
+    upstream: user-service
+`, "must start with /"},
+		{"upstream and handler", `
+routes:
+  - path: /api/dashboard
+    upstream: user-service
+    handler: dashboard
+`, "not both"},
+		{"neither upstream nor handler", `
+routes:
+  - path: /api/users
+`, "upstream or handler is required"},
+		{"unknown handler", `
+routes:
+  - path: /api/stats
+    handler: stats
+`, `unknown handler "stats"`},
+		{"bad strip prefix", `
+routes:
+  - path: /api/users
+    upstream: user-service
+    strip_prefix: api
+`, "must start with /"},
+		{"negative timeout", `
+routes:
+  - path: /api/users
+    upstream: user-service
+    timeout: -1s
+`, "timeout must be positive"},
+		{"rate limit without window", `
+routes:
+  - path: /api/users
+    upstream: user-service
+    rate_limit:
+      requests: 10
+`, "rate_limit"},
+		{"cache without ttl", `
+routes:
+  - path: /api/users
+    upstream: user-service
+    cache: {}
+`, "cache needs ttl"},
+		{"unnamed route reported by position", `
+routes:
+  - path: /api/users
+    upstream: user-service
+  - path: /api/todos
+`, "route route-2"},
+	} {
+		table, err := buildRouteTable([]byte(tc.yaml))
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			} else if len(table.routes) == 0 {
+				t.Errorf("%s: no routes compiled", tc.name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err = %v, want containing %q", tc.name, err, tc.err)
+		}
+	}
+}
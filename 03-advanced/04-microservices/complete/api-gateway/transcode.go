@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// descriptors ของ proto ที่ transcode ได้ (import แล้วลงทะเบียนใน protoregistry เอง)
+	_ "grpc-example/proto"
+)
+
+// ============ HTTP/JSON → gRPC Transcoding ============
+
+// GRPCConfig route ที่มี grpc: เรียก method ของ upstream ทาง gRPC แทนการ proxy HTTP
+// request message มาจาก path (:param), query string และ body ไม่ต้องเขียน handler ต่อ RPC
+type GRPCConfig struct {
+	Method string `yaml:"method" json:"method"`       // package.Service/Method เช่น user.UserService/GetUser
+	Body   string `yaml:"body" json:"body,omitempty"` // "*" = body ทั้งก้อนคือ request, ชื่อ field = body ใส่ field นั้น, ว่าง = ไม่อ่าน body
+}
+
+var (
+	protoJSON     = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	protoFromJSON = protojson.UnmarshalOptions{}
+)
+
+// transcoder หนึ่ง route ที่ผูกกับหนึ่ง gRPC method
+type transcoder struct {
+	conn       *grpc.ClientConn
+	fullMethod string // /user.UserService/GetUser
+	method     protoreflect.MethodDescriptor
+	pattern    pathPattern
+	bodyAll    bool
+	bodyField  protoreflect.FieldDescriptor
+	timeout    time.Duration
+}
+
+// newTranscoder ตรวจ method, path params และ body กับ descriptor ตั้งแต่ตอนโหลด routes
+// ผิดตรงไหน = ทั้งไฟล์โหลดไม่ผ่าน เหมือน config ผิดอื่น ๆ
+func newTranscoder(config RouteConfig, pattern pathPattern) (fiber.Handler, error) {
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(config.GRPC.Method, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("grpc.method %q must look like package.Service/Method", config.GRPC.Method)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("unknown gRPC service %q", serviceName)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a gRPC service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("unknown method %s/%s", serviceName, methodName)
+	}
+	if method.IsStreamingClient() {
+		return nil, fmt.Errorf("%s: client streaming cannot be transcoded", config.GRPC.Method)
+	}
+	if method.IsStreamingServer() && config.Cache != nil {
+		return nil, errors.New("cache cannot be used with streaming methods")
+	}
+	if config.StripPrefix != "" || config.AddPrefix != "" {
+		return nil, errors.New("strip_prefix and add_prefix do not apply to grpc routes")
+	}
+
+	t := &transcoder{
+		fullMethod: "/" + serviceName + "/" + methodName,
+		method:     method,
+		pattern:    pattern,
+		timeout:    config.Timeout,
+	}
+
+	input := method.Input()
+	for _, name := range pattern.params() {
+		if input.Fields().ByName(protoreflect.Name(name)) == nil {
+			return nil, fmt.Errorf("path parameter :%s is not a field of %s", name, input.FullName())
+		}
+	}
+	switch config.GRPC.Body {
+	case "":
+	case "*":
+		t.bodyAll = true
+	default:
+		t.bodyField = input.Fields().ByName(protoreflect.Name(config.GRPC.Body))
+		if t.bodyField == nil || t.bodyField.Message() == nil || t.bodyField.IsList() || t.bodyField.IsMap() {
+			return nil, fmt.Errorf("grpc.body %q must be a message field of %s", config.GRPC.Body, input.FullName())
+		}
+	}
+
+	if t.conn, err = grpcConn(config.Upstream); err != nil {
+		return nil, err
+	}
+	if method.IsStreamingServer() {
+		return t.stream, nil
+	}
+	return t.unary, nil
+}
+
+// unary ตอบ {"success": true, "data": <response message>} error = HTTP status ตาม gRPC code
+func (t *transcoder) unary(c *fiber.Ctx) error {
+	req, err := t.newRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), t.timeout)
+	defer cancel()
+
+	resp := dynamicpb.NewMessage(t.method.Output())
+	if err := t.conn.Invoke(ctx, t.fullMethod, req, resp); err != nil {
+		return grpcError(c, err)
+	}
+	data, err := protoJSON.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    json.RawMessage(data),
+	})
+}
+
+// stream server streaming → NDJSON (หนึ่ง message ต่อบรรทัด) หรือ SSE ถ้า Accept: text/event-stream
+// timeout ของ route คือเวลาทั้ง stream, client ปิด connection = ยกเลิก stream ที่ upstream
+func (t *transcoder) stream(c *fiber.Ctx) error {
+	req, err := t.newRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), t.timeout)
+	stream, err := t.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, t.fullMethod)
+	if err == nil {
+		err = stream.SendMsg(req)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+
+	// รอ message แรกก่อนเริ่มตอบ error ที่เกิดก่อนหน้านั้น (NotFound, Unauthenticated, ...) จึงยังได้ HTTP status ตามจริง
+	var first *dynamicpb.Message
+	if err == nil {
+		first = dynamicpb.NewMessage(t.method.Output())
+		if err = stream.RecvMsg(first); err == io.EOF {
+			first, err = nil, nil
+		}
+	}
+	if err != nil {
+		cancel()
+		return grpcError(c, err)
+	}
+
+	sse := strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+	if sse {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		for msg := first; msg != nil; {
+			data, err := protoJSON.Marshal(msg)
+			if err == nil {
+				writeStreamMessage(w, sse, data)
+				if w.Flush() != nil {
+					return // client ปิดไปแล้ว
+				}
+				msg = dynamicpb.NewMessage(t.method.Output())
+				err = stream.RecvMsg(msg)
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				writeStreamError(w, sse, err)
+				w.Flush()
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func writeStreamMessage(w *bufio.Writer, sse bool, data []byte) {
+	if sse {
+		w.WriteString("data: ")
+		w.Write(data)
+		w.WriteString("\n\n")
+		return
+	}
+	w.Write(data)
+	w.WriteByte('\n')
+}
+
+// writeStreamError error กลาง stream (ส่ง status ไปแล้ว) = บรรทัด/event สุดท้ายที่มี error และ code
+func writeStreamError(w *bufio.Writer, sse bool, err error) {
+	st := status.Convert(err)
+	data, _ := json.Marshal(fiber.Map{
+		"success": false,
+		"error":   st.Message(),
+		"code":    st.Code().String(),
+	})
+	if sse {
+		w.WriteString("event: error\n")
+	}
+	writeStreamMessage(w, sse, data)
+}
+
+// ============ Request Message ============
+
+// newRequest สร้าง request message: body ก่อน แล้ว query แล้ว path params (path ชนะเสมอ)
+// body: "*" = ไม่อ่าน query เพราะ body ครอบทั้ง message แล้ว
+func (t *transcoder) newRequest(c *fiber.Ctx) (*dynamicpb.Message, error) {
+	req := dynamicpb.NewMessage(t.method.Input())
+
+	if body := c.Body(); len(body) > 0 && (t.bodyAll || t.bodyField != nil) {
+		target := req
+		if t.bodyField != nil {
+			target = dynamicpb.NewMessage(t.bodyField.Message())
+		}
+		if err := protoFromJSON.Unmarshal(body, target); err != nil {
+			return nil, fmt.Errorf("invalid request body: %w", err)
+		}
+		if t.bodyField != nil {
+			req.Set(t.bodyField, protoreflect.ValueOfMessage(target))
+		}
+	}
+
+	if !t.bodyAll {
+		var err error
+		fields := t.method.Input().Fields()
+		c.Request().URI().QueryArgs().VisitAll(func(key, value []byte) {
+			field := fields.ByName(protoreflect.Name(key))
+			if field == nil {
+				field = fields.ByJSONName(string(key))
+			}
+			if field == nil || err != nil {
+				return // query ที่ไม่ใช่ field ของ request ไม่สนใจ
+			}
+			err = setField(req, field, string(value))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range t.pattern.values(c.Path()) {
+		field := t.method.Input().Fields().ByName(protoreflect.Name(name))
+		if field.IsList() {
+			req.Clear(field)
+		}
+		if err := setField(req, field, value); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// setField ใส่ค่าจาก path/query ลง field (repeated = ต่อท้าย เช่น ?tag=a&tag=b)
+func setField(msg *dynamicpb.Message, field protoreflect.FieldDescriptor, raw string) error {
+	if field.IsMap() || field.Message() != nil {
+		return fmt.Errorf("%s: message fields cannot be set from the URL", field.Name())
+	}
+	value, err := parseScalar(field, raw)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", field.Name(), raw)
+	}
+	if field.IsList() {
+		msg.Mutable(field).List().Append(value)
+		return nil
+	}
+	msg.Set(field, value)
+	return nil
+}
+
+func parseScalar(field protoreflect.FieldDescriptor, raw string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(raw), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(raw)), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(raw)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(raw, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(raw, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(raw, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(raw, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(raw, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByName(protoreflect.Name(raw)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		v, err := strconv.ParseInt(raw, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// newTestTranscoder transcoder ที่ยังไม่มี connection (ทดสอบแค่การสร้าง request message)
+func newTestTranscoder(t *testing.T, method, path, body string) *transcoder {
+	t.Helper()
+	pattern, err := compilePattern(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(method))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &transcoder{method: desc.(protoreflect.MethodDescriptor), pattern: pattern, bodyAll: body == "*"}
+	if body != "" && body != "*" {
+		tr.bodyField = tr.method.Input().Fields().ByName(protoreflect.Name(body))
+	}
+	return tr
+}
+
+func TestTranscoderNewRequest(t *testing.T) {
+	getUser := newTestTranscoder(t, "user.UserService.GetUser", "/api/users/:id", "")
+	listUsers := newTestTranscoder(t, "user.UserService.ListUsers", "/api/users", "")
+	createUser := newTestTranscoder(t, "user.UserService.CreateUser", "/api/users", "*")
+
+	for _, tc := range []struct {
+		name   string
+		tr     *transcoder
+		target string
+		body   string
+		want   string // JSON ของ request message, ว่าง = ต้อง error
+	}{
+		{"path param", getUser, "/api/users/42", "", `{"id":42}`},
+		{"path wins over query", getUser, "/api/users/42?id=7", "", `{"id":42}`},
+		{"body ignored without grpc.body", getUser, "/api/users/42", `{"id":7}`, `{"id":42}`},
+		{"bad path param", getUser, "/api/users/abc", "", ""},
+		{"query params", listUsers, "/api/users?page=2&limit=5", "", `{"page":2,"limit":5}`},
+		{"unknown query ignored", listUsers, "/api/users?page=2&sort=name", "", `{"page":2,"limit":0}`},
+		{"bad query value", listUsers, "/api/users?limit=ten", "", ""},
+		{"overflowing query value", listUsers, "/api/users?limit=99999999999", "", ""},
+		{"whole body", createUser, "/api/users", `{"name":"Ann","email":"ann@example.com"}`, `{"name":"Ann","email":"ann@example.com"}`},
+		{"query ignored with body *", createUser, "/api/users?name=Bob", `{"name":"Ann"}`, `{"name":"Ann","email":""}`},
+		{"invalid body", createUser, "/api/users", `{"name":`, ""},
+		{"unknown body field", createUser, "/api/users", `{"nickname":"A"}`, ""},
+	} {
+		app := fiber.New()
+		app.All("/*", func(c *fiber.Ctx) error {
+			req, err := tc.tr.newRequest(c)
+			if err != nil {
+				return c.Status(400).SendString(err.Error())
+			}
+			data, err := protoJSON.Marshal(req)
+			if err != nil {
+				return err
+			}
+			return c.Send(data)
+		})
+
+		resp, err := app.Test(httptest.NewRequest("POST", tc.target, strings.NewReader(tc.body)), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if tc.want == "" {
+			if resp.StatusCode != 400 {
+				t.Errorf("%s: status = %d (%s), want an error", tc.name, resp.StatusCode, body)
+			}
+			continue
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: %s", tc.name, body)
+			continue
+		}
+		var got, want interface{}
+		json.Unmarshal(body, &got)
+		json.Unmarshal([]byte(tc.want), &want)
+		if canonicalJSON(got) != canonicalJSON(want) {
+			t.Errorf("%s: request = %s, want %s", tc.name, body, tc.want)
+		}
+	}
+}
+
+// canonicalJSON JSON ที่เรียง key แล้ว เอาไว้เทียบผลโดยไม่สนลำดับ field
+func canonicalJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestBuildRouteTableRejectsGRPCRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		route string
+		err   string
+	}{
+		{"bad method name", `path: /api/users
+    upstream: user-service
+    grpc: {method: GetUser}`, "must look like package.Service/Method"},
+		{"unknown service", `path: /api/users
+    upstream: user-service
+    grpc: {method: billing.BillingService/GetInvoice}`, "unknown gRPC service"},
+		{"unknown method", `path: /api/users
+    upstream: user-service
+    grpc: {method: user.UserService/DeleteUser}`, "unknown method"},
+		{"not a service", `path: /api/users
+    upstream: user-service
+    grpc: {method: user.User/GetUser}`, "is not a gRPC service"},
+		{"path param not a field", `path: /api/users/:user_id
+    upstream: user-service
+    grpc: {method: user.UserService/GetUser}`, "path parameter :user_id"},
+		{"body not a message field", `path: /api/users
+    methods: [POST]
+    upstream: user-service
+    grpc: {method: user.UserService/CreateUser, body: name}`, `grpc.body "name"`},
+		{"cache on a stream", `path: /api/users/stream
+    upstream: user-service
+    cache: {ttl: 10s}
+    grpc: {method: user.UserService/StreamUsers}`, "cache cannot be used with streaming"},
+		{"strip prefix", `path: /api/users/:id
+    upstream: user-service
+    strip_prefix: /api
+    grpc: {method: user.UserService/GetUser}`, "do not apply to grpc routes"},
+		{"grpc on a handler", `path: /api/dashboard
+    handler: dashboard
+    grpc: {method: user.UserService/GetUser}`, "grpc requires an upstream"},
+	} {
+		_, err := buildRouteTable([]byte("routes:\n  - " + tc.route + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err = %v, want containing %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+// routes.yaml ที่ฝังไว้ต้องโหลดผ่าน และทุก route ของ user-service ใช้ REST ผ่าน registry/breaker
+func TestDefaultRoutesUseREST(t *testing.T) {
+	table, err := buildRouteTable(defaultRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range table.routes {
+		if r.config.GRPC != nil {
+			t.Errorf("route %s uses gRPC by default", r.config.Name)
+		}
+	}
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	for _, tc := range []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.OK, 200},
+		{codes.Canceled, 499},
+		{codes.Unknown, 500},
+		{codes.InvalidArgument, 400},
+		{codes.DeadlineExceeded, 504},
+		{codes.NotFound, 404},
+		{codes.AlreadyExists, 409},
+		{codes.PermissionDenied, 403},
+		{codes.ResourceExhausted, 429},
+		{codes.FailedPrecondition, 400},
+		{codes.Aborted, 409},
+		{codes.OutOfRange, 400},
+		{codes.Unimplemented, 501},
+		{codes.Internal, 500},
+		{codes.Unavailable, 503},
+		{codes.DataLoss, 500},
+		{codes.Unauthenticated, 401},
+	} {
+		if got := httpStatusFromCode(tc.code); got != tc.want {
+			t.Errorf("httpStatusFromCode(%s) = %d, want %d", tc.code, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package interceptors provides server interceptors shared by every gRPC server in this module:
+// logging, panic recovery and deadlines.
+package interceptors
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOptions chains recovery → logging → deadline for unary and streaming calls.
+// Calls without a deadline get unaryTimeout (unary) or streamTimeout (server streams).
+func ServerOptions(unaryTimeout, streamTimeout time.Duration) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryRecovery(), UnaryLogging(), UnaryDeadline(unaryTimeout)),
+		grpc.ChainStreamInterceptor(StreamRecovery(), StreamLogging(), StreamDeadline(streamTimeout)),
+	}
+}
+
+// ============ Logging ============
+
+// UnaryLogging logs method, status code, duration and request ID of every call.
+func UnaryLogging() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamLogging logs streaming calls once they finish.
+func StreamLogging() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return // health checks run every few seconds
+	}
+	log.Printf("gRPC | %-16s | %12s | %s | %s", status.Code(err), time.Since(start), RequestID(ctx), method)
+}
+
+// RequestID returns the x-request-id metadata sent by the caller (the gateway forwards its X-Request-ID).
+func RequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get("x-request-id"); len(ids) > 0 {
+		return ids[0]
+	}
+	return "-"
+}
+
+// ============ Recovery ============
+
+// UnaryRecovery turns a panic in a handler into codes.Internal instead of crashing the server.
+func UnaryRecovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is UnaryRecovery for streaming calls.
+func StreamRecovery() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func recovered(method string, r interface{}) error {
+	log.Printf("🔥 panic in %s: %v\n%s", method, r, debug.Stack())
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// ============ Deadlines ============
+
+// UnaryDeadline rejects calls whose deadline has already passed and gives calls
+// without a deadline a default one, so no handler can run forever.
+func UnaryDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel, err := withDeadline(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// StreamDeadline is UnaryDeadline for streaming calls.
+func StreamDeadline(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel, err := withDeadline(ss.Context(), timeout)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if time.Until(deadline) <= 0 {
+			return nil, nil, status.Error(codes.DeadlineExceeded, "deadline exceeded before the call started")
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// contextStream overrides the stream context so handlers see the deadline.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
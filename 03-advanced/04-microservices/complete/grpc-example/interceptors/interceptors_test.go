@@ -0,0 +1,149 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "grpc-example/proto"
+)
+
+const (
+	testUnaryTimeout  = 2 * time.Second
+	testStreamTimeout = 10 * time.Second
+)
+
+// testServer panics for id 0 / page 0 and records how much time its handlers were given.
+type testServer struct {
+	pb.UnimplementedUserServiceServer
+
+	mu        sync.Mutex
+	remaining time.Duration // time left until the handler's deadline, -1 without one
+}
+
+func (s *testServer) record(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remaining = -1
+	if deadline, ok := ctx.Deadline(); ok {
+		s.remaining = time.Until(deadline)
+	}
+}
+
+func (s *testServer) lastRemaining() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remaining
+}
+
+func (s *testServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	if req.GetId() == 0 {
+		panic("nil user")
+	}
+	s.record(ctx)
+	return &pb.User{Id: req.GetId()}, nil
+}
+
+func (s *testServer) StreamUsers(req *pb.ListUsersRequest, stream pb.UserService_StreamUsersServer) error {
+	if req.GetPage() == 0 {
+		panic("bad page")
+	}
+	s.record(stream.Context())
+	return stream.Send(&pb.User{Id: 1})
+}
+
+// newTestClient serves srv with ServerOptions over an in-memory listener.
+func newTestClient(t *testing.T, srv *testServer) pb.UserServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(ServerOptions(testUnaryTimeout, testStreamTimeout)...)
+	pb.RegisterUserServiceServer(server, srv)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewUserServiceClient(conn)
+}
+
+func streamOne(ctx context.Context, client pb.UserServiceClient, page int32) error {
+	stream, err := client.StreamUsers(ctx, &pb.ListUsersRequest{Page: page})
+	if err != nil {
+		return err
+	}
+	_, err = stream.Recv()
+	return err
+}
+
+func TestRecoveryKeepsServing(t *testing.T) {
+	client := newTestClient(t, &testServer{})
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"unary panic", func() error { _, err := client.GetUser(ctx, &pb.GetUserRequest{Id: 0}); return err }, codes.Internal},
+		{"unary after panic", func() error { _, err := client.GetUser(ctx, &pb.GetUserRequest{Id: 1}); return err }, codes.OK},
+		{"stream panic", func() error { return streamOne(ctx, client, 0) }, codes.Internal},
+		{"stream after panic", func() error { return streamOne(ctx, client, 1) }, codes.OK},
+	} {
+		err := step.call()
+		if code := status.Code(err); code != step.want {
+			t.Errorf("%s: code = %s, want %s (%v)", step.name, code, step.want, err)
+		}
+		// the panic value must not leak to the client
+		if step.want == codes.Internal && status.Convert(err).Message() != "internal server error" {
+			t.Errorf("%s: message = %q", step.name, status.Convert(err).Message())
+		}
+	}
+}
+
+func TestDefaultDeadline(t *testing.T) {
+	srv := &testServer{}
+	client := newTestClient(t, srv)
+
+	withTimeout := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+		max  time.Duration // the handler must see a deadline in (max - 1s, max]
+	}{
+		{"unary without deadline", func() error {
+			_, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: 1})
+			return err
+		}, testUnaryTimeout},
+		{"unary keeps caller deadline", func() error {
+			_, err := client.GetUser(withTimeout(30*time.Second), &pb.GetUserRequest{Id: 1})
+			return err
+		}, 30 * time.Second},
+		{"stream without deadline", func() error { return streamOne(context.Background(), client, 1) }, testStreamTimeout},
+		{"stream keeps caller deadline", func() error { return streamOne(withTimeout(time.Minute), client, 1) }, time.Minute},
+	} {
+		if err := tc.call(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := srv.lastRemaining(); got <= tc.max-time.Second || got > tc.max {
+			t.Errorf("%s: handler deadline in %v, want about %v", tc.name, got, tc.max)
+		}
+	}
+}
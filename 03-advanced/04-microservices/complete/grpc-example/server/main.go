@@ -2,173 +2,185 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net"
+	"net/mail"
+	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
-)
 
-// User represents a user entity
-type User struct {
-	ID        int32
-	Name      string
-	Email     string
-	CreatedAt string
-}
+	"grpc-example/interceptors"
+	pb "grpc-example/proto"
+)
 
-// UserServiceServer implements the gRPC UserService
+// UserServiceServer implements pb.UserServiceServer (generated from proto/user.proto)
 type UserServiceServer struct {
-	mu    sync.RWMutex
-	users map[int32]*User
+	pb.UnimplementedUserServiceServer
+
+	mu     sync.RWMutex
+	users  map[int32]*pb.User
 	nextID int32
 }
 
 // NewUserServiceServer creates a new server
 func NewUserServiceServer() *UserServiceServer {
 	s := &UserServiceServer{
-		users:  make(map[int32]*User),
+		users:  make(map[int32]*pb.User),
 		nextID: 1,
 	}
 	// Add sample data
-	s.users[1] = &User{ID: 1, Name: "Alice", Email: "alice@example.com", CreatedAt: time.Now().Format(time.RFC3339)}
-	s.users[2] = &User{ID: 2, Name: "Bob", Email: "bob@example.com", CreatedAt: time.Now().Format(time.RFC3339)}
+	s.users[1] = &pb.User{Id: 1, Name: "Alice", Email: "alice@example.com", CreatedAt: time.Now().Format(time.RFC3339)}
+	s.users[2] = &pb.User{Id: 2, Name: "Bob", Email: "bob@example.com", CreatedAt: time.Now().Format(time.RFC3339)}
 	s.nextID = 3
 	return s
 }
 
 // GetUser returns a user by ID
-func (s *UserServiceServer) GetUser(ctx context.Context, req *GetUserRequest) (*UserProto, error) {
+func (s *UserServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	user, ok := s.users[req.Id]
+	user, ok := s.users[req.GetId()]
 	if !ok {
-		return nil, status.Errorf(codes.NotFound, "user not found: %d", req.Id)
+		return nil, status.Errorf(codes.NotFound, "user not found: %d", req.GetId())
 	}
-
-	return &UserProto{
-		Id:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-	}, nil
+	return user, nil
 }
 
-// ListUsers returns all users
-func (s *UserServiceServer) ListUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// ListUsers returns one page of users ordered by ID (page starts at 1, default limit 10, max 100)
+func (s *UserServiceServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users := s.sortedUsers()
+	page, limit := pageParams(req)
 
-	var users []*UserProto
-	for _, u := range s.users {
-		users = append(users, &UserProto{
-			Id:        u.ID,
-			Name:      u.Name,
-			Email:     u.Email,
-			CreatedAt: u.CreatedAt,
-		})
+	start := int((page - 1) * limit)
+	end := start + int(limit)
+	if start > len(users) {
+		start = len(users)
+	}
+	if end > len(users) {
+		end = len(users)
 	}
 
-	return &ListUsersResponse{
-		Users: users,
+	return &pb.ListUsersResponse{
+		Users: users[start:end],
 		Total: int32(len(users)),
 	}, nil
 }
 
 // CreateUser creates a new user
-func (s *UserServiceServer) CreateUser(ctx context.Context, req *CreateUserRequest) (*UserProto, error) {
+func (s *UserServiceServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	if req.GetName() == "" || req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name and email are required")
+	}
+	if _, err := mail.ParseAddress(req.GetEmail()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid email: %s", req.GetEmail())
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	user := &User{
-		ID:        s.nextID,
-		Name:      req.Name,
-		Email:     req.Email,
+	for _, u := range s.users {
+		if u.Email == req.GetEmail() {
+			return nil, status.Errorf(codes.AlreadyExists, "email already exists: %s", req.GetEmail())
+		}
+	}
+
+	user := &pb.User{
+		Id:        s.nextID,
+		Name:      req.GetName(),
+		Email:     req.GetEmail(),
 		CreatedAt: time.Now().Format(time.RFC3339),
 	}
-	s.users[user.ID] = user
+	s.users[user.Id] = user
 	s.nextID++
-
-	return &UserProto{
-		Id:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-	}, nil
+	return user, nil
 }
 
-// StreamUsers streams users one by one (server streaming)
-func (s *UserServiceServer) StreamUsers(req *ListUsersRequest, stream UserService_StreamUsersServer) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for _, u := range s.users {
-		if err := stream.Send(&UserProto{
-			Id:        u.ID,
-			Name:      u.Name,
-			Email:     u.Email,
-			CreatedAt: u.CreatedAt,
-		}); err != nil {
+// StreamUsers streams users one by one (server streaming), stops when the client goes away
+func (s *UserServiceServer) StreamUsers(req *pb.ListUsersRequest, stream pb.UserService_StreamUsersServer) error {
+	for _, u := range s.sortedUsers() {
+		if err := stream.Send(u); err != nil {
 			return err
 		}
-		time.Sleep(100 * time.Millisecond) // Simulate streaming delay
-	}
 
+		// Simulate streaming delay
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
 	return nil
 }
 
-// Proto message types (normally generated by protoc)
-type UserProto struct {
-	Id        int32
-	Name      string
-	Email     string
-	CreatedAt string
-}
-
-type GetUserRequest struct {
-	Id int32
-}
-
-type ListUsersRequest struct {
-	Page  int32
-	Limit int32
-}
-
-type ListUsersResponse struct {
-	Users []*UserProto
-	Total int32
-}
+// sortedUsers snapshot of all users ordered by ID (handlers never hold the lock while sending)
+func (s *UserServiceServer) sortedUsers() []*pb.User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-type CreateUserRequest struct {
-	Name  string
-	Email string
+	users := make([]*pb.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users
 }
 
-type UserService_StreamUsersServer interface {
-	Send(*UserProto) error
-	grpc.ServerStream
+func pageParams(req *pb.ListUsersRequest) (page, limit int32) {
+	page, limit = req.GetPage(), req.GetLimit()
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return page, limit
 }
 
 func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "50051"
+	}
+
+	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	// Note: In real code, you would register the generated service:
-	// pb.RegisterUserServiceServer(grpcServer, NewUserServiceServer())
-
-	fmt.Println("🚀 gRPC Server running on :50051")
-	fmt.Println("")
-	fmt.Println("This is a simplified example.")
-	fmt.Println("For full gRPC, run: protoc --go_out=. --go-grpc_out=. proto/user.proto")
-
+	// recovery → logging → deadline (5s for unary calls, 1m for streams without a deadline)
+	grpcServer := grpc.NewServer(interceptors.ServerOptions(5*time.Second, time.Minute)...)
+	pb.RegisterUserServiceServer(grpcServer, NewUserServiceServer())
+
+	// Standard gRPC health protocol (grpc_health_probe, load balancers)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("user.UserService", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	// Reflection lets grpcurl / Postman discover services without the .proto file
+	reflection.Register(grpcServer)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		log.Println("🛑 Shutting down gRPC server...")
+		healthServer.Shutdown() // report NOT_SERVING so clients stop sending new calls
+		grpcServer.GracefulStop()
+	}()
+
+	log.Printf("🚀 gRPC UserService running on :%s", port)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
@@ -0,0 +1,5 @@
+module shared
+
+go 1.24.4
+
+require github.com/gofiber/fiber/v2 v2.52.8
@@ -0,0 +1,189 @@
+// Package identity ตรวจและสร้าง identity ที่ gateway ส่งต่อให้ services พร้อมลายเซ็น HMAC
+// ใช้ร่วมกันทุก service (แทนการ copy identity.go ไว้ในแต่ละ service)
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// gateway ตรวจ JWT / API key ที่ edge แล้วส่ง identity มาใน headers พร้อมลายเซ็น HMAC
+// service เชื่อเฉพาะ headers ที่ลายเซ็นถูกต้อง จึงเรียก service ตรง ๆ ด้วย X-User-ID ปลอมไม่ได้
+const (
+	HeaderUserID            = "X-User-ID"
+	HeaderUserRoles         = "X-User-Roles"
+	HeaderIdentityTimestamp = "X-Identity-Timestamp"
+	HeaderIdentitySignature = "X-Identity-Signature"
+)
+
+// identityHeaders ทุก header ของ identity (ลบทิ้งก่อนลงลายเซ็นใหม่ กัน client ส่งมาเอง)
+var identityHeaders = []string{HeaderUserID, HeaderUserRoles, HeaderIdentityTimestamp, HeaderIdentitySignature}
+
+// MethodGRPC ใช้แทน HTTP method ตอนลงลายเซ็น gRPC (uri = full method name)
+const MethodGRPC = "GRPC"
+
+// MaxAge ลายเซ็นเก่ากว่านี้ใช้ไม่ได้ (จำกัดเวลาที่เอา headers ที่ดักได้มาใช้ซ้ำ)
+const MaxAge = 60 * time.Second
+
+// RoleService role ของ service ที่เรียกกันเอง (เช่น webhook ของ events) ผู้ใช้ทั่วไปไม่มี role นี้
+const RoleService = "service"
+
+// devInternalSecret ใช้เฉพาะตอน dev ที่ไม่ได้ตั้ง INTERNAL_AUTH_SECRET (gateway และ services อ่านจากที่เดียวกันนี้)
+const devInternalSecret = "dev-internal-secret-change-me"
+
+// Identity ผู้เรียกที่ gateway รับรองมา
+type Identity struct {
+	UserID string
+	Roles  []string
+}
+
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrMissing          = errors.New("missing identity, call this service through the API gateway")
+	ErrExpired          = errors.New("identity has expired")
+	ErrInvalidSignature = errors.New("invalid identity signature")
+)
+
+var (
+	secretOnce     sync.Once
+	internalSecret []byte
+)
+
+// Init อ่าน INTERNAL_AUTH_SECRET ทันที (เตือนตอน start แทนที่จะเป็นตอน request แรก)
+func Init() {
+	secret()
+}
+
+// secret INTERNAL_AUTH_SECRET ที่ใช้ร่วมกับ gateway (อ่านครั้งเดียว)
+func secret() []byte {
+	secretOnce.Do(func() {
+		secret := os.Getenv("INTERNAL_AUTH_SECRET")
+		if secret == "" {
+			log.Println("⚠️ INTERNAL_AUTH_SECRET not set, using development secret")
+			secret = devInternalSecret
+		}
+		internalSecret = []byte(secret)
+	})
+	return internalSecret
+}
+
+// Verify ตรวจลายเซ็นที่ gateway สร้างจาก method, uri, user, roles และเวลา
+// HTTP ใช้ method + path จริง ส่วน gRPC ใช้ MethodGRPC + full method name
+//
+// ลายเซ็นไม่ครอบคลุม body (gateway stream body ต่อโดยไม่อ่านทั้งก้อน จึงคำนวณ hash ไม่ได้)
+// มันรับรองว่า "ใคร" เรียก method + URI นี้ ภายใน MaxAge เท่านั้น ใครดัก headers ได้
+// จึงส่ง request ซ้ำไปที่ method + URI เดิมด้วย body อื่นได้จนกว่าจะหมดอายุ (ใช้ TLS ระหว่าง gateway กับ services)
+func Verify(method, uri, userID, roles, timestamp, signature string) (Identity, error) {
+	if userID == "" || timestamp == "" || signature == "" {
+		return Identity{}, ErrMissing
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)).Abs() > MaxAge {
+		return Identity{}, ErrExpired
+	}
+
+	expected := Sign(method, uri, userID, roles, timestamp)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return Identity{}, ErrInvalidSignature
+	}
+
+	identity := Identity{UserID: userID}
+	if roles != "" {
+		identity.Roles = strings.Split(roles, ",")
+	}
+	return identity, nil
+}
+
+// Sign HMAC-SHA256 ของ method, uri, user, roles และเวลา ด้วย INTERNAL_AUTH_SECRET
+func Sign(method, uri, userID, roles, timestamp string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(strings.Join([]string{method, uri, userID, roles, timestamp}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ForService identity ของ service ชื่อ name ตอนเรียก service อื่นตรง ๆ (ไม่ผ่าน gateway)
+func ForService(name string) Identity {
+	return Identity{UserID: name, Roles: []string{RoleService}}
+}
+
+// signedHeaders identity headers พร้อมลายเซ็นของ method + uri ณ ตอนนี้
+func signedHeaders(method, uri string, identity Identity) map[string]string {
+	roles := strings.Join(identity.Roles, ",")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return map[string]string{
+		HeaderUserID:            identity.UserID,
+		HeaderUserRoles:         roles,
+		HeaderIdentityTimestamp: timestamp,
+		HeaderIdentitySignature: Sign(method, uri, identity.UserID, roles, timestamp),
+	}
+}
+
+// StripHeaders ลบ identity headers ทั้งหมด (เช่น ที่ client ส่งมาเองก่อนถึง gateway)
+func StripHeaders(header http.Header) {
+	for _, name := range identityHeaders {
+		header.Del(name)
+	}
+}
+
+// SignRequest ลงลายเซ็น identity ให้ request ที่ส่งหา service อื่น (แทนที่ identity headers เดิม)
+func SignRequest(req *http.Request, identity Identity) {
+	StripHeaders(req.Header)
+	for name, value := range signedHeaders(req.Method, req.URL.RequestURI(), identity) {
+		req.Header.Set(name, value)
+	}
+}
+
+// SignGRPC คู่ key/value ของ gRPC metadata (ตัวพิมพ์เล็ก) ที่ลงลายเซ็นด้วย MethodGRPC + fullMethod
+// ใช้กับ metadata.AppendToOutgoingContext(ctx, identity.SignGRPC(method, caller)...)
+func SignGRPC(fullMethod string, identity Identity) []string {
+	headers := signedHeaders(MethodGRPC, fullMethod, identity)
+	pairs := make([]string, 0, 2*len(identityHeaders))
+	for _, name := range identityHeaders {
+		pairs = append(pairs, strings.ToLower(name), headers[name])
+	}
+	return pairs
+}
+
+// Require middleware ตรวจลายเซ็นของ identity headers แล้วเก็บ Identity ไว้ใน c.Locals("identity")
+func Require() fiber.Handler {
+	secret()
+
+	return func(c *fiber.Ctx) error {
+		identity, err := Verify(c.Method(), c.OriginalURL(),
+			c.Get(HeaderUserID), c.Get(HeaderUserRoles), c.Get(HeaderIdentityTimestamp), c.Get(HeaderIdentitySignature))
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		c.Locals("identity", identity)
+		return c.Next()
+	}
+}
+
+// Current identity ของ request ปัจจุบัน (หลัง Require)
+func Current(c *fiber.Ctx) Identity {
+	identity, _ := c.Locals("identity").(Identity)
+	return identity
+}
@@ -0,0 +1,133 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestVerify(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-2*MaxAge).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(2*MaxAge).Unix(), 10)
+	valid := Sign("GET", "/todos/1", "42", "user", now)
+
+	for _, tc := range []struct {
+		name                              string
+		method, uri, user, roles, ts, sig string
+		want                              error
+	}{
+		{"valid", "GET", "/todos/1", "42", "user", now, valid, nil},
+		{"missing headers", "GET", "/todos/1", "", "", "", "", ErrMissing},
+		{"missing signature", "GET", "/todos/1", "42", "user", now, "", ErrMissing},
+		{"expired", "GET", "/todos/1", "42", "user", old, Sign("GET", "/todos/1", "42", "user", old), ErrExpired},
+		{"from the future", "GET", "/todos/1", "42", "user", future, Sign("GET", "/todos/1", "42", "user", future), ErrExpired},
+		{"bad timestamp", "GET", "/todos/1", "42", "user", "yesterday", valid, ErrExpired},
+		{"tampered user", "GET", "/todos/1", "1", "user", now, valid, ErrInvalidSignature},
+		{"escalated roles", "GET", "/todos/1", "42", "user,admin", now, valid, ErrInvalidSignature},
+		{"replayed to another URI", "GET", "/todos/2", "42", "user", now, valid, ErrInvalidSignature},
+		{"replayed with another method", "DELETE", "/todos/1", "42", "user", now, valid, ErrInvalidSignature},
+	} {
+		identity, err := Verify(tc.method, tc.uri, tc.user, tc.roles, tc.ts, tc.sig)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want == nil && (identity.UserID != "42" || !identity.HasRole("user") || identity.HasRole("admin")) {
+			t.Errorf("%s: identity = %+v", tc.name, identity)
+		}
+	}
+}
+
+func TestSignRequestRoundTrip(t *testing.T) {
+	app := fiber.New()
+	app.Post("/events", Require(), func(c *fiber.Ctx) error {
+		if !Current(c).HasRole(RoleService) {
+			return c.SendStatus(403)
+		}
+		return c.SendString(Current(c).UserID)
+	})
+
+	signed := httptest.NewRequest(http.MethodPost, "/events?source=test", nil)
+	SignRequest(signed, ForService("user-service"))
+	forged := httptest.NewRequest(http.MethodPost, "/events", nil)
+	forged.Header.Set(HeaderUserID, "user-service")
+	forged.Header.Set(HeaderUserRoles, RoleService)
+
+	for _, tc := range []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"signed by a service", signed, 200},
+		{"unsigned headers", forged, 401},
+	} {
+		resp, err := app.Test(tc.req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestSignGRPC(t *testing.T) {
+	pairs := SignGRPC("/user.UserService/GetUser", Identity{UserID: "42", Roles: []string{"user", "admin"}})
+	if len(pairs) != 8 {
+		t.Fatalf("pairs = %q, want 4 key/value pairs", pairs)
+	}
+	md := map[string]string{}
+	for i := 0; i < len(pairs); i += 2 {
+		md[pairs[i]] = pairs[i+1]
+	}
+	get := func(name string) string { return md[strings.ToLower(name)] }
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		fullMethod string
+		want       error
+	}{
+		{"same method", MethodGRPC, "/user.UserService/GetUser", nil},
+		{"another rpc", MethodGRPC, "/user.UserService/DeleteUser", ErrInvalidSignature},
+		{"as http request", http.MethodPost, "/user.UserService/GetUser", ErrInvalidSignature},
+	} {
+		identity, err := Verify(tc.method, tc.fullMethod, get(HeaderUserID), get(HeaderUserRoles),
+			get(HeaderIdentityTimestamp), get(HeaderIdentitySignature))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want == nil && (identity.UserID != "42" || !identity.HasRole("admin")) {
+			t.Errorf("%s: identity = %+v", tc.name, identity)
+		}
+	}
+}
+
+func TestSignRequestReplacesHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.Header.Set(HeaderUserRoles, "admin")
+	req.Header.Set(HeaderIdentitySignature, "forged")
+	SignRequest(req, Identity{UserID: "7"})
+
+	identity, err := Verify(req.Method, req.URL.RequestURI(), req.Header.Get(HeaderUserID), req.Header.Get(HeaderUserRoles),
+		req.Header.Get(HeaderIdentityTimestamp), req.Header.Get(HeaderIdentitySignature))
+	if err != nil || identity.UserID != "7" || len(identity.Roles) != 0 {
+		t.Errorf("identity = %+v, err = %v, want user 7 without roles", identity, err)
+	}
+
+	StripHeaders(req.Header)
+	for _, name := range identityHeaders {
+		if req.Header.Get(name) != "" {
+			t.Errorf("%s not stripped", name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package registration ลงทะเบียน instance ของ service กับ registry ของ gateway และส่ง heartbeat
+// ใช้ร่วมกันทุก service (แทนการ copy registration.go ไว้ในแต่ละ service)
+package registration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// heartbeatInterval ต้องสั้นกว่า TTL ของ registry (30 วินาที) หลายเท่า
+const heartbeatInterval = 10 * time.Second
+
+// Registration ลงทะเบียน instance นี้กับ registry ของ gateway และส่ง heartbeat
+// ถ้า registry ยังไม่พร้อมหรือลืม instance นี้ไปแล้ว (404) จะลงทะเบียนใหม่ในรอบถัดไป
+type Registration struct {
+	registryURL string // เช่น http://localhost:3000/registry
+	service     string
+	url         string // URL ที่ gateway ใช้เรียก instance นี้
+	token       string
+	client      *http.Client
+
+	mu   sync.Mutex
+	id   string
+	stop chan struct{}
+}
+
+// Start เริ่มลงทะเบียนถ้าตั้ง REGISTRY_URL ไว้ (ไม่ตั้ง = gateway ใช้ static config และคืน nil)
+func Start(service, serviceURL string) *Registration {
+	registryURL := os.Getenv("REGISTRY_URL")
+	if registryURL == "" {
+		return nil
+	}
+
+	r := &Registration{
+		registryURL: registryURL,
+		service:     service,
+		url:         serviceURL,
+		token:       os.Getenv("REGISTRY_TOKEN"),
+		client:      &http.Client{Timeout: 5 * time.Second},
+		stop:        make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Registration) run() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		r.heartbeat()
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// heartbeat ต่ออายุ หรือลงทะเบียนใหม่ถ้ายังไม่มี ID / registry ไม่รู้จักแล้ว
+func (r *Registration) heartbeat() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.id != "" {
+		status, err := r.call("PUT", "/services/"+r.service+"/instances/"+r.id+"/heartbeat", nil, nil)
+		if err == nil && status == http.StatusOK {
+			return
+		}
+		if status != http.StatusNotFound {
+			log.Printf("⚠️ Registry heartbeat failed: status=%d err=%v", status, err)
+			return
+		}
+		r.id = ""
+	}
+
+	var resp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	status, err := r.call("POST", "/services/"+r.service+"/instances", map[string]string{"url": r.url}, &resp)
+	if err != nil || status != http.StatusCreated {
+		log.Printf("⚠️ Registry registration failed (retry in %s): status=%d err=%v", heartbeatInterval, status, err)
+		return
+	}
+	r.id = resp.Data.ID
+	log.Printf("📒 Registered with %s as %s (%s)", r.registryURL, r.id, r.url)
+}
+
+// Stop หยุด heartbeat แล้วถอนตัวจาก registry (เรียกตอนปิด service)
+func (r *Registration) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.id == "" {
+		return
+	}
+	if status, err := r.call("DELETE", "/services/"+r.service+"/instances/"+r.id, nil, nil); err != nil || status != http.StatusOK {
+		log.Printf("⚠️ Registry deregistration failed: status=%d err=%v", status, err)
+		return
+	}
+	log.Printf("📕 Deregistered %s from registry", r.id)
+}
+
+func (r *Registration) call(method, path string, body, out interface{}) (int, error) {
+	var reqBody *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(data)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, r.registryURL+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("X-Registry-Token", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to parse registry response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
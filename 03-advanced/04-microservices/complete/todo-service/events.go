@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"shared/identity"
+)
+
+// ============ Events from user-service ============
+
+// user-service ส่ง events มาที่ POST /events (webhook) ด้วย identity role "service"
+// อาจได้ event เดิมซ้ำ (retry) จึงจำ ID ที่ประมวลผลแล้วไว้
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+const EventUserDeleted = "user.deleted"
+
+// orphanPolicy ทำอะไรกับ todos ของ user ที่ถูกลบ
+//
+//	ORPHAN_TODOS=delete (ค่าเริ่มต้น) ลบทิ้ง
+//	ORPHAN_TODOS=reassign            ย้ายไปให้ ORPHAN_TODOS_REASSIGN_TO (user ID)
+type orphanPolicy struct {
+	reassignTo int // 0 = ลบ
+}
+
+var orphans orphanPolicy
+
+func initOrphanPolicy() {
+	switch policy := os.Getenv("ORPHAN_TODOS"); policy {
+	case "", "delete":
+	case "reassign":
+		id, err := strconv.Atoi(os.Getenv("ORPHAN_TODOS_REASSIGN_TO"))
+		if err != nil || id <= 0 {
+			log.Fatal("❌ ORPHAN_TODOS=reassign requires ORPHAN_TODOS_REASSIGN_TO=<user id>")
+		}
+		orphans.reassignTo = id
+	default:
+		log.Fatalf("❌ unknown ORPHAN_TODOS %q (delete, reassign)", policy)
+	}
+}
+
+// processedEvents ID ของ events ล่าสุดที่ทำไปแล้ว (จำแค่ maxProcessedEvents ตัว)
+const maxProcessedEvents = 1000
+
+var processedEvents = struct {
+	sync.Mutex
+	seen  map[string]bool
+	order []string
+}{seen: make(map[string]bool)}
+
+// markProcessed false = เคยทำ event นี้แล้ว
+func markProcessed(id string) bool {
+	processedEvents.Lock()
+	defer processedEvents.Unlock()
+	if processedEvents.seen[id] {
+		return false
+	}
+	processedEvents.seen[id] = true
+	processedEvents.order = append(processedEvents.order, id)
+	if len(processedEvents.order) > maxProcessedEvents {
+		delete(processedEvents.seen, processedEvents.order[0])
+		processedEvents.order = processedEvents.order[1:]
+	}
+	return true
+}
+
+func eventsHandler(c *fiber.Ctx) error {
+	if !identity.Current(c).HasRole(identity.RoleService) {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"error":   "Events can only be sent by services",
+		})
+	}
+
+	var event Event
+	if err := c.BodyParser(&event); err != nil || event.ID == "" || event.Type == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid event",
+		})
+	}
+
+	switch event.Type {
+	case EventUserDeleted:
+		var data struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err != nil || data.UserID == 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid user.deleted event",
+			})
+		}
+		if !markProcessed(event.ID) {
+			return c.JSON(fiber.Map{"success": true, "duplicate": true})
+		}
+		handleUserDeleted(data.UserID)
+	default:
+		// event ที่ยังไม่รู้จัก = ตอบรับไว้เฉย ๆ (publisher เพิ่ม event ใหม่ได้โดยไม่ทำให้ที่นี่พัง)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// handleUserDeleted ลบ/ย้าย todos ของ user ที่ถูกลบ
+// MarkDeleted ก่อนถือ todosMu: create ที่ผ่าน Exists ไปแล้วจะเห็นตอนตรวจซ้ำ หรือถ้าเพิ่ม todo ไปก่อนก็โดนลบในรอบนี้
+func handleUserDeleted(userID int) {
+	users.MarkDeleted(userID)
+
+	todosMu.Lock()
+	defer todosMu.Unlock()
+
+	affected := 0
+	kept := todos[:0]
+	for _, todo := range todos {
+		if todo.UserID != userID {
+			kept = append(kept, todo)
+			continue
+		}
+		affected++
+		if orphans.reassignTo != 0 {
+			todo.UserID = orphans.reassignTo
+			todo.UpdatedAt = time.Now()
+			kept = append(kept, todo)
+		}
+	}
+	todos = kept
+
+	if orphans.reassignTo != 0 {
+		log.Printf("🔁 User %d deleted, reassigned %d todos to user %d", userID, affected, orphans.reassignTo)
+	} else {
+		log.Printf("🗑️ User %d deleted, removed %d todos", userID, affected)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"shared/identity"
+)
+
+func todosOf(userID int) int {
+	todosMu.RLock()
+	defer todosMu.RUnlock()
+	count := 0
+	for _, todo := range todos {
+		if todo.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+func TestUserDeletedEvent(t *testing.T) {
+	app := newTodoApp(t)
+	useTestUsers(t, func(w http.ResponseWriter, r *http.Request) {})
+	service := identity.ForService("user-service")
+	admin := identity.Identity{UserID: "99", Roles: []string{"admin"}}
+	// ID ใหม่ทุกครั้ง (processedEvents จำข้าม test)
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	event := `{"id": "` + id + `", "type": "user.deleted", "data": {"user_id": 1}}`
+
+	for _, tc := range []struct {
+		name   string
+		caller identity.Identity
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"create before delete", admin, "POST", "/todos", `{"title": "Soon orphaned", "user_id": 1}`, 201},
+		{"event from a user", admin, "POST", "/events", event, 403},
+		{"invalid event", service, "POST", "/events", `{"type": "user.deleted"}`, 400},
+		{"user deleted", service, "POST", "/events", event, 200},
+		{"duplicate event", service, "POST", "/events", event, 200},
+		{"create after delete", admin, "POST", "/todos", `{"title": "Too late", "user_id": 1}`, 400},
+		{"unknown event accepted", service, "POST", "/events", `{"id": "renamed-` + id + `", "type": "user.renamed"}`, 200},
+	} {
+		if status, body := callAs(t, app, tc.caller, tc.method, tc.path, tc.body); status != tc.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tc.name, status, tc.status, body)
+		}
+	}
+
+	// todos ของ user 1 (ทั้งจาก fixtures และที่สร้างก่อนลบ) ถูกลบหมด ของ user 2 ยังอยู่
+	if n := todosOf(1); n != 0 {
+		t.Errorf("user 1 still has %d todos", n)
+	}
+	if n := todosOf(2); n != 2 {
+		t.Errorf("user 2 has %d todos, want 2", n)
+	}
+}
+
+func TestCreateTodoRacingUserDeleted(t *testing.T) {
+	app := newTodoApp(t)
+	checked := make(chan struct{})
+	useTestUsers(t, func(w http.ResponseWriter, r *http.Request) {
+		close(checked) // user-service ตอบว่ามี user 5
+	})
+
+	// ถือ todosMu ไว้ให้ create ผ่าน Exists แล้วไปรอ lock จากนั้น user.deleted มาถึง
+	todosMu.Lock()
+	result := make(chan int)
+	go func() {
+		req := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"title": "Orphan", "user_id": 5}`))
+		req.Header.Set("Content-Type", "application/json")
+		identity.SignRequest(req, identity.Identity{UserID: "99", Roles: []string{"admin"}})
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			result <- 0
+			return
+		}
+		resp.Body.Close()
+		result <- resp.StatusCode
+	}()
+	<-checked
+	time.Sleep(50 * time.Millisecond)
+
+	// handleUserDeleted ทำ MarkDeleted ก่อนรอ todosMu ใครได้ lock ก่อนก็ต้องไม่เหลือ todo ของ user 5
+	users.MarkDeleted(5)
+	deleted := make(chan struct{})
+	go func() {
+		handleUserDeleted(5)
+		close(deleted)
+	}()
+	todosMu.Unlock()
+	<-deleted
+
+	if status := <-result; status != 400 {
+		t.Errorf("status = %d, want 400", status)
+	}
+	if n := todosOf(5); n != 0 {
+		t.Errorf("user 5 has %d todos after user.deleted", n)
+	}
+}
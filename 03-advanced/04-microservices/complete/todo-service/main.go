@@ -1,12 +1,22 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"shared/identity"
+	"shared/registration"
 )
 
 // Todo struct
@@ -20,11 +30,22 @@ type Todo struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// In-memory storage
+// In-memory storage (handlers และ events แก้พร้อมกันได้ ต้องถือ todosMu)
 var todos []Todo
 var todoID = 1
+var todosMu sync.RWMutex
 
 func main() {
+	// PORT / SERVICE_URL ทำให้รันหลาย instances ได้ (gateway กระจาย load ให้ผ่าน registry)
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3002"
+	}
+	serviceURL := os.Getenv("SERVICE_URL")
+	if serviceURL == "" {
+		serviceURL = "http://localhost:" + port
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(500).JSON(fiber.Map{
@@ -34,18 +55,26 @@ func main() {
 		},
 	})
 
-	app.Use(logger.New())
+	// X-Request-ID มาจาก gateway (หรือสร้างใหม่ถ้าเรียกตรง) ใช้ไล่ log ข้าม services
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${locals:requestid} | ${method} ${path}\n",
+	}))
 
 	// Initialize sample data
 	initSampleData()
 
+	// ตรวจ user_id กับ user-service (ดู users.go) และนโยบายเมื่อ user ถูกลบ (ดู events.go)
+	initUserDirectory()
+	initOrphanPolicy()
+
 	// Health check endpoint
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"service": "todo-service",
 			"status":  "healthy",
-			"port":    3002,
-			"todos":   len(todos),
+			"port":    port,
+			"todos":   countTodos(),
 		})
 	})
 
@@ -55,65 +84,87 @@ func main() {
 			"service":     "Todo Service",
 			"version":     "1.0.0",
 			"status":      "running",
-			"total_todos": len(todos),
+			"total_todos": countTodos(),
 		})
 	})
 
-	// API endpoints
-	app.Post("/todos", createTodoHandler)
-	app.Get("/todos/:id", getTodoHandler)
-	app.Get("/todos", getAllTodosHandler)
-	app.Put("/todos/:id", updateTodoHandler)
-	app.Delete("/todos/:id", deleteTodoHandler)
+	// API endpoints (ต้องมี identity ที่ gateway ลงลายเซ็นไว้ ดู shared/identity)
+	auth := identity.Require()
+	app.Post("/todos", auth, createTodoHandler)
+	app.Get("/todos/:id", auth, getTodoHandler)
+	app.Get("/todos", auth, getAllTodosHandler)
+	app.Put("/todos/:id", auth, updateTodoHandler)
+	app.Delete("/todos/:id", auth, deleteTodoHandler)
+
+	// Webhook ของ events จาก user-service (service-to-service เท่านั้น)
+	app.Post("/events", auth, eventsHandler)
+
+	// ลงทะเบียนกับ gateway (ถ้าตั้ง REGISTRY_URL) และถอนตัวก่อนปิด
+	reg := registration.Start("todo-service", serviceURL)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		reg.Stop()
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+	}()
 
-	log.Println("📝 Todo Service started on port 3002")
-	log.Fatal(app.Listen(":3002"))
+	log.Printf("📝 Todo Service started on port %s", port)
+	if err := app.Listen(":" + port); err != nil {
+		log.Fatal(err)
+	}
 }
 
+// ข้อมูลตัวอย่างอยู่ใน fixtures/todos.json (*_ago = เวลาย้อนหลังจากตอน start)
+//
+//go:embed fixtures/todos.json
+var sampleTodos []byte
+
 func initSampleData() {
+	var fixtures []struct {
+		Todo
+		CreatedAgo string `json:"created_ago"`
+		UpdatedAgo string `json:"updated_ago"`
+	}
+	if err := json.Unmarshal(sampleTodos, &fixtures); err != nil {
+		log.Fatalf("❌ Failed to load sample todos: %v", err)
+	}
+
 	now := time.Now()
-	todos = []Todo{
-		{
-			ID:          1,
-			Title:       "เรียน Go Fiber",
-			Description: "ศึกษา framework สำหรับสร้าง API",
-			Completed:   true,
-			UserID:      1,
-			CreatedAt:   now.Add(-48 * time.Hour),
-			UpdatedAt:   now.Add(-24 * time.Hour),
-		},
-		{
-			ID:          2,
-			Title:       "สร้าง Microservices",
-			Description: "พัฒนาระบบ microservices ด้วย Go",
-			Completed:   false,
-			UserID:      1,
-			CreatedAt:   now.Add(-24 * time.Hour),
-			UpdatedAt:   now.Add(-24 * time.Hour),
-		},
-		{
-			ID:          3,
-			Title:       "เขียน Documentation",
-			Description: "จัดทำเอกสารสำหรับ API",
-			Completed:   false,
-			UserID:      2,
-			CreatedAt:   now.Add(-12 * time.Hour),
-			UpdatedAt:   now.Add(-12 * time.Hour),
-		},
-		{
-			ID:          4,
-			Title:       "ทดสอบ API Gateway",
-			Description: "ทดสอบการทำงานของ API Gateway",
-			Completed:   true,
-			UserID:      2,
-			CreatedAt:   now.Add(-6 * time.Hour),
-			UpdatedAt:   now.Add(-1 * time.Hour),
-		},
+	todos = todos[:0]
+	todoID = 1
+	for _, f := range fixtures {
+		todo := f.Todo
+		todo.CreatedAt = now.Add(-mustParseAgo(f.CreatedAgo))
+		todo.UpdatedAt = now.Add(-mustParseAgo(f.UpdatedAgo))
+		todos = append(todos, todo)
+		if todo.ID >= todoID {
+			todoID = todo.ID + 1
+		}
 	}
-	todoID = 5
 	log.Println("✅ Sample todos loaded")
 }
 
+// mustParseAgo แปลง duration ใน fixture ("24h") ค่าว่าง = ตอนนี้
+func mustParseAgo(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("❌ Invalid duration %q in fixtures: %v", s, err)
+	}
+	return d
+}
+
+func countTodos() int {
+	todosMu.RLock()
+	defer todosMu.RUnlock()
+	return len(todos)
+}
+
 func createTodoHandler(c *fiber.Ctx) error {
 	type CreateTodoRequest struct {
 		Title       string `json:"title"`
@@ -136,13 +187,51 @@ func createTodoHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	// ไม่ระบุ user_id = สร้างให้ตัวเอง, สร้างให้คนอื่นได้เฉพาะ admin
+	caller := identity.Current(c)
+	callerID, _ := strconv.Atoi(caller.UserID)
+	if req.UserID == 0 {
+		req.UserID = callerID
+	}
 	if req.UserID == 0 {
 		return c.Status(400).JSON(fiber.Map{
 			"success": false,
 			"error":   "User ID is required",
 		})
 	}
+	if req.UserID != callerID && !caller.HasRole("admin") {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"error":   "Only admins can create todos for other users",
+		})
+	}
 
+	// user ต้องมีอยู่จริงใน user-service (ตอบไม่ได้ = 503 ดีกว่าสร้าง todo ที่อาจไม่มีเจ้าของ)
+	requestID, _ := c.Locals("requestid").(string)
+	exists, err := users.Exists(c.UserContext(), requestID, req.UserID)
+	if err != nil {
+		log.Printf("⚠️ Cannot verify user %d: %v", req.UserID, err)
+		return c.Status(503).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot verify user, user-service is unavailable",
+		})
+	}
+	if !exists {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found: " + strconv.Itoa(req.UserID),
+		})
+	}
+
+	todosMu.Lock()
+	// ตรวจซ้ำตอนถือ lock: user.deleted อาจมาถึงหลัง Exists (ดู handleUserDeleted)
+	if users.Deleted(req.UserID) {
+		todosMu.Unlock()
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found: " + strconv.Itoa(req.UserID),
+		})
+	}
 	todo := Todo{
 		ID:          todoID,
 		Title:       req.Title,
@@ -155,6 +244,7 @@ func createTodoHandler(c *fiber.Ctx) error {
 
 	todos = append(todos, todo)
 	todoID++
+	todosMu.Unlock()
 
 	log.Printf("📝 Created todo: %s for user %d", todo.Title, todo.UserID)
 
@@ -165,11 +255,28 @@ func createTodoHandler(c *fiber.Ctx) error {
 	})
 }
 
+// canAccess อ่าน แก้ หรือลบ todo ได้เฉพาะเจ้าของและ admin
+func canAccess(caller identity.Identity, todo Todo) bool {
+	return caller.UserID == strconv.Itoa(todo.UserID) || caller.HasRole("admin")
+}
+
+func forbiddenTodo(c *fiber.Ctx) error {
+	return c.Status(403).JSON(fiber.Map{
+		"success": false,
+		"error":   "You can only access your own todos",
+	})
+}
+
 func getTodoHandler(c *fiber.Ctx) error {
 	id := c.Params("id")
 
+	todosMu.RLock()
+	defer todosMu.RUnlock()
 	for _, todo := range todos {
 		if strconv.Itoa(todo.ID) == id {
+			if !canAccess(identity.Current(c), todo) {
+				return forbiddenTodo(c)
+			}
 			return c.JSON(fiber.Map{
 				"success": true,
 				"data":    todo,
@@ -184,9 +291,15 @@ func getTodoHandler(c *fiber.Ctx) error {
 }
 
 func getAllTodosHandler(c *fiber.Ctx) error {
-	// Support filtering by user
+	// user ทั่วไปเห็นเฉพาะ todos ของตัวเอง admin ดูทั้งหมดหรือกรองด้วย ?user_id= ได้
 	userIDStr := c.Query("user_id")
 	completed := c.Query("completed")
+	if caller := identity.Current(c); !caller.HasRole("admin") {
+		if userIDStr != "" && userIDStr != caller.UserID {
+			return forbiddenTodo(c)
+		}
+		userIDStr = caller.UserID
+	}
 
 	// Support pagination
 	page := c.QueryInt("page", 1)
@@ -201,13 +314,11 @@ func getAllTodosHandler(c *fiber.Ctx) error {
 
 	// Filter todos
 	var filteredTodos []Todo
+	todosMu.RLock()
 	for _, todo := range todos {
 		// Filter by user_id
-		if userIDStr != "" {
-			userID, err := strconv.Atoi(userIDStr)
-			if err == nil && todo.UserID != userID {
-				continue
-			}
+		if userIDStr != "" && strconv.Itoa(todo.UserID) != userIDStr {
+			continue
 		}
 
 		// Filter by completed status
@@ -222,6 +333,7 @@ func getAllTodosHandler(c *fiber.Ctx) error {
 
 		filteredTodos = append(filteredTodos, todo)
 	}
+	todosMu.RUnlock()
 
 	// Apply pagination
 	start := (page - 1) * limit
@@ -268,8 +380,13 @@ func updateTodoHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	todosMu.Lock()
+	defer todosMu.Unlock()
 	for i, todo := range todos {
 		if strconv.Itoa(todo.ID) == id {
+			if !canAccess(identity.Current(c), todo) {
+				return forbiddenTodo(c)
+			}
 			// Update fields if provided
 			if req.Title != nil {
 				todos[i].Title = *req.Title
@@ -301,8 +418,13 @@ func updateTodoHandler(c *fiber.Ctx) error {
 func deleteTodoHandler(c *fiber.Ctx) error {
 	id := c.Params("id")
 
+	todosMu.Lock()
+	defer todosMu.Unlock()
 	for i, todo := range todos {
 		if strconv.Itoa(todo.ID) == id {
+			if !canAccess(identity.Current(c), todo) {
+				return forbiddenTodo(c)
+			}
 			// Remove todo from slice
 			todos = append(todos[:i], todos[i+1:]...)
 
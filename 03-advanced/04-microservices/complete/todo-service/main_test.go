@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"shared/identity"
+)
+
+// newTodoApp routes เดียวกับ main พร้อมข้อมูลตัวอย่าง (POST /todos ต้องตั้ง users ก่อน ดู useTestUsers)
+// todos 1, 2 เป็นของ user 1 และ 3, 4 เป็นของ user 2
+func newTodoApp(t *testing.T) *fiber.App {
+	t.Helper()
+	initSampleData()
+
+	app := fiber.New()
+	auth := identity.Require()
+	app.Post("/todos", auth, createTodoHandler)
+	app.Get("/todos/:id", auth, getTodoHandler)
+	app.Get("/todos", auth, getAllTodosHandler)
+	app.Put("/todos/:id", auth, updateTodoHandler)
+	app.Delete("/todos/:id", auth, deleteTodoHandler)
+	app.Post("/events", auth, eventsHandler)
+	return app
+}
+
+func callAs(t *testing.T, app *fiber.App, caller identity.Identity, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	identity.SignRequest(req, caller)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestTodoOwnership(t *testing.T) {
+	app := newTodoApp(t)
+	user1 := identity.Identity{UserID: "1", Roles: []string{"user"}}
+	admin := identity.Identity{UserID: "99", Roles: []string{"admin"}}
+
+	for _, tc := range []struct {
+		name   string
+		caller identity.Identity
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"owner reads", user1, "GET", "/todos/1", "", 200},
+		{"other user reads", user1, "GET", "/todos/3", "", 403},
+		{"admin reads", admin, "GET", "/todos/3", "", 200},
+		{"owner updates", user1, "PUT", "/todos/2", `{"completed": true}`, 200},
+		{"other user updates", user1, "PUT", "/todos/3", `{"title": "hijacked"}`, 403},
+		{"other user deletes", user1, "DELETE", "/todos/3", "", 403},
+		{"owner deletes", user1, "DELETE", "/todos/1", "", 200},
+		{"admin deletes", admin, "DELETE", "/todos/4", "", 200},
+		{"missing todo", admin, "GET", "/todos/42", "", 404},
+	} {
+		if status, body := callAs(t, app, tc.caller, tc.method, tc.path, tc.body); status != tc.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tc.name, status, tc.status, body)
+		}
+	}
+
+	if _, body := callAs(t, app, admin, "GET", "/todos/4", ""); body["success"] != false {
+		t.Error("todo 4 still exists after admin delete")
+	}
+	if _, body := callAs(t, app, admin, "GET", "/todos/3", ""); body["data"].(map[string]interface{})["title"] == "hijacked" {
+		t.Error("todo 3 was updated by another user")
+	}
+}
+
+func TestListTodosScopedToCaller(t *testing.T) {
+	app := newTodoApp(t)
+	user1 := identity.Identity{UserID: "1", Roles: []string{"user"}}
+	admin := identity.Identity{UserID: "99", Roles: []string{"admin"}}
+
+	for _, tc := range []struct {
+		name   string
+		caller identity.Identity
+		query  string
+		status int
+		total  float64
+	}{
+		{"user sees own todos", user1, "", 200, 2},
+		{"user filters by self", user1, "?user_id=1", 200, 2},
+		{"user cannot list others", user1, "?user_id=2", 403, 0},
+		{"admin sees all", admin, "", 200, 4},
+		{"admin filters by user", admin, "?user_id=2", 200, 2},
+		{"admin filters completed", admin, "?completed=true", 200, 2},
+	} {
+		status, body := callAs(t, app, tc.caller, "GET", "/todos"+tc.query, "")
+		if status != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, status, tc.status)
+			continue
+		}
+		if status != 200 {
+			continue
+		}
+		if total := body["pagination"].(map[string]interface{})["total"]; total != tc.total {
+			t.Errorf("%s: total = %v, want %v", tc.name, total, tc.total)
+		}
+	}
+}
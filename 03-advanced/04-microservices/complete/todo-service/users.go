@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"shared/identity"
+)
+
+// ============ User Directory ============
+
+// userDirectory ถาม user-service ว่ามี user นี้ไหม (ก่อนสร้าง todo ให้) พร้อม cache
+// ผลว่า "มี" เก็บนานกว่า "ไม่มี" (user ที่เพิ่งสร้างจะได้ใช้ได้เร็ว) แต่ไม่เกิน ttl เผื่อ user.deleted หายระหว่างทาง
+// เมื่อได้ user.deleted จะจำไว้ว่าถูกลบ (ไม่ให้ผล fetch ที่ค้างอยู่เขียน "มี" ทับ) จนหมด ttl
+type userDirectory struct {
+	baseURL     string
+	client      *http.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[int]userCacheEntry
+}
+
+type userCacheEntry struct {
+	exists  bool
+	deleted bool // ได้ user.deleted แล้ว
+	expires time.Time
+}
+
+var users *userDirectory
+
+// initUserDirectory USER_SERVICE_URL ค่าเริ่มต้น http://localhost:3001
+func initUserDirectory() {
+	baseURL := os.Getenv("USER_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3001"
+	}
+	users = &userDirectory{
+		baseURL:     baseURL,
+		client:      &http.Client{Timeout: 2 * time.Second},
+		ttl:         30 * time.Second,
+		negativeTTL: 10 * time.Second,
+		cache:       make(map[int]userCacheEntry),
+	}
+}
+
+// Exists error = ตอบไม่ได้ว่ามีหรือไม่ (user-service ล่ม) ไม่ใช่ "ไม่มี"
+func (d *userDirectory) Exists(ctx context.Context, requestID string, id int) (bool, error) {
+	d.mu.Lock()
+	entry, ok := d.cache[id]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.exists, nil
+	}
+
+	exists, err := d.fetch(ctx, requestID, id)
+	if err != nil {
+		return false, err
+	}
+
+	ttl := d.ttl
+	if !exists {
+		ttl = d.negativeTTL
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.deletedLocked(id) {
+		return false, nil // ถูกลบระหว่างรอคำตอบ
+	}
+	d.cache[id] = userCacheEntry{exists: exists, expires: time.Now().Add(ttl)}
+	return exists, nil
+}
+
+// MarkDeleted เมื่อได้ user.deleted: ตอบ "ไม่มี" ไปอีก ttl โดยไม่ถาม user-service
+func (d *userDirectory) MarkDeleted(id int) {
+	d.mu.Lock()
+	d.cache[id] = userCacheEntry{deleted: true, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+}
+
+// Deleted true = เพิ่งได้ user.deleted ของ user นี้ (ใช้ตรวจซ้ำตอนถือ todosMu ก่อนเพิ่ม todo)
+func (d *userDirectory) Deleted(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deletedLocked(id)
+}
+
+func (d *userDirectory) deletedLocked(id int) bool {
+	entry, ok := d.cache[id]
+	return ok && entry.deleted && time.Now().Before(entry.expires)
+}
+
+// fetch GET /users/:id ของ user-service ด้วย identity ของ todo-service เอง
+func (d *userDirectory) fetch(ctx context.Context, requestID string, id int) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/users/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return false, err
+	}
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	identity.SignRequest(req, identity.ForService("todo-service"))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("user-service returned status %d", resp.StatusCode)
+}
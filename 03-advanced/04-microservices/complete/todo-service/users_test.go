@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTestUsers แทน user-service ด้วย handler แล้วคืน users เดิมเมื่อจบ test
+func useTestUsers(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := users
+	users = &userDirectory{
+		baseURL:     server.URL,
+		client:      server.Client(),
+		ttl:         time.Minute,
+		negativeTTL: time.Minute,
+		cache:       make(map[int]userCacheEntry),
+	}
+	t.Cleanup(func() {
+		users = previous
+		server.Close()
+	})
+}
+
+func TestUserDirectory(t *testing.T) {
+	var calls atomic.Int32
+	useTestUsers(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/users/1", "/users/2":
+		case "/users/500":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		before func()
+		id     int
+		exists bool
+		err    bool
+		calls  int32 // จำนวนครั้งที่ถาม user-service สะสม
+	}{
+		{"exists", nil, 1, true, false, 1},
+		{"cached", nil, 1, true, false, 1},
+		{"not found", nil, 9, false, false, 2},
+		{"not found cached", nil, 9, false, false, 2},
+		{"user-service error", nil, 500, false, true, 3},
+		{"error not cached", nil, 500, false, true, 4},
+		{"deleted answers without asking", func() { users.MarkDeleted(1) }, 1, false, false, 4},
+		{"deleted before ever asked", func() { users.MarkDeleted(2) }, 2, false, false, 4},
+		{"expired entry asks again", func() { users.cache[9] = userCacheEntry{expires: time.Now().Add(-time.Second)} }, 9, false, false, 5},
+	} {
+		if tc.before != nil {
+			tc.before()
+		}
+		exists, err := users.Exists(context.Background(), "", tc.id)
+		if exists != tc.exists || (err != nil) != tc.err {
+			t.Errorf("%s: Exists(%d) = %v, %v, want %v (error %v)", tc.name, tc.id, exists, err, tc.exists, tc.err)
+		}
+		if got := calls.Load(); got != tc.calls {
+			t.Errorf("%s: user-service called %d times, want %d", tc.name, got, tc.calls)
+		}
+	}
+}
+
+func TestUserDirectoryDeletedWhileFetching(t *testing.T) {
+	// user.deleted มาถึงระหว่างรอคำตอบ "มี" จาก user-service = ต้องไม่ cache "มี" ทับ
+	useTestUsers(t, func(w http.ResponseWriter, r *http.Request) {
+		users.MarkDeleted(3)
+	})
+
+	if exists, err := users.Exists(context.Background(), "", 3); exists || err != nil {
+		t.Errorf("Exists = %v, %v, want false", exists, err)
+	}
+	if !users.Deleted(3) {
+		t.Error("user 3 no longer marked deleted")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"shared/identity"
+)
+
+// ============ Domain Events ============
+
+// services อื่นเก็บข้อมูลที่อ้างถึง user (เช่น todos ของ todo-service)
+// user-service จึงประกาศ event เมื่อ user หายไป แทนที่จะรู้จักและเรียกแต่ละ service เอง
+const EventUserDeleted = "user.deleted"
+
+// Event หน้าตาเดียวกันทุก transport, ID ใช้กันประมวลผลซ้ำเมื่อส่งซ้ำ
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Source     string      `json:"source"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+type UserDeleted struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func newEvent(eventType string, data interface{}) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{
+		ID:         hex.EncodeToString(id),
+		Type:       eventType,
+		Source:     "user-service",
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// EventPublisher transport ของ events เปลี่ยนได้ (เช่น NATS, Kafka) โดย handlers ไม่ต้องแก้
+type EventPublisher interface {
+	// Publish ไม่ block request ที่ทำให้เกิด event (ส่งจริงทีหลัง)
+	Publish(event Event)
+	// Close ส่ง events ที่ค้างอยู่ให้เสร็จ (เรียกตอนปิด service)
+	Close()
+}
+
+var publisher EventPublisher
+
+// initEvents เลือก transport จาก EVENT_TRANSPORT
+//
+//	webhook (ค่าเริ่มต้น) POST ไปทุก URL ใน EVENT_WEBHOOKS (คั่นด้วย ,) ค่าเริ่มต้น = todo-service
+//	log                  แค่เขียน log (รัน user-service เดี่ยว ๆ)
+func initEvents() {
+	switch transport := os.Getenv("EVENT_TRANSPORT"); transport {
+	case "", "webhook":
+		webhooks := os.Getenv("EVENT_WEBHOOKS")
+		if webhooks == "" {
+			webhooks = "http://localhost:3002/events"
+		}
+		publisher = newWebhookPublisher(strings.Split(webhooks, ","))
+	case "log":
+		publisher = logPublisher{}
+	default:
+		log.Fatalf("❌ unknown EVENT_TRANSPORT %q (webhook, log)", transport)
+	}
+}
+
+type logPublisher struct{}
+
+func (logPublisher) Publish(event Event) {
+	data, _ := json.Marshal(event)
+	log.Printf("📣 Event: %s", data)
+}
+
+func (logPublisher) Close() {}
+
+// ============ Webhook Transport ============
+
+const (
+	webhookQueueSize = 1000
+	webhookAttempts  = 5
+)
+
+// webhookPublisher ส่ง events ตามลำดับจาก goroutine เดียว ปลายทางล่ม = retry แบบ backoff
+// คิวอยู่ใน memory (at-least-once ระหว่างที่ service ยังรันอยู่ ปิดไปแล้ว events ที่ค้างหาย)
+// ปลายทางต้องทนการได้ event ซ้ำ (ดูจาก Event.ID)
+type webhookPublisher struct {
+	urls   []string
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newWebhookPublisher(urls []string) *webhookPublisher {
+	p := &webhookPublisher{
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan Event, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	for _, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			p.urls = append(p.urls, url)
+		}
+	}
+	log.Printf("📣 Publishing events to webhooks: %s", strings.Join(p.urls, ", "))
+	go p.run()
+	return p
+}
+
+func (p *webhookPublisher) Publish(event Event) {
+	select {
+	case p.queue <- event:
+	default:
+		log.Printf("⚠️ Event queue full, dropped %s %s", event.Type, event.ID)
+	}
+}
+
+// Close รอส่งที่ค้างอยู่ไม่เกิน 10 วินาที
+func (p *webhookPublisher) Close() {
+	p.once.Do(func() { close(p.queue) })
+	select {
+	case <-p.done:
+	case <-time.After(10 * time.Second):
+		log.Printf("⚠️ Gave up delivering %d pending events", len(p.queue))
+	}
+}
+
+func (p *webhookPublisher) run() {
+	defer close(p.done)
+	for event := range p.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("⚠️ Cannot encode event %s: %v", event.ID, err)
+			continue
+		}
+		for _, url := range p.urls {
+			p.deliver(url, event, body)
+		}
+	}
+}
+
+// deliver ลองส่งซ้ำ 1s, 2s, 4s, ... ปลายทางตอบ 4xx (ยกเว้น 429) = ไม่มีทางสำเร็จ เลิกทันที
+func (p *webhookPublisher) deliver(url string, event Event, body []byte) {
+	backoff := time.Second
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		status, err := p.post(url, event, body)
+		if err == nil && status < 300 {
+			log.Printf("📣 Delivered %s %s to %s", event.Type, event.ID, url)
+			return
+		}
+		if err == nil && status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+			log.Printf("⚠️ Webhook %s rejected %s %s: status=%d", url, event.Type, event.ID, status)
+			return
+		}
+		log.Printf("⚠️ Webhook %s failed (attempt %d/%d): status=%d err=%v", url, attempt, webhookAttempts, status, err)
+		if attempt < webhookAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	log.Printf("❌ Gave up delivering %s %s to %s", event.Type, event.ID, url)
+}
+
+// post ลงลายเซ็นใหม่ทุกครั้ง (ลายเซ็นมีอายุ 60 วินาที retry รอบหลังจะหมดอายุถ้าใช้ของเดิม)
+func (p *webhookPublisher) post(url string, event Event, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.ID)
+	req.Header.Set("X-Event-Type", event.Type)
+	identity.SignRequest(req, identity.ForService("user-service"))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
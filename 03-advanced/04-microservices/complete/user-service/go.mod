@@ -4,4 +4,31 @@ go 1.24.4
 
 require (
 	github.com/gofiber/fiber/v2 v2.52.8
-) 
\ No newline at end of file
+	google.golang.org/grpc v1.68.0
+	grpc-example v0.0.0
+	shared v0.0.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/rivo/uniseg v0.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.51.0 // indirect
+	github.com/valyala/tcplisten v1.0.0 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+)
+
+// proto และ interceptors ที่ใช้ร่วมกันอยู่ใน grpc-example, identity และ registration อยู่ใน shared
+replace (
+	grpc-example => ../grpc-example
+	shared => ../shared
+)
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"grpc-example/interceptors"
+	pb "grpc-example/proto"
+	"shared/identity"
+)
+
+// ============ gRPC Server ============
+
+// UserService เดียวกับ grpc-example/proto/user.proto แต่ใช้ข้อมูลชุดเดียวกับ HTTP API
+// gateway เรียกทางนี้เมื่อ route ใน routes.yaml มี grpc: (ค่าเริ่มต้นใช้ REST ดูตัวอย่างที่ comment ไว้ในไฟล์นั้น)
+
+type userGRPCServer struct {
+	pb.UnimplementedUserServiceServer
+}
+
+// startGRPCServer เปิด gRPC บน port ที่กำหนด เปิดไม่ได้ (เช่นรันหลาย instances บนเครื่องเดียว) = ใช้แค่ HTTP
+func startGRPCServer(port string) *grpc.Server {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Printf("⚠️ gRPC disabled, cannot listen on :%s: %v", port, err)
+		return nil
+	}
+
+	server := newGRPCServer()
+	go func() {
+		log.Printf("🔌 gRPC UserService listening on :%s", port)
+		if err := server.Serve(lis); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	return server
+}
+
+// newGRPCServer UserService + health + reflection พร้อม interceptors (recovery, logging, deadline, identity)
+func newGRPCServer() *grpc.Server {
+	options := append(interceptors.ServerOptions(5*time.Second, time.Minute),
+		grpc.ChainUnaryInterceptor(unaryIdentity()),
+		grpc.ChainStreamInterceptor(streamIdentity()))
+	server := grpc.NewServer(options...)
+	pb.RegisterUserServiceServer(server, &userGRPCServer{})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("user.UserService", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	return server
+}
+
+func (s *userGRPCServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	user, ok := findUser(int(req.GetId()))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "user not found: %d", req.GetId())
+	}
+	return toProtoUser(user), nil
+}
+
+func (s *userGRPCServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	page, limit := int(req.GetPage()), int(req.GetLimit())
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	users, total := listUsers(page, limit)
+	resp := &pb.ListUsersResponse{Total: int32(total)}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toProtoUser(user))
+	}
+	return resp, nil
+}
+
+func (s *userGRPCServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	if req.GetName() == "" || req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name and email are required")
+	}
+	user, err := createUser(req.GetName(), req.GetEmail())
+	if errors.Is(err, ErrEmailExists) {
+		return nil, status.Error(codes.AlreadyExists, "email already exists")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	log.Printf("👤 Created user via gRPC: %s (%s)", user.Name, user.Email)
+	return toProtoUser(user), nil
+}
+
+// StreamUsers ส่ง users ทีละคนจนครบทุกหน้า หยุดเมื่อ client ยกเลิก
+func (s *userGRPCServer) StreamUsers(req *pb.ListUsersRequest, stream pb.UserService_StreamUsersServer) error {
+	for page := 1; ; page++ {
+		users, total := listUsers(page, 100)
+		for _, user := range users {
+			if err := stream.Context().Err(); err != nil {
+				return status.FromContextError(err).Err()
+			}
+			if err := stream.Send(toProtoUser(user)); err != nil {
+				return err
+			}
+		}
+		if page*100 >= total {
+			return nil
+		}
+	}
+}
+
+func toProtoUser(user User) *pb.User {
+	return &pb.User{
+		Id:        int32(user.ID),
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ============ gRPC Identity ============
+
+// identity มากับ metadata ชื่อเดียวกับ HTTP headers (ตัวเล็ก) ลายเซ็นใช้ identity.MethodGRPC + full method name
+func checkIdentity(ctx context.Context, fullMethod string) error {
+	if strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") || strings.HasPrefix(fullMethod, "/grpc.reflection.") {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if _, err := identity.Verify(identity.MethodGRPC, fullMethod, get(identity.HeaderUserID), get(identity.HeaderUserRoles),
+		get(identity.HeaderIdentityTimestamp), get(identity.HeaderIdentitySignature)); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+func unaryIdentity() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkIdentity(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamIdentity() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkIdentity(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "grpc-example/proto"
+	"shared/identity"
+)
+
+// newGRPCTestConn เปิด newGRPCServer บน listener ในหน่วยความจำ (ข้อมูลจาก fixtures)
+func newGRPCTestConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	initSampleData()
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// signedFor context ที่มี identity ลงลายเซ็นสำหรับ fullMethod แบบเดียวกับ gateway
+func signedFor(fullMethod string) context.Context {
+	caller := identity.Identity{UserID: "1", Roles: []string{"user"}}
+	return metadata.AppendToOutgoingContext(context.Background(), identity.SignGRPC(fullMethod, caller)...)
+}
+
+func TestGRPCRequiresIdentity(t *testing.T) {
+	conn := newGRPCTestConn(t)
+	client := pb.NewUserServiceClient(conn)
+	getUser := pb.UserService_GetUser_FullMethodName
+	// ส่ง X-User-ID มาเองโดยไม่มีลายเซ็น
+	forged := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", "1", "x-user-roles", "admin")
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"unsigned", context.Background(), codes.Unauthenticated},
+		{"forged headers", forged, codes.Unauthenticated},
+		{"signed for another method", signedFor(pb.UserService_CreateUser_FullMethodName), codes.Unauthenticated},
+		{"signed", signedFor(getUser), codes.OK},
+	} {
+		_, err := client.GetUser(tc.ctx, &pb.GetUserRequest{Id: 1})
+		if code := status.Code(err); code != tc.want {
+			t.Errorf("GetUser %s: code = %s, want %s (%v)", tc.name, code, tc.want, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"unsigned", context.Background(), codes.Unauthenticated},
+		{"signed", signedFor(pb.UserService_StreamUsers_FullMethodName), codes.OK},
+	} {
+		stream, err := client.StreamUsers(tc.ctx, &pb.ListUsersRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if code := status.Code(err); code != tc.want {
+			t.Errorf("StreamUsers %s: code = %s, want %s (%v)", tc.name, code, tc.want, err)
+		}
+	}
+
+	// health check ไม่ต้องมี identity (load balancer / orchestrator เรียกตรง)
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "user.UserService"})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health: status = %v, err = %v, want SERVING", resp.GetStatus(), err)
+	}
+}
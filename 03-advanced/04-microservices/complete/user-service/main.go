@@ -1,12 +1,23 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
+	"errors"
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"shared/identity"
+	"shared/registration"
 )
 
 // User struct
@@ -17,11 +28,26 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// In-memory storage
+// In-memory storage (ใช้ผ่าน store.go)
 var users []User
 var userID = 1
+var usersMu sync.RWMutex
 
 func main() {
+	// PORT / SERVICE_URL ทำให้รันหลาย instances ได้ (gateway กระจาย load ให้ผ่าน registry)
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3001"
+	}
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "50052"
+	}
+	serviceURL := os.Getenv("SERVICE_URL")
+	if serviceURL == "" {
+		serviceURL = "http://localhost:" + port
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(500).JSON(fiber.Map{
@@ -31,7 +57,11 @@ func main() {
 		},
 	})
 
-	app.Use(logger.New())
+	// X-Request-ID มาจาก gateway (หรือสร้างใหม่ถ้าเรียกตรง) ใช้ไล่ log ข้าม services
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${locals:requestid} | ${method} ${path}\n",
+	}))
 
 	// Initialize sample data
 	initSampleData()
@@ -41,8 +71,8 @@ func main() {
 		return c.JSON(fiber.Map{
 			"service": "user-service",
 			"status":  "healthy",
-			"port":    3001,
-			"users":   len(users),
+			"port":    port,
+			"users":   countUsers(),
 		})
 	})
 
@@ -52,44 +82,86 @@ func main() {
 			"service":     "User Service",
 			"version":     "1.0.0",
 			"status":      "running",
-			"total_users": len(users),
+			"total_users": countUsers(),
 		})
 	})
 
-	// API endpoints
-	app.Post("/users", createUserHandler)
-	app.Get("/users/:id", getUserHandler)
-	app.Get("/users", getAllUsersHandler)
+	// API endpoints (ต้องมี identity ที่ gateway ลงลายเซ็นไว้ ดู shared/identity)
+	auth := identity.Require()
+	app.Post("/users", auth, createUserHandler)
+	app.Get("/users/:id", auth, getUserHandler)
+	app.Get("/users", auth, getAllUsersHandler)
+	app.Delete("/users/:id", auth, deleteUserHandler)
+
+	// events (เช่น user.deleted) ส่งให้ services ที่สนใจ ค่าเริ่มต้น = webhooks (ดู events.go)
+	initEvents()
 
-	log.Println("👥 User Service started on port 3001")
-	log.Fatal(app.Listen(":3001"))
+	// gRPC API ของข้อมูลชุดเดียวกัน (ดู grpc_server.go)
+	grpcServer := startGRPCServer(grpcPort)
+
+	// ลงทะเบียนกับ gateway (ถ้าตั้ง REGISTRY_URL) และถอนตัวก่อนปิด
+	reg := registration.Start("user-service", serviceURL)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		reg.Stop()
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+	}()
+
+	log.Printf("👥 User Service started on port %s", port)
+	if err := app.Listen(":" + port); err != nil {
+		log.Fatal(err)
+	}
+	// Listen คืนค่าหลัง Shutdown แล้ว ส่ง events ที่ค้างอยู่ให้หมดก่อนจบ
+	publisher.Close()
 }
 
+// ข้อมูลตัวอย่างอยู่ใน fixtures/users.json (created_ago = เวลาย้อนหลังจากตอน start)
+//
+//go:embed fixtures/users.json
+var sampleUsers []byte
+
 func initSampleData() {
-	users = []User{
-		{
-			ID:        1,
-			Name:      "John Doe",
-			Email:     "john@example.com",
-			CreatedAt: time.Now().Add(-24 * time.Hour),
-		},
-		{
-			ID:        2,
-			Name:      "Jane Smith",
-			Email:     "jane@example.com",
-			CreatedAt: time.Now().Add(-12 * time.Hour),
-		},
-		{
-			ID:        3,
-			Name:      "Bob Johnson",
-			Email:     "bob@example.com",
-			CreatedAt: time.Now().Add(-6 * time.Hour),
-		},
+	var fixtures []struct {
+		User
+		CreatedAgo string `json:"created_ago"`
+	}
+	if err := json.Unmarshal(sampleUsers, &fixtures); err != nil {
+		log.Fatalf("❌ Failed to load sample users: %v", err)
+	}
+
+	now := time.Now()
+	users = users[:0]
+	userID = 1
+	for _, f := range fixtures {
+		user := f.User
+		user.CreatedAt = now.Add(-mustParseAgo(f.CreatedAgo))
+		users = append(users, user)
+		if user.ID >= userID {
+			userID = user.ID + 1
+		}
 	}
-	userID = 4
 	log.Println("✅ Sample users loaded")
 }
 
+// mustParseAgo แปลง duration ใน fixture ("24h") ค่าว่าง = ตอนนี้
+func mustParseAgo(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("❌ Invalid duration %q in fixtures: %v", s, err)
+	}
+	return d
+}
+
 func createUserHandler(c *fiber.Ctx) error {
 	type CreateUserRequest struct {
 		Name  string `json:"name"`
@@ -112,25 +184,14 @@ func createUserHandler(c *fiber.Ctx) error {
 	}
 
 	// Check if email already exists
-	for _, existingUser := range users {
-		if existingUser.Email == req.Email {
-			return c.Status(409).JSON(fiber.Map{
-				"success": false,
-				"error":   "Email already exists",
-			})
-		}
-	}
-
-	user := User{
-		ID:        userID,
-		Name:      req.Name,
-		Email:     req.Email,
-		CreatedAt: time.Now(),
+	user, err := createUser(req.Name, req.Email)
+	if errors.Is(err, ErrEmailExists) {
+		return c.Status(409).JSON(fiber.Map{
+			"success": false,
+			"error":   "Email already exists",
+		})
 	}
 
-	users = append(users, user)
-	userID++
-
 	log.Printf("👤 Created user: %s (%s)", user.Name, user.Email)
 
 	return c.Status(201).JSON(fiber.Map{
@@ -141,15 +202,12 @@ func createUserHandler(c *fiber.Ctx) error {
 }
 
 func getUserHandler(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	for _, user := range users {
-		if strconv.Itoa(user.ID) == id {
-			return c.JSON(fiber.Map{
-				"success": true,
-				"data":    user,
-			})
-		}
+	id, err := strconv.Atoi(c.Params("id"))
+	if user, ok := findUser(id); err == nil && ok {
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    user,
+		})
 	}
 
 	return c.Status(404).JSON(fiber.Map{
@@ -170,18 +228,7 @@ func getAllUsersHandler(c *fiber.Ctx) error {
 		limit = 10
 	}
 
-	start := (page - 1) * limit
-	end := start + limit
-
-	var paginatedUsers []User
-	if start < len(users) {
-		if end > len(users) {
-			end = len(users)
-		}
-		paginatedUsers = users[start:end]
-	} else {
-		paginatedUsers = []User{}
-	}
+	paginatedUsers, total := listUsers(page, limit)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -189,10 +236,45 @@ func getAllUsersHandler(c *fiber.Ctx) error {
 		"pagination": fiber.Map{
 			"page":     page,
 			"limit":    limit,
-			"total":    len(users),
-			"has_next": end < len(users),
+			"total":    total,
+			"has_next": page*limit < total,
 			"has_prev": page > 1,
 		},
 		"count": len(paginatedUsers),
 	})
 }
+
+// deleteUserHandler ลบได้เฉพาะตัวเองหรือ admin แล้วแจ้ง user.deleted ให้ services อื่นเก็บกวาดข้อมูลที่อ้างถึง
+func deleteUserHandler(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+
+	caller := identity.Current(c)
+	if caller.UserID != strconv.Itoa(id) && !caller.HasRole("admin") {
+		return c.Status(403).JSON(fiber.Map{
+			"success": false,
+			"error":   "Only admins can delete other users",
+		})
+	}
+
+	user, ok := deleteUser(id)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "User not found",
+		})
+	}
+
+	log.Printf("🗑️ Deleted user: %s (%s)", user.Name, user.Email)
+	publisher.Publish(newEvent(EventUserDeleted, UserDeleted{UserID: user.ID, Email: user.Email}))
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User deleted successfully",
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ============ User Store ============
+
+// HTTP และ gRPC (grpc_server.go) ใช้ข้อมูลชุดเดียวกัน จึงต้องผ่านฟังก์ชันเหล่านี้ที่ล็อกไว้
+
+var ErrEmailExists = errors.New("email already exists")
+
+func findUser(id int) (User, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for _, user := range users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// listUsers คืน users หน้าที่ต้องการ (page เริ่มที่ 1) และจำนวนทั้งหมด
+func listUsers(page, limit int) ([]User, int) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+
+	start := (page - 1) * limit
+	end := start + limit
+	if start >= len(users) {
+		return []User{}, len(users)
+	}
+	if end > len(users) {
+		end = len(users)
+	}
+	return append([]User(nil), users[start:end]...), len(users)
+}
+
+func createUser(name, email string) (User, error) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	for _, existingUser := range users {
+		if existingUser.Email == email {
+			return User{}, ErrEmailExists
+		}
+	}
+
+	user := User{
+		ID:        userID,
+		Name:      name,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+	users = append(users, user)
+	userID++
+	return user, nil
+}
+
+// deleteUser ลบแล้วคืน user ที่ลบไป (ไม่เจอ = false)
+func deleteUser(id int) (User, bool) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	for i, user := range users {
+		if user.ID == id {
+			users = append(users[:i], users[i+1:]...)
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func countUsers() int {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return len(users)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"regexp"
 	"sync"
 	"time"
 
@@ -31,6 +33,7 @@ type Worker struct {
 
 type Queue struct {
 	jobs       []Job
+	ids        map[string]struct{} // job IDs ที่เคยรับแล้ว (AddJobOnce ไม่ต้องไล่ทั้ง jobs)
 	workers    []Worker
 	jobChannel chan Job
 	mutex      sync.RWMutex
@@ -49,9 +52,18 @@ type Notification struct {
 	Type    string `json:"type"`
 }
 
+// EventJob domain event จาก service อื่น (ID = dedupe ID ของ event)
+type EventJob struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
 // Global queue instance
 var queue *Queue
 
+var eventIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 func main() {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -80,6 +92,7 @@ func main() {
 	// Job submission endpoints
 	app.Post("/jobs/email", createEmailJobHandler)
 	app.Post("/jobs/notification", createNotificationJobHandler)
+	app.Post("/jobs/events", createEventJobHandler)
 	
 	// Job monitoring endpoints
 	app.Get("/jobs", getJobsHandler)
@@ -90,16 +103,22 @@ func main() {
 	app.Post("/send-email-sync", sendEmailSyncHandler)
 	app.Post("/send-notification-sync", sendNotificationSyncHandler)
 
-	log.Println("🚀 Message Queue API started on port 3000")
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3000"
+	}
+
+	log.Printf("🚀 Message Queue API started on port %s", port)
 	log.Println("📬 Workers ready to process background jobs")
-	log.Println("📊 Visit http://localhost:3000/dashboard for monitoring")
-	log.Fatal(app.Listen(":3000"))
+	log.Printf("📊 Visit http://localhost:%s/dashboard for monitoring", port)
+	log.Fatal(app.Listen(":" + port))
 }
 
 // Queue implementation
 func NewQueue(numWorkers int) *Queue {
 	queue := &Queue{
 		jobs:       make([]Job, 0),
+		ids:        make(map[string]struct{}),
 		workers:    make([]Worker, numWorkers),
 		jobChannel: make(chan Job, 100), // Buffer for 100 jobs
 	}
@@ -180,6 +199,8 @@ func (q *Queue) processJob(worker *Worker, job Job) {
 		err = q.processEmailJob(job)
 	case "notification":
 		err = q.processNotificationJob(job)
+	case "event":
+		err = q.processEventJob(job)
 	default:
 		err = fmt.Errorf("unknown job type: %s", job.Type)
 	}
@@ -223,13 +244,46 @@ func (q *Queue) processNotificationJob(job Job) error {
 	return nil
 }
 
+func (q *Queue) processEventJob(job Job) error {
+	var event EventJob
+	if err := json.Unmarshal([]byte(job.Payload), &event); err != nil {
+		return fmt.Errorf("invalid event payload: %w", err)
+	}
+
+	log.Printf("📣 Event %s received: %s", event.Type, event.Payload)
+	return nil
+}
+
 func (q *Queue) AddJob(job Job) {
 	q.mutex.Lock()
 	job.Status = "pending"
 	job.CreatedAt = time.Now()
 	q.jobs = append(q.jobs, job)
+	q.ids[job.ID] = struct{}{}
 	q.mutex.Unlock()
 
+	q.enqueue(job)
+}
+
+// AddJobOnce เพิ่ม job ถ้ายังไม่เคยมี job ID นี้ (คืน false = ซ้ำ)
+// ใช้กับ producer ที่ส่งแบบ at-least-once และอาจส่ง ID เดิมมาซ้ำ
+func (q *Queue) AddJobOnce(job Job) bool {
+	q.mutex.Lock()
+	if _, exists := q.ids[job.ID]; exists {
+		q.mutex.Unlock()
+		return false
+	}
+	job.Status = "pending"
+	job.CreatedAt = time.Now()
+	q.jobs = append(q.jobs, job)
+	q.ids[job.ID] = struct{}{}
+	q.mutex.Unlock()
+
+	q.enqueue(job)
+	return true
+}
+
+func (q *Queue) enqueue(job Job) {
 	// Send to job channel
 	select {
 	case q.jobChannel <- job:
@@ -343,6 +397,45 @@ func createNotificationJobHandler(c *fiber.Ctx) error {
 	})
 }
 
+func createEventJobHandler(c *fiber.Ctx) error {
+	var event EventJob
+	if err := c.BodyParser(&event); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if event.ID == "" || event.Type == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "ID and type are required"})
+	}
+	// ID กลายเป็น job ID ที่ dashboard และ /jobs/:id แสดง จึงรับเฉพาะตัวอักษรที่ปลอดภัย
+	if !eventIDPattern.MatchString(event.ID) {
+		return c.Status(400).JSON(fiber.Map{"error": "ID must be 1-64 characters of A-Z, a-z, 0-9, _ or -"})
+	}
+
+	payload, _ := json.Marshal(event)
+
+	// ใช้ event ID เป็น job ID ส่งซ้ำกี่ครั้งก็ถูกประมวลผลครั้งเดียว
+	job := Job{
+		ID:      event.ID,
+		Type:    "event",
+		Payload: string(payload),
+	}
+
+	if !queue.AddJobOnce(job) {
+		return c.JSON(fiber.Map{
+			"success":   true,
+			"job_id":    job.ID,
+			"duplicate": true,
+			"message":   "Event already received",
+		})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"success": true,
+		"job_id":  job.ID,
+		"message": "Event job queued successfully",
+	})
+}
+
 func getJobsHandler(c *fiber.Ctx) error {
 	jobs := queue.GetJobs()
 
@@ -554,13 +647,16 @@ func dashboardHandler(c *fiber.Ctx) error {
                         recentJobs.forEach(job => {
                             const div = document.createElement('div');
                             div.className = 'job ' + job.status;
-                            div.innerHTML = \`
-                                <div>
-                                    <strong>\${job.id}</strong> (\${job.type})
-                                    <br><small>\${new Date(job.created_at).toLocaleString()}</small>
-                                </div>
-                                <div>\${job.status.toUpperCase()}</div>
-                            \`;
+                            // ข้อมูลของ job มาจาก client จึงใส่ด้วย textContent เท่านั้น (ไม่ใช่ innerHTML)
+                            const info = document.createElement('div');
+                            const id = document.createElement('strong');
+                            id.textContent = job.id;
+                            const created = document.createElement('small');
+                            created.textContent = new Date(job.created_at).toLocaleString();
+                            info.append(id, ' (' + job.type + ')', document.createElement('br'), created);
+                            const status = document.createElement('div');
+                            status.textContent = job.status.toUpperCase();
+                            div.append(info, status);
                             container.appendChild(div);
                         });
                         
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -45,6 +49,7 @@ type Session struct {
 
 var (
 	rdb      *redis.Client
+	tagCache *TagCache
 	ctx      = context.Background()
 	products = make(map[string]Product) // จำลอง database
 	users    = make(map[string]User)    // จำลอง database
@@ -64,12 +69,23 @@ const (
 	ProductListCacheKey = "products:all"
 	SessionPrefix       = "session:"
 	RateLimitPrefix     = "ratelimit:"
+	TagPrefix           = "tag:"
 	CacheTTL            = 5 * time.Minute
 	SessionTTL          = 24 * time.Hour
 	RateLimitWindow     = 1 * time.Minute
 	RateLimitMax        = 100
 )
 
+// Cache tags - handlers ประกาศว่า response ขึ้นอยู่กับข้อมูลอะไร แทนการจำชื่อ keys
+const (
+	TagProductList   = "products:list"
+	ProductTagPrefix = "product:"
+)
+
+func productTag(id string) string {
+	return ProductTagPrefix + id
+}
+
 func main() {
 	// เชื่อมต่อ Redis
 	rdb = redis.NewClient(&redis.Options{
@@ -85,6 +101,8 @@ func main() {
 	}
 	log.Println("✅ เชื่อมต่อ Redis สำเร็จ")
 
+	tagCache = NewTagCache(rdb)
+
 	// สร้างข้อมูลตัวอย่าง
 	setupSampleData()
 
@@ -98,7 +116,11 @@ func main() {
 	// Public routes
 	app.Get("/", homeHandler)
 	app.Get("/stats", statsHandler)
-	app.Post("/cache/clear", clearCacheHandler)
+
+	// Admin routes (ต้องส่ง X-Admin-Token ให้ตรงกับ ADMIN_TOKEN)
+	cache := app.Group("/cache", adminOnly())
+	cache.Post("/clear", clearCacheHandler)
+	cache.Post("/invalidate", invalidateCacheHandler)
 
 	// Auth routes
 	app.Post("/register", registerHandler)
@@ -107,7 +129,7 @@ func main() {
 	// Product routes (with caching & rate limiting)
 	products := app.Group("/products")
 	products.Use(RateLimitMiddleware())
-	products.Get("/", CacheMiddleware(ProductListCacheKey, CacheTTL), listProductsHandler)
+	products.Get("/", CacheMiddleware(ProductListCacheKey, CacheTTL, TagProductList), listProductsHandler)
 	products.Get("/:id", getProductHandler)
 	products.Post("/", createProductHandler)
 	products.Put("/:id", updateProductHandler)
@@ -123,6 +145,126 @@ func main() {
 	log.Fatal(app.Listen(":3000"))
 }
 
+// ============ Tag Cache ============
+
+// TagCache เก็บ cache ใน Redis พร้อม tag sets สำหรับ invalidate เป็นกลุ่ม
+// แต่ละ tag คือ Redis SET ชื่อ "tag:<name>" ที่เก็บรายชื่อ keys ที่ขึ้นอยู่กับ tag นั้น
+type TagCache struct {
+	rdb *redis.Client
+}
+
+// setWithTagsScript เก็บ key และผูกเข้ากับ tag sets ใน script เดียว
+// tag set ต้องอยู่นานกว่า key ที่ยาวที่สุดในนั้น จึงยืด TTL ออกเท่านั้น (PTTL + PEXPIRE แทน EXPIRE NX/GT ที่ต้องใช้ Redis 7)
+// KEYS[1] = cache key, KEYS[2..] = tag sets, ARGV[1] = value, ARGV[2] = ttl (ms, 0 = ไม่หมดอายุ)
+var setWithTagsScript = redis.NewScript(`
+	local ttl = tonumber(ARGV[2])
+	if ttl > 0 then
+		redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+	else
+		redis.call('SET', KEYS[1], ARGV[1])
+	end
+	for i = 2, #KEYS do
+		redis.call('SADD', KEYS[i], KEYS[1])
+		if ttl <= 0 then
+			redis.call('PERSIST', KEYS[i])
+		elseif redis.call('PTTL', KEYS[i]) < ttl then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	end
+	return 1
+`)
+
+// invalidateTagsScript ลบทุก key ใน tag sets และตัว tag set เองแบบ atomic
+// (script นี้เข้าถึง keys ที่ไม่ได้ส่งผ่าน KEYS จึงใช้ได้กับ Redis instance เดียว ไม่ใช่ Cluster)
+var invalidateTagsScript = redis.NewScript(`
+	local removed = 0
+	for _, tagKey in ipairs(KEYS) do
+		local members = redis.call('SMEMBERS', tagKey)
+		for _, key in ipairs(members) do
+			removed = removed + redis.call('DEL', key)
+		end
+		redis.call('DEL', tagKey)
+	end
+	return removed
+`)
+
+func NewTagCache(rdb *redis.Client) *TagCache {
+	return &TagCache{rdb: rdb}
+}
+
+// Set เก็บ value พร้อมผูก key เข้ากับ tags
+func (tc *TagCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, key)
+	for _, tag := range tags {
+		keys = append(keys, TagPrefix+tag)
+	}
+	return setWithTagsScript.Run(ctx, tc.rdb, keys, value, ttl.Milliseconds()).Err()
+}
+
+// InvalidateTags ลบทุก key ที่ผูกกับ tags และส่งจำนวน keys ที่ถูกลบ
+func (tc *TagCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+
+	tagKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		tagKeys[i] = TagPrefix + tag
+	}
+	return invalidateTagsScript.Run(ctx, tc.rdb, tagKeys).Int64()
+}
+
+// DeleteByPrefix ลบทุก key ที่ขึ้นต้นด้วย prefix (ใช้ SCAN แทน KEYS เพื่อไม่ block Redis)
+// prefix เป็นข้อความตรงตัว อักขระ glob (* ? [ ] \) ถูก escape ก่อนใส่ใน MATCH
+func (tc *TagCache) DeleteByPrefix(ctx context.Context, prefix string) (int64, error) {
+	var removed int64
+	batch := make([]string, 0, 100)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := tc.rdb.Del(ctx, batch...).Result()
+		removed += n
+		batch = batch[:0]
+		return err
+	}
+
+	iter := tc.rdb.Scan(ctx, 0, escapeGlob(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := flush(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return removed, err
+	}
+	return removed, flush()
+}
+
+// escapeGlob ทำให้ s ถูก match แบบตรงตัวใน pattern ของ SCAN MATCH
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// invalidate เป็น helper สำหรับ handlers - log error แต่ไม่ทำให้ request ล้ม
+func invalidate(tags ...string) {
+	if _, err := tagCache.InvalidateTags(ctx, tags...); err != nil {
+		log.Printf("Cache invalidation error (tags=%v): %v", tags, err)
+	}
+}
+
 // ============ Middleware ============
 
 // RateLimitMiddleware - Sliding window rate limiting with Redis
@@ -180,8 +322,8 @@ func RateLimitMiddleware() fiber.Handler {
 	}
 }
 
-// CacheMiddleware - Cache response in Redis
-func CacheMiddleware(cacheKey string, ttl time.Duration) fiber.Handler {
+// CacheMiddleware - Cache response in Redis พร้อมผูก tags ที่ response ขึ้นอยู่ด้วย
+func CacheMiddleware(cacheKey string, ttl time.Duration, tags ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// พยายามอ่านจาก cache
 		cached, err := rdb.Get(ctx, cacheKey).Result()
@@ -203,13 +345,36 @@ func CacheMiddleware(cacheKey string, ttl time.Duration) fiber.Handler {
 		// Cache response body
 		body := c.Response().Body()
 		if len(body) > 0 && c.Response().StatusCode() == 200 {
-			rdb.Set(ctx, cacheKey, body, ttl)
+			if err := tagCache.Set(ctx, cacheKey, body, ttl, tags...); err != nil {
+				log.Printf("Cache set error: %v", err)
+			}
 		}
 
 		return nil
 	}
 }
 
+// adminOnly ป้องกัน endpoints สำหรับ admin ด้วย header X-Admin-Token
+// ถ้าไม่ได้ตั้ง ADMIN_TOKEN ไว้ endpoints เหล่านี้จะถูกปิด
+func adminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			return c.Status(403).JSON(fiber.Map{
+				"success": false,
+				"error":   "Admin endpoints ถูกปิด (ไม่ได้ตั้ง ADMIN_TOKEN)",
+			})
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Get("X-Admin-Token")), []byte(token)) != 1 {
+			return c.Status(401).JSON(fiber.Map{
+				"success": false,
+				"error":   "Admin token ไม่ถูกต้อง",
+			})
+		}
+		return c.Next()
+	}
+}
+
 // SessionMiddleware - Validate session from Redis
 func SessionMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -263,7 +428,8 @@ func homeHandler(c *fiber.Ctx) error {
 			"auth":        "POST /register, /login",
 			"protected":   "GET /me/profile (requires session)",
 			"stats":       "GET /stats",
-			"clear_cache": "POST /cache/clear",
+			"clear_cache": "POST /cache/clear (admin)",
+			"invalidate":  "POST /cache/invalidate (admin)",
 		},
 	})
 }
@@ -288,15 +454,69 @@ func statsHandler(c *fiber.Ctx) error {
 }
 
 func clearCacheHandler(c *fiber.Ctx) error {
-	// ลบเฉพาะ cache keys (ไม่ลบ sessions)
-	keys, _ := rdb.Keys(ctx, "product*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
+	// ลบเฉพาะ cache keys และ tag sets (ไม่ลบ sessions)
+	var total int64
+	for _, prefix := range []string{"product", TagPrefix} {
+		n, err := tagCache.DeleteByPrefix(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		total += n
 	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": fmt.Sprintf("ลบ cache %d keys", len(keys)),
+		"message": fmt.Sprintf("ลบ cache %d keys", total),
+	})
+}
+
+func invalidateCacheHandler(c *fiber.Ctx) error {
+	var req struct {
+		Tags   []string `json:"tags"`
+		Prefix string   `json:"prefix"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	if len(req.Tags) == 0 && req.Prefix == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "ต้องระบุ tags หรือ prefix",
+		})
+	}
+	// กันไม่ให้ล้าง sessions หรือ rate limit counters ผ่าน endpoint นี้
+	if req.Prefix != "" && overlapsPrefix(req.Prefix, SessionPrefix, RateLimitPrefix) {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "prefix นี้ไม่ใช่ cache",
+		})
+	}
+
+	var removed int64
+	if len(req.Tags) > 0 {
+		n, err := tagCache.InvalidateTags(ctx, req.Tags...)
+		if err != nil {
+			return err
+		}
+		removed += n
+	}
+	if req.Prefix != "" {
+		n, err := tagCache.DeleteByPrefix(ctx, req.Prefix)
+		if err != nil {
+			return err
+		}
+		removed += n
+	}
+
+	return c.JSON(fiber.Map{
+		"success":          true,
+		"invalidated_keys": removed,
+		"tags":             req.Tags,
+		"prefix":           req.Prefix,
 	})
 }
 
@@ -346,9 +566,11 @@ func getProductHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Cache ผลลัพธ์
+	// Cache ผลลัพธ์ โดยผูกกับ tag ของสินค้าตัวนี้
 	productJSON, _ := json.Marshal(product)
-	rdb.Set(ctx, cacheKey, productJSON, CacheTTL)
+	if err := tagCache.Set(ctx, cacheKey, productJSON, CacheTTL, productTag(id)); err != nil {
+		log.Printf("Cache set error: %v", err)
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -370,7 +592,7 @@ func createProductHandler(c *fiber.Ctx) error {
 	products[product.ID] = product
 
 	// Invalidate cache
-	rdb.Del(ctx, ProductListCacheKey)
+	invalidate(TagProductList)
 
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
@@ -400,7 +622,7 @@ func updateProductHandler(c *fiber.Ctx) error {
 	products[id] = product
 
 	// Invalidate cache
-	rdb.Del(ctx, ProductCachePrefix+id, ProductListCacheKey)
+	invalidate(productTag(id), TagProductList)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -421,7 +643,7 @@ func deleteProductHandler(c *fiber.Ctx) error {
 	delete(products, id)
 
 	// Invalidate cache
-	rdb.Del(ctx, ProductCachePrefix+id, ProductListCacheKey)
+	invalidate(productTag(id), TagProductList)
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -575,19 +797,35 @@ func logoutHandler(c *fiber.Ctx) error {
 
 // ============ Helpers ============
 
+// ข้อมูลตัวอย่างอยู่ใน fixtures/sample.json (ฝังเข้าโปรแกรมตอน build)
+//
+//go:embed fixtures/sample.json
+var sampleData []byte
+
 func setupSampleData() {
-	// สร้าง products ตัวอย่าง
-	sampleProducts := []Product{
-		{ID: "1", Name: "iPhone 15 Pro", Price: 48900, Description: "สมาร์ทโฟนรุ่นใหม่ล่าสุด", CreatedAt: time.Now()},
-		{ID: "2", Name: "MacBook Pro M3", Price: 89900, Description: "แล็ปท็อปสำหรับมืออาชีพ", CreatedAt: time.Now()},
-		{ID: "3", Name: "AirPods Pro 2", Price: 8990, Description: "หูฟังไร้สายระดับพรีเมียม", CreatedAt: time.Now()},
+	var fixtures struct {
+		Products []Product `json:"products"`
+		Users    []struct {
+			User
+			Password string `json:"password"`
+		} `json:"users"`
 	}
-	for _, p := range sampleProducts {
-		products[p.ID] = p
+	if err := json.Unmarshal(sampleData, &fixtures); err != nil {
+		log.Fatalf("❌ โหลดข้อมูลตัวอย่างไม่สำเร็จ: %v", err)
 	}
 
-	// สร้าง user ตัวอย่าง
-	users["1"] = User{ID: "1", Email: "demo@example.com", Password: "123456", Name: "Demo User"}
+	now := time.Now()
+	for _, p := range fixtures.Products {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+		products[p.ID] = p
+	}
+	for _, fixture := range fixtures.Users {
+		user := fixture.User
+		user.Password = fixture.Password
+		users[user.ID] = user
+	}
 
 	log.Printf("📦 โหลดข้อมูลตัวอย่าง: %d products, %d users", len(products), len(users))
 }
@@ -599,6 +837,16 @@ func errorHandler(c *fiber.Ctx, err error) error {
 	})
 }
 
+// overlapsPrefix ตรวจว่า prefix จะ match keys ที่ขึ้นต้นด้วย protected ตัวใดตัวหนึ่งหรือไม่
+func overlapsPrefix(prefix string, protected ...string) bool {
+	for _, p := range protected {
+		if strings.HasPrefix(prefix, p) || strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func calculateHitRate() string {
 	hits := atomic.LoadInt64(&cacheStats.Hits)
 	misses := atomic.LoadInt64(&cacheStats.Misses)
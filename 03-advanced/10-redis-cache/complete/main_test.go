@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestTagCache ต่อ Redis จริงที่ REDIS_ADDR (ค่าเริ่มต้น localhost:6379, DB 15)
+// ไม่มี Redis = skip (docker-compose up -d ก่อนรัน go test)
+func newTestTagCache(t *testing.T) (*TagCache, string) {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	t.Cleanup(func() { client.Close() })
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis not available at %s: %v", addr, err)
+	}
+
+	// prefix ต่อ test กันชนกับข้อมูลอื่นใน DB
+	prefix := "test:" + uuid.NewString() + ":"
+	tc := NewTagCache(client)
+	t.Cleanup(func() {
+		tc.DeleteByPrefix(context.Background(), prefix)
+		tc.DeleteByPrefix(context.Background(), TagPrefix+prefix)
+	})
+	return tc, prefix
+}
+
+func TestTagCacheInvalidateTags(t *testing.T) {
+	tc, p := newTestTagCache(t)
+	ctx := context.Background()
+
+	must(t, tc.Set(ctx, p+"product:1", "one", time.Minute, p+"product:1", p+"list"))
+	must(t, tc.Set(ctx, p+"product:2", "two", time.Minute, p+"product:2", p+"list"))
+	must(t, tc.Set(ctx, p+"list:all", "[one,two]", time.Minute, p+"list"))
+
+	for _, step := range []struct {
+		name    string
+		tags    []string
+		removed int64
+		left    []string
+	}{
+		{"single product", []string{p + "product:1"}, 1, []string{p + "product:2", p + "list:all"}},
+		{"already invalidated", []string{p + "product:1"}, 0, []string{p + "product:2", p + "list:all"}},
+		{"list tag", []string{p + "list"}, 2, nil},
+		{"unknown tag", []string{p + "missing"}, 0, nil},
+	} {
+		removed, err := tc.InvalidateTags(ctx, step.tags...)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if removed != step.removed {
+			t.Errorf("%s: removed = %d, want %d", step.name, removed, step.removed)
+		}
+		left, err := tc.rdb.Exists(ctx, p+"product:1", p+"product:2", p+"list:all").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left != int64(len(step.left)) {
+			t.Errorf("%s: %d keys left, want %v", step.name, left, step.left)
+		}
+	}
+}
+
+func TestTagCacheTagSetOutlivesKeys(t *testing.T) {
+	tc, p := newTestTagCache(t)
+	ctx := context.Background()
+	tagKey := TagPrefix + p + "list"
+
+	for _, step := range []struct {
+		key     string
+		ttl     time.Duration
+		wantTTL time.Duration // TTL ของ tag set หลัง Set
+	}{
+		{p + "short", 10 * time.Second, 10 * time.Second},
+		{p + "long", time.Minute, time.Minute},
+		{p + "shorter", 5 * time.Second, time.Minute}, // ไม่ถูกย่อลง
+	} {
+		must(t, tc.Set(ctx, step.key, "v", step.ttl, p+"list"))
+		ttl, err := tc.rdb.PTTL(ctx, tagKey).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl > step.wantTTL || ttl < step.wantTTL-time.Second {
+			t.Errorf("after %s: tag TTL = %v, want ~%v", step.key, ttl, step.wantTTL)
+		}
+	}
+}
+
+func TestTagCacheDeleteByPrefix(t *testing.T) {
+	tc, p := newTestTagCache(t)
+	ctx := context.Background()
+
+	for i := 0; i < 250; i++ {
+		must(t, tc.rdb.Set(ctx, p+"product:"+uuid.NewString(), "v", time.Minute).Err())
+	}
+	must(t, tc.rdb.Set(ctx, p+"session:1", "v", time.Minute).Err())
+
+	removed, err := tc.DeleteByPrefix(ctx, p+"product:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 250 {
+		t.Errorf("removed = %d, want 250", removed)
+	}
+	if n, _ := tc.rdb.Exists(ctx, p+"session:1").Result(); n != 1 {
+		t.Error("key outside prefix was deleted")
+	}
+}
+
+func TestTagCacheDeleteByPrefixIsLiteral(t *testing.T) {
+	tc, p := newTestTagCache(t)
+	ctx := context.Background()
+
+	// session จริงอยู่นอก namespace ของ test จึงต้องลบเอง
+	session := SessionPrefix + p + "1"
+	must(t, tc.rdb.Set(ctx, session, "v", time.Minute).Err())
+	t.Cleanup(func() { tc.rdb.Del(context.Background(), session) })
+	must(t, tc.rdb.Set(ctx, p+"product:1", "v", time.Minute).Err())
+	must(t, tc.rdb.Set(ctx, p+"*literal", "v", time.Minute).Err())
+
+	for _, prefix := range []string{"*", "s*", "?ession:", "[s]ession:", p + "?roduct:", p + "*"} {
+		if _, err := tc.DeleteByPrefix(ctx, prefix); err != nil {
+			t.Fatalf("DeleteByPrefix(%q): %v", prefix, err)
+		}
+		if n, _ := tc.rdb.Exists(ctx, session, p+"product:1").Result(); n != 2 {
+			t.Fatalf("DeleteByPrefix(%q) deleted keys it does not start", prefix)
+		}
+	}
+	// "*" ตรงตัวยังใช้เป็น prefix ได้
+	if n, _ := tc.rdb.Exists(ctx, p+"*literal").Result(); n != 0 {
+		t.Error(`key starting with a literal "*" was not deleted`)
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"product:", "product:"},
+		{"*", `\*`},
+		{"?ession:", `\?ession:`},
+		{"[a-z]", `\[a-z\]`},
+		{`back\slash`, `back\\slash`},
+		{"สินค้า:*", `สินค้า:\*`},
+	} {
+		if got := escapeGlob(tc.in); got != tc.want {
+			t.Errorf("escapeGlob(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestCacheEndpointsRequireAdmin(t *testing.T) {
+	app := fiber.New()
+	app.Post("/cache/invalidate", adminOnly(), func(c *fiber.Ctx) error { return c.SendStatus(200) })
+
+	for _, tc := range []struct {
+		name   string
+		token  string // ADMIN_TOKEN ของ server
+		header string
+		status int
+	}{
+		{"disabled without ADMIN_TOKEN", "", "", 403},
+		{"missing token", "secret", "", 401},
+		{"wrong token", "secret", "guess", 401},
+		{"valid token", "secret", "secret", 200},
+	} {
+		t.Setenv("ADMIN_TOKEN", tc.token)
+		req := httptest.NewRequest("POST", "/cache/invalidate", strings.NewReader(`{"prefix":"*"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.header != "" {
+			req.Header.Set("X-Admin-Token", tc.header)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestOverlapsPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   bool
+	}{
+		{"product:", false},
+		{"session:", true},
+		{"sess", true},
+		{"session:abc", true},
+		{"", true},
+	} {
+		if got := overlapsPrefix(tc.prefix, SessionPrefix, RateLimitPrefix); got != tc.want {
+			t.Errorf("overlapsPrefix(%q) = %v, want %v", tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}